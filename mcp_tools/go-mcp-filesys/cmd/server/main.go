@@ -1,11 +1,26 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"go-mcp-filesys/internal/config"
 	"go-mcp-filesys/internal/filesys"
+	"go-mcp-filesys/internal/resources"
 	"go-mcp-filesys/internal/tools"
+	"go-mcp-filesys/internal/transport"
 	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
@@ -29,69 +44,399 @@ import (
 // 16. 统计文件
 // 17. 编辑文件
 // 18. 追加文件内容
+// 19. 应用unified diff补丁
+// 20. 列出允许访问的根目录
+// 21. 以 file:// 资源的形式提供根目录下的文件，支持订阅文件变化
+// 22. 以事务方式批量执行文件操作，失败时回滚
+// 23. 记录操作历史，支持撤销和恢复文件
+// 24. 统计目录的磁盘占用
+// 25. 查看文件元数据，包括所有者、MIME类型、编码和校验和
+// 26. 创建、列出和解压 zip、tar、tar.gz 压缩包
+// 27. 以base64读写二进制文件，支持分块上传和校验
+// 28. 按路径读取和修改 JSON、YAML、TOML 文件
+// 29. 查询CSV文件，支持过滤、排序和分组聚合
+// 30. 限制文件大小、根目录总大小、目录条目数和响应大小，查看配额使用情况
+// 31. 把每次工具调用写入可轮转的审计日志，支持查询
+// 32. 通过stdio、SSE或streamable HTTP提供服务，HTTP传输支持TLS、令牌认证和CORS
+// 33. 按权限配置和允许/禁止列表注册工具
+// 34. 识别文件的编码（UTF-8、UTF-16、GBK）、BOM和换行风格，读取时转换为UTF-8，写入时按原有格式写回
+// 35. 按行编辑文件：插入、删除、替换行范围或第N个匹配，一次原子写入并返回差异
+// 36. 比较两个文件或文件与给定内容的差异，支持unified和并排格式、上下文行数和忽略空白
 
 func main() {
 	// Parse command line arguments
-	rootPath := flag.String("root", "", "Path to the root directory (uses default config if not specified)")
-	transport := flag.String("transport", "stdio", "Transport to use (stdio, sse)")
+	var rootPaths, readOnlyRootPaths config.StringList
+	flag.Var(&rootPaths, "root", "Read-write root directory as name=path or path (repeatable)")
+	flag.Var(&readOnlyRootPaths, "readonly-root", "Read-only root directory as name=path or path (repeatable)")
+	configPath := flag.String("config", "", "Path to a JSON configuration file")
+	symlinks := flag.String("symlinks", "", "Symlink policy: follow (targets must stay inside the root) or deny")
+	transportName := flag.String("transport", "", "Transport to use: stdio (default), sse, or http (streamable HTTP at /mcp plus the SSE endpoints)")
+	listen := flag.String("listen", "", "Listen address for the sse and http transports (default 127.0.0.1:8080); a non-loopback address requires -auth-token or -insecure-listen")
+	baseURL := flag.String("base-url", "", "URL clients use to reach the server, e.g. https://files.example.com (default derived from -listen)")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file; serves HTTPS together with -tls-key")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	profile := flag.String("profile", "", "Permission profile: read-only, read-write (no deletes or permission changes) or full (default)")
+	var allowTools, denyTools config.StringList
+	flag.Var(&allowTools, "allow-tool", "Enable a tool beyond the permission profile, e.g. delete_file (repeatable or comma separated); the extra permission applies to that tool only, not to batch_operations or apply_patch")
+	flag.Var(&denyTools, "deny-tool", "Disable a tool, e.g. delete_directory (repeatable or comma separated)")
+	var authTokens, corsOrigins config.StringList
+	flag.Var(&authTokens, "auth-token", "Bearer token or API key accepted by the sse and http transports (repeatable; prefer auth_tokens in the config file to keep it out of the process list)")
+	flag.Var(&corsOrigins, "cors-origin", "Origin allowed to call the server from a browser, or * for any (repeatable)")
+	insecureListen := flag.Bool("insecure-listen", false, "Allow the sse and http transports to listen on a non-loopback address without -auth-token; requests must then use the -base-url host")
+	watch := flag.String("watch", "", "File watch mode for resource subscriptions: auto, fsnotify, poll or off")
+	pollInterval := flag.Duration("poll-interval", 0, "Polling interval when watching files by polling (default 2s)")
+	historyDir := flag.String("history-dir", "", "Directory for the undo history, outside all roots (default: user cache directory, \"off\" disables history)")
+	historyMaxEntries := flag.Int("history-max-entries", 0, "Maximum number of history entries to keep (default 200)")
+	historyMaxBytes := flag.Int64("history-max-bytes", 0, "Maximum total size of the history in bytes (default 512MB)")
+	maxFileBytes := flag.Int64("max-file-bytes", 0, "Maximum size of a file after a write in bytes (0 means unlimited)")
+	maxRootBytes := flag.Int64("max-root-bytes", 0, "Maximum total size of the files under each root in bytes (0 means unlimited)")
+	maxDirEntries := flag.Int("max-dir-entries", 0, "Maximum number of entries in a single directory (0 means unlimited)")
+	maxResultBytes := flag.Int("max-result-bytes", 0, "Maximum size of a single tool response in bytes (0 means unlimited)")
+	auditFile := flag.String("audit-file", "", "Audit log file for tool invocations, outside all roots (default: user cache directory, \"off\" disables auditing)")
+	auditMaxBytes := flag.Int64("audit-max-bytes", 0, "Maximum size of the audit log before it is rotated in bytes (default 10MB)")
+	auditMaxFiles := flag.Int("audit-max-files", 0, "Number of rotated audit log files to keep (default 5)")
 	flag.Parse()
 
+	// Create configuration
+	cfg, err := config.NewConfig(*configPath, rootPaths, readOnlyRootPaths)
+	if err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+	if *symlinks != "" {
+		cfg.SymlinkPolicy = *symlinks
+	}
+	if *watch != "" {
+		cfg.Watch = *watch
+	}
+	if *pollInterval > 0 {
+		cfg.PollInterval = pollInterval.String()
+	}
+	if *historyDir != "" {
+		cfg.HistoryDir = *historyDir
+	}
+	if *historyMaxEntries > 0 {
+		cfg.HistoryMaxEntries = *historyMaxEntries
+	}
+	if *historyMaxBytes > 0 {
+		cfg.HistoryMaxBytes = *historyMaxBytes
+	}
+	if *maxFileBytes > 0 {
+		cfg.MaxFileBytes = *maxFileBytes
+	}
+	if *maxRootBytes > 0 {
+		cfg.MaxRootBytes = *maxRootBytes
+	}
+	if *maxDirEntries > 0 {
+		cfg.MaxDirEntries = *maxDirEntries
+	}
+	if *maxResultBytes > 0 {
+		cfg.MaxResultBytes = *maxResultBytes
+	}
+	if *auditFile != "" {
+		cfg.AuditFile = *auditFile
+	}
+	if *auditMaxBytes > 0 {
+		cfg.AuditMaxBytes = *auditMaxBytes
+	}
+	if *auditMaxFiles > 0 {
+		cfg.AuditMaxFiles = *auditMaxFiles
+	}
+	if *transportName != "" {
+		cfg.Transport = *transportName
+	}
+	if *listen != "" {
+		cfg.Listen = *listen
+	}
+	if *baseURL != "" {
+		cfg.BaseURL = *baseURL
+	}
+	if *tlsCert != "" {
+		cfg.TLSCert = *tlsCert
+	}
+	if *tlsKey != "" {
+		cfg.TLSKey = *tlsKey
+	}
+	cfg.AuthTokens = append(cfg.AuthTokens, authTokens...)
+	cfg.CORSOrigins = append(cfg.CORSOrigins, corsOrigins...)
+	if *insecureListen {
+		cfg.InsecureListen = true
+	}
+	if *profile != "" {
+		cfg.PermissionProfile = *profile
+	}
+	cfg.AllowTools = append(cfg.AllowTools, splitList(allowTools)...)
+	cfg.DenyTools = append(cfg.DenyTools, splitList(denyTools)...)
+	if cfg.Transport == "" {
+		cfg.Transport = "stdio"
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = "127.0.0.1:8080"
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	roots := make([]filesys.Root, 0, len(cfg.Roots))
+	for _, r := range cfg.Roots {
+		roots = append(roots, filesys.Root{Name: r.Name, Path: r.Path, Mode: filesys.RootMode(r.Mode)})
+	}
+	if err := filesys.SetRoots(roots); err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	policy, err := filesys.ParseSymlinkPolicy(cfg.SymlinkPolicy)
+	if err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	filesys.SetSymlinkPolicy(policy)
+	history := filesys.HistoryConfig{Dir: cfg.HistoryDir, MaxEntries: cfg.HistoryMaxEntries, MaxBytes: cfg.HistoryMaxBytes}
+	switch history.Dir {
+	case "off":
+		history.Dir = ""
+	case "":
+		if cacheDir, err := os.UserCacheDir(); err == nil {
+			history.Dir = filepath.Join(cacheDir, "go-mcp-filesys", "history")
+		} else {
+			log.Printf("Operation history disabled: %v", err)
+		}
+	}
+	if err := filesys.SetHistory(history); err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	quota := filesys.QuotaConfig{
+		MaxFileBytes:   cfg.MaxFileBytes,
+		MaxRootBytes:   cfg.MaxRootBytes,
+		MaxDirEntries:  cfg.MaxDirEntries,
+		MaxResultBytes: cfg.MaxResultBytes,
+	}
+	if err := filesys.SetQuota(quota); err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	audit := filesys.AuditConfig{File: cfg.AuditFile, MaxBytes: cfg.AuditMaxBytes, MaxFiles: cfg.AuditMaxFiles}
+	switch audit.File {
+	case "off":
+		audit.File = ""
+	case "":
+		if cacheDir, err := os.UserCacheDir(); err == nil {
+			audit.File = filepath.Join(cacheDir, "go-mcp-filesys", "audit.log")
+		} else {
+			log.Printf("Audit log disabled: %v", err)
+		}
+	}
+	if err := filesys.SetAudit(audit); err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	defer filesys.CloseAudit()
+	permissionProfile, err := filesys.ParsePermissionProfile(cfg.PermissionProfile)
+	if err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	permissions, err := tools.NewPermissions(permissionProfile, cfg.AllowTools, cfg.DenyTools)
+	if err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	if err := filesys.SetPermissions(permissionProfile, permissions.ExtraOperations()...); err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	watchMode, err := filesys.ParseWatchMode(cfg.Watch)
+	if err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	var watchInterval time.Duration
+	if cfg.PollInterval != "" {
+		watchInterval, _ = time.ParseDuration(cfg.PollInterval)
+	}
+
 	// Create MCP server
+	resourceManager := resources.NewManager()
+	hooks := &server.Hooks{}
+	resourceManager.RegisterHooks(hooks)
+	permissions.RegisterHooks(hooks)
 	mcpServer := server.NewMCPServer(
 		"File System MCP Server",
 		"1.0.0",
 		server.WithResourceCapabilities(true, true),
+		server.WithPaginationLimit(100),
+		server.WithHooks(hooks),
 		server.WithLogging(),
 		server.WithRecovery(),
+		server.WithToolHandlerMiddleware(tools.AuditToolCalls),
+		server.WithToolHandlerMiddleware(tools.LimitResultSize),
 	)
-	if *rootPath != "" {
-		filesys.SetAllowedOpsFolder(*rootPath)
+
+	// Expose files as resources
+	if err := resourceManager.Start(mcpServer, watchMode, watchInterval); err != nil {
+		log.Fatalf("Failed to register resources: %v", err)
 	}
+	defer resourceManager.Close()
 
 	// Add basic tools
 	//fmt.Println("Registering basic tools...")
-	mcpServer.AddTool(tools.ListFilesInDirectoryTool(), tools.ListFilesInDirectoryHandle())
-	mcpServer.AddTool(tools.ReplaceFileContentTool(), tools.ReplaceFileContentToolHandle())
-	mcpServer.AddTool(tools.CreateNewFileTool(), tools.CreateNewFileToolHandle())
-	mcpServer.AddTool(tools.AppendFileContentTool(), tools.AppendFileContentToolHandle())
-	mcpServer.AddTool(tools.EditFileTool(), tools.EditFileToolHandle())
-	mcpServer.AddTool(tools.FindFileTool(), tools.FindFileToolHandle())
-	mcpServer.AddTool(tools.CountFilesInDirectoryTool(), tools.CountFilesInDirectoryToolHandle())
-	mcpServer.AddTool(tools.DeleteFileTool(), tools.DeleteFileToolHandle())
-	mcpServer.AddTool(tools.MoveFileTool(), tools.MoveFileToolHandle())
-	mcpServer.AddTool(tools.CopyFileTool(), tools.CopyFileToolHandle())
-	mcpServer.AddTool(tools.ChangeFilePermissionsTool(), tools.ChangeFilePermissionsToolHandle())
-	mcpServer.AddTool(tools.CreateDirectoryTool(), tools.CreateDirectoryToolHandle())
-	mcpServer.AddTool(tools.DeleteDirectoryTool(), tools.DeleteDirectoryToolHandle())
-	mcpServer.AddTool(tools.MoveDirectoryTool(), tools.MoveDirectoryToolHandle())
-	mcpServer.AddTool(tools.CopyDirectoryTool(), tools.CopyDirectoryToolHandle())
-	mcpServer.AddTool(tools.ChangeDirectoryPermissionsTool(), tools.ChangeDirectoryPermissionsToolHandle())
+	// 按权限配置注册工具，被禁用的工具不出现在工具列表中，调用时返回禁用原因
+	addTool := func(tool mcp.Tool, handler server.ToolHandlerFunc) {
+		if !permissions.Enabled(tool.Name) {
+			handler = permissions.RejectHandle(tool.Name)
+		}
+		mcpServer.AddTool(tool, handler)
+	}
+	if disabled := permissions.Disabled(); len(disabled) > 0 {
+		log.Printf("Permission profile %s, disabled tools: %s", permissionProfile, strings.Join(disabled, ", "))
+	}
+	addTool(tools.ListAllowedRootsTool(), tools.ListAllowedRootsToolHandle())
+	addTool(tools.ListFilesInDirectoryTool(), tools.ListFilesInDirectoryHandle())
+	addTool(tools.ReadFileTool(), tools.ReadFileToolHandle())
+	addTool(tools.WriteFileTool(), tools.WriteFileToolHandle())
+	addTool(tools.ReplaceFileContentTool(), tools.ReplaceFileContentToolHandle())
+	addTool(tools.CreateNewFileTool(), tools.CreateNewFileToolHandle())
+	addTool(tools.AppendFileContentTool(), tools.AppendFileContentToolHandle())
+	addTool(tools.EditFileTool(), tools.EditFileToolHandle())
+	addTool(tools.EditLinesTool(), tools.EditLinesToolHandle())
+	addTool(tools.DiffFilesTool(), tools.DiffFilesToolHandle())
+	addTool(tools.ApplyPatchTool(), tools.ApplyPatchToolHandle())
+	addTool(tools.BatchOperationsTool(), tools.BatchOperationsToolHandle())
+	addTool(tools.ListHistoryTool(), tools.ListHistoryToolHandle())
+	addTool(tools.UndoLastTool(), tools.UndoLastToolHandle())
+	addTool(tools.RestoreFileTool(), tools.RestoreFileToolHandle())
+	addTool(tools.FindFileTool(), tools.FindFileToolHandle())
+	addTool(tools.CountFilesInDirectoryTool(), tools.CountFilesInDirectoryToolHandle())
+	addTool(tools.DiskUsageTool(), tools.DiskUsageToolHandle())
+	addTool(tools.StatFileTool(), tools.StatFileToolHandle())
+	addTool(tools.StatFilesTool(), tools.StatFilesToolHandle())
+	addTool(tools.CreateArchiveTool(), tools.CreateArchiveToolHandle())
+	addTool(tools.ListArchiveTool(), tools.ListArchiveToolHandle())
+	addTool(tools.ExtractArchiveTool(), tools.ExtractArchiveToolHandle())
+	addTool(tools.ReadFileBinaryTool(), tools.ReadFileBinaryToolHandle())
+	addTool(tools.WriteFileBinaryTool(), tools.WriteFileBinaryToolHandle())
+	addTool(tools.BeginUploadTool(), tools.BeginUploadToolHandle())
+	addTool(tools.UploadChunkTool(), tools.UploadChunkToolHandle())
+	addTool(tools.FinishUploadTool(), tools.FinishUploadToolHandle())
+	addTool(tools.CancelUploadTool(), tools.CancelUploadToolHandle())
+	addTool(tools.ListUploadsTool(), tools.ListUploadsToolHandle())
+	addTool(tools.StructuredGetTool(), tools.StructuredGetToolHandle())
+	addTool(tools.StructuredSetTool(), tools.StructuredSetToolHandle())
+	addTool(tools.StructuredDeleteTool(), tools.StructuredDeleteToolHandle())
+	addTool(tools.StructuredMergeTool(), tools.StructuredMergeToolHandle())
+	addTool(tools.QueryCSVTool(), tools.QueryCSVToolHandle())
+	addTool(tools.GetQuotaTool(), tools.GetQuotaToolHandle())
+	addTool(tools.AuditQueryTool(), tools.AuditQueryToolHandle())
+	addTool(tools.DeleteFileTool(), tools.DeleteFileToolHandle())
+	addTool(tools.MoveFileTool(), tools.MoveFileToolHandle())
+	addTool(tools.CopyFileTool(), tools.CopyFileToolHandle())
+	addTool(tools.ChangeFilePermissionsTool(), tools.ChangeFilePermissionsToolHandle())
+	addTool(tools.CreateDirectoryTool(), tools.CreateDirectoryToolHandle())
+	addTool(tools.DeleteDirectoryTool(), tools.DeleteDirectoryToolHandle())
+	addTool(tools.MoveDirectoryTool(), tools.MoveDirectoryToolHandle())
+	addTool(tools.CopyDirectoryTool(), tools.CopyDirectoryToolHandle())
+	addTool(tools.ChangeDirectoryPermissionsTool(), tools.ChangeDirectoryPermissionsToolHandle())
 
 	// Start stdio server
 	// if err := server.ServeStdio(mcpServer); err != nil {
 	// 	fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
 	// 	os.Exit(1)
 	// }
-	// start sse server
-
-	// mcpServer := server.NewMCPServer(
-	// 	"File System MCP Server",
-	// 	"1.0.0",
-	// 	server.WithResourceCapabilities(true, true),
-	// 	server.WithLogging(),
-	// 	server.WithRecovery(),
-	// )
-
-	// Only check for "sse" since stdio is the default
-	if *transport == "sse" {
-		sseServer := server.NewSSEServer(mcpServer, server.WithBaseURL("http://localhost:8080"))
-		log.Printf("SSE server listening on :8080")
-		if err := sseServer.Start(":8080"); err != nil {
-			log.Fatalf("Server error: %v", err)
+
+	// SIGTERM或SIGINT时停止接受新请求，等待进行中的请求完成后退出
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// resources/subscribe is intercepted before the messages reach mcp-go
+	if cfg.Transport == "sse" || cfg.Transport == "http" {
+		if err := serveHTTP(ctx, cfg, mcpServer, resourceManager); err != nil {
+			log.Printf("Server error: %v", err)
 		}
 	} else {
-		if err := server.ServeStdio(mcpServer); err != nil {
-			log.Fatalf("Server error: %v", err)
+		stdioServer := server.NewStdioServer(mcpServer)
+		stdioServer.SetErrorLogger(log.New(os.Stderr, "", log.LstdFlags))
+		if err := stdioServer.Listen(ctx, resourceManager.StdioReader(os.Stdin), os.Stdout); err != nil && err != context.Canceled {
+			log.Printf("Server error: %v", err)
+		}
+	}
+}
+
+// 启动SSE或streamable HTTP传输，ctx结束时优雅关闭：先结束所有会话和事件流，再等待进行中的请求完成
+func serveHTTP(ctx context.Context, cfg *config.Config, mcpServer *server.MCPServer, resourceManager *resources.Manager) error {
+	scheme := "http"
+	if cfg.TLSCert != "" {
+		scheme = "https"
+	}
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		host, port, err := net.SplitHostPort(cfg.Listen)
+		if err != nil {
+			return fmt.Errorf("invalid listen address %s: %w", cfg.Listen, err)
+		}
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			host = "localhost"
+		}
+		baseURL = fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port))
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL %s: %w", baseURL, err)
+	}
+
+	httpServer := &http.Server{Addr: cfg.Listen, ReadHeaderTimeout: 10 * time.Second}
+	sseServer := server.NewSSEServer(mcpServer, server.WithBaseURL(baseURL), server.WithHTTPServer(httpServer))
+	handler := resourceManager.HTTPMiddleware(sseServer, sseServer.CompleteMessagePath())
+	var streamable *transport.StreamableServer
+	if cfg.Transport == "http" {
+		streamable = transport.NewStreamableServer(mcpServer, resourceManager.InterceptMessage)
+		mux := http.NewServeMux()
+		mux.Handle(u.Path+"/mcp", streamable)
+		mux.Handle("/", handler)
+		handler = mux
+	}
+	httpServer.Handler = transport.Secure(handler, transport.SecurityOptions{
+		Tokens:      cfg.AuthTokens,
+		CORSOrigins: cfg.CORSOrigins,
+		Hosts:       []string{u.Hostname()},
+	})
+
+	if len(cfg.AuthTokens) == 0 {
+		log.Printf("Warning: no -auth-token configured, anyone who can reach %s can read and modify files", cfg.Listen)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		if cfg.TLSCert != "" {
+			errCh <- httpServer.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			errCh <- httpServer.ListenAndServe()
+		}
+	}()
+	if streamable != nil {
+		log.Printf("Streamable HTTP endpoint: %s/mcp", baseURL)
+	}
+	log.Printf("SSE endpoint: %s", sseServer.CompleteSseEndpoint())
+	log.Printf("Server listening on %s", cfg.Listen)
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if streamable != nil {
+		streamable.Shutdown(shutdownCtx)
+	}
+	if err := sseServer.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// 展开逗号分隔的命令行参数
+func splitList(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
 		}
 	}
+	return result
 }
@@ -2,10 +2,17 @@ module go-mcp-filesys
 
 go 1.23.8
 
-require github.com/mark3labs/mcp-go v0.23.1
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/mark3labs/mcp-go v0.23.1
+	github.com/pelletier/go-toml/v2 v2.2.4
+	golang.org/x/text v0.23.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/spf13/cast v1.7.1 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
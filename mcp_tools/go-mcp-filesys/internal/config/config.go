@@ -0,0 +1,219 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// RootConfig 表示一个允许访问的根目录
+type RootConfig struct {
+	// 根目录名称，工具中通过 "名称:相对路径" 访问
+	Name string `json:"name"`
+	// 根目录路径
+	Path string `json:"path"`
+	// 访问模式：read-only 或 read-write
+	Mode string `json:"mode"`
+}
+
+// Config 表示应用程序配置
+type Config struct {
+	// 允许访问的根目录，第一个为默认根目录
+	Roots []RootConfig `json:"roots"`
+	// 符号链接策略：follow 跟随（目标必须在根目录内），deny 拒绝
+	SymlinkPolicy string `json:"symlink_policy"`
+	// 文件监视模式：auto、fsnotify、poll 或 off
+	Watch string `json:"watch"`
+	// 轮询间隔，如 "2s"，仅在轮询模式下使用
+	PollInterval string `json:"poll_interval"`
+	// 操作历史目录，为空时使用用户缓存目录，"off" 表示不记录历史
+	HistoryDir string `json:"history_dir"`
+	// 最多保留的历史记录数
+	HistoryMaxEntries int `json:"history_max_entries"`
+	// 历史记录占用的最大字节数
+	HistoryMaxBytes int64 `json:"history_max_bytes"`
+	// 单个文件写入后的最大字节数，0表示不限制
+	MaxFileBytes int64 `json:"max_file_bytes"`
+	// 每个根目录下所有文件的最大总字节数，0表示不限制
+	MaxRootBytes int64 `json:"max_root_bytes"`
+	// 单个目录中的最大条目数，0表示不限制
+	MaxDirEntries int `json:"max_dir_entries"`
+	// 单个工具响应的最大字节数，0表示不限制
+	MaxResultBytes int `json:"max_result_bytes"`
+	// 审计日志文件，为空时使用用户缓存目录，"off" 表示不记录审计日志
+	AuditFile string `json:"audit_file"`
+	// 单个审计日志文件的最大字节数，超过后轮转
+	AuditMaxBytes int64 `json:"audit_max_bytes"`
+	// 保留的已轮转审计日志文件数
+	AuditMaxFiles int `json:"audit_max_files"`
+	// 传输方式：stdio、sse 或 http（streamable HTTP，同时提供SSE端点）
+	Transport string `json:"transport"`
+	// HTTP传输的监听地址，如 "127.0.0.1:8080"
+	Listen string `json:"listen"`
+	// 客户端访问服务器使用的URL，为空时根据监听地址生成
+	BaseURL string `json:"base_url"`
+	// TLS证书和私钥文件，同时设置时使用HTTPS
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
+	// 允许的bearer token或API key，为空时HTTP传输不要求认证
+	AuthTokens []string `json:"auth_tokens"`
+	// 允许跨域访问的来源，"*" 表示任意来源
+	CORSOrigins []string `json:"cors_origins"`
+	// 允许在没有认证令牌时监听非本机回环地址
+	InsecureListen bool `json:"insecure_listen"`
+	// 权限配置：read-only、read-write 或 full（默认）
+	PermissionProfile string `json:"permission_profile"`
+	// 在权限配置之外额外启用的工具
+	AllowTools []string `json:"allow_tools"`
+	// 禁用的工具，优先于 allow_tools
+	DenyTools []string `json:"deny_tools"`
+}
+
+// 判断监听的主机是否只能从本机访问，空主机表示所有网络接口
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// StringList 可重复使用的命令行参数
+type StringList []string
+
+func (s *StringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *StringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// NewConfig 从配置文件和命令行参数创建配置
+// 命令行中的根目录追加在配置文件中的根目录之后
+func NewConfig(configPath string, roots []string, readOnlyRoots []string) (*Config, error) {
+	cfg := &Config{}
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("无法读取配置文件: %w", err)
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("无法解析配置文件: %w", err)
+		}
+	}
+
+	for _, spec := range roots {
+		cfg.addRoot(spec, "read-write")
+	}
+	for _, spec := range readOnlyRoots {
+		cfg.addRoot(spec, "read-only")
+	}
+	return cfg, nil
+}
+
+// addRoot 解析 "名称=路径" 或 "路径" 形式的根目录参数，未指定名称时自动命名
+func (c *Config) addRoot(spec string, mode string) {
+	name, path := "", spec
+	if idx := strings.Index(spec, "="); idx > 0 && !strings.ContainsAny(spec[:idx], `/\`) {
+		name, path = spec[:idx], spec[idx+1:]
+	}
+	if name == "" {
+		name = "default"
+		for i := 1; c.hasRoot(name); i++ {
+			name = fmt.Sprintf("root%d", i)
+		}
+	}
+	c.Roots = append(c.Roots, RootConfig{Name: name, Path: path, Mode: mode})
+}
+
+func (c *Config) hasRoot(name string) bool {
+	for _, r := range c.Roots {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 验证配置是否有效
+func (c *Config) Validate() error {
+	if len(c.Roots) == 0 {
+		return fmt.Errorf("未配置根目录，请使用 -root 参数或配置文件指定")
+	}
+	for _, r := range c.Roots {
+		if r.Path == "" {
+			return fmt.Errorf("根目录 %s 的路径为空", r.Name)
+		}
+		info, err := os.Stat(r.Path)
+		if err != nil {
+			return fmt.Errorf("无法访问根目录 %s: %w", r.Name, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("根目录 %s 不是目录: %s", r.Name, r.Path)
+		}
+	}
+	switch c.SymlinkPolicy {
+	case "", "follow", "deny":
+	default:
+		return fmt.Errorf("无效的符号链接策略: %s", c.SymlinkPolicy)
+	}
+	switch c.Watch {
+	case "", "auto", "fsnotify", "poll", "off":
+	default:
+		return fmt.Errorf("无效的文件监视模式: %s", c.Watch)
+	}
+	if c.HistoryMaxEntries < 0 || c.HistoryMaxBytes < 0 {
+		return fmt.Errorf("历史记录的保留限制不能为负数")
+	}
+	if c.MaxFileBytes < 0 || c.MaxRootBytes < 0 || c.MaxDirEntries < 0 || c.MaxResultBytes < 0 {
+		return fmt.Errorf("配额限制不能为负数")
+	}
+	if c.AuditMaxBytes < 0 || c.AuditMaxFiles < 0 {
+		return fmt.Errorf("审计日志的轮转限制不能为负数")
+	}
+	switch c.PermissionProfile {
+	case "", "read-only", "read-write", "full":
+	default:
+		return fmt.Errorf("无效的权限配置: %s", c.PermissionProfile)
+	}
+	switch c.Transport {
+	case "", "stdio", "sse", "http":
+	default:
+		return fmt.Errorf("无效的传输方式: %s", c.Transport)
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("TLS证书和私钥必须同时指定")
+	}
+	if c.BaseURL != "" {
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+			return fmt.Errorf("无效的基础URL: %s", c.BaseURL)
+		}
+	}
+	for _, token := range c.AuthTokens {
+		if strings.TrimSpace(token) == "" {
+			return fmt.Errorf("认证令牌不能为空")
+		}
+	}
+	if (c.Transport == "sse" || c.Transport == "http") && len(c.AuthTokens) == 0 && !c.InsecureListen {
+		host, _, err := net.SplitHostPort(c.Listen)
+		if err != nil {
+			return fmt.Errorf("无效的监听地址 %s: %w", c.Listen, err)
+		}
+		if !isLoopbackHost(host) {
+			return fmt.Errorf("监听地址 %s 不是本机回环地址，请配置认证令牌（-auth-token），或使用 -insecure-listen 明确允许无认证访问", c.Listen)
+		}
+	}
+	if c.PollInterval != "" {
+		if d, err := time.ParseDuration(c.PollInterval); err != nil || d <= 0 {
+			return fmt.Errorf("无效的轮询间隔: %s", c.PollInterval)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,932 @@
+package filesys
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 支持的压缩包格式
+const (
+	ArchiveZip   = "zip"
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+)
+
+// 解压和打包时的上限，调用方可以设置更小的值
+const (
+	MaxArchiveBytes int64 = 1 << 30
+	MaxArchiveFiles       = 10000
+)
+
+// 列出压缩包内容时默认返回的条目数
+const DefaultArchiveListLimit = 1000
+
+// tar中的硬链接条目
+const archiveHardlink = "hardlink"
+
+// 创建压缩包的选项
+type CreateArchiveOptions struct {
+	// 为空时根据压缩包的扩展名判断
+	Format string
+	// 压缩包已存在时覆盖
+	Overwrite bool
+	// 跳过 .gitignore 等规则忽略的文件
+	RespectIgnore bool
+}
+
+// 解压的选项，上限为0时使用默认值
+type ExtractOptions struct {
+	// 覆盖已存在的文件，目录总是合并
+	Overwrite bool
+	MaxBytes  int64
+	MaxFiles  int
+}
+
+// 压缩包中的条目
+type ArchiveEntry struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"`
+	ModTime    time.Time `json:"mod_time"`
+	LinkTarget string    `json:"link_target,omitempty"`
+}
+
+// 压缩包的内容列表
+type ArchiveListing struct {
+	Archive     string         `json:"archive"`
+	Format      string         `json:"format"`
+	Files       int            `json:"files"`
+	Directories int            `json:"directories"`
+	TotalSize   int64          `json:"total_size"`
+	Entries     []ArchiveEntry `json:"entries"`
+	Truncated   bool           `json:"truncated,omitempty"`
+}
+
+// 打包或解压的结果
+type ArchiveResult struct {
+	Archive     string `json:"archive"`
+	Format      string `json:"format"`
+	Destination string `json:"destination,omitempty"`
+	Files       int    `json:"files"`
+	Directories int    `json:"directories"`
+	Symlinks    int    `json:"symlinks,omitempty"`
+	Bytes       int64  `json:"bytes"`
+	// 不支持的条目类型（设备文件等）被跳过的数量
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// 从压缩包中读出的条目，open只能在遍历回调中调用
+type archiveItem struct {
+	name     string
+	typ      string
+	size     int64
+	mode     os.FileMode
+	modTime  time.Time
+	linkname string
+	open     func() (io.Reader, error)
+}
+
+// 根据扩展名判断压缩包格式，扩展名无法识别时读取文件头
+func detectArchiveFormat(archivePath string, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case ArchiveZip:
+		return ArchiveZip, nil
+	case ArchiveTar:
+		return ArchiveTar, nil
+	case ArchiveTarGz, "tgz":
+		return ArchiveTarGz, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported archive format: %s (supported: zip, tar, tar.gz)", format)
+	}
+
+	lower := strings.ToLower(archivePath)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveZip, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveTarGz, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return ArchiveTar, nil
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("cannot determine archive format of %s, specify format", DisplayPath(archivePath))
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return ArchiveZip, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return ArchiveTarGz, nil
+	case n >= 262 && string(head[257:262]) == "ustar":
+		return ArchiveTar, nil
+	}
+	return "", fmt.Errorf("cannot determine archive format of %s, specify format", DisplayPath(archivePath))
+}
+
+// 依次遍历压缩包中的条目
+func walkArchive(archivePath string, format string, fn func(item *archiveItem) error) error {
+	if format == ArchiveZip {
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			mode := f.Mode()
+			item := &archiveItem{
+				name:    f.Name,
+				size:    int64(f.UncompressedSize64),
+				mode:    mode,
+				modTime: f.Modified,
+			}
+			var rc io.ReadCloser
+			item.open = func() (io.Reader, error) {
+				var err error
+				rc, err = f.Open()
+				return rc, err
+			}
+			switch {
+			case mode&os.ModeSymlink != 0:
+				item.typ = EntrySymlink
+				r, err := f.Open()
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", f.Name, err)
+				}
+				target, err := io.ReadAll(io.LimitReader(r, 4096))
+				r.Close()
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", f.Name, err)
+				}
+				item.linkname = string(target)
+			case mode.IsDir() || strings.HasSuffix(f.Name, "/"):
+				item.typ = EntryDirectory
+			case mode.IsRegular():
+				item.typ = EntryFile
+			default:
+				item.typ = EntryOther
+			}
+			err := fn(item)
+			if rc != nil {
+				rc.Close()
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if format == ArchiveTarGz {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		item := &archiveItem{
+			name:     hdr.Name,
+			size:     hdr.Size,
+			mode:     hdr.FileInfo().Mode(),
+			modTime:  hdr.ModTime,
+			linkname: hdr.Linkname,
+			open:     func() (io.Reader, error) { return tr, nil },
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			item.typ = EntryFile
+		case tar.TypeDir:
+			item.typ = EntryDirectory
+		case tar.TypeSymlink:
+			item.typ = EntrySymlink
+		case tar.TypeLink:
+			item.typ = archiveHardlink
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			item.typ = EntryOther
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+}
+
+// 列出压缩包中的条目
+func ListArchive(archivePath string, format string, limit int) (*ArchiveListing, error) {
+	if !isPathInAllowedDirectory(archivePath) {
+		return nil, fmt.Errorf("file access not allowed: %s", archivePath)
+	}
+	format, err := detectArchiveFormat(archivePath, format)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultArchiveListLimit
+	}
+	listing := &ArchiveListing{Archive: DisplayPath(archivePath), Format: format, Entries: make([]ArchiveEntry, 0)}
+	err = walkArchive(archivePath, format, func(item *archiveItem) error {
+		switch item.typ {
+		case EntryDirectory:
+			listing.Directories++
+		default:
+			listing.Files++
+			listing.TotalSize += item.size
+		}
+		if len(listing.Entries) >= limit {
+			listing.Truncated = true
+			return nil
+		}
+		listing.Entries = append(listing.Entries, ArchiveEntry{
+			Name:       item.name,
+			Type:       item.typ,
+			Size:       item.size,
+			Mode:       item.mode.String(),
+			ModTime:    item.modTime,
+			LinkTarget: item.linkname,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+// 把文件和目录打包，每个来源以它的名称作为压缩包中的顶层条目
+func CreateArchive(archivePath string, sources []string, opts CreateArchiveOptions) (*ArchiveResult, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no sources provided")
+	}
+	if err := checkWritable(archivePath); err != nil {
+		return nil, err
+	}
+	format, err := detectArchiveFormat(archivePath, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	archivePath = filepath.Clean(archivePath)
+	unlock := lockPath(archivePath)
+	defer unlock()
+	if info, err := os.Lstat(archivePath); err == nil {
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", DisplayPath(archivePath))
+		}
+		if !opts.Overwrite {
+			return nil, fmt.Errorf("%s already exists", DisplayPath(archivePath))
+		}
+	}
+	names := make(map[string]string, len(sources))
+	for _, source := range sources {
+		if !isPathInAllowedDirectory(source) {
+			return nil, fmt.Errorf("file access not allowed: %s", source)
+		}
+		name := filepath.Base(filepath.Clean(source))
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("%s and %s would both be stored as %s", DisplayPath(other), DisplayPath(source), name)
+		}
+		names[name] = source
+	}
+
+	dir := filepath.Dir(archivePath)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to access directory: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(dir, "tmp_*")
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	w := &archiveWriter{format: format, skip: []string{archivePath, tmpPath}}
+	w.result = &ArchiveResult{Archive: DisplayPath(archivePath), Format: format}
+	w.open(tmpFile)
+	for _, source := range sources {
+		var matcher *IgnoreMatcher
+		if opts.RespectIgnore {
+			matcher = newIgnoreMatcherFor(source)
+		}
+		if err := w.add(source, filepath.Base(filepath.Clean(source)), matcher); err != nil {
+			w.close()
+			tmpFile.Close()
+			return nil, err
+		}
+	}
+	if err := w.close(); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := tmpFile.Chmod(0644); err != nil {
+		tmpFile.Close()
+		return nil, err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWriteQuota(archivePath, info.Size()); err != nil {
+		return nil, err
+	}
+
+	rec, err := beginHistory("create_archive", archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := rec.finish(os.Rename(tmpPath, archivePath)); err != nil {
+		return nil, err
+	}
+	return w.result, nil
+}
+
+// 按格式写入压缩包，并统计写入的条目
+type archiveWriter struct {
+	format string
+	skip   []string
+	result *ArchiveResult
+	zw     *zip.Writer
+	tw     *tar.Writer
+	gz     *gzip.Writer
+}
+
+func (w *archiveWriter) open(out io.Writer) {
+	switch w.format {
+	case ArchiveZip:
+		w.zw = zip.NewWriter(out)
+	case ArchiveTarGz:
+		w.gz = gzip.NewWriter(out)
+		w.tw = tar.NewWriter(w.gz)
+	default:
+		w.tw = tar.NewWriter(out)
+	}
+}
+
+func (w *archiveWriter) close() error {
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+// 把路径写入压缩包，目录按名称顺序递归写入，符号链接按链接本身写入
+func (w *archiveWriter) add(p string, name string, matcher *IgnoreMatcher) error {
+	for _, s := range w.skip {
+		if p == s {
+			return nil
+		}
+	}
+	info, err := os.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if matcher != nil && matcher.Match(p, info.IsDir()) {
+		return nil
+	}
+
+	var link string
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		if link, err = os.Readlink(p); err != nil {
+			return err
+		}
+		w.result.Symlinks++
+	case info.IsDir():
+		w.result.Directories++
+	case info.Mode().IsRegular():
+		w.result.Files++
+		w.result.Bytes += info.Size()
+	default:
+		w.result.Skipped++
+		return nil
+	}
+	if w.result.Files+w.result.Symlinks > MaxArchiveFiles {
+		return fmt.Errorf("too many files to archive (limit %d)", MaxArchiveFiles)
+	}
+	if w.result.Bytes > MaxArchiveBytes {
+		return fmt.Errorf("files to archive exceed %d bytes", MaxArchiveBytes)
+	}
+	if err := w.writeEntry(p, name, info, link); err != nil {
+		return fmt.Errorf("failed to add %s: %w", DisplayPath(p), err)
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := w.add(filepath.Join(p, entry.Name()), name+"/"+entry.Name(), matcher); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *archiveWriter) writeEntry(p string, name string, info os.FileInfo, link string) error {
+	if info.IsDir() {
+		name += "/"
+	}
+	var out io.Writer
+	if w.zw != nil {
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if info.Mode().IsRegular() {
+			hdr.Method = zip.Deflate
+		}
+		if out, err = w.zw.CreateHeader(hdr); err != nil {
+			return err
+		}
+		if link != "" {
+			_, err = io.WriteString(out, link)
+			return err
+		}
+	} else {
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if err := w.tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		out = w.tw
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(out, f)
+	return err
+}
+
+// 解压到目标目录。先检查所有条目（路径穿越、符号链接目标、数量和大小上限、已存在的文件），
+// 全部通过后才写入；写入失败时删除已解压的内容并恢复被覆盖的文件
+func ExtractArchive(archivePath string, destination string, opts ExtractOptions) (*ArchiveResult, error) {
+	if !isPathInAllowedDirectory(archivePath) {
+		return nil, fmt.Errorf("file access not allowed: %s", archivePath)
+	}
+	if err := checkWritable(destination); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(destination); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", DisplayPath(destination))
+	}
+	format, err := detectArchiveFormat(archivePath, "")
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxBytes <= 0 || opts.MaxBytes > MaxArchiveBytes {
+		opts.MaxBytes = MaxArchiveBytes
+	}
+	if opts.MaxFiles <= 0 || opts.MaxFiles > MaxArchiveFiles {
+		opts.MaxFiles = MaxArchiveFiles
+	}
+
+	if _, err := os.Lstat(destination); os.IsNotExist(err) {
+		if err := checkNewEntryQuota(destination); err != nil {
+			return nil, err
+		}
+	}
+
+	x := &extractor{dest: destination, opts: opts, seen: make(map[string]string), sizes: make(map[string]int64)}
+	x.result = &ArchiveResult{Archive: DisplayPath(archivePath), Format: format, Destination: DisplayPath(destination)}
+	if err := walkArchive(archivePath, format, x.check); err != nil {
+		return nil, err
+	}
+	if err := checkRootQuota(destination, x.result.Bytes); err != nil {
+		return nil, err
+	}
+
+	// 锁定目标目录和所有要写入的路径，直到写入或回滚完成
+	targets := make([]string, 0, len(x.seen)+1)
+	targets = append(targets, filepath.Clean(destination))
+	for name := range x.seen {
+		targets = append(targets, filepath.Join(destination, filepath.FromSlash(name)))
+	}
+	unlock := lockPaths(targets...)
+	defer unlock()
+
+	paths := make([]string, 0, len(x.topLevel))
+	if _, err := os.Stat(destination); os.IsNotExist(err) {
+		paths = append(paths, destination)
+	} else {
+		for _, name := range x.topLevel {
+			paths = append(paths, filepath.Join(destination, name))
+		}
+	}
+	rec, err := beginHistory("extract_archive", paths...)
+	if err != nil {
+		return nil, err
+	}
+	backupDir, err := os.MkdirTemp("", "mcp-extract-")
+	if err != nil {
+		return nil, rec.finish(fmt.Errorf("failed to create backup area: %w", err))
+	}
+	defer os.RemoveAll(backupDir)
+	x.backupDir = backupDir
+
+	// 写入阶段重新统计实际写入的内容
+	*x.result = ArchiveResult{Archive: x.result.Archive, Format: format, Destination: x.result.Destination}
+	err = x.mkdirAll(destination)
+	if err == nil {
+		x.realDest, err = filepath.EvalSymlinks(destination)
+	}
+	if err == nil {
+		err = walkArchive(archivePath, format, x.extract)
+	}
+	if err != nil {
+		if rerr := x.rollback(); rerr != nil {
+			err = fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+		}
+		return nil, rec.finish(err)
+	}
+	if err := x.applyDirModes(); err != nil {
+		return nil, rec.finish(err)
+	}
+	return x.result, rec.finish(nil)
+}
+
+type extractor struct {
+	dest      string
+	realDest  string
+	opts      ExtractOptions
+	result    *ArchiveResult
+	backupDir string
+	// 检查阶段记录的条目类型和文件大小，用于校验硬链接和重复条目
+	seen     map[string]string
+	sizes    map[string]int64
+	topLevel []string
+	// 检查阶段统计的新路径（包括隐含的父目录）和各目录解压后的条目数
+	counted    map[string]bool
+	dirEntries map[string]int
+	undos      []func() error
+	dirModes   []dirMode
+}
+
+type dirMode struct {
+	path    string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// 把压缩包中的条目名称规范化为相对路径，拒绝绝对路径和包含 ".." 的路径
+func cleanArchiveName(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" || (len(name) > 1 && name[1] == ':') {
+		return "", fmt.Errorf("archive entry %q has an absolute path", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("archive entry %q escapes the destination directory", name)
+		}
+	}
+	return path.Clean(name), nil
+}
+
+// 检查阶段：校验条目并统计数量和大小，不写入任何内容
+func (x *extractor) check(item *archiveItem) error {
+	name, err := cleanArchiveName(item.name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return nil
+	}
+	target := filepath.Join(x.dest, filepath.FromSlash(name))
+	if !isPathWithin(target, x.dest) {
+		return fmt.Errorf("archive entry %q escapes the destination directory", item.name)
+	}
+
+	switch item.typ {
+	case EntryDirectory:
+		x.result.Directories++
+	case EntryFile:
+		x.result.Files++
+		x.result.Bytes += item.size
+		if err := checkFileSizeQuota(target, item.size); err != nil {
+			return err
+		}
+	case EntrySymlink:
+		x.result.Symlinks++
+		if item.linkname == "" || filepath.IsAbs(item.linkname) || strings.HasPrefix(item.linkname, "/") {
+			return fmt.Errorf("archive entry %q is a symbolic link to an absolute path %q", item.name, item.linkname)
+		}
+		linkTarget := filepath.Join(filepath.Dir(target), filepath.FromSlash(item.linkname))
+		if !isPathWithin(linkTarget, x.dest) {
+			return fmt.Errorf("archive entry %q is a symbolic link pointing outside the destination directory", item.name)
+		}
+	case archiveHardlink:
+		x.result.Files++
+		linkName, err := cleanArchiveName(item.linkname)
+		if err != nil {
+			return err
+		}
+		if x.seen[linkName] != EntryFile {
+			return fmt.Errorf("archive entry %q is a hard link to %q, which is not a file earlier in the archive", item.name, item.linkname)
+		}
+		x.result.Bytes += x.sizes[linkName]
+	default:
+		x.result.Skipped++
+		return nil
+	}
+	if x.result.Files+x.result.Symlinks > x.opts.MaxFiles {
+		return fmt.Errorf("archive contains more than %d files", x.opts.MaxFiles)
+	}
+	if x.result.Bytes > x.opts.MaxBytes {
+		return fmt.Errorf("archive expands to more than %d bytes", x.opts.MaxBytes)
+	}
+
+	typ := item.typ
+	if typ == archiveHardlink {
+		typ = EntryFile
+	}
+	if prev, ok := x.seen[name]; ok && (prev == EntryDirectory) != (typ == EntryDirectory) {
+		return fmt.Errorf("archive entry %q appears both as a directory and a file", item.name)
+	}
+	if _, ok := x.seen[name]; !ok {
+		top := strings.SplitN(name, "/", 2)[0]
+		if _, ok := x.seen[top]; !ok && !containsString(x.topLevel, top) {
+			x.topLevel = append(x.topLevel, top)
+		}
+	}
+	x.seen[name] = typ
+	if item.typ == EntryFile {
+		x.sizes[name] = item.size
+	}
+	if err := x.checkDirEntries(name); err != nil {
+		return err
+	}
+
+	// 路径上已存在的文件不能被当作目录使用
+	for p := filepath.Dir(target); p != x.dest && isPathWithin(p, x.dest); p = filepath.Dir(p) {
+		if info, err := os.Lstat(p); err == nil && !info.IsDir() && info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("cannot extract %q: %s is not a directory", item.name, DisplayPath(p))
+		}
+	}
+	info, err := os.Lstat(target)
+	if err != nil {
+		return nil
+	}
+	if typ == EntryDirectory {
+		if !info.IsDir() {
+			return fmt.Errorf("cannot extract directory %q: %s already exists and is not a directory", item.name, DisplayPath(target))
+		}
+		return nil
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot extract %q: %s is an existing directory", item.name, DisplayPath(target))
+	}
+	if !x.opts.Overwrite {
+		return fmt.Errorf("%s already exists, set overwrite to replace existing files", DisplayPath(target))
+	}
+	return nil
+}
+
+// 统计条目及缺少的父目录给各目录新增的条目数，检查目录条目数限制
+func (x *extractor) checkDirEntries(name string) error {
+	limit := currentQuota().MaxDirEntries
+	if limit <= 0 {
+		return nil
+	}
+	if x.counted == nil {
+		x.counted = make(map[string]bool)
+		x.dirEntries = make(map[string]int)
+	}
+	p := ""
+	for _, part := range strings.Split(name, "/") {
+		p = path.Join(p, part)
+		if x.counted[p] {
+			continue
+		}
+		x.counted[p] = true
+		target := filepath.Join(x.dest, filepath.FromSlash(p))
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		}
+		dir := filepath.Dir(target)
+		count, ok := x.dirEntries[dir]
+		if !ok {
+			n, err := countDirEntries(dir)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			count = n
+		}
+		count++
+		x.dirEntries[dir] = count
+		if count > limit {
+			return fmt.Errorf("%w: extracting %q would bring directory %s to %d entries, the limit is %d per directory", ErrQuotaExceeded, name, DisplayPath(dir), count, limit)
+		}
+	}
+	return nil
+}
+
+// 写入阶段：每个条目写入前都解析符号链接并确认真实位置在目标目录内
+func (x *extractor) extract(item *archiveItem) error {
+	name, err := cleanArchiveName(item.name)
+	if err != nil {
+		return err
+	}
+	if name == "." || item.typ == EntryOther {
+		if item.typ == EntryOther {
+			x.result.Skipped++
+		}
+		return nil
+	}
+	// 先确认父目录的真实位置在目标目录内再创建，避免经由之前解压出的符号链接在外部创建目录
+	joined := filepath.Join(x.dest, filepath.FromSlash(name))
+	parent, err := confinePath(filepath.Dir(joined), x.dest)
+	if err != nil {
+		return fmt.Errorf("archive entry %q escapes the destination directory: %w", item.name, err)
+	}
+	if err := x.mkdirAll(parent); err != nil {
+		return err
+	}
+	target, err := confinePath(joined, x.dest)
+	if err != nil {
+		return fmt.Errorf("archive entry %q escapes the destination directory: %w", item.name, err)
+	}
+
+	if item.typ == EntryDirectory {
+		// 已存在的目录直接合并，不修改它的权限
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			mode := item.mode.Perm()
+			if mode == 0 {
+				mode = 0755
+			}
+			x.dirModes = append(x.dirModes, dirMode{path: target, mode: mode, modTime: item.modTime})
+		}
+		if err := x.mkdirAll(target); err != nil {
+			return err
+		}
+		x.result.Directories++
+		return nil
+	}
+
+	if err := x.backup(target); err != nil {
+		return err
+	}
+	switch item.typ {
+	case EntrySymlink:
+		// 检查阶段只能按字面判断，这里从链接所在的真实目录逐个分量解析目标，
+		// 经过之前解压出的符号链接的链式跳转同样会被发现
+		resolved, _, err := resolveComponents(filepath.Dir(target), filepath.FromSlash(item.linkname))
+		if err != nil || !isPathWithin(resolved, x.realDest) {
+			return fmt.Errorf("archive entry %q is a symbolic link pointing outside the destination directory", item.name)
+		}
+		if err := os.Symlink(item.linkname, target); err != nil {
+			return fmt.Errorf("failed to create symbolic link %s: %w", DisplayPath(target), err)
+		}
+		x.result.Symlinks++
+		return nil
+	case archiveHardlink:
+		linkName, _ := cleanArchiveName(item.linkname)
+		source, err := confinePath(filepath.Join(x.dest, filepath.FromSlash(linkName)), x.dest)
+		if err != nil {
+			return fmt.Errorf("archive entry %q links outside the destination directory: %w", item.name, err)
+		}
+		src, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		info, err := src.Stat()
+		if err != nil {
+			return err
+		}
+		item.mode = info.Mode()
+		item.modTime = info.ModTime()
+		item.open = func() (io.Reader, error) { return src, nil }
+	}
+
+	r, err := item.open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", item.name, err)
+	}
+	mode := item.mode.Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", DisplayPath(target), err)
+	}
+	remaining := x.opts.MaxBytes - x.result.Bytes
+	n, err := io.Copy(out, io.LimitReader(r, remaining+1))
+	x.result.Bytes += n
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", item.name, err)
+	}
+	if x.result.Bytes > x.opts.MaxBytes {
+		return fmt.Errorf("archive expands to more than %d bytes", x.opts.MaxBytes)
+	}
+	// 以O_CREATE创建时权限会受umask影响，这里显式设置
+	if err := os.Chmod(target, mode); err != nil {
+		return err
+	}
+	if !item.modTime.IsZero() {
+		os.Chtimes(target, item.modTime, item.modTime)
+	}
+	x.result.Files++
+	return nil
+}
+
+// 创建目录并记录新建的目录，回滚时删除
+func (x *extractor) mkdirAll(dir string) error {
+	created, err := mkdirAllTracked(dir)
+	if err != nil {
+		return err
+	}
+	if len(created) > 0 {
+		x.undos = append(x.undos, func() error { return removeCreatedDirs(created) })
+	}
+	return nil
+}
+
+// 目标已存在时先移到备份目录，回滚时移回；不存在时回滚会删除新建的文件
+func (x *extractor) backup(target string) error {
+	restore, err := backupPath(target, filepath.Join(x.backupDir, fmt.Sprintf("%d", len(x.undos))), true)
+	if err != nil {
+		return err
+	}
+	x.undos = append(x.undos, restore)
+	return nil
+}
+
+func (x *extractor) rollback() error {
+	var firstErr error
+	for i := len(x.undos) - 1; i >= 0; i-- {
+		if err := x.undos[i](); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// 所有文件写入后再设置目录的权限和时间，避免只读目录阻止写入其中的文件
+func (x *extractor) applyDirModes() error {
+	sort.SliceStable(x.dirModes, func(i, j int) bool {
+		return len(x.dirModes[i].path) > len(x.dirModes[j].path)
+	})
+	for _, d := range x.dirModes {
+		if err := os.Chmod(d.path, d.mode); err != nil {
+			return err
+		}
+		if !d.modTime.IsZero() {
+			os.Chtimes(d.path, d.modTime, d.modTime)
+		}
+	}
+	return nil
+}
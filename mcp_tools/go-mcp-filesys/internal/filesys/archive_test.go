@@ -0,0 +1,113 @@
+package filesys
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type tarEntry struct {
+	name     string
+	linkname string
+	body     string
+}
+
+// 写一个tar包，linkname非空的条目为符号链接
+func writeTestTar(t *testing.T, path string, entries []tarEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+		if e.linkname != "" {
+			hdr = &tar.Header{Name: e.name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: e.linkname}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractArchiveSymlinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		wantErr bool
+	}{
+		{
+			name: "link inside destination",
+			entries: []tarEntry{
+				{name: "sub/file.txt", body: "x"},
+				{name: "link", linkname: "sub/file.txt"},
+			},
+		},
+		{
+			name: "direct escape",
+			entries: []tarEntry{
+				{name: "link", linkname: "../outside"},
+			},
+			wantErr: true,
+		},
+		{
+			// 每个链接按字面看都在目标目录内，但经过前面的链接后会跳出
+			name: "chained escape",
+			entries: []tarEntry{
+				{name: "sub/link", linkname: ".."},
+				{name: "sub/link/l2", linkname: ".."},
+				{name: "sub/link/l3", linkname: "l2/.."},
+			},
+			wantErr: true,
+		},
+		{
+			name: "file through escaping chain",
+			entries: []tarEntry{
+				{name: "sub/link", linkname: ".."},
+				{name: "sub/link/l2", linkname: ".."},
+				{name: "sub/link/l2/dir/escaped.txt", body: "x"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupLockRoot(t)
+			archive := filepath.Join(root, "test.tar")
+			writeTestTar(t, archive, tt.entries)
+			dest := filepath.Join(root, "out")
+
+			_, err := ExtractArchive(archive, dest, ExtractOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtractArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			// 失败后目标目录被回滚，根目录外也没有留下任何内容
+			if _, err := os.Lstat(dest); !os.IsNotExist(err) {
+				t.Fatalf("destination was not rolled back: %v", err)
+			}
+			entries, err := os.ReadDir(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("unexpected entries left in root: %v", entries)
+			}
+			if _, err := os.Lstat(filepath.Join(filepath.Dir(root), "dir")); !os.IsNotExist(err) {
+				t.Fatalf("directory created outside the root: %v", err)
+			}
+		})
+	}
+}
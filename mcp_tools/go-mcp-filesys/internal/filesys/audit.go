@@ -0,0 +1,274 @@
+package filesys
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 审计日志的默认轮转限制
+const (
+	DefaultAuditMaxBytes int64 = 10 * 1024 * 1024
+	DefaultAuditMaxFiles       = 5
+)
+
+// 查询审计日志时的默认和最大返回条数
+const (
+	DefaultAuditQueryLimit = 50
+	MaxAuditQueryLimit     = 1000
+)
+
+// 审计日志配置
+type AuditConfig struct {
+	// 审计日志文件，为空时不记录。不能位于任何根目录内
+	File string
+	// 单个日志文件的最大字节数，超过后轮转
+	MaxBytes int64
+	// 保留的已轮转文件数，依次命名为 File.1、File.2 ...
+	MaxFiles int
+}
+
+// 一次工具调用的审计记录
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Tool    string    `json:"tool"`
+	Session string    `json:"session,omitempty"`
+	// 调用参数，文件内容等字段只保留长度和SHA-256
+	Arguments map[string]any `json:"arguments,omitempty"`
+	// 参数中的路径解析后的绝对路径
+	Paths []string `json:"paths,omitempty"`
+	// ok、error（工具返回错误结果）或 failed（调用失败）
+	Result       string  `json:"result"`
+	ResultBytes  int     `json:"result_bytes,omitempty"`
+	ResultSHA256 string  `json:"result_sha256,omitempty"`
+	Error        string  `json:"error,omitempty"`
+	DurationMS   float64 `json:"duration_ms"`
+}
+
+// 查询审计日志的条件，空值表示不限制
+type AuditQuery struct {
+	Tool    string
+	Session string
+	// 只返回涉及该路径（或其中文件）的记录
+	Path   string
+	Since  time.Time
+	Until  time.Time
+	Errors bool
+	Limit  int
+}
+
+var (
+	auditMu     sync.Mutex
+	auditConfig AuditConfig
+	auditFile   *os.File
+	auditSize   int64
+)
+
+// 设置审计日志文件，替换之前的配置
+func SetAudit(cfg AuditConfig) error {
+	if cfg.File != "" {
+		absFile, err := filepath.Abs(cfg.File)
+		if err != nil {
+			return fmt.Errorf("invalid audit log file: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(absFile), 0700); err != nil {
+			return fmt.Errorf("failed to create audit log directory: %w", err)
+		}
+		if realDir, err := filepath.EvalSymlinks(filepath.Dir(absFile)); err == nil {
+			absFile = filepath.Join(realDir, filepath.Base(absFile))
+		}
+		for _, root := range ListRoots() {
+			if isPathWithin(absFile, root.Path) {
+				return fmt.Errorf("audit log %s must not be inside root %s", absFile, root.Name)
+			}
+		}
+		cfg.File = absFile
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultAuditMaxBytes
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = DefaultAuditMaxFiles
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	closeAuditLocked()
+	auditConfig = cfg
+	if cfg.File == "" {
+		return nil
+	}
+	return openAuditLocked()
+}
+
+// 关闭审计日志文件
+func CloseAudit() error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	return closeAuditLocked()
+}
+
+// 是否启用了审计日志
+func AuditEnabled() bool {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	return auditFile != nil
+}
+
+func openAuditLocked() error {
+	f, err := os.OpenFile(auditConfig.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	auditFile = f
+	auditSize = info.Size()
+	return nil
+}
+
+func closeAuditLocked() error {
+	if auditFile == nil {
+		return nil
+	}
+	err := auditFile.Close()
+	auditFile = nil
+	return err
+}
+
+// 追加一条审计记录，当前文件写满时先轮转
+func WriteAudit(entry *AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if auditFile == nil {
+		return nil
+	}
+	if auditSize > 0 && auditSize+int64(len(line)) > auditConfig.MaxBytes {
+		if err := rotateAuditLocked(); err != nil {
+			return err
+		}
+	}
+	n, err := auditFile.Write(line)
+	auditSize += int64(n)
+	return err
+}
+
+// 把 File.n-1 依次改名为 File.n，最旧的文件被覆盖，然后重新打开 File
+func rotateAuditLocked() error {
+	if err := closeAuditLocked(); err != nil {
+		return err
+	}
+	for i := auditConfig.MaxFiles - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", auditConfig.File, i)
+		if _, err := os.Stat(from); err == nil {
+			os.Rename(from, fmt.Sprintf("%s.%d", auditConfig.File, i+1))
+		}
+	}
+	if err := os.Rename(auditConfig.File, auditConfig.File+".1"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return openAuditLocked()
+}
+
+// 按条件查询审计日志，最新的在前。会依次读取当前文件和已轮转的文件
+func QueryAudit(q AuditQuery) ([]AuditEntry, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultAuditQueryLimit
+	}
+	if q.Limit > MaxAuditQueryLimit {
+		q.Limit = MaxAuditQueryLimit
+	}
+
+	auditMu.Lock()
+	cfg := auditConfig
+	enabled := auditFile != nil
+	auditMu.Unlock()
+	if !enabled {
+		return nil, fmt.Errorf("audit log is disabled")
+	}
+
+	files := []string{cfg.File}
+	for i := 1; i <= cfg.MaxFiles; i++ {
+		files = append(files, fmt.Sprintf("%s.%d", cfg.File, i))
+	}
+	result := make([]AuditEntry, 0)
+	for _, file := range files {
+		entries, err := readAuditFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !auditMatches(&entries[i], &q) {
+				continue
+			}
+			result = append(result, entries[i])
+			if len(result) >= q.Limit {
+				return result, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+// 读取一个日志文件中的全部记录，跳过无法解析的行（例如写入中断留下的半行）
+func readAuditFile(file string) ([]AuditEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]AuditEntry, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func auditMatches(e *AuditEntry, q *AuditQuery) bool {
+	if q.Tool != "" && e.Tool != q.Tool {
+		return false
+	}
+	if q.Session != "" && e.Session != q.Session {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && e.Time.After(q.Until) {
+		return false
+	}
+	if q.Errors && e.Result == "ok" {
+		return false
+	}
+	if q.Path != "" {
+		for _, p := range e.Paths {
+			if isPathWithin(p, q.Path) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,705 @@
+package filesys
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 批量操作类型
+const (
+	BatchCreate  = "create"
+	BatchWrite   = "write"
+	BatchAppend  = "append"
+	BatchReplace = "replace"
+	BatchDelete  = "delete"
+	BatchMkdir   = "mkdir"
+	BatchRmdir   = "rmdir"
+	BatchMove    = "move"
+	BatchCopy    = "copy"
+)
+
+// 单次批量操作允许的最大步骤数
+const MaxBatchOperations = 200
+
+// 批量操作中的一个步骤。
+// create/write/append/replace/delete/mkdir/rmdir 使用Path，move/copy 使用From和To
+type BatchOperation struct {
+	Op      string `json:"op"`
+	Path    string `json:"path,omitempty"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+	Content string `json:"content,omitempty"`
+	// replace 使用：被替换的内容和新内容，Old必须出现在文件中
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// 批量操作的选项
+type BatchOptions struct {
+	// 只校验不写入
+	DryRun bool
+}
+
+// 单个步骤的执行结果
+type BatchStepResult struct {
+	Index int    `json:"index"`
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	To    string `json:"to,omitempty"`
+	// ok（仅校验）、not_applied、invalid、skipped、committed、rolled_back、failed
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// 批量操作的结果
+type BatchResult struct {
+	Committed bool              `json:"committed"`
+	DryRun    bool              `json:"dry_run,omitempty"`
+	Steps     []BatchStepResult `json:"steps"`
+}
+
+// 暂存区中记录的路径状态
+type stagedNode struct {
+	exists bool
+	isDir  bool
+	mode   os.FileMode
+	// 暂存区中保存文件新内容的路径
+	staged string
+	// 内容来源的磁盘路径（未修改的文件，或移动/复制的目录）
+	origin string
+}
+
+// 校验阶段使用的暂存区：在磁盘状态之上叠加之前步骤产生的变化，
+// 文件的新内容写入临时目录，不修改真实的目录树
+type batchStage struct {
+	dir   string
+	nodes map[string]*stagedNode
+	seq   int
+}
+
+// 校验通过、等待提交的步骤
+type plannedStep struct {
+	op     string
+	path   string
+	to     string
+	staged string
+	mode   os.FileMode
+}
+
+// 按顺序执行一组文件操作，要么全部成功，要么全部不生效。
+// 所有步骤先在暂存区中依次校验，新内容写入临时目录；
+// 全部通过后按顺序提交到目录树，提交中途失败会按相反顺序回滚已完成的步骤
+func ApplyBatch(ops []BatchOperation, opts BatchOptions) (*BatchResult, error) {
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("no operations provided")
+	}
+	if len(ops) > MaxBatchOperations {
+		return nil, fmt.Errorf("too many operations: %d (limit %d)", len(ops), MaxBatchOperations)
+	}
+
+	stagingDir, err := os.MkdirTemp("", "mcp-batch-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging area: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	// 校验和提交期间锁定所有步骤涉及的路径
+	lockList := make([]string, 0, len(ops)*2)
+	for _, op := range ops {
+		for _, p := range []string{op.Path, op.From, op.To} {
+			if strings.TrimSpace(p) == "" {
+				continue
+			}
+			if path, err := ResolvePath(p); err == nil {
+				lockList = append(lockList, path)
+			}
+		}
+	}
+	unlock := lockPaths(lockList...)
+	defer unlock()
+
+	stage := &batchStage{dir: stagingDir, nodes: make(map[string]*stagedNode)}
+	result := &BatchResult{DryRun: opts.DryRun, Steps: make([]BatchStepResult, len(ops))}
+	steps := make([]plannedStep, len(ops))
+	valid := true
+
+	for i, op := range ops {
+		step := BatchStepResult{Index: i, Op: op.Op, Path: op.Path, To: op.To}
+		if op.Path == "" {
+			step.Path = op.From
+		}
+		if !valid {
+			step.Status = "skipped"
+			result.Steps[i] = step
+			continue
+		}
+		planned, err := stage.plan(op)
+		if err != nil {
+			valid = false
+			step.Status = "invalid"
+			step.Error = err.Error()
+		} else {
+			steps[i] = planned
+			step.Status = "ok"
+			step.Path = DisplayPath(planned.path)
+			if planned.to != "" {
+				step.To = DisplayPath(planned.to)
+			}
+		}
+		result.Steps[i] = step
+	}
+
+	if !valid || opts.DryRun {
+		if !valid {
+			for i := range result.Steps {
+				if result.Steps[i].Status == "ok" {
+					result.Steps[i].Status = "not_applied"
+				}
+			}
+		}
+		return result, nil
+	}
+
+	paths := make([]string, 0, len(steps))
+	for _, step := range steps {
+		paths = append(paths, step.path)
+		if step.to != "" {
+			paths = append(paths, step.to)
+		}
+	}
+	rec, err := beginHistory("batch_operations", paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	backupDir := filepath.Join(stagingDir, "backup")
+	if err := os.Mkdir(backupDir, 0700); err != nil {
+		return nil, rec.finish(fmt.Errorf("failed to create backup area: %w", err))
+	}
+	undos := make([]func() error, 0, len(steps))
+	for i, step := range steps {
+		undo, err := commitStep(step, filepath.Join(backupDir, fmt.Sprintf("%d", i)))
+		if err != nil {
+			result.Steps[i].Status = "failed"
+			result.Steps[i].Error = err.Error()
+			for j := len(undos) - 1; j >= 0; j-- {
+				if uerr := undos[j](); uerr != nil {
+					result.Steps[j].Status = "failed"
+					result.Steps[j].Error = fmt.Sprintf("rollback failed: %v", uerr)
+				} else {
+					result.Steps[j].Status = "rolled_back"
+				}
+			}
+			for j := i + 1; j < len(steps); j++ {
+				result.Steps[j].Status = "skipped"
+			}
+			rec.finish(err)
+			return result, nil
+		}
+		undos = append(undos, undo)
+		result.Steps[i].Status = "committed"
+	}
+	result.Committed = true
+	return result, rec.finish(nil)
+}
+
+// 查询路径在之前的步骤执行后的状态
+func (s *batchStage) stat(path string) stagedNode {
+	for p := path; ; {
+		if node, ok := s.nodes[p]; ok {
+			if p == path {
+				return *node
+			}
+			if !node.exists || !node.isDir {
+				return stagedNode{}
+			}
+			if node.origin == "" {
+				// 本次批量操作中新建的目录，其中只有暂存区记录的内容
+				return stagedNode{}
+			}
+			rel, err := filepath.Rel(p, path)
+			if err != nil {
+				return stagedNode{}
+			}
+			return diskNode(filepath.Join(node.origin, rel))
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			break
+		}
+		p = parent
+	}
+	return diskNode(path)
+}
+
+func diskNode(path string) stagedNode {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return stagedNode{}
+	}
+	return stagedNode{exists: true, isDir: info.IsDir(), mode: info.Mode().Perm(), origin: path}
+}
+
+// 读取文件在之前的步骤执行后的内容
+func (s *batchStage) readFile(path string) ([]byte, os.FileMode, error) {
+	node := s.stat(path)
+	if !node.exists {
+		return nil, 0, fmt.Errorf("file does not exist: %s", DisplayPath(path))
+	}
+	if node.isDir {
+		return nil, 0, fmt.Errorf("not a regular file: %s", DisplayPath(path))
+	}
+	source := node.staged
+	if source == "" {
+		source = node.origin
+	}
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s: %w", DisplayPath(path), err)
+	}
+	return content, node.mode, nil
+}
+
+// 把新内容写入暂存区并记录文件状态
+func (s *batchStage) stageFile(path string, content []byte, mode os.FileMode) (string, error) {
+	s.seq++
+	staged := filepath.Join(s.dir, fmt.Sprintf("stage-%d", s.seq))
+	if err := os.WriteFile(staged, content, 0600); err != nil {
+		return "", fmt.Errorf("failed to stage %s: %w", DisplayPath(path), err)
+	}
+	s.nodes[path] = &stagedNode{exists: true, mode: mode, staged: staged}
+	return staged, nil
+}
+
+// 确保父目录存在，不存在的父目录在暂存区中标记为新建
+func (s *batchStage) ensureParents(path string) error {
+	missing := make([]string, 0)
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		node := s.stat(dir)
+		if node.exists {
+			if !node.isDir {
+				return fmt.Errorf("parent is not a directory: %s", DisplayPath(dir))
+			}
+			break
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	for _, dir := range missing {
+		s.nodes[dir] = &stagedNode{exists: true, isDir: true, mode: 0755}
+	}
+	return nil
+}
+
+// 删除路径及暂存区中记录的所有子路径
+func (s *batchStage) remove(path string) {
+	for p := range s.nodes {
+		if isPathWithin(p, path) {
+			delete(s.nodes, p)
+		}
+	}
+	s.nodes[path] = &stagedNode{}
+}
+
+// 把路径的状态（包括暂存区中记录的子路径）复制到新位置
+func (s *batchStage) copyTo(from string, to string) {
+	node := s.stat(from)
+	children := make(map[string]*stagedNode)
+	for p, n := range s.nodes {
+		if p != from && isPathWithin(p, from) {
+			rel, _ := filepath.Rel(from, p)
+			copied := *n
+			children[filepath.Join(to, rel)] = &copied
+		}
+	}
+	s.remove(to)
+	s.nodes[to] = &node
+	for p, n := range children {
+		s.nodes[p] = n
+	}
+}
+
+// 解析目标路径并检查是否允许写入
+func resolveBatchPath(p string) (string, error) {
+	if strings.TrimSpace(p) == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	fullPath, err := ResolvePath(p)
+	if err != nil {
+		return "", err
+	}
+	if err := checkWritable(fullPath); err != nil {
+		return "", err
+	}
+	return fullPath, nil
+}
+
+// 校验一个步骤并把它的效果记录到暂存区
+func (s *batchStage) plan(op BatchOperation) (plannedStep, error) {
+	switch op.Op {
+	case BatchCreate, BatchWrite, BatchAppend, BatchReplace, BatchDelete, BatchMkdir, BatchRmdir:
+		path, err := resolveBatchPath(op.Path)
+		if err != nil {
+			return plannedStep{}, err
+		}
+		return s.planPath(op, path)
+	case BatchMove, BatchCopy:
+		from, err := ResolvePath(op.From)
+		if err != nil {
+			return plannedStep{}, err
+		}
+		if op.Op == BatchMove {
+			if err := checkWritable(from); err != nil {
+				return plannedStep{}, err
+			}
+		}
+		to, err := resolveBatchPath(op.To)
+		if err != nil {
+			return plannedStep{}, err
+		}
+		return s.planTransfer(op.Op, from, to)
+	case "":
+		return plannedStep{}, fmt.Errorf("op is required")
+	default:
+		return plannedStep{}, fmt.Errorf("unknown op: %s", op.Op)
+	}
+}
+
+func (s *batchStage) planPath(op BatchOperation, path string) (plannedStep, error) {
+	node := s.stat(path)
+	step := plannedStep{op: op.Op, path: path}
+
+	switch op.Op {
+	case BatchCreate, BatchWrite:
+		if op.Op == BatchCreate && node.exists {
+			return step, fmt.Errorf("file already exists: %s", DisplayPath(path))
+		}
+		if node.isDir {
+			return step, fmt.Errorf("is a directory: %s", DisplayPath(path))
+		}
+		if !node.exists && !IsValidFileName(filepath.Base(path)) {
+			return step, fmt.Errorf("invalid file name: %s", filepath.Base(path))
+		}
+		if err := s.ensureParents(path); err != nil {
+			return step, err
+		}
+		step.mode = 0644
+		content := []byte(op.Content)
+		if node.exists {
+			// 覆盖已有文件时沿用它的编码、BOM和换行风格
+			old, mode, err := s.readFile(path)
+			if err != nil {
+				return step, err
+			}
+			if content, err = replaceText(old, op.Content, TextOptions{}); err != nil {
+				return step, fmt.Errorf("%s: %w", DisplayPath(path), err)
+			}
+			step.mode = mode
+		}
+		staged, err := s.stageFile(path, content, step.mode)
+		step.staged = staged
+		return step, err
+
+	case BatchAppend, BatchReplace:
+		content, mode, err := s.readFile(path)
+		if err != nil {
+			return step, err
+		}
+		if op.Op == BatchReplace && op.Old == "" {
+			return step, fmt.Errorf("old content is required for replace")
+		}
+		content, err = rewriteText(content, TextOptions{}, func(text string, format TextFormat) (string, error) {
+			if op.Op == BatchAppend {
+				return appendText(text, op.Content), nil
+			}
+			old, replacement := op.Old, op.New
+			if format.LineEnding == LineEndingCRLF {
+				old = convertLineEndings(old, LineEndingLF)
+				replacement = convertLineEndings(replacement, LineEndingLF)
+			}
+			if !strings.Contains(text, old) {
+				return "", fmt.Errorf("content to replace not found in %s", DisplayPath(path))
+			}
+			return strings.ReplaceAll(text, old, replacement), nil
+		})
+		if err != nil {
+			return step, err
+		}
+		step.mode = mode
+		staged, err := s.stageFile(path, content, mode)
+		step.staged = staged
+		return step, err
+
+	case BatchDelete:
+		if err := checkProfileOperation(OperationDelete); err != nil {
+			return step, err
+		}
+		if !node.exists {
+			return step, fmt.Errorf("file does not exist: %s", DisplayPath(path))
+		}
+		if node.isDir {
+			return step, fmt.Errorf("not a regular file: %s, use rmdir", DisplayPath(path))
+		}
+		s.remove(path)
+		return step, nil
+
+	case BatchMkdir:
+		if node.exists {
+			if !node.isDir {
+				return step, fmt.Errorf("file already exists: %s", DisplayPath(path))
+			}
+			return step, nil
+		}
+		if err := s.ensureParents(path); err != nil {
+			return step, err
+		}
+		s.nodes[path] = &stagedNode{exists: true, isDir: true, mode: 0755}
+		return step, nil
+
+	case BatchRmdir:
+		if err := checkProfileOperation(OperationDelete); err != nil {
+			return step, err
+		}
+		if !node.exists {
+			return step, fmt.Errorf("directory does not exist: %s", DisplayPath(path))
+		}
+		if !node.isDir {
+			return step, fmt.Errorf("not a directory: %s", DisplayPath(path))
+		}
+		if root := rootForPath(path); root != nil && root.Path == path {
+			return step, fmt.Errorf("cannot delete root directory %s", root.Name)
+		}
+		s.remove(path)
+		return step, nil
+	}
+	return step, fmt.Errorf("unknown op: %s", op.Op)
+}
+
+func (s *batchStage) planTransfer(op string, from string, to string) (plannedStep, error) {
+	step := plannedStep{op: op, path: from, to: to}
+	src := s.stat(from)
+	if !src.exists {
+		return step, fmt.Errorf("source does not exist: %s", DisplayPath(from))
+	}
+	if s.stat(to).exists {
+		return step, fmt.Errorf("destination already exists: %s", DisplayPath(to))
+	}
+	if src.isDir && isPathWithin(to, from) {
+		return step, fmt.Errorf("cannot %s %s into itself", op, DisplayPath(from))
+	}
+	if op == BatchMove {
+		if root := rootForPath(from); root != nil && root.Path == from {
+			return step, fmt.Errorf("cannot move root directory %s", root.Name)
+		}
+	}
+	if err := s.ensureParents(to); err != nil {
+		return step, err
+	}
+	s.copyTo(from, to)
+	if op == BatchMove {
+		s.remove(from)
+	}
+	return step, nil
+}
+
+// 把步骤提交到目录树，返回撤销该步骤的函数。
+// 被覆盖或删除的内容先移动到backup中，回滚时再移回原处
+func commitStep(step plannedStep, backup string) (func() error, error) {
+	switch step.op {
+	case BatchCreate, BatchWrite, BatchAppend, BatchReplace:
+		content, err := os.ReadFile(step.staged)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read staged content: %w", err)
+		}
+		if err := checkWriteQuota(step.path, int64(len(content))); err != nil {
+			return nil, err
+		}
+		created, err := mkdirAllTracked(filepath.Dir(step.path))
+		if err != nil {
+			return nil, err
+		}
+		restore, err := backupPath(step.path, backup, false)
+		if err != nil {
+			removeCreatedDirs(created)
+			return nil, err
+		}
+		if err := safeWriteFile(step.path, content, step.mode); err != nil {
+			restore()
+			removeCreatedDirs(created)
+			return nil, fmt.Errorf("failed to write %s: %w", DisplayPath(step.path), err)
+		}
+		return func() error {
+			if err := restore(); err != nil {
+				return err
+			}
+			return removeCreatedDirs(created)
+		}, nil
+
+	case BatchDelete, BatchRmdir:
+		restore, err := backupPath(step.path, backup, true)
+		if err != nil {
+			return nil, err
+		}
+		return restore, nil
+
+	case BatchMkdir:
+		if err := checkNewEntryQuota(step.path); err != nil {
+			return nil, err
+		}
+		created, err := mkdirAllTracked(step.path)
+		if err != nil {
+			return nil, err
+		}
+		return func() error { return removeCreatedDirs(created) }, nil
+
+	case BatchMove, BatchCopy:
+		if err := checkTransferQuota(step.path, step.to, step.op == BatchCopy); err != nil {
+			return nil, err
+		}
+		// 校验之后目标被其他操作创建时不能覆盖，失败清理时也不能删除它
+		if _, err := os.Lstat(step.to); err == nil {
+			return nil, fmt.Errorf("destination already exists: %s", DisplayPath(step.to))
+		}
+		created, err := mkdirAllTracked(filepath.Dir(step.to))
+		if err != nil {
+			return nil, err
+		}
+		if step.op == BatchMove {
+			// 跨设备复制失败时transferPath自己删除复制的部分
+			if err := movePath(step.path, step.to); err != nil {
+				removeCreatedDirs(created)
+				return nil, err
+			}
+		} else if err := copyPath(step.path, step.to); err != nil {
+			os.RemoveAll(step.to)
+			removeCreatedDirs(created)
+			return nil, fmt.Errorf("failed to copy %s: %w", DisplayPath(step.path), err)
+		}
+		return func() error {
+			if step.op == BatchMove {
+				if err := movePath(step.to, step.path); err != nil {
+					return err
+				}
+			} else if err := os.RemoveAll(step.to); err != nil {
+				return err
+			}
+			return removeCreatedDirs(created)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown op: %s", step.op)
+}
+
+// 把已存在的路径移到备份位置（remove为false时复制，原路径保留等待覆盖），
+// 返回恢复原状的函数；路径不存在时恢复函数会删除之后创建的路径
+func backupPath(path string, backup string, remove bool) (func() error, error) {
+	if _, err := os.Lstat(path); err != nil {
+		if os.IsNotExist(err) {
+			return func() error {
+				if err := os.RemoveAll(path); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				return nil
+			}, nil
+		}
+		return nil, err
+	}
+	var err error
+	if remove {
+		err = movePath(path, backup)
+	} else {
+		err = copyPath(path, backup)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up %s: %w", DisplayPath(path), err)
+	}
+	return func() error {
+		if err := os.RemoveAll(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return movePath(backup, path)
+	}, nil
+}
+
+// 创建目录及不存在的父目录，返回新创建的目录（从外到内）
+func mkdirAllTracked(dir string) ([]string, error) {
+	missing := make([]string, 0)
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append([]string{d}, missing...)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	return missing, nil
+}
+
+// 删除mkdirAllTracked创建的空目录
+func removeCreatedDirs(created []string) error {
+	for i := len(created) - 1; i >= 0; i-- {
+		if err := os.Remove(created[i]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// 移动文件或目录，只在跨设备时复制并校验后删除源，其他重命名错误直接返回
+func movePath(from string, to string) error {
+	_, err := transferPath(from, to)
+	return err
+}
+
+// 复制文件或目录树，保留权限，符号链接按链接本身复制
+func copyPath(from string, to string) error {
+	info, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(from)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, to)
+	case info.IsDir():
+		if err := os.Mkdir(to, info.Mode().Perm()); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(from)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyPath(filepath.Join(from, entry.Name()), filepath.Join(to, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		src, err := os.Open(from)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			dst.Close()
+			return err
+		}
+		return dst.Close()
+	}
+}
@@ -0,0 +1,305 @@
+package filesys
+
+import (
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// 记录目录树的状态：普通文件为内容，目录为 "<dir>"，其他类型为其类型
+func snapshotTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	tree := make(map[string]string)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		switch {
+		case d.IsDir():
+			tree[rel] = "<dir>"
+			return nil
+		case !d.Type().IsRegular():
+			tree[rel] = d.Type().String()
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		tree[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// 构造测试目录：a.txt、b.txt、dir/c.txt 和一个200字节的 big.bin
+func setupBatchTree(t *testing.T) string {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRoots([]Root{{Name: "ws", Path: root, Mode: RootModeReadWrite}}); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"a.txt":     "alpha\n",
+		"b.txt":     "bravo\n",
+		"dir/c.txt": "charlie\n",
+		"big.bin":   strings.Repeat("x", 200),
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestApplyBatchRollsBackAfterFailure(t *testing.T) {
+	// 套接字能通过校验，但提交时无法打开复制，最后一步失败，之前已提交的步骤都要回滚
+	tests := []struct {
+		name string
+		ops  func(root string) []BatchOperation
+	}{
+		{
+			name: "write and create",
+			ops: func(root string) []BatchOperation {
+				return []BatchOperation{
+					{Op: BatchWrite, Path: filepath.Join(root, "a.txt"), Content: "changed\n"},
+					{Op: BatchCreate, Path: filepath.Join(root, "new/sub/new.txt"), Content: "new\n"},
+				}
+			},
+		},
+		{
+			name: "delete, move and mkdir",
+			ops: func(root string) []BatchOperation {
+				return []BatchOperation{
+					{Op: BatchDelete, Path: filepath.Join(root, "a.txt")},
+					{Op: BatchMove, From: filepath.Join(root, "b.txt"), To: filepath.Join(root, "moved/b.txt")},
+					{Op: BatchMkdir, Path: filepath.Join(root, "x/y")},
+				}
+			},
+		},
+		{
+			name: "replace, append and rmdir",
+			ops: func(root string) []BatchOperation {
+				return []BatchOperation{
+					{Op: BatchReplace, Path: filepath.Join(root, "dir/c.txt"), Old: "charlie", New: "delta"},
+					{Op: BatchAppend, Path: filepath.Join(root, "a.txt"), Content: "more"},
+					{Op: BatchRmdir, Path: filepath.Join(root, "dir")},
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupBatchTree(t)
+			sock := filepath.Join(root, "sock")
+			l, err := net.Listen("unix", sock)
+			if err != nil {
+				t.Skipf("unix sockets not supported: %v", err)
+			}
+			defer l.Close()
+			before := snapshotTree(t, root)
+
+			ops := append(tt.ops(root), BatchOperation{Op: BatchCopy, From: sock, To: filepath.Join(root, "sock2")})
+			result, err := ApplyBatch(ops, BatchOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Committed {
+				t.Fatal("batch committed, want failure on the last step")
+			}
+			last := len(ops) - 1
+			if result.Steps[last].Status != "failed" {
+				t.Errorf("last step status = %s, want failed", result.Steps[last].Status)
+			}
+			for _, step := range result.Steps[:last] {
+				if step.Status != "rolled_back" {
+					t.Errorf("step %d status = %s (%s), want rolled_back", step.Index, step.Status, step.Error)
+				}
+			}
+			if after := snapshotTree(t, root); !reflect.DeepEqual(before, after) {
+				t.Errorf("tree changed after rollback:\nbefore %v\nafter  %v", before, after)
+			}
+		})
+	}
+}
+
+func TestApplyBatchInvalidStepAppliesNothing(t *testing.T) {
+	root := setupBatchTree(t)
+	before := snapshotTree(t, root)
+	ops := []BatchOperation{
+		{Op: BatchWrite, Path: filepath.Join(root, "a.txt"), Content: "changed\n"},
+		{Op: BatchDelete, Path: filepath.Join(root, "b.txt")},
+		// 前面的步骤已经删除了 b.txt，校验时按暂存后的状态报错
+		{Op: BatchReplace, Path: filepath.Join(root, "b.txt"), Old: "bravo", New: "x"},
+		{Op: BatchMkdir, Path: filepath.Join(root, "later")},
+	}
+	result, err := ApplyBatch(ops, BatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"not_applied", "not_applied", "invalid", "skipped"}
+	for i, step := range result.Steps {
+		if step.Status != want[i] {
+			t.Errorf("step %d status = %s, want %s", i, step.Status, want[i])
+		}
+	}
+	if result.Committed {
+		t.Error("batch with an invalid step was committed")
+	}
+	if after := snapshotTree(t, root); !reflect.DeepEqual(before, after) {
+		t.Errorf("tree changed:\nbefore %v\nafter  %v", before, after)
+	}
+}
+
+func TestApplyBatchRollsBackOverQuota(t *testing.T) {
+	// 单文件配额在提交时才检查，最后一步超出配额，之前已提交的步骤都要回滚
+	tests := []struct {
+		name string
+		ops  func(root string) []BatchOperation
+	}{
+		{
+			name: "write over quota",
+			ops: func(root string) []BatchOperation {
+				return []BatchOperation{
+					{Op: BatchWrite, Path: filepath.Join(root, "a.txt"), Content: "changed\n"},
+					{Op: BatchCreate, Path: filepath.Join(root, "new/sub/new.txt"), Content: "new\n"},
+					{Op: BatchWrite, Path: filepath.Join(root, "b.txt"), Content: strings.Repeat("y", 200)},
+				}
+			},
+		},
+		{
+			name: "copy over quota",
+			ops: func(root string) []BatchOperation {
+				return []BatchOperation{
+					{Op: BatchDelete, Path: filepath.Join(root, "a.txt")},
+					{Op: BatchMove, From: filepath.Join(root, "b.txt"), To: filepath.Join(root, "moved/b.txt")},
+					{Op: BatchCopy, From: filepath.Join(root, "big.bin"), To: filepath.Join(root, "big2.bin")},
+				}
+			},
+		},
+		{
+			name: "append over quota",
+			ops: func(root string) []BatchOperation {
+				return []BatchOperation{
+					{Op: BatchReplace, Path: filepath.Join(root, "dir/c.txt"), Old: "charlie", New: "delta"},
+					{Op: BatchAppend, Path: filepath.Join(root, "a.txt"), Content: strings.Repeat("z", 200)},
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupBatchTree(t)
+			if err := SetQuota(QuotaConfig{MaxFileBytes: 100}); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { SetQuota(QuotaConfig{}) })
+			before := snapshotTree(t, root)
+
+			ops := tt.ops(root)
+			result, err := ApplyBatch(ops, BatchOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := len(ops) - 1
+			if result.Committed || result.Steps[last].Status != "failed" {
+				t.Fatalf("last step status = %s, want failed", result.Steps[last].Status)
+			}
+			for _, step := range result.Steps[:last] {
+				if step.Status != "rolled_back" {
+					t.Errorf("step %d status = %s (%s), want rolled_back", step.Index, step.Status, step.Error)
+				}
+			}
+			if after := snapshotTree(t, root); !reflect.DeepEqual(before, after) {
+				t.Errorf("tree changed after rollback:\nbefore %v\nafter  %v", before, after)
+			}
+		})
+	}
+}
+
+func TestApplyBatchMoveRenameErrors(t *testing.T) {
+	// 只有EXDEV退化为复制，其他重命名错误使步骤失败，不能留下源和目标两份内容
+	tests := []struct {
+		name      string
+		renameErr error
+		committed bool
+	}{
+		{name: "cross device", renameErr: syscall.EXDEV, committed: true},
+		{name: "permission denied", renameErr: syscall.EACCES},
+		{name: "busy", renameErr: syscall.EBUSY},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupBatchTree(t)
+			// 只让被移动的目录重命名失败，回滚时的备份恢复不受影响
+			renameFunc = func(from string, to string) error {
+				if from != filepath.Join(root, "dir") {
+					return os.Rename(from, to)
+				}
+				return &os.LinkError{Op: "rename", Old: from, New: to, Err: tt.renameErr}
+			}
+			t.Cleanup(func() { renameFunc = os.Rename })
+			want := snapshotTree(t, root)
+
+			ops := []BatchOperation{
+				{Op: BatchWrite, Path: filepath.Join(root, "a.txt"), Content: "changed\n"},
+				{Op: BatchMove, From: filepath.Join(root, "dir"), To: filepath.Join(root, "moved")},
+			}
+			result, err := ApplyBatch(ops, BatchOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Committed != tt.committed {
+				t.Fatalf("committed = %v, want %v: %+v", result.Committed, tt.committed, result.Steps)
+			}
+			if tt.committed {
+				want["a.txt"] = "changed\n"
+				delete(want, "dir")
+				delete(want, "dir/c.txt")
+				want["moved"] = "<dir>"
+				want["moved/c.txt"] = "charlie\n"
+			}
+			if got := snapshotTree(t, root); !reflect.DeepEqual(want, got) {
+				t.Errorf("unexpected tree:\nwant %v\ngot  %v", want, got)
+			}
+		})
+	}
+}
+
+func TestApplyBatchDoesNotReplaceNewDestination(t *testing.T) {
+	root := setupBatchTree(t)
+	dst := filepath.Join(root, "moved.txt")
+	// 校验阶段目标还不存在，提交前被创建
+	stage := &batchStage{dir: t.TempDir(), nodes: make(map[string]*stagedNode)}
+	step, err := stage.plan(BatchOperation{Op: BatchMove, From: filepath.Join(root, "a.txt"), To: dst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, []byte("someone else\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commitStep(step, filepath.Join(t.TempDir(), "backup")); err == nil {
+		t.Fatal("move replaced a destination created after validation")
+	}
+	tree := snapshotTree(t, root)
+	if tree["moved.txt"] != "someone else\n" || tree["a.txt"] != "alpha\n" {
+		t.Errorf("unexpected tree after failed move: %v", tree)
+	}
+}
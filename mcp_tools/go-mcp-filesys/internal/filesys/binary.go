@@ -0,0 +1,516 @@
+package filesys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 二进制读写和分块上传的上限
+const (
+	// 单次读取或写入的最大字节数（解码后）
+	MaxBinaryChunkBytes = 4 * 1024 * 1024
+	// 分块上传的文件最大字节数
+	MaxUploadBytes int64 = 1 << 30
+	// 同时进行的上传会话数
+	MaxUploadSessions = 16
+	// 上传会话空闲超过该时间后被清理
+	UploadSessionTTL = time.Hour
+)
+
+// 以base64返回的一段文件内容
+type BinaryChunk struct {
+	File     string `json:"file"`
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	Offset   int64  `json:"offset"`
+	Length   int    `json:"length"`
+	EOF      bool   `json:"eof"`
+	// 本段内容的SHA-256
+	SHA256 string `json:"sha256"`
+	Data   string `json:"data,omitempty"`
+}
+
+// 写入二进制文件的结果
+type BinaryWriteResult struct {
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// 上传会话的状态
+type UploadStatus struct {
+	UploadID string `json:"upload_id"`
+	File     string `json:"file"`
+	Received int64  `json:"received"`
+	// 声明的文件大小，0表示未声明
+	Size      int64     `json:"size,omitempty"`
+	Overwrite bool      `json:"overwrite"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type uploadSession struct {
+	mu        sync.Mutex
+	id        string
+	target    string
+	size      int64
+	sha256    string
+	overwrite bool
+	staged    *os.File
+	received  int64
+	touched   time.Time
+	// 会话已完成或取消
+	done bool
+}
+
+var (
+	uploadMu       sync.Mutex
+	uploadSessions = make(map[string]*uploadSession)
+)
+
+// 读取文件的一段内容，length为0时读取到文件末尾，超过MaxBinaryChunkBytes时截断
+func ReadFileBinary(filePath string, offset int64, length int) (*BinaryChunk, error) {
+	if !isPathInAllowedDirectory(filePath) {
+		return nil, fmt.Errorf("access denied: %s", filePath)
+	}
+	if !isRegularFile(filePath) {
+		return nil, fmt.Errorf("not a regular file: %s", filePath)
+	}
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("offset and length must not be negative")
+	}
+	if length == 0 || length > MaxBinaryChunkBytes {
+		length = MaxBinaryChunkBytes
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if offset > info.Size() {
+		return nil, fmt.Errorf("offset %d is beyond the end of the file (%d bytes)", offset, info.Size())
+	}
+
+	buf := make([]byte, length)
+	n, err := f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	buf = buf[:n]
+
+	head := make([]byte, statSniffLength)
+	hn, _ := f.ReadAt(head, 0)
+	head = head[:hn]
+
+	sum := sha256.Sum256(buf)
+	return &BinaryChunk{
+		File:     DisplayPath(filePath),
+		MIMEType: detectMIMEType(filePath, head, guessEncoding(head, int64(hn) == info.Size())),
+		Size:     info.Size(),
+		Offset:   offset,
+		Length:   n,
+		EOF:      offset+int64(n) >= info.Size(),
+		SHA256:   hex.EncodeToString(sum[:]),
+		Data:     base64.StdEncoding.EncodeToString(buf),
+	}, nil
+}
+
+// 把base64内容写入文件。文件已存在时需要overwrite，expectedSHA256不为空时先校验内容
+func WriteFileBinary(filePath string, data string, overwrite bool, expectedSHA256 string) (*BinaryWriteResult, error) {
+	if !isPathInAllowedDirectory(filePath) {
+		return nil, fmt.Errorf("access denied: %s", filePath)
+	}
+	if err := checkWritable(filePath); err != nil {
+		return nil, err
+	}
+	content, err := decodeBase64(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > MaxBinaryChunkBytes {
+		return nil, fmt.Errorf("content is %d bytes, larger than %d; use begin_upload to upload it in chunks", len(content), MaxBinaryChunkBytes)
+	}
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	if expectedSHA256 != "" && !strings.EqualFold(expectedSHA256, digest) {
+		return nil, fmt.Errorf("checksum mismatch: expected %s, got %s", expectedSHA256, digest)
+	}
+
+	cleanPath := filepath.Clean(filePath)
+	unlock := lockPath(cleanPath)
+	defer unlock()
+	mode, err := binaryTargetMode(cleanPath, overwrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWriteQuota(cleanPath, int64(len(content))); err != nil {
+		return nil, err
+	}
+	rec, err := beginHistory("write_file_binary", cleanPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := rec.finish(safeWriteFile(cleanPath, content, mode)); err != nil {
+		return nil, err
+	}
+	return &BinaryWriteResult{File: DisplayPath(cleanPath), Size: int64(len(content)), SHA256: digest}, nil
+}
+
+// 检查写入目标，返回写入时使用的权限：覆盖时保留原文件的权限
+func binaryTargetMode(path string, overwrite bool) (os.FileMode, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if _, err := os.Stat(filepath.Dir(path)); err != nil {
+			return 0, fmt.Errorf("parent directory does not exist: %s", DisplayPath(filepath.Dir(path)))
+		}
+		return 0644, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return 0, fmt.Errorf("not a regular file: %s", DisplayPath(path))
+	}
+	if !overwrite {
+		return 0, fmt.Errorf("%s already exists, set overwrite to replace it", DisplayPath(path))
+	}
+	return info.Mode().Perm(), nil
+}
+
+func decodeBase64(data string) ([]byte, error) {
+	data = strings.TrimSpace(data)
+	// 兼容 data URL 形式
+	if strings.HasPrefix(data, "data:") {
+		if idx := strings.Index(data, ";base64,"); idx >= 0 {
+			data = data[idx+len(";base64,"):]
+		}
+	}
+	content, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		if content, err2 := base64.RawStdEncoding.DecodeString(data); err2 == nil {
+			return content, nil
+		}
+		return nil, fmt.Errorf("invalid base64 data: %w", err)
+	}
+	return content, nil
+}
+
+// 开始分块上传，内容先写入目标目录中的隐藏临时文件，完成并校验后才重命名为目标文件。
+// 暂存的内容位于目标所在的根目录内，接收分块时就计入根目录的配额。
+// size和sha256可以在开始时声明，也可以在完成时提供
+func BeginUpload(filePath string, size int64, expectedSHA256 string, overwrite bool) (*UploadStatus, error) {
+	if !isPathInAllowedDirectory(filePath) {
+		return nil, fmt.Errorf("access denied: %s", filePath)
+	}
+	if err := checkWritable(filePath); err != nil {
+		return nil, err
+	}
+	if size < 0 || size > MaxUploadBytes {
+		return nil, fmt.Errorf("size must be between 0 and %d bytes", MaxUploadBytes)
+	}
+	cleanPath := filepath.Clean(filePath)
+	if _, err := binaryTargetMode(cleanPath, overwrite); err != nil {
+		return nil, err
+	}
+	// 声明了大小时提前检查单文件限制，完成时再检查全部配额
+	if err := checkFileSizeQuota(cleanPath, size); err != nil {
+		return nil, err
+	}
+
+	uploadMu.Lock()
+	defer uploadMu.Unlock()
+	expireUploadsLocked()
+	if len(uploadSessions) >= MaxUploadSessions {
+		return nil, fmt.Errorf("too many uploads in progress (limit %d), finish or cancel one first", MaxUploadSessions)
+	}
+	for _, s := range uploadSessions {
+		if s.target == cleanPath {
+			return nil, fmt.Errorf("an upload to %s is already in progress: %s", DisplayPath(cleanPath), s.id)
+		}
+	}
+
+	staged, err := os.CreateTemp(filepath.Dir(cleanPath), ".mcp-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging file: %w", err)
+	}
+	id, err := newUploadID()
+	if err != nil {
+		staged.Close()
+		os.Remove(staged.Name())
+		return nil, err
+	}
+	s := &uploadSession{
+		id:        id,
+		target:    cleanPath,
+		size:      size,
+		sha256:    strings.ToLower(expectedSHA256),
+		overwrite: overwrite,
+		staged:    staged,
+		touched:   time.Now(),
+	}
+	uploadSessions[id] = s
+	return s.status(), nil
+}
+
+// 写入一个分块。offset必须不大于已接收的字节数，小于时覆盖已接收的内容，便于重传
+func UploadChunk(id string, offset int64, data string) (*UploadStatus, error) {
+	s, err := lookupUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	content, err := decodeBase64(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > MaxBinaryChunkBytes {
+		return nil, fmt.Errorf("chunk is %d bytes, larger than %d", len(content), MaxBinaryChunkBytes)
+	}
+	if offset < 0 || offset > s.received {
+		return nil, fmt.Errorf("offset %d does not continue the upload, %d bytes received so far", offset, s.received)
+	}
+	end := offset + int64(len(content))
+	if end > MaxUploadBytes || (s.size > 0 && end > s.size) {
+		return nil, fmt.Errorf("chunk ends at %d bytes, beyond the declared size", end)
+	}
+	if err := checkFileSizeQuota(s.target, end); err != nil {
+		return nil, err
+	}
+	// 新增的字节预留在根目录的配额中，会话取消或失败时释放
+	if end > s.received {
+		if err := checkRootQuota(s.target, end-s.received); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.staged.WriteAt(content, offset); err != nil {
+		if end > s.received {
+			releaseRootBytes(s.target, end-s.received)
+		}
+		return nil, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	if end > s.received {
+		s.received = end
+	}
+	s.touched = time.Now()
+	return s.status(), nil
+}
+
+// 完成上传：校验大小和SHA-256后把内容移动到目标位置
+func FinishUpload(id string, expectedSHA256 string) (*BinaryWriteResult, error) {
+	s, err := lookupUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	if expectedSHA256 == "" {
+		expectedSHA256 = s.sha256
+	}
+	if expectedSHA256 == "" {
+		return nil, fmt.Errorf("sha256 is required to finish the upload")
+	}
+	if s.size > 0 && s.received != s.size {
+		return nil, fmt.Errorf("upload is incomplete: received %d of %d bytes", s.received, s.size)
+	}
+	if err := s.staged.Truncate(s.received); err != nil {
+		return nil, err
+	}
+	if _, err := s.staged.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, s.staged); err != nil {
+		return nil, fmt.Errorf("failed to read staged upload: %w", err)
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(digest, expectedSHA256) {
+		return nil, fmt.Errorf("checksum mismatch: expected %s, got %s; the upload is kept so corrupted chunks can be sent again", expectedSHA256, digest)
+	}
+
+	// 目标可能在上传期间发生了变化，重新检查
+	unlock := lockPath(s.target)
+	defer unlock()
+	if err := checkWritable(s.target); err != nil {
+		return nil, err
+	}
+	mode, err := binaryTargetMode(s.target, s.overwrite)
+	if err != nil {
+		return nil, err
+	}
+	// 接收的内容已经计入根目录的配额，替换原有文件后释放原文件占用的空间
+	if err := checkFileSizeQuota(s.target, s.received); err != nil {
+		return nil, err
+	}
+	var oldSize int64
+	if info, err := os.Lstat(s.target); err == nil {
+		oldSize = info.Size()
+	} else if err := checkNewEntryQuota(s.target); err != nil {
+		return nil, err
+	}
+	if err := s.staged.Chmod(mode); err != nil {
+		return nil, err
+	}
+	if err := s.staged.Close(); err != nil {
+		return nil, err
+	}
+	rec, err := beginHistory("upload_file", s.target)
+	if err != nil {
+		return nil, err
+	}
+	if err := rec.finish(placeUpload(s.staged.Name(), s.target, mode)); err != nil {
+		// 暂存文件已关闭，会话无法继续
+		releaseUploadQuota(s)
+		removeUpload(s)
+		return nil, err
+	}
+	releaseRootBytes(s.target, oldSize)
+	removeUpload(s)
+	return &BinaryWriteResult{File: DisplayPath(s.target), Size: s.received, SHA256: digest}, nil
+}
+
+// 取消上传并删除已接收的内容
+func CancelUpload(id string) error {
+	s, err := lookupUpload(id)
+	if err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	s.staged.Close()
+	releaseUploadQuota(s)
+	removeUpload(s)
+	return nil
+}
+
+// 把暂存文件移动到目标位置。暂存文件与目标位于同一目录，通常直接重命名；
+// 重命名失败时先复制到目标目录中的临时文件再重命名，保证目标不会出现不完整的内容
+func placeUpload(staged string, target string, mode os.FileMode) error {
+	if err := os.Rename(staged, target); err == nil {
+		return nil
+	}
+	src, err := os.Open(staged)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmpFile, err := os.CreateTemp(filepath.Dir(target), "tmp_*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+	if _, err := io.Copy(tmpFile, src); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Chmod(mode); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, target)
+}
+
+// 列出进行中的上传
+func ListUploads() []UploadStatus {
+	uploadMu.Lock()
+	expireUploadsLocked()
+	sessions := make([]*uploadSession, 0, len(uploadSessions))
+	for _, s := range uploadSessions {
+		sessions = append(sessions, s)
+	}
+	uploadMu.Unlock()
+
+	// 会话的锁在uploadMu之外获取，与FinishUpload的加锁顺序一致
+	result := make([]UploadStatus, 0, len(sessions))
+	for _, s := range sessions {
+		s.mu.Lock()
+		if !s.done {
+			result = append(result, *s.status())
+		}
+		s.mu.Unlock()
+	}
+	return result
+}
+
+func (s *uploadSession) status() *UploadStatus {
+	return &UploadStatus{
+		UploadID:  s.id,
+		File:      DisplayPath(s.target),
+		Received:  s.received,
+		Size:      s.size,
+		Overwrite: s.overwrite,
+		ExpiresAt: s.touched.Add(UploadSessionTTL),
+	}
+}
+
+// 查找上传会话并锁定，调用者需要释放s.mu
+func lookupUpload(id string) (*uploadSession, error) {
+	uploadMu.Lock()
+	expireUploadsLocked()
+	s, ok := uploadSessions[id]
+	uploadMu.Unlock()
+	if ok {
+		s.mu.Lock()
+		if !s.done {
+			return s, nil
+		}
+		s.mu.Unlock()
+	}
+	return nil, fmt.Errorf("upload %s not found or expired", id)
+}
+
+// 释放会话在根目录配额中预留的空间，调用者需要持有s.mu
+func releaseUploadQuota(s *uploadSession) {
+	releaseRootBytes(s.target, s.received)
+}
+
+// 删除会话和暂存文件，调用者需要持有s.mu
+func removeUpload(s *uploadSession) {
+	s.done = true
+	uploadMu.Lock()
+	delete(uploadSessions, s.id)
+	uploadMu.Unlock()
+	os.Remove(s.staged.Name())
+}
+
+// 清理过期的上传会话，调用者需要持有uploadMu
+func expireUploadsLocked() {
+	now := time.Now()
+	for id, s := range uploadSessions {
+		if !s.mu.TryLock() {
+			continue
+		}
+		if now.Sub(s.touched) > UploadSessionTTL {
+			s.done = true
+			s.staged.Close()
+			releaseUploadQuota(s)
+			os.Remove(s.staged.Name())
+			delete(uploadSessions, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to create upload id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,217 @@
+package filesys
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// 开始一个上传，测试结束时取消仍未完成的会话
+func beginTestUpload(t *testing.T, path string, size int64, overwrite bool) string {
+	t.Helper()
+	status, err := BeginUpload(path, size, "", overwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { CancelUpload(status.UploadID) })
+	return status.UploadID
+}
+
+func sendChunk(t *testing.T, id string, offset int64, data string) *UploadStatus {
+	t.Helper()
+	status, err := UploadChunk(id, offset, base64.StdEncoding.EncodeToString([]byte(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+// 缓存中根目录的占用，与重新统计的结果比较可以发现预留的空间没有正确释放
+func cachedRootBytes(t *testing.T, root string) int64 {
+	t.Helper()
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	usage := rootUsages[root]
+	if usage == nil {
+		t.Fatal("root usage is not cached")
+	}
+	return usage.bytes
+}
+
+func measuredRootBytes(t *testing.T) int64 {
+	t.Helper()
+	report, err := GetQuota()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report.Roots[0].Bytes
+}
+
+func stagedUploads(t *testing.T, dir string) []string {
+	t.Helper()
+	staged, err := filepath.Glob(filepath.Join(dir, ".mcp-upload-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return staged
+}
+
+func TestUploadResendsChunks(t *testing.T) {
+	root := setupLockRoot(t)
+	target := filepath.Join(root, "out.bin")
+	id := beginTestUpload(t, target, 11, false)
+
+	sendChunk(t, id, 0, "hello")
+	sendChunk(t, id, 5, " wor")
+	// 较小的offset覆盖已接收的内容，已接收的字节数不变
+	if status := sendChunk(t, id, 5, " WOR"); status.Received != 9 {
+		t.Errorf("received = %d after resend, want 9", status.Received)
+	}
+	if _, err := UploadChunk(id, 10, base64.StdEncoding.EncodeToString([]byte("d"))); err == nil {
+		t.Error("chunk leaving a gap accepted")
+	}
+	if _, err := UploadChunk(id, 9, base64.StdEncoding.EncodeToString([]byte("ld!"))); err == nil {
+		t.Error("chunk beyond the declared size accepted")
+	}
+	sendChunk(t, id, 9, "ld")
+
+	result, err := FinishUpload(id, sha256Hex("hello WORld"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Size != 11 || result.SHA256 != sha256Hex("hello WORld") {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "hello WORld" {
+		t.Errorf("content = %q", got)
+	}
+	if staged := stagedUploads(t, root); len(staged) != 0 {
+		t.Errorf("staging files left behind: %v", staged)
+	}
+}
+
+func TestUploadChecksumMismatchKeepsSession(t *testing.T) {
+	root := setupLockRoot(t)
+	target := filepath.Join(root, "out.bin")
+	id := beginTestUpload(t, target, 0, false)
+	sendChunk(t, id, 0, "good ")
+	sendChunk(t, id, 5, "bXd")
+
+	_, err := FinishUpload(id, sha256Hex("good bad"))
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("error = %v, want checksum mismatch", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("target created after checksum mismatch: %v", err)
+	}
+	uploads := ListUploads()
+	if len(uploads) != 1 || uploads[0].UploadID != id || uploads[0].Received != 8 {
+		t.Fatalf("session not kept: %+v", uploads)
+	}
+
+	// 重传损坏的分块后可以正常完成
+	sendChunk(t, id, 5, "bad")
+	if _, err := FinishUpload(id, sha256Hex("good bad")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "good bad" {
+		t.Errorf("content = %q", got)
+	}
+	if uploads := ListUploads(); len(uploads) != 0 {
+		t.Errorf("finished session still listed: %+v", uploads)
+	}
+}
+
+func TestUploadExpires(t *testing.T) {
+	root := setupBatchTree(t)
+	if err := SetQuota(QuotaConfig{MaxRootBytes: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetQuota(QuotaConfig{}) })
+	id := beginTestUpload(t, filepath.Join(root, "out.bin"), 0, false)
+	sendChunk(t, id, 0, strings.Repeat("z", 30))
+	if got := cachedRootBytes(t, root); got != 250 {
+		t.Fatalf("usage = %d with the chunk reserved, want 250", got)
+	}
+
+	s, err := lookupUpload(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.touched = time.Now().Add(-UploadSessionTTL - time.Minute)
+	s.mu.Unlock()
+
+	if uploads := ListUploads(); len(uploads) != 0 {
+		t.Errorf("expired session still listed: %+v", uploads)
+	}
+	if _, err := UploadChunk(id, 30, base64.StdEncoding.EncodeToString([]byte("z"))); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("chunk for expired upload: got %v", err)
+	}
+	if staged := stagedUploads(t, root); len(staged) != 0 {
+		t.Errorf("staging files left behind: %v", staged)
+	}
+	if got := cachedRootBytes(t, root); got != 220 {
+		t.Errorf("usage = %d after expiry, want the reservation released (220)", got)
+	}
+}
+
+func TestUploadQuotaReservation(t *testing.T) {
+	// setupBatchTree 的文件共220字节
+	root := setupBatchTree(t)
+	if err := SetQuota(QuotaConfig{MaxRootBytes: 300}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetQuota(QuotaConfig{}) })
+
+	id := beginTestUpload(t, filepath.Join(root, "out.bin"), 0, false)
+	sendChunk(t, id, 0, strings.Repeat("z", 50))
+	if got := cachedRootBytes(t, root); got != 270 {
+		t.Fatalf("usage = %d after the first chunk, want 270", got)
+	}
+	// 重传已接收的范围不会再次预留
+	sendChunk(t, id, 0, strings.Repeat("y", 50))
+	if got := cachedRootBytes(t, root); got != 270 {
+		t.Errorf("usage = %d after a resend, want 270", got)
+	}
+	_, err := UploadChunk(id, 50, base64.StdEncoding.EncodeToString([]byte(strings.Repeat("z", 40))))
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("chunk over the root quota: got %v", err)
+	}
+	if got, want := cachedRootBytes(t, root), measuredRootBytes(t); got != want || got != 270 {
+		t.Errorf("usage = %d, measured %d; want 270", got, want)
+	}
+
+	if err := CancelUpload(id); err != nil {
+		t.Fatal(err)
+	}
+	if got := cachedRootBytes(t, root); got != 220 {
+		t.Errorf("usage = %d after cancel, want 220", got)
+	}
+	if staged := stagedUploads(t, root); len(staged) != 0 {
+		t.Errorf("staging files left behind: %v", staged)
+	}
+
+	// 覆盖已有文件时，完成后释放原文件占用的空间
+	id = beginTestUpload(t, filepath.Join(root, "big.bin"), 0, true)
+	sendChunk(t, id, 0, strings.Repeat("n", 70))
+	if got := cachedRootBytes(t, root); got != 290 {
+		t.Errorf("usage = %d while replacing big.bin, want 290", got)
+	}
+	if _, err := FinishUpload(id, sha256Hex(strings.Repeat("n", 70))); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cachedRootBytes(t, root), measuredRootBytes(t); got != want || got != 90 {
+		t.Errorf("usage = %d, measured %d after replacing big.bin; want 90", got, want)
+	}
+}
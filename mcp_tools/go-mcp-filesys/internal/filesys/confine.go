@@ -0,0 +1,167 @@
+package filesys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 符号链接策略
+type SymlinkPolicy string
+
+const (
+	// 跟随符号链接，但解析后的目标必须仍在同一个根目录内
+	SymlinkFollow SymlinkPolicy = "follow"
+	// 拒绝访问根目录内任何经过符号链接的路径
+	SymlinkDeny SymlinkPolicy = "deny"
+)
+
+// 解析符号链接的最大次数，防止循环链接
+const maxSymlinkHops = 255
+
+var symlinkPolicy = SymlinkFollow
+
+// 解析符号链接策略
+func ParseSymlinkPolicy(policy string) (SymlinkPolicy, error) {
+	switch SymlinkPolicy(strings.ToLower(strings.TrimSpace(policy))) {
+	case "", SymlinkFollow:
+		return SymlinkFollow, nil
+	case SymlinkDeny:
+		return SymlinkDeny, nil
+	default:
+		return "", fmt.Errorf("invalid symlink policy: %s", policy)
+	}
+}
+
+// 设置符号链接策略
+func SetSymlinkPolicy(policy SymlinkPolicy) {
+	folderMutex.Lock()
+	defer folderMutex.Unlock()
+	symlinkPolicy = policy
+}
+
+func currentSymlinkPolicy() SymlinkPolicy {
+	folderMutex.RLock()
+	defer folderMutex.RUnlock()
+	return symlinkPolicy
+}
+
+// 检查路径是否在目录内（按路径分量比较，"a..b" 这样的名称不会被误判）
+func isPathWithin(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// 将路径限制在根目录内，返回解析符号链接后的真实路径。
+// 已存在的路径分量逐个用Lstat检查并解析符号链接，包括悬空的符号链接；
+// 不存在的分量原样拼接，因此尚未创建的目标同样会被检查
+func confinePath(path string, root string) (string, error) {
+	cleanPath := filepath.Clean(path)
+	cleanRoot := filepath.Clean(root)
+	if !isPathWithin(cleanPath, cleanRoot) {
+		return "", fmt.Errorf("access denied: %s is outside %s", path, root)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(cleanRoot)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve root %s: %w", root, err)
+	}
+
+	rel, err := filepath.Rel(cleanRoot, cleanPath)
+	if err != nil {
+		return "", fmt.Errorf("access denied: %s", path)
+	}
+
+	resolved, sawSymlink, err := resolveComponents(realRoot, rel)
+	if err != nil {
+		return "", err
+	}
+	if sawSymlink && currentSymlinkPolicy() == SymlinkDeny {
+		return "", fmt.Errorf("access denied: %s contains a symbolic link", path)
+	}
+	if !isPathWithin(resolved, realRoot) {
+		return "", fmt.Errorf("access denied: %s resolves outside %s", path, root)
+	}
+	return resolved, nil
+}
+
+// 从base开始逐个解析rel中的路径分量，返回解析后的路径以及是否经过了符号链接
+func resolveComponents(base string, rel string) (string, bool, error) {
+	components := splitPathComponents(rel)
+	resolved := base
+	sawSymlink := false
+	hops := 0
+	exists := true
+
+	for len(components) > 0 {
+		c := components[0]
+		components = components[1:]
+
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, c)
+		if !exists {
+			resolved = next
+			continue
+		}
+
+		info, err := os.Lstat(next)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// 之后的分量都不存在，不会再有符号链接
+				exists = false
+				resolved = next
+				continue
+			}
+			return "", false, fmt.Errorf("failed to access %s: %w", next, err)
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		sawSymlink = true
+		hops++
+		if hops > maxSymlinkHops {
+			return "", false, fmt.Errorf("too many levels of symbolic links: %s", next)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read symbolic link %s: %w", next, err)
+		}
+		if filepath.IsAbs(target) {
+			resolved = filepath.VolumeName(target) + string(filepath.Separator)
+			target = target[len(filepath.VolumeName(target)):]
+		}
+		components = append(splitPathComponents(target), components...)
+	}
+	return filepath.Clean(resolved), sawSymlink, nil
+}
+
+func splitPathComponents(p string) []string {
+	return strings.Split(filepath.ToSlash(p), "/")
+}
+
+// 解析路径并找到它所属的根目录，符号链接解析后的目标必须仍在同一个根目录内
+func resolveAllowedPath(path string) (string, *Root, error) {
+	root := rootForPath(path)
+	if root == nil {
+		return "", nil, fmt.Errorf("access denied: %s", path)
+	}
+	resolved, err := confinePath(path, root.Path)
+	if err != nil {
+		return "", nil, err
+	}
+	return resolved, root, nil
+}
@@ -0,0 +1,186 @@
+package filesys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 构造测试目录：
+//
+//	base/
+//	  outside/secret.txt
+//	  root/
+//	    inside.txt
+//	    a..b.txt
+//	    sub/
+//	    link_inside      -> sub
+//	    link_outside     -> ../outside
+//	    link_etc         -> /etc
+//	    link_file_out    -> ../outside/secret.txt
+//	    link_rel_escape  -> sub/../../outside
+//	    link_chain       -> link_outside
+//	    dangling_out     -> ../outside/new.txt
+//	    dangling_in      -> sub/new.txt
+//	    loop_a           -> loop_b
+//	    loop_b           -> loop_a
+func setupConfineTree(t *testing.T) (string, string) {
+	t.Helper()
+	base := t.TempDir()
+	outside := filepath.Join(base, "outside")
+	root := filepath.Join(base, "root")
+	for _, dir := range []string{outside, filepath.Join(root, "sub")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(outside, "secret.txt"), filepath.Join(root, "inside.txt"), filepath.Join(root, "a..b.txt")} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"link_inside":     "sub",
+		"link_outside":    filepath.Join("..", "outside"),
+		"link_etc":        "/etc",
+		"link_file_out":   filepath.Join("..", "outside", "secret.txt"),
+		"link_rel_escape": filepath.Join("sub", "..", "..", "outside"),
+		"link_chain":      "link_outside",
+		"dangling_out":    filepath.Join("..", "outside", "new.txt"),
+		"dangling_in":     filepath.Join("sub", "new.txt"),
+		"loop_a":          "loop_b",
+		"loop_b":          "loop_a",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	if err := SetRoots([]Root{{Name: "ws", Path: root, Mode: RootModeReadWrite}}); err != nil {
+		t.Fatal(err)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return realRoot, outside
+}
+
+func TestResolvePathConfinement(t *testing.T) {
+	root, outside := setupConfineTree(t)
+	defer SetSymlinkPolicy(SymlinkFollow)
+
+	tests := []struct {
+		name    string
+		path    string
+		policy  SymlinkPolicy
+		want    string
+		wantErr bool
+	}{
+		{name: "plain file", path: "inside.txt", policy: SymlinkFollow, want: filepath.Join(root, "inside.txt")},
+		{name: "name containing dots", path: "a..b.txt", policy: SymlinkFollow, want: filepath.Join(root, "a..b.txt")},
+		{name: "root prefix", path: "ws:sub", policy: SymlinkFollow, want: filepath.Join(root, "sub")},
+		{name: "not yet existing file", path: "sub/new/deep.txt", policy: SymlinkFollow, want: filepath.Join(root, "sub", "new", "deep.txt")},
+		{name: "dot dot inside root", path: "sub/../inside.txt", policy: SymlinkFollow, want: filepath.Join(root, "inside.txt")},
+		{name: "parent traversal", path: "../outside/secret.txt", policy: SymlinkFollow, wantErr: true},
+		{name: "parent traversal with root prefix", path: "ws:../outside/secret.txt", policy: SymlinkFollow, wantErr: true},
+		{name: "deep parent traversal", path: "sub/../../outside", policy: SymlinkFollow, wantErr: true},
+		{name: "absolute path outside", path: filepath.Join(outside, "secret.txt"), policy: SymlinkFollow, wantErr: true},
+		{name: "absolute system path", path: "/etc/passwd", policy: SymlinkFollow, wantErr: true},
+		{name: "symlink dir outside", path: "link_outside/secret.txt", policy: SymlinkFollow, wantErr: true},
+		{name: "symlink to /etc", path: "link_etc/passwd", policy: SymlinkFollow, wantErr: true},
+		{name: "symlink file outside", path: "link_file_out", policy: SymlinkFollow, wantErr: true},
+		{name: "relative symlink escape", path: "link_rel_escape/secret.txt", policy: SymlinkFollow, wantErr: true},
+		{name: "symlink chain outside", path: "link_chain/secret.txt", policy: SymlinkFollow, wantErr: true},
+		{name: "new file under outside symlink", path: "link_outside/created.txt", policy: SymlinkFollow, wantErr: true},
+		{name: "dangling symlink outside", path: "dangling_out", policy: SymlinkFollow, wantErr: true},
+		{name: "dangling symlink inside", path: "dangling_in", policy: SymlinkFollow, want: filepath.Join(root, "sub", "new.txt")},
+		{name: "symlink loop", path: "loop_a/file", policy: SymlinkFollow, wantErr: true},
+		{name: "symlink inside followed", path: "link_inside/x.txt", policy: SymlinkFollow, want: filepath.Join(root, "sub", "x.txt")},
+		{name: "symlink inside denied", path: "link_inside/x.txt", policy: SymlinkDeny, wantErr: true},
+		{name: "dangling symlink inside denied", path: "dangling_in", policy: SymlinkDeny, wantErr: true},
+		{name: "plain file with deny policy", path: "inside.txt", policy: SymlinkDeny, want: filepath.Join(root, "inside.txt")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetSymlinkPolicy(tt.policy)
+			got, err := ResolvePath(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ResolvePath(%q) = %q, want error", tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolvePath(%q) returned error: %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Fatalf("ResolvePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperationsRejectSymlinkEscapes(t *testing.T) {
+	root, outside := setupConfineTree(t)
+	defer SetSymlinkPolicy(SymlinkFollow)
+	SetSymlinkPolicy(SymlinkFollow)
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{name: "read through outside symlink", op: func() error {
+			_, err := ReadFile(filepath.Join(root, "link_file_out"), ReadFileOptions{})
+			return err
+		}},
+		{name: "write through outside symlink", op: func() error {
+			_, err := WriteFile(filepath.Join(root, "link_file_out"), "pwned", "", TextOptions{})
+			return err
+		}},
+		{name: "create through dangling symlink", op: func() error {
+			_, err := CreateNewFile(filepath.Join(root, "link_outside", "created.txt"), "pwned", TextOptions{})
+			return err
+		}},
+		{name: "copy outside file in", op: func() error {
+			return CopyFile(filepath.Join(root, "link_file_out"), filepath.Join(root, "copy.txt"))
+		}},
+		{name: "delete through outside symlink", op: func() error {
+			return DeleteFile(filepath.Join(root, "link_outside", "secret.txt"))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); err == nil {
+				t.Fatalf("%s: expected access denied error", tt.name)
+			}
+		})
+	}
+
+	content, err := os.ReadFile(filepath.Join(outside, "secret.txt"))
+	if err != nil || string(content) != "x" {
+		t.Fatalf("file outside root was modified: %q, %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "created.txt")); !os.IsNotExist(err) {
+		t.Fatalf("file was created outside root")
+	}
+}
+
+func TestSearchSkipsOutsideSymlinks(t *testing.T) {
+	root, _ := setupConfineTree(t)
+	SetSymlinkPolicy(SymlinkFollow)
+
+	result, err := SearchFileContent(root, SearchOptions{Pattern: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range result.Matches {
+		if m.Path == "link_file_out" {
+			t.Fatalf("search followed symlink outside root: %+v", m)
+		}
+	}
+}
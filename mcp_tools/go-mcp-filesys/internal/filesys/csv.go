@@ -0,0 +1,836 @@
+package filesys
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 查询CSV时读取的最大文件大小和返回的行数
+const (
+	MaxCSVBytes     int64 = 100 * 1024 * 1024
+	DefaultCSVLimit       = 100
+	MaxCSVLimit           = 10000
+)
+
+// 推断出的列类型
+const (
+	ColumnInteger = "integer"
+	ColumnNumber  = "number"
+	ColumnBoolean = "boolean"
+	ColumnDate    = "date"
+	ColumnString  = "string"
+)
+
+// 支持的日期格式，按顺序尝试
+var csvDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006/01/02",
+}
+
+// 查询CSV文件的选项
+type CSVQueryOptions struct {
+	// 分隔符，为空时按扩展名和第一行内容推断
+	Delimiter string
+	// 第一行是否为表头，否则列名为 column1、column2...
+	NoHeader bool
+	// 返回的列，为空表示全部。分组时不使用
+	Columns []string
+	// 过滤条件，形如 "age >= 30"、"name contains li"，多个条件同时满足
+	Filters []string
+	// 分组列和聚合，聚合形如 count、sum(price)、avg(price)、min(x)、max(x)、count(x)、count_distinct(x)
+	GroupBy    []string
+	Aggregates []string
+	// 排序，"col" 为升序，"-col" 或 "col desc" 为降序，可以使用聚合名
+	SortBy []string
+	Limit  int
+	Offset int
+}
+
+// 列名和推断出的类型
+type CSVColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// 查询结果，Rows中的键按Columns的顺序输出
+type CSVQueryResult struct {
+	File      string      `json:"file"`
+	Columns   []CSVColumn `json:"columns"`
+	Rows      []CSVRow    `json:"rows"`
+	TotalRows int         `json:"total_rows"`
+	Matched   int         `json:"matched_rows"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// 一行结果，按列顺序序列化为JSON对象
+type CSVRow struct {
+	keys   []string
+	values []any
+}
+
+func (r CSVRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// 按推断出的类型转换后的单元格，Null表示空单元格
+type csvValue struct {
+	Null bool
+	Str  string
+	Num  float64
+	Bool bool
+	Time time.Time
+}
+
+type csvFilter struct {
+	column int
+	op     string
+	value  string
+}
+
+type csvAggregate struct {
+	name   string
+	fn     string
+	column int
+}
+
+// 查询CSV文件：推断列类型，按条件过滤、分组聚合、排序，返回JSON行
+func QueryCSV(filePath string, opts CSVQueryOptions) (*CSVQueryResult, error) {
+	if !isPathInAllowedDirectory(filePath) {
+		return nil, fmt.Errorf("access denied: %s", filePath)
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %s", filePath)
+	}
+	if info.Size() > MaxCSVBytes {
+		return nil, fmt.Errorf("file is too large to query (%d bytes, limit %d)", info.Size(), MaxCSVBytes)
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultCSVLimit
+	}
+	if opts.Limit > MaxCSVLimit {
+		opts.Limit = MaxCSVLimit
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+	delimiter, err := csvDelimiter(filePath, data, opts.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+	names, records, err := readCSV(data, delimiter, !opts.NoHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	types := inferColumnTypes(records, len(names))
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		if _, ok := index[name]; !ok {
+			index[name] = i
+		}
+	}
+	lookup := func(name string) (int, error) {
+		if i, ok := index[name]; ok {
+			return i, nil
+		}
+		return -1, fmt.Errorf("unknown column %q (columns: %s)", name, strings.Join(names, ", "))
+	}
+
+	filters := make([]csvFilter, 0, len(opts.Filters))
+	for _, expr := range opts.Filters {
+		f, err := parseCSVFilter(expr, lookup)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+
+	rows := make([][]csvValue, len(records))
+	for i, record := range records {
+		rows[i] = convertCSVRecord(record, types)
+	}
+	matched := make([][]csvValue, 0, len(rows))
+	for _, row := range rows {
+		if matchCSVRow(row, filters, types) {
+			matched = append(matched, row)
+		}
+	}
+
+	result := &CSVQueryResult{File: DisplayPath(filePath), TotalRows: len(rows), Matched: len(matched)}
+	var outKeys []string
+	var outTypes []string
+	var outRows [][]csvValue
+	if len(opts.GroupBy) > 0 || len(opts.Aggregates) > 0 {
+		outKeys, outTypes, outRows, err = groupCSVRows(matched, opts, names, types, lookup)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		selected := make([]int, 0, len(names))
+		if len(opts.Columns) == 0 {
+			for i := range names {
+				selected = append(selected, i)
+			}
+		}
+		for _, name := range opts.Columns {
+			i, err := lookup(name)
+			if err != nil {
+				return nil, err
+			}
+			selected = append(selected, i)
+		}
+		// 排序可以使用未选择的列，因此先排序再选择列
+		if err := sortCSVRows(matched, opts.SortBy, types, lookup); err != nil {
+			return nil, err
+		}
+		for _, i := range selected {
+			outKeys = append(outKeys, names[i])
+			outTypes = append(outTypes, types[i])
+		}
+		outRows = make([][]csvValue, len(matched))
+		for r, row := range matched {
+			out := make([]csvValue, len(selected))
+			for j, i := range selected {
+				out[j] = row[i]
+			}
+			outRows[r] = out
+		}
+	}
+
+	result.Columns = make([]CSVColumn, len(outKeys))
+	for i := range outKeys {
+		result.Columns[i] = CSVColumn{Name: outKeys[i], Type: outTypes[i]}
+	}
+	if opts.Offset > len(outRows) {
+		opts.Offset = len(outRows)
+	}
+	outRows = outRows[opts.Offset:]
+	if len(outRows) > opts.Limit {
+		outRows = outRows[:opts.Limit]
+		result.Truncated = true
+	}
+	result.Rows = make([]CSVRow, len(outRows))
+	for i, row := range outRows {
+		values := make([]any, len(row))
+		for j, v := range row {
+			values[j] = v.jsonValue(outTypes[j])
+		}
+		result.Rows[i] = CSVRow{keys: outKeys, values: values}
+	}
+	return result, nil
+}
+
+// 确定分隔符：参数优先，其次 .tsv 扩展名，最后取第一行中出现最多的候选字符
+func csvDelimiter(filePath string, data []byte, delimiter string) (rune, error) {
+	switch delimiter {
+	case "":
+	case `\t`, "tab":
+		return '\t', nil
+	default:
+		r := []rune(delimiter)
+		if len(r) != 1 || r[0] == '"' || r[0] == '\r' || r[0] == '\n' {
+			return 0, fmt.Errorf("invalid delimiter %q", delimiter)
+		}
+		return r[0], nil
+	}
+	if strings.EqualFold(filepath.Ext(filePath), ".tsv") {
+		return '\t', nil
+	}
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	best, bestCount := ',', 0
+	for _, c := range []rune{',', '\t', ';', '|'} {
+		if n := bytes.Count(firstLine, []byte(string(c))); n > bestCount {
+			best, bestCount = c, n
+		}
+	}
+	return best, nil
+}
+
+// 读取所有记录，列数不足的行补空，多出的列自动命名
+func readCSV(data []byte, delimiter rune, header bool) ([]string, [][]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.ReuseRecord = false
+
+	var names []string
+	records := make([][]string, 0)
+	width := 0
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		if header && names == nil {
+			names = make([]string, len(record))
+			for i, name := range record {
+				names[i] = strings.TrimSpace(name)
+			}
+			width = len(names)
+			continue
+		}
+		if len(record) > width {
+			width = len(record)
+		}
+		records = append(records, record)
+	}
+	for i := range names {
+		if names[i] == "" {
+			names[i] = "column" + strconv.Itoa(i+1)
+		}
+	}
+	for i := len(names); i < width; i++ {
+		names = append(names, "column"+strconv.Itoa(i+1))
+	}
+	for i, record := range records {
+		for len(record) < width {
+			record = append(record, "")
+		}
+		records[i] = record
+	}
+	return names, records, nil
+}
+
+// 按列推断类型：所有非空单元格都能解析为某种类型时使用该类型，否则为字符串
+func inferColumnTypes(records [][]string, width int) []string {
+	types := make([]string, width)
+	for col := 0; col < width; col++ {
+		isInt, isNum, isBool, isDate, seen := true, true, true, true, false
+		for _, record := range records {
+			cell := strings.TrimSpace(record[col])
+			if cell == "" {
+				continue
+			}
+			seen = true
+			if isInt {
+				if _, err := strconv.ParseInt(cell, 10, 64); err != nil {
+					isInt = false
+				}
+			}
+			if isNum && !isInt {
+				if _, err := parseCSVNumber(cell); err != nil {
+					isNum = false
+				}
+			}
+			if isBool {
+				if _, err := strconv.ParseBool(cell); err != nil {
+					isBool = false
+				}
+			}
+			if isDate {
+				if _, ok := parseCSVDate(cell); !ok {
+					isDate = false
+				}
+			}
+			if !isInt && !isNum && !isBool && !isDate {
+				break
+			}
+		}
+		switch {
+		case !seen:
+			types[col] = ColumnString
+		case isInt:
+			types[col] = ColumnInteger
+		case isNum:
+			types[col] = ColumnNumber
+		case isBool:
+			types[col] = ColumnBoolean
+		case isDate:
+			types[col] = ColumnDate
+		default:
+			types[col] = ColumnString
+		}
+	}
+	return types
+}
+
+func parseCSVNumber(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("not a number: %s", s)
+	}
+	return f, nil
+}
+
+func parseCSVDate(s string) (time.Time, bool) {
+	for _, layout := range csvDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func convertCSVRecord(record []string, types []string) []csvValue {
+	row := make([]csvValue, len(types))
+	for i, t := range types {
+		row[i] = parseCSVValue(record[i], t)
+	}
+	return row
+}
+
+func parseCSVValue(cell string, typ string) csvValue {
+	trimmed := strings.TrimSpace(cell)
+	if trimmed == "" {
+		return csvValue{Null: true}
+	}
+	v := csvValue{Str: cell}
+	switch typ {
+	case ColumnInteger, ColumnNumber:
+		v.Num, _ = parseCSVNumber(trimmed)
+	case ColumnBoolean:
+		v.Bool, _ = strconv.ParseBool(trimmed)
+	case ColumnDate:
+		v.Time, _ = parseCSVDate(trimmed)
+	}
+	return v
+}
+
+func (v csvValue) jsonValue(typ string) any {
+	if v.Null {
+		return nil
+	}
+	switch typ {
+	case ColumnInteger:
+		if v.Num == math.Trunc(v.Num) && math.Abs(v.Num) < 1<<53 {
+			return int64(v.Num)
+		}
+		return v.Num
+	case ColumnNumber:
+		return v.Num
+	case ColumnBoolean:
+		return v.Bool
+	}
+	return v.Str
+}
+
+// 比较两个同类型的值，空值排在最后
+func compareCSVValues(a, b csvValue, typ string) int {
+	switch {
+	case a.Null && b.Null:
+		return 0
+	case a.Null:
+		return 1
+	case b.Null:
+		return -1
+	}
+	switch typ {
+	case ColumnInteger, ColumnNumber:
+		switch {
+		case a.Num < b.Num:
+			return -1
+		case a.Num > b.Num:
+			return 1
+		}
+		return 0
+	case ColumnBoolean:
+		switch {
+		case a.Bool == b.Bool:
+			return 0
+		case !a.Bool:
+			return -1
+		}
+		return 1
+	case ColumnDate:
+		return a.Time.Compare(b.Time)
+	}
+	return strings.Compare(a.Str, b.Str)
+}
+
+var csvFilterOps = []string{">=", "<=", "!=", "==", "=", ">", "<"}
+
+var csvWordOps = []string{"not contains", "contains", "startswith", "endswith", "is not empty", "is empty"}
+
+// 解析 "列 操作符 值" 形式的过滤条件，值可以用引号括起来
+func parseCSVFilter(expr string, lookup func(string) (int, error)) (csvFilter, error) {
+	pos, op := -1, ""
+	lower := strings.ToLower(expr)
+	for _, candidate := range csvWordOps {
+		if i := strings.Index(lower, " "+candidate); i >= 0 && (pos < 0 || i < pos) {
+			rest := lower[i+1+len(candidate):]
+			if rest == "" || rest[0] == ' ' {
+				pos, op = i, candidate
+			}
+		}
+	}
+	for _, candidate := range csvFilterOps {
+		if i := strings.Index(expr, candidate); i > 0 && (pos < 0 || i < pos) {
+			pos, op = i, candidate
+		}
+	}
+	if pos <= 0 {
+		return csvFilter{}, fmt.Errorf("invalid filter %q, expected \"column operator value\" with one of =, !=, >, >=, <, <=, contains, not contains, startswith, endswith, is empty, is not empty", expr)
+	}
+	column := strings.Trim(strings.TrimSpace(expr[:pos]), "`")
+	rest := strings.TrimSpace(expr[pos:])
+	value := strings.TrimSpace(rest[len(op):])
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	if op == "==" {
+		op = "="
+	}
+	col, err := lookup(column)
+	if err != nil {
+		return csvFilter{}, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	return csvFilter{column: col, op: op, value: value}, nil
+}
+
+func matchCSVRow(row []csvValue, filters []csvFilter, types []string) bool {
+	for _, f := range filters {
+		v := row[f.column]
+		switch f.op {
+		case "is empty":
+			if !v.Null {
+				return false
+			}
+			continue
+		case "is not empty":
+			if v.Null {
+				return false
+			}
+			continue
+		}
+		if v.Null {
+			if f.op == "!=" || f.op == "not contains" {
+				continue
+			}
+			return false
+		}
+		cell, value := strings.ToLower(v.Str), strings.ToLower(f.value)
+		switch f.op {
+		case "contains":
+			if !strings.Contains(cell, value) {
+				return false
+			}
+			continue
+		case "not contains":
+			if strings.Contains(cell, value) {
+				return false
+			}
+			continue
+		case "startswith":
+			if !strings.HasPrefix(cell, value) {
+				return false
+			}
+			continue
+		case "endswith":
+			if !strings.HasSuffix(cell, value) {
+				return false
+			}
+			continue
+		}
+
+		// 比较运算按列类型进行，条件值无法按该类型解析时按字符串比较
+		typ := types[f.column]
+		target := parseCSVValue(f.value, typ)
+		if target.Null || !validCSVValue(f.value, typ) {
+			typ = ColumnString
+			target = csvValue{Str: f.value}
+		}
+		c := compareCSVValues(v, target, typ)
+		var ok bool
+		switch f.op {
+		case "=":
+			ok = c == 0
+		case "!=":
+			ok = c != 0
+		case ">":
+			ok = c > 0
+		case ">=":
+			ok = c >= 0
+		case "<":
+			ok = c < 0
+		case "<=":
+			ok = c <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func validCSVValue(s string, typ string) bool {
+	s = strings.TrimSpace(s)
+	switch typ {
+	case ColumnInteger, ColumnNumber:
+		_, err := parseCSVNumber(s)
+		return err == nil
+	case ColumnBoolean:
+		_, err := strconv.ParseBool(s)
+		return err == nil
+	case ColumnDate:
+		_, ok := parseCSVDate(s)
+		return ok
+	}
+	return true
+}
+
+// 解析排序字段，返回列位置和是否降序
+func parseCSVSort(spec string) (string, bool) {
+	spec = strings.TrimSpace(spec)
+	lower := strings.ToLower(spec)
+	switch {
+	case strings.HasPrefix(spec, "-"):
+		return strings.TrimSpace(spec[1:]), true
+	case strings.HasSuffix(lower, " desc"):
+		return strings.TrimSpace(spec[:len(spec)-5]), true
+	case strings.HasSuffix(lower, " asc"):
+		return strings.TrimSpace(spec[:len(spec)-4]), false
+	}
+	return spec, false
+}
+
+func sortCSVRows(rows [][]csvValue, specs []string, types []string, lookup func(string) (int, error)) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	type sortKey struct {
+		column int
+		desc   bool
+	}
+	keys := make([]sortKey, 0, len(specs))
+	for _, spec := range specs {
+		name, desc := parseCSVSort(spec)
+		col, err := lookup(name)
+		if err != nil {
+			return fmt.Errorf("invalid sort %q: %w", spec, err)
+		}
+		keys = append(keys, sortKey{column: col, desc: desc})
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range keys {
+			a, b := rows[i][k.column], rows[j][k.column]
+			c := compareCSVValues(a, b, types[k.column])
+			if c == 0 {
+				continue
+			}
+			// 空值始终排在最后
+			if k.desc && !a.Null && !b.Null {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+func parseCSVAggregate(spec string, lookup func(string) (int, error)) (csvAggregate, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.EqualFold(spec, "count") || strings.EqualFold(spec, "count(*)") {
+		return csvAggregate{name: "count", fn: "count", column: -1}, nil
+	}
+	open := strings.Index(spec, "(")
+	if open <= 0 || !strings.HasSuffix(spec, ")") {
+		return csvAggregate{}, fmt.Errorf("invalid aggregate %q, expected count or fn(column) with fn one of sum, avg, min, max, count, count_distinct", spec)
+	}
+	fn := strings.ToLower(strings.TrimSpace(spec[:open]))
+	switch fn {
+	case "sum", "avg", "min", "max", "count", "count_distinct":
+	default:
+		return csvAggregate{}, fmt.Errorf("unsupported aggregate function %q", fn)
+	}
+	column := strings.TrimSpace(spec[open+1 : len(spec)-1])
+	col, err := lookup(column)
+	if err != nil {
+		return csvAggregate{}, fmt.Errorf("invalid aggregate %q: %w", spec, err)
+	}
+	return csvAggregate{name: fn + "(" + column + ")", fn: fn, column: col}, nil
+}
+
+// 按分组列聚合，分组按首次出现的顺序输出，再按SortBy排序
+func groupCSVRows(rows [][]csvValue, opts CSVQueryOptions, names []string, types []string, lookup func(string) (int, error)) ([]string, []string, [][]csvValue, error) {
+	groupCols := make([]int, 0, len(opts.GroupBy))
+	for _, name := range opts.GroupBy {
+		col, err := lookup(name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		groupCols = append(groupCols, col)
+	}
+	specs := opts.Aggregates
+	if len(specs) == 0 {
+		specs = []string{"count"}
+	}
+	aggs := make([]csvAggregate, 0, len(specs))
+	for _, spec := range specs {
+		agg, err := parseCSVAggregate(spec, lookup)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if (agg.fn == "sum" || agg.fn == "avg") && types[agg.column] != ColumnInteger && types[agg.column] != ColumnNumber {
+			return nil, nil, nil, fmt.Errorf("%s requires a numeric column, %s is %s", agg.name, names[agg.column], types[agg.column])
+		}
+		aggs = append(aggs, agg)
+	}
+
+	keys := make([]string, 0, len(groupCols)+len(aggs))
+	outTypes := make([]string, 0, cap(keys))
+	for _, col := range groupCols {
+		keys = append(keys, names[col])
+		outTypes = append(outTypes, types[col])
+	}
+	for _, agg := range aggs {
+		keys = append(keys, agg.name)
+		switch agg.fn {
+		case "count", "count_distinct":
+			outTypes = append(outTypes, ColumnInteger)
+		case "avg":
+			outTypes = append(outTypes, ColumnNumber)
+		default:
+			outTypes = append(outTypes, types[agg.column])
+		}
+	}
+
+	type group struct {
+		first []csvValue
+		rows  [][]csvValue
+	}
+	groups := make([]*group, 0)
+	byKey := make(map[string]*group)
+	for _, row := range rows {
+		parts := make([]string, len(groupCols))
+		for i, col := range groupCols {
+			if !row[col].Null {
+				parts[i] = "v" + row[col].Str
+			}
+		}
+		key := strings.Join(parts, "\x00")
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{first: row}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.rows = append(g.rows, row)
+	}
+	// 没有分组列时即使没有匹配的行也返回一行聚合结果
+	if len(groupCols) == 0 && len(groups) == 0 {
+		groups = append(groups, &group{})
+	}
+
+	out := make([][]csvValue, 0, len(groups))
+	for _, g := range groups {
+		row := make([]csvValue, 0, len(keys))
+		for _, col := range groupCols {
+			row = append(row, g.first[col])
+		}
+		for _, agg := range aggs {
+			row = append(row, aggregateCSV(g.rows, agg, types))
+		}
+		out = append(out, row)
+	}
+
+	outIndex := make(map[string]int, len(keys))
+	for i, k := range keys {
+		if _, ok := outIndex[k]; !ok {
+			outIndex[k] = i
+		}
+	}
+	outLookup := func(name string) (int, error) {
+		if i, ok := outIndex[name]; ok {
+			return i, nil
+		}
+		return -1, fmt.Errorf("unknown column %q in grouped result (columns: %s)", name, strings.Join(keys, ", "))
+	}
+	if err := sortCSVRows(out, opts.SortBy, outTypes, outLookup); err != nil {
+		return nil, nil, nil, err
+	}
+	return keys, outTypes, out, nil
+}
+
+func aggregateCSV(rows [][]csvValue, agg csvAggregate, types []string) csvValue {
+	if agg.column < 0 {
+		return csvValue{Num: float64(len(rows)), Str: strconv.Itoa(len(rows))}
+	}
+	typ := types[agg.column]
+	var result csvValue
+	count, sum := 0, 0.0
+	distinct := make(map[string]struct{})
+	for _, row := range rows {
+		v := row[agg.column]
+		if v.Null {
+			continue
+		}
+		count++
+		sum += v.Num
+		distinct[v.Str] = struct{}{}
+		switch agg.fn {
+		case "min":
+			if count == 1 || compareCSVValues(v, result, typ) < 0 {
+				result = v
+			}
+		case "max":
+			if count == 1 || compareCSVValues(v, result, typ) > 0 {
+				result = v
+			}
+		}
+	}
+	switch agg.fn {
+	case "count":
+		return csvValue{Num: float64(count), Str: strconv.Itoa(count)}
+	case "count_distinct":
+		return csvValue{Num: float64(len(distinct)), Str: strconv.Itoa(len(distinct))}
+	case "sum":
+		return csvValue{Num: sum, Str: strconv.FormatFloat(sum, 'g', -1, 64)}
+	case "avg":
+		if count == 0 {
+			return csvValue{Null: true}
+		}
+		avg := sum / float64(count)
+		return csvValue{Num: avg, Str: strconv.FormatFloat(avg, 'g', -1, 64)}
+	}
+	if count == 0 {
+		return csvValue{Null: true}
+	}
+	return result
+}
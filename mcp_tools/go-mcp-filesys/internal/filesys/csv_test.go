@@ -0,0 +1,226 @@
+package filesys
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const csvTestData = "name,age,score,active,joined,team\n" +
+	"alice,30,91.5,true,2023-01-05,red\n" +
+	"bob,25,78,false,2022-11-30,blue\n" +
+	"carol,35,,true,2024-02-01,red\n" +
+	"dave,41,65.25,false,2021-07-15,\n" +
+	"erin,28,88,true,2023-09-09,blue\n"
+
+func TestQueryCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		opts    CSVQueryOptions
+		// 结果行序列化后的JSON
+		want        string
+		wantColumns []CSVColumn
+		wantErr     string
+		check       func(t *testing.T, r *CSVQueryResult)
+	}{
+		{
+			name:    "type inference",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Limit: 1},
+			want:    `[{"name":"alice","age":30,"score":91.5,"active":true,"joined":"2023-01-05","team":"red"}]`,
+			wantColumns: []CSVColumn{
+				{Name: "name", Type: ColumnString},
+				{Name: "age", Type: ColumnInteger},
+				{Name: "score", Type: ColumnNumber},
+				{Name: "active", Type: ColumnBoolean},
+				{Name: "joined", Type: ColumnDate},
+				{Name: "team", Type: ColumnString},
+			},
+			check: func(t *testing.T, r *CSVQueryResult) {
+				if r.TotalRows != 5 || r.Matched != 5 || !r.Truncated {
+					t.Errorf("total = %d, matched = %d, truncated = %v; want 5, 5, true", r.TotalRows, r.Matched, r.Truncated)
+				}
+			},
+		},
+		{
+			name:    "numeric filter and columns",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Columns: []string{"name", "age"}, Filters: []string{"age >= 30"}},
+			want:    `[{"name":"alice","age":30},{"name":"carol","age":35},{"name":"dave","age":41}]`,
+		},
+		{
+			name:    "numbers compare as numbers",
+			content: "n\n9\n10\n100\n",
+			opts:    CSVQueryOptions{Filters: []string{"n > 9"}},
+			want:    `[{"n":10},{"n":100}]`,
+		},
+		{
+			name:    "several filters",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Columns: []string{"name"}, Filters: []string{"active = true", "joined < 2024-01-01", "score != 91.5"}},
+			want:    `[{"name":"erin"}]`,
+		},
+		{
+			name:    "word filters",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Columns: []string{"name"}, Filters: []string{"name contains A", "name not contains ice"}},
+			want:    `[{"name":"carol"},{"name":"dave"}]`,
+		},
+		{
+			name:    "prefix, suffix and quoted values",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Columns: []string{"name"}, Filters: []string{"name startswith 'b'", `team endswith "ue"`}},
+			want:    `[{"name":"bob"}]`,
+		},
+		{
+			name:    "empty cells",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Columns: []string{"name"}, Filters: []string{"score is empty"}},
+			want:    `[{"name":"carol"}]`,
+		},
+		{
+			name:    "not empty",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Columns: []string{"name"}, Filters: []string{"team is not empty", "team != red"}},
+			want:    `[{"name":"bob"},{"name":"erin"}]`,
+		},
+		{
+			name:    "group by with aggregates",
+			content: csvTestData,
+			opts: CSVQueryOptions{
+				GroupBy:    []string{"team"},
+				Aggregates: []string{"count", "sum(age)", "avg(score)", "min(joined)", "max(name)", "count(score)", "count_distinct(active)"},
+			},
+			want: `[{"team":"red","count":2,"sum(age)":65,"avg(score)":91.5,"min(joined)":"2023-01-05","max(name)":"carol","count(score)":1,"count_distinct(active)":1},` +
+				`{"team":"blue","count":2,"sum(age)":53,"avg(score)":83,"min(joined)":"2022-11-30","max(name)":"erin","count(score)":2,"count_distinct(active)":2},` +
+				`{"team":null,"count":1,"sum(age)":41,"avg(score)":65.25,"min(joined)":"2021-07-15","max(name)":"dave","count(score)":1,"count_distinct(active)":1}]`,
+		},
+		{
+			name:    "aggregate without group",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Aggregates: []string{"count", "avg(age)"}, Filters: []string{"age > 100"}},
+			want:    `[{"count":0,"avg(age)":null}]`,
+		},
+		{
+			name:    "sort by aggregate",
+			content: csvTestData,
+			opts:    CSVQueryOptions{GroupBy: []string{"team"}, Aggregates: []string{"sum(age)"}, SortBy: []string{"-sum(age)"}},
+			want:    `[{"team":"red","sum(age)":65},{"team":"blue","sum(age)":53},{"team":null,"sum(age)":41}]`,
+		},
+		{
+			name:    "sum requires numbers",
+			content: csvTestData,
+			opts:    CSVQueryOptions{GroupBy: []string{"team"}, Aggregates: []string{"sum(name)"}},
+			wantErr: "requires a numeric column",
+		},
+		{
+			name:    "sort with empty values last",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Columns: []string{"name"}, SortBy: []string{"score desc"}},
+			want:    `[{"name":"alice"},{"name":"erin"},{"name":"bob"},{"name":"dave"},{"name":"carol"}]`,
+		},
+		{
+			name:    "sort by several columns",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Columns: []string{"name"}, SortBy: []string{"active", "-joined"}},
+			want:    `[{"name":"bob"},{"name":"dave"},{"name":"carol"},{"name":"erin"},{"name":"alice"}]`,
+		},
+		{
+			name:    "limit and offset",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Columns: []string{"name"}, SortBy: []string{"age"}, Offset: 1, Limit: 2},
+			want:    `[{"name":"erin"},{"name":"alice"}]`,
+			check: func(t *testing.T, r *CSVQueryResult) {
+				if !r.Truncated {
+					t.Error("result not reported as truncated")
+				}
+			},
+		},
+		{
+			name:    "offset past the end",
+			content: csvTestData,
+			opts:    CSVQueryOptions{Offset: 10},
+			want:    `[]`,
+		},
+		{
+			name:    "byte order mark",
+			content: "\xEF\xBB\xBFid,v\n1,a\n",
+			want:    `[{"id":1,"v":"a"}]`,
+		},
+		{
+			name:    "semicolon delimiter",
+			content: "a;b\n1,5;x\n",
+			want:    `[{"a":"1,5","b":"x"}]`,
+		},
+		{
+			name:    "tsv extension",
+			file:    "data.tsv",
+			content: "a,b\tc\n1\t2\n",
+			want:    `[{"a,b":1,"c":2}]`,
+		},
+		{
+			name:    "pipe delimiter",
+			content: "a|b\n1|2\n",
+			want:    `[{"a":1,"b":2}]`,
+		},
+		{
+			name:    "explicit delimiter",
+			content: "a;b,c\n1;2,3\n",
+			opts:    CSVQueryOptions{Delimiter: ";"},
+			want:    `[{"a":1,"b,c":"2,3"}]`,
+		},
+		{
+			name:    "no header and ragged rows",
+			content: "1,x\n2,y,extra\n",
+			opts:    CSVQueryOptions{NoHeader: true},
+			want:    `[{"column1":1,"column2":"x","column3":null},{"column1":2,"column2":"y","column3":"extra"}]`,
+		},
+		{
+			name:    "quoted fields",
+			content: "a,b\n\"x, y\",\"say \"\"hi\"\"\"\n",
+			want:    `[{"a":"x, y","b":"say \"hi\""}]`,
+		},
+		{name: "unknown column", content: csvTestData, opts: CSVQueryOptions{Columns: []string{"nope"}}, wantErr: "unknown column"},
+		{name: "invalid filter", content: csvTestData, opts: CSVQueryOptions{Filters: []string{"age"}}, wantErr: "invalid filter"},
+		{name: "invalid aggregate", content: csvTestData, opts: CSVQueryOptions{Aggregates: []string{"median(age)"}}, wantErr: "unsupported aggregate"},
+		{name: "invalid delimiter", content: csvTestData, opts: CSVQueryOptions{Delimiter: `"`}, wantErr: "invalid delimiter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupLockRoot(t)
+			file := tt.file
+			if file == "" {
+				file = "data.csv"
+			}
+			writeTestFiles(t, root, map[string]string{file: tt.content})
+			r, err := QueryCSV(filepath.Join(root, file), tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(r.Rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("rows:\ngot  %s\nwant %s", got, tt.want)
+			}
+			if tt.wantColumns != nil && !reflect.DeepEqual(r.Columns, tt.wantColumns) {
+				t.Errorf("columns = %+v, want %+v", r.Columns, tt.wantColumns)
+			}
+			if tt.check != nil {
+				tt.check(t, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,584 @@
+package filesys
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// unified diff 默认的上下文行数
+const DefaultDiffContext = 3
+
+// 并排格式中每一侧的默认宽度以及允许的范围（字符数）
+const (
+	DefaultDiffWidth = 60
+	MinDiffWidth     = 10
+	MaxDiffWidth     = 500
+)
+
+// 参与比较的文件或内容的最大字节数
+const MaxDiffBytes = MaxReadBytes * 16
+
+// 一次比较中Myers搜索最多检查的位置数。完全不同的大文件的搜索是平方级的，
+// 超出后剩余的部分不再寻找最短的编辑，直接作为整段删除和新增输出（类似GNU diff的 "too expensive" 启发式）
+const maxDiffCost = 1 << 24
+
+// 差异的输出格式
+const (
+	DiffUnified    = "unified"
+	DiffSideBySide = "side-by-side"
+)
+
+// 比较时忽略的空白
+const (
+	// 忽略行尾空白
+	WhitespaceTrailing = "trailing"
+	// 忽略空白数量的变化，连续的空白视为一个空格
+	WhitespaceChange = "change"
+	// 忽略所有空白
+	WhitespaceAll = "all"
+)
+
+// 比较的选项
+type DiffOptions struct {
+	Format string
+	// 每处修改前后保留的相同行数
+	Context    int
+	Whitespace string
+	// 并排格式中每一侧的宽度
+	Width int
+}
+
+// 比较的结果
+type DiffResult struct {
+	Old       string `json:"old"`
+	New       string `json:"new"`
+	Identical bool   `json:"identical"`
+	// 任一侧是二进制内容时只比较字节是否相同
+	Binary  bool   `json:"binary,omitempty"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Hunks   int    `json:"hunks"`
+	Format  string `json:"format"`
+	Diff    string `json:"diff"`
+}
+
+// 差异中的一行：' ' 相同，'-' 删除，'+' 新增。OldLine/NewLine为行号（从1开始）；
+// 删除的行的NewLine和新增的行的OldLine为另一侧在该位置之前的行数
+type diffLine struct {
+	Kind    byte
+	Text    string
+	OldLine int
+	NewLine int
+}
+
+// 用Myers算法（线性空间的分治版本）比较两组行，返回把a变为b的编辑脚本。
+// 行先经过normalize（可以为nil）并映射为整数再比较，没有最后换行符的末行与有换行符的同一行视为不同
+func diffLines(a textLines, b textLines, normalize func(string) string) []diffLine {
+	ids := make(map[string]int)
+	intern := func(t textLines) []int {
+		out := make([]int, len(t.lines))
+		for i, line := range t.lines {
+			key := line
+			if normalize != nil {
+				key = normalize(line)
+			}
+			if t.noFinalEOL && i == len(t.lines)-1 {
+				key += "\x00"
+			}
+			id, ok := ids[key]
+			if !ok {
+				id = len(ids)
+				ids[key] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	m := &myers{a: intern(a), b: intern(b), budget: maxDiffCost}
+	m.removed = make([]bool, len(m.a))
+	m.added = make([]bool, len(m.b))
+	m.compare(0, len(m.a), 0, len(m.b))
+
+	script := make([]diffLine, 0, len(m.a)+len(m.b))
+	i, j := 0, 0
+	for i < len(m.a) || j < len(m.b) {
+		switch {
+		case i < len(m.a) && m.removed[i]:
+			script = append(script, diffLine{Kind: '-', Text: a.lines[i], OldLine: i + 1, NewLine: j})
+			i++
+		case j < len(m.b) && m.added[j]:
+			script = append(script, diffLine{Kind: '+', Text: b.lines[j], OldLine: i, NewLine: j + 1})
+			j++
+		default:
+			script = append(script, diffLine{Kind: ' ', Text: a.lines[i], OldLine: i + 1, NewLine: j + 1})
+			i++
+			j++
+		}
+	}
+	return script
+}
+
+// Myers差异算法的状态，removed/added标记a中被删除和b中新增的行，budget为剩余可以检查的位置数
+type myers struct {
+	a, b    []int
+	removed []bool
+	added   []bool
+	budget  int
+}
+
+// 比较a[aLo:aHi]和b[bLo:bHi]，先去掉相同的首尾，再从中间的snake处一分为二递归比较
+func (m *myers) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && m.a[aLo] == m.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && m.a[aHi-1] == m.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	if aLo == aHi || bLo == bHi {
+		for i := aLo; i < aHi; i++ {
+			m.removed[i] = true
+		}
+		for j := bLo; j < bHi; j++ {
+			m.added[j] = true
+		}
+		return
+	}
+	x, y, ok := m.bisect(aLo, aHi, bLo, bHi)
+	if !ok {
+		// 没有任何相同的行，或者搜索的代价过高
+		for i := aLo; i < aHi; i++ {
+			m.removed[i] = true
+		}
+		for j := bLo; j < bHi; j++ {
+			m.added[j] = true
+		}
+		return
+	}
+	m.compare(aLo, x, bLo, y)
+	m.compare(x, aHi, y, bHi)
+}
+
+// 同时从两端搜索，返回最短编辑路径上前后两个方向相遇的位置。
+// 检查的位置数超出剩余的budget时放弃搜索，返回false
+func (m *myers) bisect(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, k := aHi-aLo, bHi-bLo
+	maxD := (n + k + 1) / 2
+	offset := maxD
+	// 多留两个位置，只有一行时vf[offset+1]也不会越界
+	size := 2*maxD + 2
+	vf := make([]int, size)
+	vb := make([]int, size)
+	for i := range vf {
+		vf[i] = -1
+		vb[i] = -1
+	}
+	vf[offset+1] = 0
+	vb[offset+1] = 0
+	delta := n - k
+	// 差值为奇数时在正向搜索中检查相遇，否则在反向搜索中检查
+	front := delta%2 != 0
+	var fStart, fEnd, bStart, bEnd int
+	for d := 0; d < maxD; d++ {
+		// 每一轮正反两个方向各检查最多d+1条对角线，沿对角线前进的步数另外计入
+		if m.budget -= 2 * (d + 1); m.budget < 0 {
+			return 0, 0, false
+		}
+		for k1 := -d + fStart; k1 <= d-fEnd; k1 += 2 {
+			i := offset + k1
+			var x int
+			if k1 == -d || (k1 != d && vf[i-1] < vf[i+1]) {
+				x = vf[i+1]
+			} else {
+				x = vf[i-1] + 1
+			}
+			y := x - k1
+			for x < n && y < k && m.a[aLo+x] == m.b[bLo+y] {
+				x++
+				y++
+				m.budget--
+			}
+			vf[i] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > k:
+				fStart += 2
+			case front:
+				j := offset + delta - k1
+				if j >= 0 && j < size && vb[j] != -1 && x >= n-vb[j] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+		for k2 := -d + bStart; k2 <= d-bEnd; k2 += 2 {
+			i := offset + k2
+			var x int
+			if k2 == -d || (k2 != d && vb[i-1] < vb[i+1]) {
+				x = vb[i+1]
+			} else {
+				x = vb[i-1] + 1
+			}
+			y := x - k2
+			for x < n && y < k && m.a[aHi-1-x] == m.b[bHi-1-y] {
+				x++
+				y++
+				m.budget--
+			}
+			vb[i] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > k:
+				bStart += 2
+			case !front:
+				j := offset + delta - k2
+				if j >= 0 && j < size && vf[j] != -1 {
+					fx := vf[j]
+					fy := offset + fx - j
+					if fx >= n-x {
+						return aLo + fx, bLo + fy, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// 统计编辑脚本中新增和删除的行数
+func diffStats(script []diffLine) (added int, removed int) {
+	for _, line := range script {
+		switch line.Kind {
+		case '+':
+			added++
+		case '-':
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// 把编辑脚本分组为hunk，每个hunk前后最多保留context行相同的内容，
+// 两处修改之间相同的行不超过2*context时合并为一个hunk。返回每个hunk在脚本中的范围
+func diffHunks(script []diffLine, context int) [][2]int {
+	if context < 0 {
+		context = 0
+	}
+	hunks := make([][2]int, 0)
+	for i := 0; i < len(script); i++ {
+		if script[i].Kind == ' ' {
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		if n := len(hunks); n > 0 && start <= hunks[n-1][1] {
+			start = hunks[n-1][0]
+			hunks = hunks[:n-1]
+		}
+		// 找到这一组修改的结尾
+		end := i
+		for end < len(script) && script[end].Kind != ' ' {
+			end++
+		}
+		stop := end + context
+		if stop > len(script) {
+			stop = len(script)
+		}
+		hunks = append(hunks, [2]int{start, stop})
+		i = end - 1
+	}
+	return hunks
+}
+
+// 按unified diff格式输出编辑脚本，没有差异时返回空字符串
+func formatUnifiedDiff(oldName string, newName string, script []diffLine, a textLines, b textLines, context int) string {
+	hunks := diffHunks(script, context)
+	if len(hunks) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		lines := script[h[0]:h[1]]
+		oldStart, oldCount, newStart, newCount := hunkRange(lines)
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", unifiedRange(oldStart, oldCount), unifiedRange(newStart, newCount))
+		for _, line := range lines {
+			sb.WriteByte(line.Kind)
+			sb.WriteString(line.Text)
+			sb.WriteByte('\n')
+			if missingFinalEOL(line, a, b) {
+				sb.WriteString("\\ No newline at end of file\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// 该行是否是没有最后换行符的末行。相同的行两侧的换行情况一致，按旧文件判断
+func missingFinalEOL(line diffLine, a textLines, b textLines) bool {
+	if line.Kind == '+' {
+		return b.noFinalEOL && line.NewLine == len(b.lines)
+	}
+	return a.noFinalEOL && line.OldLine == len(a.lines)
+}
+
+// hunk在两侧的起始行号和行数。一侧没有行时，起始行号为插入或删除位置之前的行
+func hunkRange(lines []diffLine) (oldStart, oldCount, newStart, newCount int) {
+	oldStart, newStart = lines[0].OldLine, lines[0].NewLine
+	for _, line := range lines {
+		if line.Kind != '+' {
+			oldCount++
+		}
+		if line.Kind != '-' {
+			newCount++
+		}
+	}
+	if lines[0].Kind == '+' && oldCount > 0 {
+		oldStart++
+	}
+	if lines[0].Kind == '-' && newCount > 0 {
+		newStart++
+	}
+	return oldStart, oldCount, newStart, newCount
+}
+
+func unifiedRange(start int, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// 比较两个文件，oldPath为修改前的一侧
+func DiffFiles(oldPath string, newPath string, opts DiffOptions) (*DiffResult, error) {
+	oldData, err := readDiffFile(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newData, err := readDiffFile(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return diffContent(DisplayPath(filepath.Clean(oldPath)), oldData, DisplayPath(filepath.Clean(newPath)), newData, opts)
+}
+
+// 比较文件和给定的内容，用于在写入之前预览修改
+func DiffFileContent(filePath string, content string, opts DiffOptions) (*DiffResult, error) {
+	if int64(len(content)) > MaxDiffBytes {
+		return nil, fmt.Errorf("content is too large to diff: %d bytes (limit %d)", len(content), MaxDiffBytes)
+	}
+	oldData, err := readDiffFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	name := DisplayPath(filepath.Clean(filePath))
+	return diffContent(name, oldData, name+" (proposed)", []byte(content), opts)
+}
+
+func readDiffFile(filePath string) ([]byte, error) {
+	if !isPathInAllowedDirectory(filePath) {
+		return nil, fmt.Errorf("access denied: %s", filePath)
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file does not exist: %s", filePath)
+		}
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %s", filePath)
+	}
+	if info.Size() > MaxDiffBytes {
+		return nil, fmt.Errorf("file is too large to diff: %d bytes (limit %d)", info.Size(), MaxDiffBytes)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, nil
+}
+
+// 解码两侧内容并按选项输出差异
+func diffContent(oldName string, oldData []byte, newName string, newData []byte, opts DiffOptions) (*DiffResult, error) {
+	if opts.Format == "" {
+		opts.Format = DiffUnified
+	}
+	if opts.Format != DiffUnified && opts.Format != DiffSideBySide {
+		return nil, fmt.Errorf("invalid diff format: %s (supported: unified, side-by-side)", opts.Format)
+	}
+	normalize, err := whitespaceNormalizer(opts.Whitespace)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Context < 0 {
+		opts.Context = 0
+	}
+	switch {
+	case opts.Width <= 0:
+		opts.Width = DefaultDiffWidth
+	case opts.Width < MinDiffWidth:
+		opts.Width = MinDiffWidth
+	case opts.Width > MaxDiffWidth:
+		opts.Width = MaxDiffWidth
+	}
+
+	result := &DiffResult{Old: oldName, New: newName, Format: opts.Format}
+	oldFormat, newFormat := detectTextFormat(oldData, true), detectTextFormat(newData, true)
+	if oldFormat.Encoding == EncodingBinary || newFormat.Encoding == EncodingBinary {
+		result.Binary = true
+		result.Identical = bytes.Equal(oldData, newData)
+		if !result.Identical {
+			result.Diff = fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+		}
+		return result, nil
+	}
+	oldText, err := decodeText(oldData, oldFormat)
+	if err != nil {
+		return nil, err
+	}
+	newText, err := decodeText(newData, newFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	a, b := splitLines(oldText), splitLines(newText)
+	script := diffLines(a, b, normalize)
+	result.Added, result.Removed = diffStats(script)
+	result.Hunks = len(diffHunks(script, opts.Context))
+	result.Identical = result.Hunks == 0
+	if opts.Format == DiffSideBySide {
+		result.Diff = formatSideBySide(oldName, newName, script, a, b, opts.Context, opts.Width)
+	} else {
+		result.Diff = formatUnifiedDiff(oldName, newName, script, a, b, opts.Context)
+	}
+	return result, nil
+}
+
+// 按忽略空白的方式返回比较前对行的处理函数
+func whitespaceNormalizer(mode string) (func(string) string, error) {
+	switch mode {
+	case "", "none":
+		return nil, nil
+	case WhitespaceTrailing:
+		return func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }, nil
+	case WhitespaceChange:
+		return func(s string) string {
+			var sb strings.Builder
+			space := false
+			for _, r := range strings.TrimRightFunc(s, unicode.IsSpace) {
+				if unicode.IsSpace(r) {
+					space = true
+					continue
+				}
+				if space {
+					sb.WriteByte(' ')
+					space = false
+				}
+				sb.WriteRune(r)
+			}
+			return sb.String()
+		}, nil
+	case WhitespaceAll:
+		return func(s string) string {
+			return strings.Map(func(r rune) rune {
+				if unicode.IsSpace(r) {
+					return -1
+				}
+				return r
+			}, s)
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid whitespace mode: %s (supported: none, trailing, change, all)", mode)
+	}
+}
+
+// 按并排格式输出编辑脚本：左侧为旧内容，右侧为新内容，中间的标记
+// '|' 表示修改，'<' 表示删除，'>' 表示新增。相邻的删除和新增配对显示为修改
+func formatSideBySide(oldName string, newName string, script []diffLine, a textLines, b textLines, context int, width int) string {
+	hunks := diffHunks(script, context)
+	if len(hunks) == 0 {
+		return ""
+	}
+	numWidth := len(fmt.Sprint(len(a.lines)))
+	if n := len(fmt.Sprint(len(b.lines))); n > numWidth {
+		numWidth = n
+	}
+	var sb strings.Builder
+	row := func(oldNo int, oldText string, mark byte, newNo int, newText string) {
+		left, right := "", ""
+		if oldNo > 0 {
+			left = fmt.Sprintf("%*d %s", numWidth, oldNo, oldText)
+		}
+		if newNo > 0 {
+			right = fmt.Sprintf("%*d %s", numWidth, newNo, newText)
+		}
+		line := fmt.Sprintf("%s %c %s", padColumn(left, width+numWidth+1), mark, fitColumn(right, width+numWidth+1))
+		sb.WriteString(strings.TrimRight(line, " "))
+		sb.WriteByte('\n')
+	}
+	fmt.Fprintf(&sb, "%s   %s\n", padColumn(oldName, width+numWidth+1), newName)
+	for _, h := range hunks {
+		lines := script[h[0]:h[1]]
+		oldStart, oldCount, newStart, newCount := hunkRange(lines)
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", unifiedRange(oldStart, oldCount), unifiedRange(newStart, newCount))
+		for i := 0; i < len(lines); {
+			line := lines[i]
+			if line.Kind == ' ' {
+				mark := byte(' ')
+				newText := b.lines[line.NewLine-1]
+				if newText != line.Text {
+					// 忽略空白时相同的行
+					mark = '|'
+				}
+				row(line.OldLine, line.Text, mark, line.NewLine, newText)
+				i++
+				continue
+			}
+			// 一组连续的删除和新增，逐行配对
+			var removed, added []diffLine
+			for ; i < len(lines) && lines[i].Kind == '-'; i++ {
+				removed = append(removed, lines[i])
+			}
+			for ; i < len(lines) && lines[i].Kind == '+'; i++ {
+				added = append(added, lines[i])
+			}
+			for j := 0; j < len(removed) || j < len(added); j++ {
+				switch {
+				case j < len(removed) && j < len(added):
+					row(removed[j].OldLine, removed[j].Text, '|', added[j].NewLine, added[j].Text)
+				case j < len(removed):
+					row(removed[j].OldLine, removed[j].Text, '<', 0, "")
+				default:
+					row(0, "", '>', added[j].NewLine, added[j].Text)
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+// 截断到width个字符，被截断时以 "…" 结尾
+func fitColumn(s string, width int) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+// 截断并用空格补齐到width个字符
+func padColumn(s string, width int) string {
+	s = fitColumn(s, width)
+	return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+}
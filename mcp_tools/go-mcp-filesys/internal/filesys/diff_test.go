@@ -0,0 +1,111 @@
+package filesys
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 动态规划计算最长公共子序列的长度，用于检验编辑脚本是否最短
+func lcsLength(a []string, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				dp[i][j] = dp[i+1][j+1] + 1
+			case dp[i+1][j] > dp[i][j+1]:
+				dp[i][j] = dp[i+1][j]
+			default:
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestDiffLinesIsMinimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for n := 0; n < 500; n++ {
+		a, b := randomLines(), randomLines()
+		script := diffLines(textLines{lines: a}, textLines{lines: b}, nil)
+
+		var gotOld, gotNew []string
+		for _, line := range script {
+			if line.Kind != '+' {
+				gotOld = append(gotOld, line.Text)
+			}
+			if line.Kind != '-' {
+				gotNew = append(gotNew, b[line.NewLine-1])
+			}
+		}
+		if strings.Join(gotOld, "") != strings.Join(a, "") || strings.Join(gotNew, "") != strings.Join(b, "") {
+			t.Fatalf("script does not reproduce inputs: %v -> %v", a, b)
+		}
+		added, removed := diffStats(script)
+		if want := len(a) + len(b) - 2*lcsLength(a, b); added+removed != want {
+			t.Fatalf("%v -> %v: %d edits, want %d", a, b, added+removed, want)
+		}
+	}
+}
+
+func TestDiffFileContent(t *testing.T) {
+	root := setupLockRoot(t)
+	file := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(file, []byte("one\r\ntwo  words\r\nthree\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := DiffFileContent(file, "one\ntwo words\nthree\nfour", DiffOptions{Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- ws:a.txt\n+++ ws:a.txt (proposed)\n@@ -1,3 +1,4 @@\n one\n-two  words\n+two words\n three\n+four\n\\ No newline at end of file\n"
+	if result.Diff != want || result.Added != 2 || result.Removed != 1 || result.Hunks != 1 {
+		t.Fatalf("unexpected diff:\n%s%+v", result.Diff, result)
+	}
+
+	result, err = DiffFileContent(file, "one\ntwo words\nthree\n", DiffOptions{Whitespace: WhitespaceChange})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Identical || result.Diff != "" {
+		t.Fatalf("expected identical content, got:\n%s", result.Diff)
+	}
+}
+
+func TestDiffLinesTooExpensive(t *testing.T) {
+	// 完全不同的两组行超出搜索代价后整段输出为删除和新增，仍然能还原两侧内容
+	a, b := make([]string, 8000), make([]string, 8000)
+	for i := range a {
+		a[i] = fmt.Sprintf("a%d\n", i)
+		b[i] = fmt.Sprintf("b%d\n", i)
+	}
+	b[4000] = a[4000]
+	script := diffLines(textLines{lines: a}, textLines{lines: b}, nil)
+	var gotOld, gotNew []string
+	for _, line := range script {
+		if line.Kind != '+' {
+			gotOld = append(gotOld, line.Text)
+		}
+		if line.Kind != '-' {
+			gotNew = append(gotNew, b[line.NewLine-1])
+		}
+	}
+	if strings.Join(gotOld, "") != strings.Join(a, "") || strings.Join(gotNew, "") != strings.Join(b, "") {
+		t.Fatal("script does not reproduce inputs")
+	}
+}
@@ -0,0 +1,303 @@
+package filesys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 单次 edit_lines 最多包含的操作数
+const MaxLineEdits = 200
+
+// 按行编辑的操作类型
+const (
+	LineInsertBefore = "insert_before"
+	LineInsertAfter  = "insert_after"
+	LineDelete       = "delete"
+	LineReplace      = "replace"
+	LineReplaceMatch = "replace_match"
+)
+
+// 一个按行编辑的操作。所有行号都指编辑前的文件内容，与操作的先后顺序无关
+type LineEdit struct {
+	Op string `json:"op"`
+	// insert_before/insert_after 使用：插入位置的行号。insert_after 0 表示插入到文件开头，
+	// insert_before 总行数+1 表示追加到文件末尾
+	Line int `json:"line,omitempty"`
+	// delete/replace 使用：行范围（包含End），End为0时等于Start
+	Start int `json:"start,omitempty"`
+	End   int `json:"end,omitempty"`
+	// 插入或替换的内容，delete 不使用
+	Content string `json:"content,omitempty"`
+	// replace_match 使用：要查找的字符串或正则表达式，Regex为true时Content中可以用 $1 引用分组
+	Match      string `json:"match,omitempty"`
+	Regex      bool   `json:"regex,omitempty"`
+	Occurrence int    `json:"occurrence,omitempty"`
+}
+
+// 按行编辑的选项
+type EditLinesOptions struct {
+	ExpectedVersion string
+	// 只计算差异不写入
+	DryRun bool
+	Text   TextOptions
+}
+
+// 按行编辑的结果
+type EditLinesResult struct {
+	Applied bool `json:"applied"`
+	DryRun  bool `json:"dry_run"`
+	// 写入后的版本，dry run 时为当前版本
+	Version string `json:"version"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	// 编辑前后内容的unified diff
+	Diff string `json:"diff"`
+}
+
+// 换算为编辑前文本中的字节范围后的操作
+type textEdit struct {
+	index       int
+	start       int
+	end         int
+	replacement string
+}
+
+// 在一次原子写入中对文件应用一组按行编辑的操作，返回编辑前后的差异。
+// 操作的范围不能重叠；文件按原有的编码和换行风格写回
+func EditLines(filePath string, edits []LineEdit, opts EditLinesOptions) (*EditLinesResult, error) {
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("no operations provided")
+	}
+	if len(edits) > MaxLineEdits {
+		return nil, fmt.Errorf("too many operations: %d (limit %d)", len(edits), MaxLineEdits)
+	}
+	if !isPathInAllowedDirectory(filePath) {
+		return nil, fmt.Errorf("access denied: %s", filePath)
+	}
+	if err := checkWritable(filePath); err != nil {
+		return nil, err
+	}
+
+	cleanPath := filepath.Clean(filePath)
+	unlock := lockPath(cleanPath)
+	defer unlock()
+
+	info, err := os.Stat(cleanPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file does not exist: %s", filePath)
+		}
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %s", filePath)
+	}
+	if err := checkVersion(cleanPath, opts.ExpectedVersion); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(cleanPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var before, after string
+	content, err := rewriteText(data, opts.Text, func(text string, format TextFormat) (string, error) {
+		if format.Encoding == EncodingBinary {
+			return "", fmt.Errorf("cannot edit lines of a binary file: %s", DisplayPath(cleanPath))
+		}
+		crlf := format.LineEnding == LineEndingCRLF
+		changes, err := planLineEdits(text, edits, crlf)
+		if err != nil {
+			return "", err
+		}
+		before, after = text, applyTextEdits(text, changes)
+		return after, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a, b := splitLines(before), splitLines(after)
+	script := diffLines(a, b, nil)
+	name := DisplayPath(cleanPath)
+	result := &EditLinesResult{DryRun: opts.DryRun}
+	result.Added, result.Removed = diffStats(script)
+	result.Diff = formatUnifiedDiff(name, name, script, a, b, DefaultDiffContext)
+
+	if opts.DryRun {
+		result.Version, err = fileVersion(cleanPath)
+		return result, err
+	}
+	if err := checkWriteQuota(cleanPath, int64(len(content))); err != nil {
+		return nil, err
+	}
+	rec, err := beginHistory("edit_lines", cleanPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := rec.finish(safeWriteFile(cleanPath, content, info.Mode().Perm())); err != nil {
+		return nil, err
+	}
+	result.Applied = true
+	if result.Version, err = fileVersion(cleanPath); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 把操作换算为编辑前文本中的字节范围，按位置排序并检查重叠。
+// text已统一为LF，crlf表示原文件使用CRLF，此时Match和Content中的换行同样统一为LF
+func planLineEdits(text string, edits []LineEdit, crlf bool) ([]textEdit, error) {
+	// starts[i] 为第i+1行的起始位置，starts[total]为文本末尾
+	starts := make([]int, 0)
+	for pos := 0; pos < len(text); {
+		starts = append(starts, pos)
+		i := strings.IndexByte(text[pos:], '\n')
+		if i < 0 {
+			break
+		}
+		pos += i + 1
+	}
+	total := len(starts)
+	starts = append(starts, len(text))
+	noFinalEOL := text != "" && !strings.HasSuffix(text, "\n")
+
+	// 插入或替换的整行内容，保证以换行结尾；位于没有最后换行符的文件末尾时换行放在前面
+	block := func(content string, atEOF bool) string {
+		if crlf {
+			content = convertLineEndings(content, LineEndingLF)
+		}
+		content = strings.TrimSuffix(content, "\n")
+		if atEOF && noFinalEOL {
+			return "\n" + content
+		}
+		return content + "\n"
+	}
+
+	changes := make([]textEdit, 0, len(edits))
+	for i, e := range edits {
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("operation %d (%s): %s", i+1, e.Op, fmt.Sprintf(format, args...))
+		}
+		change := textEdit{index: i}
+		switch e.Op {
+		case LineInsertBefore, LineInsertAfter:
+			line := e.Line
+			if e.Op == LineInsertAfter {
+				line++
+			}
+			if line < 1 || line > total+1 {
+				return nil, fail("line %d is out of range (file has %d lines)", e.Line, total)
+			}
+			change.start = starts[line-1]
+			change.end = change.start
+			change.replacement = block(e.Content, line > total)
+		case LineDelete, LineReplace:
+			end := e.End
+			if end == 0 {
+				end = e.Start
+			}
+			if e.Start < 1 || end < e.Start || end > total {
+				return nil, fail("line range %d-%d is out of range (file has %d lines)", e.Start, end, total)
+			}
+			change.start, change.end = starts[e.Start-1], starts[end]
+			if e.Op == LineReplace && e.Content != "" {
+				change.replacement = block(e.Content, false)
+				if end == total && noFinalEOL {
+					change.replacement = strings.TrimSuffix(change.replacement, "\n")
+				}
+			} else if end == total && noFinalEOL && e.Start > 1 {
+				// 删除到没有最后换行符的末尾时，去掉前一行的换行，文件仍然没有最后换行符
+				change.start--
+			}
+		case LineReplaceMatch:
+			start, end, replacement, err := findMatch(text, e, crlf)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			change.start, change.end, change.replacement = start, end, replacement
+		case "":
+			return nil, fmt.Errorf("operation %d: op is required", i+1)
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op: %s", i+1, e.Op)
+		}
+		changes = append(changes, change)
+	}
+
+	// 同一位置的插入排在替换之前，多个插入保持操作顺序
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].start != changes[j].start {
+			return changes[i].start < changes[j].start
+		}
+		return changes[i].end-changes[i].start == 0 && changes[j].end-changes[j].start > 0
+	})
+	for i := 1; i < len(changes); i++ {
+		prev, cur := changes[i-1], changes[i]
+		if cur.start < prev.end {
+			return nil, fmt.Errorf("operations %d and %d overlap", prev.index+1, cur.index+1)
+		}
+	}
+	return changes, nil
+}
+
+// 查找第Occurrence个（默认第一个）匹配，返回匹配的范围和替换后的内容
+func findMatch(text string, e LineEdit, crlf bool) (int, int, string, error) {
+	if e.Match == "" {
+		return 0, 0, "", fmt.Errorf("match is required")
+	}
+	n := e.Occurrence
+	if n == 0 {
+		n = 1
+	}
+	if n < 0 {
+		return 0, 0, "", fmt.Errorf("occurrence must be positive")
+	}
+	content := e.Content
+	if crlf {
+		content = convertLineEndings(content, LineEndingLF)
+	}
+	if e.Regex {
+		re, err := regexp.Compile(e.Match)
+		if err != nil {
+			return 0, 0, "", fmt.Errorf("invalid regular expression: %w", err)
+		}
+		matches := re.FindAllStringSubmatchIndex(text, n)
+		if len(matches) < n {
+			return 0, 0, "", fmt.Errorf("pattern %q matched %d times, occurrence %d does not exist", e.Match, len(matches), n)
+		}
+		m := matches[n-1]
+		return m[0], m[1], string(re.ExpandString(nil, content, text, m)), nil
+	}
+	match := e.Match
+	if crlf {
+		match = convertLineEndings(match, LineEndingLF)
+	}
+	pos := 0
+	for i := 1; ; i++ {
+		idx := strings.Index(text[pos:], match)
+		if idx < 0 {
+			return 0, 0, "", fmt.Errorf("%q found %d times, occurrence %d does not exist", e.Match, i-1, n)
+		}
+		if i == n {
+			return pos + idx, pos + idx + len(match), content, nil
+		}
+		pos += idx + len(match)
+	}
+}
+
+// 按位置顺序应用不重叠的修改
+func applyTextEdits(text string, changes []textEdit) string {
+	var sb strings.Builder
+	pos := 0
+	for _, c := range changes {
+		sb.WriteString(text[pos:c.start])
+		sb.WriteString(c.replacement)
+		pos = c.end
+	}
+	sb.WriteString(text[pos:])
+	return sb.String()
+}
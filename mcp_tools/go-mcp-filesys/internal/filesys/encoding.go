@@ -0,0 +1,429 @@
+package filesys
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// 文本编码
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingGBK     = "gbk"
+	// 含有NUL字节或无法识别的内容，读写时不做转换
+	EncodingBinary  = "binary"
+	EncodingUnknown = "unknown"
+)
+
+// 换行风格
+const (
+	LineEndingLF   = "lf"
+	LineEndingCRLF = "crlf"
+	// 同时含有两种换行，写入时保持内容原样
+	LineEndingMixed = "mixed"
+)
+
+// 需要转码读取的文件超过该大小时拒绝读取
+const maxTranscodeBytes int64 = 64 * 1024 * 1024
+
+// 识别编码和换行风格时读取的文件开头字节数
+const textSniffLength = 64 * 1024
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// 文件的文本格式。读取时转换为UTF-8交给模型，写入时按同样的格式写回
+type TextFormat struct {
+	Encoding string `json:"encoding"`
+	BOM      bool   `json:"bom,omitempty"`
+	// 没有换行时为空
+	LineEnding string `json:"line_ending,omitempty"`
+}
+
+// 写入时覆盖文件原有格式的选项，为空的字段保持原样（新文件为无BOM的UTF-8，换行不做转换）
+type TextOptions struct {
+	// utf-8、utf-8-bom、utf-16le、utf-16be 或 gbk，UTF-16总是带BOM写入
+	Encoding string
+	// lf 或 crlf
+	LineEnding string
+}
+
+// 解析写入选项中的编码和换行名称
+func ParseTextOptions(encodingName string, lineEnding string) (TextOptions, error) {
+	var opts TextOptions
+	switch strings.ToLower(strings.TrimSpace(encodingName)) {
+	case "":
+	case "utf-8", "utf8":
+		opts.Encoding = EncodingUTF8
+	case "utf-8-bom", "utf8-bom", "utf-8-sig":
+		opts.Encoding = "utf-8-bom"
+	case "utf-16le", "utf-16", "utf16le", "utf16":
+		opts.Encoding = EncodingUTF16LE
+	case "utf-16be", "utf16be":
+		opts.Encoding = EncodingUTF16BE
+	case "gbk", "gb2312", "cp936":
+		opts.Encoding = EncodingGBK
+	default:
+		return opts, fmt.Errorf("unsupported encoding: %s (supported: utf-8, utf-8-bom, utf-16le, utf-16be, gbk)", encodingName)
+	}
+	switch strings.ToLower(strings.TrimSpace(lineEnding)) {
+	case "":
+	case "lf", "\n":
+		opts.LineEnding = LineEndingLF
+	case "crlf", "\r\n":
+		opts.LineEnding = LineEndingCRLF
+	default:
+		return opts, fmt.Errorf("unsupported line ending: %s (supported: lf, crlf)", lineEnding)
+	}
+	return opts, nil
+}
+
+// 用写入选项覆盖格式
+func (f TextFormat) apply(opts TextOptions) TextFormat {
+	switch opts.Encoding {
+	case "":
+	case "utf-8-bom":
+		f.Encoding, f.BOM = EncodingUTF8, true
+	case EncodingUTF16LE, EncodingUTF16BE:
+		f.Encoding, f.BOM = opts.Encoding, true
+	default:
+		f.Encoding, f.BOM = opts.Encoding, false
+	}
+	if opts.LineEnding != "" {
+		f.LineEnding = opts.LineEnding
+	}
+	return f
+}
+
+// 是否需要转码，UTF-8和无法识别的内容按原始字节处理
+func (f TextFormat) transcoded() bool {
+	return f.Encoding == EncodingUTF16LE || f.Encoding == EncodingUTF16BE || f.Encoding == EncodingGBK
+}
+
+func (f TextFormat) bom() []byte {
+	if !f.BOM {
+		return nil
+	}
+	switch f.Encoding {
+	case EncodingUTF8:
+		return bomUTF8
+	case EncodingUTF16LE:
+		return bomUTF16LE
+	case EncodingUTF16BE:
+		return bomUTF16BE
+	}
+	return nil
+}
+
+func (f TextFormat) codec() encoding.Encoding {
+	switch f.Encoding {
+	case EncodingUTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case EncodingUTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case EncodingGBK:
+		return simplifiedchinese.GBK
+	}
+	return nil
+}
+
+// 识别内容的编码、BOM和换行风格，complete表示sample是完整的文件内容
+func detectTextFormat(sample []byte, complete bool) TextFormat {
+	var format TextFormat
+	switch guessEncoding(sample, complete) {
+	case "empty", "ascii", "utf-8":
+		format.Encoding = EncodingUTF8
+	case "utf-8-bom":
+		format.Encoding, format.BOM = EncodingUTF8, true
+	case "utf-16le":
+		format.Encoding, format.BOM = EncodingUTF16LE, bytes.HasPrefix(sample, bomUTF16LE)
+	case "utf-16be":
+		format.Encoding, format.BOM = EncodingUTF16BE, bytes.HasPrefix(sample, bomUTF16BE)
+	case "gbk":
+		format.Encoding = EncodingGBK
+	case "binary":
+		format.Encoding = EncodingBinary
+		return format
+	default:
+		format.Encoding = EncodingUnknown
+	}
+	if format.transcoded() {
+		if !complete {
+			sample = trimIncompleteUnit(sample, format.Encoding)
+		}
+		if text, err := decodeText(sample, format); err == nil {
+			format.LineEnding = detectLineEnding(text)
+		}
+		return format
+	}
+	format.LineEnding = detectLineEnding(string(sample))
+	return format
+}
+
+// 识别换行风格，只统计\n，单独的\r不视为换行
+func detectLineEnding(text string) string {
+	return lineEndingFromCounts(strings.Count(text, "\n"), strings.Count(text, "\r\n"))
+}
+
+func lineEndingFromCounts(lf int, crlf int) string {
+	switch {
+	case lf == 0:
+		return ""
+	case crlf == lf:
+		return LineEndingCRLF
+	case crlf == 0:
+		return LineEndingLF
+	default:
+		return LineEndingMixed
+	}
+}
+
+// 没有BOM的UTF-16：ASCII字符的高字节为0，NUL集中出现在奇数位（LE）或偶数位（BE）
+func guessUTF16(sample []byte) string {
+	pairs := len(sample) / 2
+	if pairs < 2 {
+		return ""
+	}
+	var evenZeros, oddZeros int
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	switch {
+	case oddZeros*10 >= pairs*3 && evenZeros*20 < pairs:
+		return "utf-16le"
+	case evenZeros*10 >= pairs*3 && oddZeros*20 < pairs:
+		return "utf-16be"
+	}
+	return ""
+}
+
+// 内容是否是含有双字节字符的合法GBK，complete为false时忽略末尾不完整的字符
+func validGBK(sample []byte, complete bool) bool {
+	double := false
+	for i := 0; i < len(sample); i++ {
+		b := sample[i]
+		if b < 0x80 {
+			continue
+		}
+		if b == 0x80 || b == 0xFF {
+			return false
+		}
+		if i+1 >= len(sample) {
+			return !complete && double
+		}
+		t := sample[i+1]
+		if t < 0x40 || t == 0x7F || t == 0xFF {
+			return false
+		}
+		double = true
+		i++
+	}
+	return double
+}
+
+// 去掉末尾不完整的字符，避免解码时产生替换字符
+func trimIncompleteUnit(b []byte, enc string) []byte {
+	switch enc {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		b = b[:len(b)&^1]
+		if len(b) >= 2 {
+			// 末尾是代理对的前半部分
+			hi := b[len(b)-1]
+			if enc == EncodingUTF16BE {
+				hi = b[len(b)-2]
+			}
+			if hi >= 0xD8 && hi <= 0xDB {
+				b = b[:len(b)-2]
+			}
+		}
+	case EncodingGBK:
+		n := 0
+		for i := 0; i < len(b); i++ {
+			if b[i] >= 0x80 {
+				if i+1 >= len(b) {
+					break
+				}
+				i++
+			}
+			n = i + 1
+		}
+		b = b[:n]
+	default:
+		b = trimIncompleteRune(b)
+	}
+	return b
+}
+
+// 把文件内容转换为UTF-8文本并去掉BOM
+func decodeText(data []byte, format TextFormat) (string, error) {
+	data = bytes.TrimPrefix(data, format.bom())
+	codec := format.codec()
+	if codec == nil {
+		return string(data), nil
+	}
+	out, err := codec.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s content: %w", format.Encoding, err)
+	}
+	return string(out), nil
+}
+
+// 按格式编码文本：转换换行，编码并加上BOM。二进制和无法识别的内容按原样写入
+func encodeText(text string, format TextFormat) ([]byte, error) {
+	if format.Encoding == EncodingBinary || format.Encoding == EncodingUnknown {
+		return []byte(text), nil
+	}
+	text = convertLineEndings(text, format.LineEnding)
+	data := []byte(text)
+	if codec := format.codec(); codec != nil {
+		var err error
+		if data, err = codec.NewEncoder().Bytes(data); err != nil {
+			return nil, fmt.Errorf("content cannot be encoded as %s: %w", format.Encoding, err)
+		}
+	} else if !utf8.Valid(data) {
+		return nil, fmt.Errorf("content is not valid UTF-8")
+	}
+	if bom := format.bom(); bom != nil {
+		data = append(append(make([]byte, 0, len(bom)+len(data)), bom...), data...)
+	}
+	return data, nil
+}
+
+// 统一换行风格，lineEnding为空或mixed时不转换
+func convertLineEndings(text string, lineEnding string) string {
+	switch lineEnding {
+	case LineEndingLF:
+		return strings.ReplaceAll(text, "\r\n", "\n")
+	case LineEndingCRLF:
+		return strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+	}
+	return text
+}
+
+// 读取文件开头，识别文件的文本格式
+func sniffTextFormat(r io.ReaderAt, size int64) (TextFormat, error) {
+	n := int64(textSniffLength)
+	if size < n {
+		n = size
+	}
+	head := make([]byte, n)
+	read, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return TextFormat{}, err
+	}
+	return detectTextFormat(head[:read], int64(read) == size), nil
+}
+
+// 识别整个文件的文本格式。开头识别为UTF-8的文件（不超过maxTranscodeBytes）继续分块检查后面的内容，
+// 只有开头是ASCII的GBK等文件在后面出现非UTF-8内容时按整个文件重新识别
+func scanTextFormat(r io.ReaderAt, size int64) (TextFormat, error) {
+	format, err := sniffTextFormat(r, size)
+	if err != nil || format.Encoding != EncodingUTF8 || format.BOM || size <= textSniffLength || size > maxTranscodeBytes {
+		return format, err
+	}
+
+	var lf, crlf int
+	var carry []byte
+	buf := make([]byte, textSniffLength)
+	for offset := int64(0); offset < size; {
+		n, err := r.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return TextFormat{}, err
+		}
+		if n == 0 {
+			break
+		}
+		offset += int64(n)
+		chunk := append(carry, buf[:n]...)
+		carry = nil
+		if offset < size {
+			// 不完整的字符和末尾的\r留到下一块，避免把\r\n拆开统计
+			complete := trimIncompleteRune(chunk)
+			if len(complete) > 0 && complete[len(complete)-1] == '\r' {
+				complete = complete[:len(complete)-1]
+			}
+			carry = append([]byte(nil), chunk[len(complete):]...)
+			chunk = complete
+		}
+		if !utf8.Valid(chunk) || bytes.IndexByte(chunk, 0) >= 0 {
+			data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+			if err != nil {
+				return TextFormat{}, err
+			}
+			return detectTextFormat(data, true), nil
+		}
+		lf += bytes.Count(chunk, []byte("\n"))
+		crlf += bytes.Count(chunk, []byte("\r\n"))
+	}
+	format.LineEnding = lineEndingFromCounts(lf, crlf)
+	return format, nil
+}
+
+// 已有文件的文本格式，文件不存在时为无BOM的UTF-8
+func fileTextFormat(path string) (TextFormat, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return TextFormat{Encoding: EncodingUTF8}, nil
+	}
+	if err != nil {
+		return TextFormat{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return TextFormat{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	format, err := scanTextFormat(f, info.Size())
+	if err != nil {
+		return TextFormat{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	return format, nil
+}
+
+// 按原有格式修改文件内容：解码为UTF-8后交给edit，结果按原有格式（可被opts覆盖）编码。
+// 原有格式是CRLF时，edit收到和返回的文本都统一为LF，模型提供的内容无论用哪种换行都能匹配
+func rewriteText(data []byte, opts TextOptions, edit func(text string, format TextFormat) (string, error)) ([]byte, error) {
+	format := detectTextFormat(data, true)
+	text, err := decodeText(data, format)
+	if err != nil {
+		return nil, err
+	}
+	if format.LineEnding == LineEndingCRLF {
+		text = convertLineEndings(text, LineEndingLF)
+	}
+	if text, err = edit(text, format); err != nil {
+		return nil, err
+	}
+	return encodeText(text, format.apply(opts))
+}
+
+// 用文本替换已有内容，沿用原有格式（可被opts覆盖）
+func replaceText(data []byte, content string, opts TextOptions) ([]byte, error) {
+	return encodeText(content, detectTextFormat(data, true).apply(opts))
+}
+
+// 按path处文件原有的格式（可被opts覆盖）编码要写入的文本
+func encodeFileText(path string, content string, opts TextOptions) ([]byte, error) {
+	format, err := fileTextFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	return encodeText(content, format.apply(opts))
+}
@@ -0,0 +1,116 @@
+package filesys
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGBKCRLFRoundTrip(t *testing.T) {
+	root := setupLockRoot(t)
+	file := filepath.Join(root, "gbk.txt")
+	// "中文\r\n第二行" 的GBK编码
+	original := []byte{0xD6, 0xD0, 0xCE, 0xC4, '\r', '\n', 0xB5, 0xDA, 0xB6, 0xFE, 0xD0, 0xD0}
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadFile(file, ReadFileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Content != "中文\r\n第二行" || read.Encoding != EncodingGBK || read.LineEnding != LineEndingCRLF {
+		t.Fatalf("unexpected read result: %q %s %s", read.Content, read.Encoding, read.LineEnding)
+	}
+
+	if _, err := ReplaceFileContent(file, "中文\n", "汉字\n", read.Version, TextOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AppendFileContent(file, "末行", "", TextOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0xBA, 0xBA, 0xD7, 0xD6, '\r', '\n', 0xB5, 0xDA, 0xB6, 0xFE, 0xD0, 0xD0, '\r', '\n', 0xC4, 0xA9, 0xD0, 0xD0}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("unexpected content: % x", got)
+	}
+}
+
+func TestUTF16BOMPreservedAndOverridden(t *testing.T) {
+	root := setupLockRoot(t)
+	file := filepath.Join(root, "utf16.txt")
+	if err := os.WriteFile(file, []byte{0xFF, 0xFE, 'a', 0, '\r', 0, '\n', 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadFile(file, ReadFileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Content != "a\r\n" || !read.BOM || read.Encoding != EncodingUTF16LE {
+		t.Fatalf("unexpected read result: %q %+v", read.Content, read.TextFormat)
+	}
+
+	if _, err := WriteFile(file, "b\nc", "", TextOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(file)
+	if want := []byte{0xFF, 0xFE, 'b', 0, '\r', 0, '\n', 0, 'c', 0}; !bytes.Equal(got, want) {
+		t.Fatalf("unexpected content: % x", got)
+	}
+
+	text, err := ParseTextOptions("utf-8", "lf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteFile(file, "b\r\nc", "", text); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(file); string(got) != "b\nc" {
+		t.Fatalf("unexpected content: %q", got)
+	}
+}
+
+func TestTextFormatBeyondSniffLength(t *testing.T) {
+	root := setupLockRoot(t)
+	file := filepath.Join(root, "late.txt")
+	// 开头64KB以上都是ASCII，之后才出现GBK编码的 "中文"
+	head := bytes.Repeat([]byte("0123456789abcde\n"), textSniffLength/16+10)
+	if err := os.WriteFile(file, append(append([]byte(nil), head...), 0xD6, 0xD0, 0xCE, 0xC4, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadFile(file, ReadFileOptions{StartLine: textSniffLength/16 + 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Encoding != EncodingGBK || read.Content != "中文\n" {
+		t.Fatalf("unexpected read result: %q %+v", read.Content, read.TextFormat)
+	}
+
+	if _, err := WriteFile(file, string(head)+"汉字\n", "", TextOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(append([]byte(nil), head...), 0xBA, 0xBA, 0xD7, 0xD6, '\n'); !bytes.Equal(got, want) {
+		t.Fatalf("file was not written back as GBK: % x", got[len(head):])
+	}
+
+	// 后面才出现的CRLF同样计入换行风格
+	if err := os.WriteFile(file, append(append([]byte(nil), head...), "x\r\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if read, err = ReadFile(file, ReadFileOptions{Length: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if read.Encoding != EncodingUTF8 || read.LineEnding != LineEndingMixed {
+		t.Fatalf("unexpected format: %+v", read.TextFormat)
+	}
+}
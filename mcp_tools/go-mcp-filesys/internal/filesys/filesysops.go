@@ -1,30 +1,17 @@
 package filesys
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
+	"unicode/utf8"
 )
 
-// 允许编辑的文件夹
-var (
-	ALLOWED_OPS_FOLDER = "C:/workspaces/python-projects/python-diff-img/output"
-	folderMutex        sync.RWMutex
-)
-
-// 设置允许编辑的文件夹
-func SetAllowedOpsFolder(folder string) {
-	folderMutex.Lock()
-	defer folderMutex.Unlock()
-
-	// 规范化路径
-	folder = filepath.Clean(folder)
-	ALLOWED_OPS_FOLDER = folder
-}
-
 // 检查文件名是否符合系统命名规则
 func IsValidFileName(fileName string) bool {
 	// 检查文件名是否为空
@@ -33,7 +20,7 @@ func IsValidFileName(fileName string) bool {
 	}
 
 	// 检查文件名是否包含非法字符
-	invalidChars := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|", "..", "~"}
+	invalidChars := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|", "~"}
 	for _, char := range invalidChars {
 		if strings.Contains(fileName, char) {
 			return false
@@ -53,29 +40,22 @@ func IsValidFileName(fileName string) bool {
 	return true
 }
 
-// 检查路径是否在允许的目录内
-func isPathInAllowedDirectory(path string) bool {
-	folderMutex.RLock()
-	defer folderMutex.RUnlock()
-
-	cleanPath := filepath.Clean(path)
-	cleanAllowed := filepath.Clean(ALLOWED_OPS_FOLDER)
-
-	rel, err := filepath.Rel(cleanAllowed, cleanPath)
+// 检查文件是否为普通文件
+func isRegularFile(path string) bool {
+	info, err := os.Stat(path)
 	if err != nil {
 		return false
 	}
-
-	return !strings.Contains(rel, "..")
+	return info.Mode().IsRegular()
 }
 
-// 检查文件是否为普通文件
-func isRegularFile(path string) bool {
+// 文件现有的权限，文件不存在时为新文件的默认权限0644
+func filePerm(path string) os.FileMode {
 	info, err := os.Stat(path)
 	if err != nil {
-		return false
+		return 0644
 	}
-	return info.Mode().IsRegular()
+	return info.Mode().Perm()
 }
 
 // 安全的文件写入
@@ -94,6 +74,12 @@ func safeWriteFile(path string, content []byte, perm os.FileMode) error {
 		return err
 	}
 
+	// CreateTemp创建的文件权限为0600，需要设置为目标权限
+	if err := tmpFile.Chmod(perm); err != nil {
+		tmpFile.Close()
+		return err
+	}
+
 	if err := tmpFile.Close(); err != nil {
 		return err
 	}
@@ -110,43 +96,8 @@ func EscapeFileName(fileName string) string {
 	return fileName
 }
 
-// 获取指定文件在ALLOWED_OPS_FOLDER中的绝对路径
-func GetAbsPathWithAllowedOpsFolder(targetfile string) string {
-	folderMutex.RLock()
-	defer folderMutex.RUnlock()
-
-	if targetfile == "" {
-		return ALLOWED_OPS_FOLDER
-	}
-
-	// 规范化路径
-	fullPath := filepath.Join(ALLOWED_OPS_FOLDER, targetfile)
-	fullPath = filepath.Clean(fullPath)
-
-	// 检查路径是否在允许的目录内
-	if !isPathInAllowedDirectory(fullPath) {
-		return ""
-	}
-
-	// 检查文件是否存在
-	if _, err := os.Stat(fullPath); err != nil {
-		return ""
-	}
-
-	return fullPath
-}
-
-// 检查指定目录是否在ALLOWED_OPS_FOLDER中
-func IsAllowedOpsFolder(folder string) bool {
-	// 检查folder是否是ALLOWED_OPS_FOLDER的子目录
-	if strings.HasPrefix(folder, ALLOWED_OPS_FOLDER) {
-		return true
-	}
-	return false
-}
-
-// 列出目录中的文件
-func ListFilesInDirectory(directory string, includeSubdirectories bool) ([]string, error) {
+// 列出目录中的文件，respectIgnore为true时跳过 .gitignore 等规则忽略的文件
+func ListFilesInDirectory(directory string, includeSubdirectories bool, respectIgnore bool) ([]string, error) {
 	// 检查目录是否在允许的范围内
 	if !isPathInAllowedDirectory(directory) {
 		return nil, fmt.Errorf("directory access not allowed: %s", directory)
@@ -155,11 +106,23 @@ func ListFilesInDirectory(directory string, includeSubdirectories bool) ([]strin
 	directory = filepath.Clean(directory)
 	result := make([]string, 0)
 
+	var matcher *IgnoreMatcher
+	if respectIgnore {
+		matcher = newIgnoreMatcherFor(directory)
+	}
+
 	walkFn := func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
+		if matcher != nil && path != directory && matcher.Match(path, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		// 获取相对路径
 		relPath, err := filepath.Rel(directory, path)
 		if err != nil {
@@ -182,97 +145,363 @@ func ListFilesInDirectory(directory string, includeSubdirectories bool) ([]strin
 	return result, nil
 }
 
-// 读取文件内容
-func ReadFile(filePath string) (string, error) {
+// 单次读取返回的最大字节数，避免把超大文件一次性塞进模型上下文
+const MaxReadBytes int64 = 256 * 1024
+
+// 读取文件的选项
+// StartLine/EndLine 按行读取（从1开始，包含EndLine），Offset/Length 按字节读取，
+// 两者都未设置时从文件开头读取，最多返回 MaxReadBytes 字节
+type ReadFileOptions struct {
+	StartLine int
+	EndLine   int
+	Offset    int64
+	Length    int64
+}
+
+// 读取文件的结果
+type ReadFileResult struct {
+	Content    string `json:"content"`
+	Size       int64  `json:"size"`
+	TotalLines int    `json:"total_lines"`
+	StartLine  int    `json:"start_line,omitempty"`
+	EndLine    int    `json:"end_line,omitempty"`
+	Offset     int64  `json:"offset"`
+	Length     int64  `json:"length"`
+	HasMore    bool   `json:"has_more"`
+	NextLine   int    `json:"next_line,omitempty"`
+	NextOffset int64  `json:"next_offset,omitempty"`
+	// 整个文件的版本，可以作为写入工具的 expected_version
+	Version string `json:"version"`
+	// 文件的编码、BOM和换行风格，写入工具默认按同样的格式写回
+	TextFormat
+}
+
+// 读取文件内容。UTF-16和GBK文件转换为UTF-8返回，此时Offset/Length等字节位置按转换后的内容计算；
+// 其他文件的字节位置就是文件中的位置。开头的BOM不包含在内容中
+func ReadFile(filePath string, opts ReadFileOptions) (*ReadFileResult, error) {
 	if !isPathInAllowedDirectory(filePath) {
-		return "", fmt.Errorf("access denied: %s", filePath)
+		return nil, fmt.Errorf("access denied: %s", filePath)
 	}
 
 	cleanPath := filepath.Clean(filePath)
 	if !isRegularFile(cleanPath) {
-		return "", fmt.Errorf("not a regular file: %s", filePath)
+		return nil, fmt.Errorf("not a regular file: %s", filePath)
 	}
 
-	content, err := os.ReadFile(cleanPath)
+	if opts.StartLine < 0 || opts.EndLine < 0 || opts.Offset < 0 || opts.Length < 0 {
+		return nil, fmt.Errorf("invalid read range: negative values are not allowed")
+	}
+	if opts.EndLine > 0 && opts.StartLine > opts.EndLine {
+		return nil, fmt.Errorf("invalid line range: %d-%d", opts.StartLine, opts.EndLine)
+	}
+	if (opts.StartLine > 0 || opts.EndLine > 0) && (opts.Offset > 0 || opts.Length > 0) {
+		return nil, fmt.Errorf("line range and byte range cannot be used together")
+	}
+
+	f, err := os.Open(cleanPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	format, err := scanTextFormat(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// 需要转码的文件整体解码后再按范围读取
+	var source io.ReadSeeker = f
+	var sourceAt io.ReaderAt = f
+	sourceSize := info.Size()
+	if format.transcoded() {
+		if info.Size() > maxTranscodeBytes {
+			return nil, fmt.Errorf("%s file is too large to transcode: %d bytes (limit %d)", format.Encoding, info.Size(), maxTranscodeBytes)
+		}
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		text, err := decodeText(data, format)
+		if err != nil {
+			return nil, err
+		}
+		reader := strings.NewReader(text)
+		source, sourceAt, sourceSize = reader, reader, int64(len(text))
+	}
+
+	var result *ReadFileResult
+	if opts.StartLine > 0 || opts.EndLine > 0 {
+		if result, err = readLineRange(source, sourceSize, opts.StartLine, opts.EndLine); err != nil {
+			return nil, err
+		}
+	} else {
+		if result, err = readByteRange(sourceAt, sourceSize, opts.Offset, opts.Length); err != nil {
+			return nil, err
+		}
+		// 统计总行数需要从头扫描一遍文件
+		if _, err := source.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if result.TotalLines, err = countLines(source); err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+	result.Size = info.Size()
+	result.TextFormat = format
+	if format.BOM && !format.transcoded() && result.Offset == 0 {
+		result.Content = strings.TrimPrefix(result.Content, "\uFEFF")
 	}
 
-	return string(content), nil
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if result.Version, err = contentVersion(f, info); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return result, nil
 }
 
-// 写入文件内容
-func WriteFile(filePath string, content string) error {
-	if !isPathInAllowedDirectory(filePath) {
-		return fmt.Errorf("access denied: %s", filePath)
+// 按字节范围读取，结果会截断在完整的UTF-8字符边界上
+func readByteRange(f io.ReaderAt, size int64, offset int64, length int64) (*ReadFileResult, error) {
+	if offset > size {
+		return nil, fmt.Errorf("offset %d is beyond end of file (size %d)", offset, size)
+	}
+	if length == 0 || length > MaxReadBytes {
+		length = MaxReadBytes
+	}
+	if offset+length > size {
+		length = size - offset
 	}
 
-	cleanPath := filepath.Clean(filePath)
-	if !isRegularFile(cleanPath) {
-		return fmt.Errorf("not a regular file: %s", filePath)
+	buf := make([]byte, length)
+	n, err := f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
+	buf = buf[:n]
 
-	return safeWriteFile(cleanPath, []byte(content), 0644)
+	// 不在多字节字符中间截断
+	if offset+int64(len(buf)) < size {
+		buf = trimIncompleteRune(buf)
+	}
+
+	result := &ReadFileResult{
+		Content: string(buf),
+		Size:    size,
+		Offset:  offset,
+		Length:  int64(len(buf)),
+	}
+	if end := offset + int64(len(buf)); end < size {
+		result.HasMore = true
+		result.NextOffset = end
+	}
+	return result, nil
 }
 
-// 删除文件
-func DeleteFile(filePath string) error {
-	if !isPathInAllowedDirectory(filePath) {
-		return fmt.Errorf("access denied: %s", filePath)
+// 去掉末尾不完整的UTF-8字符
+func trimIncompleteRune(b []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(b); i++ {
+		c := b[len(b)-i]
+		if c < utf8.RuneSelf {
+			return b
+		}
+		if utf8.RuneStart(c) {
+			if !utf8.FullRune(b[len(b)-i:]) && len(b) > i {
+				return b[:len(b)-i]
+			}
+			return b
+		}
 	}
+	return b
+}
 
-	cleanPath := filepath.Clean(filePath)
-	if !isRegularFile(cleanPath) {
-		return fmt.Errorf("not a regular file: %s", filePath)
+// 按行范围读取，同时统计总行数。内容最多 MaxReadBytes 字节，超出时剩余的行留给下一次读取；
+// 第一行本身超出上限时只返回它的开头，NextOffset 为按字节范围继续读取这一行的位置
+func readLineRange(f io.Reader, size int64, startLine int, endLine int) (*ReadFileResult, error) {
+	if startLine == 0 {
+		startLine = 1
+	}
+
+	result := &ReadFileResult{Size: size, StartLine: startLine}
+	content := make([]byte, 0)
+	var offset int64
+	lineNo := 0
+	lineStart := true
+	// 当前行在content中的起始位置
+	lineBegin := 0
+	truncated := false
+
+	reader := bufio.NewReader(f)
+	for {
+		// ReadSlice每次最多返回缓冲区大小的内容，很长的行分多次读取，不会整行读入内存
+		chunk, err := reader.ReadSlice('\n')
+		if len(chunk) > 0 {
+			if lineStart {
+				lineNo++
+				lineBegin = len(content)
+			}
+			inRange := lineNo >= startLine && (endLine == 0 || lineNo <= endLine)
+			if inRange && !truncated {
+				if lineNo == startLine && lineStart {
+					result.Offset = offset
+				}
+				content = append(content, chunk...)
+				result.EndLine = lineNo
+				if int64(len(content)) > MaxReadBytes {
+					truncated = true
+					if lineNo > startLine {
+						// 超出单次读取上限，这一行和剩余的行留给下一次读取
+						content = content[:lineBegin]
+						result.EndLine = lineNo - 1
+						result.NextLine = lineNo
+					} else {
+						content = trimIncompleteRune(content[:MaxReadBytes])
+						result.NextOffset = result.Offset + int64(len(content))
+					}
+				}
+			}
+			offset += int64(len(chunk))
+			lineStart = chunk[len(chunk)-1] == '\n'
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
 	}
 
-	if err := os.Remove(cleanPath); err != nil {
-		return fmt.Errorf("failed to delete file: %w", err)
+	if startLine > lineNo && !(startLine == 1 && lineNo == 0) {
+		return nil, fmt.Errorf("start line %d is beyond end of file (%d lines)", startLine, lineNo)
 	}
 
-	return nil
+	result.Content = string(content)
+	result.Length = int64(len(content))
+	result.TotalLines = lineNo
+	if result.NextLine == 0 && result.EndLine < lineNo {
+		result.NextLine = result.EndLine + 1
+	}
+	result.HasMore = result.NextLine > 0 || result.NextOffset > 0
+	return result, nil
 }
 
-// 移动文件
-func MoveFile(oldPath, newPath string) error {
-	if !isPathInAllowedDirectory(oldPath) || !isPathInAllowedDirectory(newPath) {
-		return fmt.Errorf("access denied: source or destination path not allowed")
+// 统计行数，最后一行没有换行符时也计为一行
+func countLines(r io.Reader) (int, error) {
+	buf := make([]byte, 32*1024)
+	count := 0
+	endsWithNewline := true
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			count += bytes.Count(buf[:n], []byte{'\n'})
+			endsWithNewline = buf[n-1] == '\n'
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
 	}
+	if !endsWithNewline {
+		count++
+	}
+	return count, nil
+}
 
-	cleanOldPath := filepath.Clean(oldPath)
-	cleanNewPath := filepath.Clean(newPath)
+// 写入文件内容，expectedVersion不为空时文件的当前版本必须与之一致。
+// 内容按文件原有的编码、BOM和换行风格写入，text可以覆盖。返回写入后的版本
+func WriteFile(filePath string, content string, expectedVersion string, text TextOptions) (string, error) {
+	if !isPathInAllowedDirectory(filePath) {
+		return "", fmt.Errorf("access denied: %s", filePath)
+	}
 
-	if !isRegularFile(cleanOldPath) {
-		return fmt.Errorf("not a regular file: %s", oldPath)
+	if err := checkWritable(filePath); err != nil {
+		return "", err
 	}
 
-	// 使用临时文件进行移动操作
-	content, err := os.ReadFile(cleanOldPath)
+	cleanPath := filepath.Clean(filePath)
+	unlock := lockPath(cleanPath)
+	defer unlock()
+
+	if !isRegularFile(cleanPath) {
+		return "", fmt.Errorf("not a regular file: %s", filePath)
+	}
+	if err := checkVersion(cleanPath, expectedVersion); err != nil {
+		return "", err
+	}
+
+	data, err := encodeFileText(cleanPath, content, text)
 	if err != nil {
-		return fmt.Errorf("failed to read source file: %w", err)
+		return "", err
+	}
+	if err := checkWriteQuota(cleanPath, int64(len(data))); err != nil {
+		return "", err
 	}
 
-	if err := safeWriteFile(cleanNewPath, content, 0644); err != nil {
-		return fmt.Errorf("failed to write destination file: %w", err)
+	rec, err := beginHistory("write_file", cleanPath)
+	if err != nil {
+		return "", err
 	}
+	if err := rec.finish(safeWriteFile(cleanPath, data, filePerm(cleanPath))); err != nil {
+		return "", err
+	}
+	return fileVersion(cleanPath)
+}
 
-	if err := os.Remove(cleanOldPath); err != nil {
-		// 如果删除源文件失败，尝试删除目标文件
-		os.Remove(cleanNewPath)
-		return fmt.Errorf("failed to remove source file: %w", err)
+// 删除文件
+func DeleteFile(filePath string) error {
+	if !isPathInAllowedDirectory(filePath) {
+		return fmt.Errorf("access denied: %s", filePath)
+	}
+
+	if err := checkWritableFor(filePath, OperationDelete); err != nil {
+		return err
+	}
+
+	cleanPath := filepath.Clean(filePath)
+	unlock := lockPath(cleanPath)
+	defer unlock()
+	if !isRegularFile(cleanPath) {
+		return fmt.Errorf("not a regular file: %s", filePath)
+	}
+
+	// 启用操作历史时文件被移入回收站
+	rec, err := beginHistory("delete_file")
+	if err != nil {
+		return err
+	}
+	if err := rec.finish(rec.trash(cleanPath)); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
 	}
 
 	return nil
 }
 
+// 移动文件，目标的父目录不存在时自动创建，opts.Conflict决定目标已存在时的处理方式
+func MoveFile(oldPath, newPath string, opts MoveOptions) (*MoveResult, error) {
+	return movePathWithPolicy("move_file", oldPath, newPath, false, opts)
+}
+
 // 复制文件
 func CopyFile(oldPath string, newPath string) error {
 	if !isPathInAllowedDirectory(oldPath) || !isPathInAllowedDirectory(newPath) {
 		return fmt.Errorf("access denied: source or destination path not allowed")
 	}
 
+	if err := checkWritable(newPath); err != nil {
+		return err
+	}
+
 	cleanOldPath := filepath.Clean(oldPath)
 	cleanNewPath := filepath.Clean(newPath)
+	unlock := lockPath(cleanNewPath)
+	defer unlock()
 
 	if !isRegularFile(cleanOldPath) {
 		return fmt.Errorf("not a regular file: %s", oldPath)
@@ -284,8 +513,16 @@ func CopyFile(oldPath string, newPath string) error {
 		return fmt.Errorf("failed to read source file: %w", err)
 	}
 
+	if err := checkWriteQuota(cleanNewPath, int64(len(content))); err != nil {
+		return err
+	}
+
+	rec, err := beginHistory("copy_file", cleanNewPath)
+	if err != nil {
+		return err
+	}
 	// 使用安全写入方式复制到新文件
-	return safeWriteFile(cleanNewPath, content, 0644)
+	return rec.finish(safeWriteFile(cleanNewPath, content, filePerm(cleanOldPath)))
 }
 
 // 修改文件权限
@@ -294,10 +531,15 @@ func ChangeFilePermissions(filePath string, permissions string) error {
 		return fmt.Errorf("access denied: %s", filePath)
 	}
 
+	if err := checkWritableFor(filePath, OperationChmod); err != nil {
+		return err
+	}
+
 	cleanPath := filepath.Clean(filePath)
 	if !isRegularFile(cleanPath) {
 		return fmt.Errorf("not a regular file: %s", filePath)
 	}
+	op := "change_file_permissions"
 
 	perm, err := strconv.ParseUint(permissions, 8, 32)
 	if err != nil {
@@ -309,7 +551,14 @@ func ChangeFilePermissions(filePath string, permissions string) error {
 		return fmt.Errorf("invalid permissions value: %s", permissions)
 	}
 
-	if err := os.Chmod(cleanPath, os.FileMode(perm)); err != nil {
+	rec, err := beginHistory(op)
+	if err != nil {
+		return err
+	}
+	if err := rec.snapshotMeta(cleanPath); err != nil {
+		return rec.finish(err)
+	}
+	if err := rec.finish(os.Chmod(cleanPath, os.FileMode(perm))); err != nil {
 		return fmt.Errorf("failed to change permissions: %w", err)
 	}
 
@@ -322,8 +571,24 @@ func CreateDirectory(directory string) error {
 		return fmt.Errorf("access denied: %s", directory)
 	}
 
+	if err := checkWritable(directory); err != nil {
+		return err
+	}
+
 	cleanPath := filepath.Clean(directory)
-	if err := os.MkdirAll(cleanPath, 0755); err != nil {
+	if _, err := os.Stat(cleanPath); os.IsNotExist(err) {
+		if err := checkNewEntryQuota(cleanPath); err != nil {
+			return err
+		}
+	}
+	rec, err := beginHistory("create_directory")
+	if err != nil {
+		return err
+	}
+	if err := rec.snapshotMeta(cleanPath); err != nil {
+		return rec.finish(err)
+	}
+	if err := rec.finish(os.MkdirAll(cleanPath, 0755)); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
@@ -336,6 +601,10 @@ func DeleteDirectory(directory string) error {
 		return fmt.Errorf("access denied: %s", directory)
 	}
 
+	if err := checkWritableFor(directory, OperationDelete); err != nil {
+		return err
+	}
+
 	cleanPath := filepath.Clean(directory)
 	info, err := os.Stat(cleanPath)
 	if err != nil {
@@ -346,23 +615,21 @@ func DeleteDirectory(directory string) error {
 		return fmt.Errorf("not a directory: %s", directory)
 	}
 
-	if err := os.RemoveAll(cleanPath); err != nil {
+	// 启用操作历史时目录被移入回收站
+	rec, err := beginHistory("delete_directory")
+	if err != nil {
+		return err
+	}
+	if err := rec.finish(rec.trash(cleanPath)); err != nil {
 		return fmt.Errorf("failed to delete directory: %w", err)
 	}
 
 	return nil
 }
 
-// 移动目录
-func MoveDirectory(oldPath string, newPath string) error {
-	// 检查目录是否存在
-	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
-		return fmt.Errorf("directory does not exist: %s", oldPath)
-	}
-	// 移动目录
-	oldPath = EscapeFileName(oldPath)
-	newPath = EscapeFileName(newPath)
-	return os.Rename(oldPath, newPath)
+// 移动目录，目标可以是新名称，也可以按merge策略合并到已存在的目录中
+func MoveDirectory(oldPath string, newPath string, opts MoveOptions) (*MoveResult, error) {
+	return movePathWithPolicy("move_directory", oldPath, newPath, true, opts)
 }
 
 // 复制目录
@@ -371,8 +638,27 @@ func CopyDirectory(oldPath string, newPath string) error {
 		return fmt.Errorf("access denied: source or destination path not allowed")
 	}
 
+	if err := checkWritable(newPath); err != nil {
+		return err
+	}
+
 	cleanOldPath := filepath.Clean(oldPath)
 	cleanNewPath := filepath.Clean(newPath)
+	unlock := lockPath(cleanNewPath)
+	defer unlock()
+
+	rec, err := beginHistory("copy_directory", cleanNewPath)
+	if err != nil {
+		return err
+	}
+	return rec.finish(copyDirectoryTree(cleanOldPath, cleanNewPath))
+}
+
+// 递归复制目录，每个条目都检查是否在允许的范围内，写入每个文件时锁定该文件
+func copyDirectoryTree(cleanOldPath string, cleanNewPath string) error {
+	if !isPathInAllowedDirectory(cleanOldPath) || !isPathInAllowedDirectory(cleanNewPath) {
+		return fmt.Errorf("access denied: source or destination path not allowed")
+	}
 
 	// 检查源目录
 	srcInfo, err := os.Stat(cleanOldPath)
@@ -380,10 +666,15 @@ func CopyDirectory(oldPath string, newPath string) error {
 		return fmt.Errorf("failed to access source directory: %w", err)
 	}
 	if !srcInfo.IsDir() {
-		return fmt.Errorf("source is not a directory: %s", oldPath)
+		return fmt.Errorf("source is not a directory: %s", cleanOldPath)
 	}
 
 	// 创建目标目录
+	if _, err := os.Stat(cleanNewPath); os.IsNotExist(err) {
+		if err := checkNewEntryQuota(cleanNewPath); err != nil {
+			return err
+		}
+	}
 	if err := os.MkdirAll(cleanNewPath, srcInfo.Mode()); err != nil {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
@@ -399,194 +690,243 @@ func CopyDirectory(oldPath string, newPath string) error {
 		dstPath := filepath.Join(cleanNewPath, entry.Name())
 
 		if entry.IsDir() {
-			if err := CopyDirectory(srcPath, dstPath); err != nil {
-				return err
-			}
-		} else {
-			if err := CopyFile(srcPath, dstPath); err != nil {
+			if err := copyDirectoryTree(srcPath, dstPath); err != nil {
 				return err
 			}
+			continue
+		}
+		if !isPathInAllowedDirectory(srcPath) {
+			return fmt.Errorf("access denied: source path not allowed: %s", srcPath)
+		}
+		if err := checkWritable(dstPath); err != nil {
+			return err
+		}
+		if !isRegularFile(srcPath) {
+			return fmt.Errorf("not a regular file: %s", srcPath)
+		}
+		if err := copyTreeFile(srcPath, dstPath); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-// 统计目录中的文件数量和文件大小
-func CountFilesInDirectory(directory string) (int, int64, error) {
-	// 检查目录是否存在
-	if _, err := os.Stat(directory); os.IsNotExist(err) {
-		return 0, 0, fmt.Errorf("directory does not exist: %s", directory)
-	}
-	// 统计目录中的文件数量和文件大小
-	directory = EscapeFileName(directory)
-	files, err := os.ReadDir(directory)
+func copyTreeFile(srcPath string, dstPath string) error {
+	unlock := lockPath(dstPath)
+	defer unlock()
+	content, err := os.ReadFile(srcPath)
 	if err != nil {
-		return 0, 0, err
+		return fmt.Errorf("failed to read source file: %w", err)
 	}
-	totalSize := int64(0)
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
+	if err := checkWriteQuota(dstPath, int64(len(content))); err != nil {
+		return err
 	}
-	return len(files), totalSize, nil
+	return safeWriteFile(dstPath, content, filePerm(srcPath))
 }
 
-// 搜索文件
-func SearchFile(directory string, fileName string) ([]string, error) {
-	// 检查目录是否存在
-	if _, err := os.Stat(directory); os.IsNotExist(err) {
-		return nil, fmt.Errorf("directory does not exist: %s", directory)
-	}
-	// 搜索文件
-	result := make([]string, 0)
-	directory = EscapeFileName(directory)
-	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if strings.Contains(info.Name(), fileName) {
-			// 获取相对路径
-			relativePath, err := filepath.Rel(directory, path)
-			if err != nil {
-				return err
-			}
-			result = append(result, relativePath)
-		}
-		return nil
-	})
+// 递归统计目录中的文件数量和文件总大小，不计入目录本身
+func CountFilesInDirectory(directory string, respectIgnore bool) (int, int64, error) {
+	report, err := DiskUsage(directory, UsageOptions{RespectIgnore: respectIgnore})
 	if err != nil {
-		return nil, err
+		return 0, 0, err
 	}
-	return result, nil
+	return report.Files, report.Size, nil
 }
 
-// 搜索文件内容
-func SearchFileContent(directory string, content string) ([]string, error) {
-	if !isPathInAllowedDirectory(directory) {
-		return nil, fmt.Errorf("access denied: %s", directory)
+// 替换文件内容，expectedVersion不为空时文件的当前版本必须与之一致。返回写入后的版本
+func ReplaceFileContent(filePath string, oldContent string, newContent string, expectedVersion string, text TextOptions) (string, error) {
+	if err := checkWritable(filePath); err != nil {
+		return "", err
 	}
+	cleanPath := filepath.Clean(filePath)
+	unlock := lockPath(cleanPath)
+	defer unlock()
 
-	cleanDir := filepath.Clean(directory)
-	result := make([]string, 0)
-
-	err := filepath.Walk(cleanDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// 跳过非常规文件
-		if !info.Mode().IsRegular() {
-			return nil
-		}
-
-		// 检查路径是否在允许的目录内
-		if !isPathInAllowedDirectory(path) {
-			return nil
-		}
-
-		// 读取文件内容
-		fileContent, err := os.ReadFile(path)
-		if err != nil {
-			return nil
-		}
-
-		if strings.Contains(string(fileContent), content) {
-			relPath, err := filepath.Rel(cleanDir, path)
-			if err != nil {
-				return err
-			}
-			result = append(result, filepath.ToSlash(relPath))
+	// 检查文件是否存在
+	info, err := os.Stat(cleanPath)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("file does not exist: %s", filePath)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := checkVersion(cleanPath, expectedVersion); err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(cleanPath)
+	if err != nil {
+		return "", err
+	}
+	// 替换文件内容，解码后替换再按原有格式编码
+	tmpContent, err := rewriteText(content, text, func(s string, format TextFormat) (string, error) {
+		if format.LineEnding == LineEndingCRLF {
+			oldContent = convertLineEndings(oldContent, LineEndingLF)
+			newContent = convertLineEndings(newContent, LineEndingLF)
 		}
-
-		return nil
+		return strings.Replace(s, oldContent, newContent, -1), nil
 	})
-
 	if err != nil {
-		return nil, fmt.Errorf("failed to search files: %w", err)
+		return "", err
 	}
-
-	return result, nil
-}
-
-// 替换文件内容
-func ReplaceFileContent(filePath string, oldContent string, newContent string) error {
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("file does not exist: %s", filePath)
+	if err := checkWriteQuota(cleanPath, int64(len(tmpContent))); err != nil {
+		return "", err
 	}
-	// 替换文件内容
-	filePath = EscapeFileName(filePath)
-	content, err := os.ReadFile(filePath)
+	rec, err := beginHistory("replace_file_content", cleanPath)
 	if err != nil {
-		return err
+		return "", err
 	}
-	// 替换文件内容
-	tmpContent := strings.Replace(string(content), oldContent, newContent, -1)
-	return os.WriteFile(filePath, []byte(tmpContent), 0644)
+	if err := rec.finish(safeWriteFile(cleanPath, tmpContent, info.Mode().Perm())); err != nil {
+		return "", err
+	}
+	return fileVersion(cleanPath)
 }
 
-// 创建新文件
-func CreateNewFile(tmppath string, content string) error {
+// 创建新文件，返回文件的版本
+func CreateNewFile(tmppath string, content string, text TextOptions) (string, error) {
 	if !isPathInAllowedDirectory(tmppath) {
-		return fmt.Errorf("access denied: %s", tmppath)
+		return "", fmt.Errorf("access denied: %s", tmppath)
+	}
+
+	if err := checkWritable(tmppath); err != nil {
+		return "", err
 	}
 
 	cleanPath := filepath.Clean(tmppath)
 
 	// 检查文件名是否合法
 	if !IsValidFileName(filepath.Base(cleanPath)) {
-		return fmt.Errorf("invalid file name: %s", filepath.Base(cleanPath))
+		return "", fmt.Errorf("invalid file name: %s", filepath.Base(cleanPath))
 	}
 
+	unlock := lockPath(cleanPath)
+	defer unlock()
+
 	// 检查文件是否已存在
 	if _, err := os.Stat(cleanPath); err == nil {
-		return fmt.Errorf("file already exists: %s", tmppath)
+		return "", fmt.Errorf("file already exists: %s", tmppath)
+	}
+	data, err := encodeText(content, TextFormat{Encoding: EncodingUTF8}.apply(text))
+	if err != nil {
+		return "", err
+	}
+	if err := checkWriteQuota(cleanPath, int64(len(data))); err != nil {
+		return "", err
+	}
+
+	rec, err := beginHistory("create_new_file", cleanPath)
+	if err != nil {
+		return "", err
 	}
 
 	// 确保目录存在
 	dir := filepath.Dir(cleanPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+		return "", rec.finish(fmt.Errorf("failed to create directory: %w", err))
 	}
 
 	// 使用安全写入方式创建文件
-	return safeWriteFile(cleanPath, []byte(content), 0644)
+	if err := rec.finish(safeWriteFile(cleanPath, data, 0644)); err != nil {
+		return "", err
+	}
+	return fileVersion(cleanPath)
 }
 
-// 追加文件内容
-func AppendFileContent(filePath string, content string) error {
+// 追加文件内容，expectedVersion不为空时文件的当前版本必须与之一致。返回写入后的版本
+func AppendFileContent(filePath string, content string, expectedVersion string, text TextOptions) (string, error) {
 	if !isPathInAllowedDirectory(filePath) {
-		return fmt.Errorf("access denied: %s", filePath)
+		return "", fmt.Errorf("access denied: %s", filePath)
+	}
+
+	if err := checkWritable(filePath); err != nil {
+		return "", err
 	}
 
 	cleanPath := filepath.Clean(filePath)
+	// 读取和写入之间持有锁，并发的追加不会互相覆盖
+	unlock := lockPath(cleanPath)
+	defer unlock()
+
 	if !isRegularFile(cleanPath) {
-		return fmt.Errorf("not a regular file: %s", filePath)
+		return "", fmt.Errorf("not a regular file: %s", filePath)
+	}
+	if err := checkVersion(cleanPath, expectedVersion); err != nil {
+		return "", err
 	}
 
 	// 读取现有内容
 	oldContent, err := os.ReadFile(cleanPath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return "", fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// 准备新内容
-	newContent := append(oldContent, []byte("\n"+content)...)
+	newContent, err := rewriteText(oldContent, text, func(s string, _ TextFormat) (string, error) {
+		return appendText(s, content), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := checkWriteQuota(cleanPath, int64(len(newContent))); err != nil {
+		return "", err
+	}
 
+	rec, err := beginHistory("append_file_content", cleanPath)
+	if err != nil {
+		return "", err
+	}
 	// 使用安全写入方式更新文件
-	return safeWriteFile(cleanPath, newContent, 0644)
+	if err := rec.finish(safeWriteFile(cleanPath, newContent, filePerm(cleanPath))); err != nil {
+		return "", err
+	}
+	return fileVersion(cleanPath)
 }
 
-// 编辑文件
-func EditFile(filePath string, content string) error {
+// 在现有内容之后追加新内容，现有内容不以换行结尾时以换行分隔。
+// 文本已统一为LF，写回时换行按文件原有风格转换
+func appendText(oldContent string, content string) string {
+	if oldContent == "" || strings.HasSuffix(oldContent, "\n") {
+		return oldContent + content
+	}
+	return oldContent + "\n" + content
+}
+
+// 编辑文件，expectedVersion不为空时文件的当前版本必须与之一致。
+// 内容按文件原有的编码、BOM和换行风格写入，text可以覆盖。返回写入后的版本
+func EditFile(filePath string, content string, expectedVersion string, text TextOptions) (string, error) {
+	if err := checkWritable(filePath); err != nil {
+		return "", err
+	}
+	cleanPath := filepath.Clean(filePath)
+	unlock := lockPath(cleanPath)
+	defer unlock()
+
 	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("file does not exist: %s", filePath)
+	info, err := os.Stat(cleanPath)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("file does not exist: %s", filePath)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := checkVersion(cleanPath, expectedVersion); err != nil {
+		return "", err
+	}
+	data, err := encodeFileText(cleanPath, content, text)
+	if err != nil {
+		return "", err
+	}
+	if err := checkWriteQuota(cleanPath, int64(len(data))); err != nil {
+		return "", err
 	}
 	// 编辑文件
-	return os.WriteFile(filePath, []byte(content), 0644)
+	rec, err := beginHistory("edit_file", cleanPath)
+	if err != nil {
+		return "", err
+	}
+	if err := rec.finish(safeWriteFile(cleanPath, data, info.Mode().Perm())); err != nil {
+		return "", err
+	}
+	return fileVersion(cleanPath)
 }
 
 // 修改目录权限
@@ -595,6 +935,10 @@ func ChangeDirectoryPermissions(directory string, permissions string) error {
 		return fmt.Errorf("access denied: %s", directory)
 	}
 
+	if err := checkWritableFor(directory, OperationChmod); err != nil {
+		return err
+	}
+
 	cleanPath := filepath.Clean(directory)
 	info, err := os.Stat(cleanPath)
 	if err != nil {
@@ -604,6 +948,7 @@ func ChangeDirectoryPermissions(directory string, permissions string) error {
 	if !info.IsDir() {
 		return fmt.Errorf("not a directory: %s", directory)
 	}
+	op := "change_directory_permissions"
 
 	perm, err := strconv.ParseUint(permissions, 8, 32)
 	if err != nil {
@@ -615,7 +960,14 @@ func ChangeDirectoryPermissions(directory string, permissions string) error {
 		return fmt.Errorf("invalid permissions value: %s", permissions)
 	}
 
-	if err := os.Chmod(cleanPath, os.FileMode(perm)); err != nil {
+	rec, err := beginHistory(op)
+	if err != nil {
+		return err
+	}
+	if err := rec.snapshotMeta(cleanPath); err != nil {
+		return rec.finish(err)
+	}
+	if err := rec.finish(os.Chmod(cleanPath, os.FileMode(perm))); err != nil {
 		return fmt.Errorf("failed to change permissions: %w", err)
 	}
 
@@ -0,0 +1,321 @@
+package filesys
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWritesKeepFileMode(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(root string) error
+		// 检查权限的文件
+		path string
+	}{
+		{name: "write", path: "f.sh", op: func(root string) error {
+			_, err := WriteFile(filepath.Join(root, "f.sh"), "new\n", "", TextOptions{})
+			return err
+		}},
+		{name: "append", path: "f.sh", op: func(root string) error {
+			_, err := AppendFileContent(filepath.Join(root, "f.sh"), "more", "", TextOptions{})
+			return err
+		}},
+		{name: "replace", path: "f.sh", op: func(root string) error {
+			_, err := ReplaceFileContent(filepath.Join(root, "f.sh"), "echo", "printf", "", TextOptions{})
+			return err
+		}},
+		{name: "edit", path: "f.sh", op: func(root string) error {
+			_, err := EditFile(filepath.Join(root, "f.sh"), "new\n", "", TextOptions{})
+			return err
+		}},
+		{name: "copy file", path: "copy.sh", op: func(root string) error {
+			return CopyFile(filepath.Join(root, "f.sh"), filepath.Join(root, "copy.sh"))
+		}},
+		{name: "copy directory", path: "copy/f.sh", op: func(root string) error {
+			if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(filepath.Join(root, "f.sh"), filepath.Join(root, "dir", "f.sh")); err != nil {
+				return err
+			}
+			return CopyDirectory(filepath.Join(root, "dir"), filepath.Join(root, "copy"))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupLockRoot(t)
+			file := filepath.Join(root, "f.sh")
+			if err := os.WriteFile(file, []byte("echo hi\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(file, 0750); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.op(root); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(filepath.Join(root, filepath.FromSlash(tt.path)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0750 {
+				t.Errorf("mode = %v, want 0750", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestCreateNewFileMode(t *testing.T) {
+	root := setupLockRoot(t)
+	file := filepath.Join(root, "new.txt")
+	if _, err := CreateNewFile(file, "x", TextOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+}
+
+// 5行，最后一行没有换行符，共23字节
+const readTestFile = "one\ntwo\nthree\nfour\nfive"
+
+func TestReadFileRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		opts    ReadFileOptions
+		// 只比较范围相关的字段
+		want    ReadFileResult
+		wantErr string
+	}{
+		{
+			name:    "whole file",
+			content: readTestFile,
+			want:    ReadFileResult{Content: readTestFile, TotalLines: 5, Length: 23},
+		},
+		{
+			name:    "line range",
+			content: readTestFile,
+			opts:    ReadFileOptions{StartLine: 2, EndLine: 3},
+			want:    ReadFileResult{Content: "two\nthree\n", TotalLines: 5, StartLine: 2, EndLine: 3, Offset: 4, Length: 10, HasMore: true, NextLine: 4},
+		},
+		{
+			name:    "start line only",
+			content: readTestFile,
+			opts:    ReadFileOptions{StartLine: 4},
+			want:    ReadFileResult{Content: "four\nfive", TotalLines: 5, StartLine: 4, EndLine: 5, Offset: 14, Length: 9},
+		},
+		{
+			name:    "end line only",
+			content: readTestFile,
+			opts:    ReadFileOptions{EndLine: 2},
+			want:    ReadFileResult{Content: "one\ntwo\n", TotalLines: 5, StartLine: 1, EndLine: 2, Length: 8, HasMore: true, NextLine: 3},
+		},
+		{
+			name:    "end line beyond end of file",
+			content: readTestFile,
+			opts:    ReadFileOptions{StartLine: 5, EndLine: 10},
+			want:    ReadFileResult{Content: "five", TotalLines: 5, StartLine: 5, EndLine: 5, Offset: 19, Length: 4},
+		},
+		{
+			name:    "single line",
+			content: readTestFile,
+			opts:    ReadFileOptions{StartLine: 1, EndLine: 1},
+			want:    ReadFileResult{Content: "one\n", TotalLines: 5, StartLine: 1, EndLine: 1, Length: 4, HasMore: true, NextLine: 2},
+		},
+		{
+			name:    "crlf lines",
+			content: "a\r\nb\r\nc\r\n",
+			opts:    ReadFileOptions{StartLine: 2, EndLine: 2},
+			want:    ReadFileResult{Content: "b\r\n", TotalLines: 3, StartLine: 2, EndLine: 2, Offset: 3, Length: 3, HasMore: true, NextLine: 3},
+		},
+		{
+			name:    "empty file by line",
+			content: "",
+			opts:    ReadFileOptions{StartLine: 1},
+			want:    ReadFileResult{StartLine: 1},
+		},
+		{
+			name:    "byte range",
+			content: readTestFile,
+			opts:    ReadFileOptions{Offset: 4, Length: 6},
+			want:    ReadFileResult{Content: "two\nth", TotalLines: 5, Offset: 4, Length: 6, HasMore: true, NextOffset: 10},
+		},
+		{
+			name:    "offset to end of file",
+			content: readTestFile,
+			opts:    ReadFileOptions{Offset: 20},
+			want:    ReadFileResult{Content: "ive", TotalLines: 5, Offset: 20, Length: 3},
+		},
+		{
+			name:    "length past end of file",
+			content: readTestFile,
+			opts:    ReadFileOptions{Offset: 19, Length: 100},
+			want:    ReadFileResult{Content: "five", TotalLines: 5, Offset: 19, Length: 4},
+		},
+		{
+			name:    "offset at end of file",
+			content: readTestFile,
+			opts:    ReadFileOptions{Offset: 23},
+			want:    ReadFileResult{TotalLines: 5, Offset: 23},
+		},
+		{
+			// 不在多字节字符中间截断
+			name:    "byte range ends inside a character",
+			content: "h\u00e9llo",
+			opts:    ReadFileOptions{Length: 2},
+			want:    ReadFileResult{Content: "h", TotalLines: 1, Length: 1, HasMore: true, NextOffset: 1},
+		},
+		{
+			name:    "counts a final newline once",
+			content: "a\nb\n",
+			want:    ReadFileResult{Content: "a\nb\n", TotalLines: 2, Length: 4},
+		},
+		{name: "start line beyond end of file", content: readTestFile, opts: ReadFileOptions{StartLine: 6}, wantErr: "start line 6 is beyond end of file (5 lines)"},
+		{name: "offset beyond end of file", content: readTestFile, opts: ReadFileOptions{Offset: 24}, wantErr: "offset 24 is beyond end of file"},
+		{name: "reversed line range", content: readTestFile, opts: ReadFileOptions{StartLine: 3, EndLine: 2}, wantErr: "invalid line range: 3-2"},
+		{name: "negative offset", content: readTestFile, opts: ReadFileOptions{Offset: -1}, wantErr: "negative values"},
+		{name: "lines and bytes together", content: readTestFile, opts: ReadFileOptions{StartLine: 1, Length: 3}, wantErr: "cannot be used together"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupLockRoot(t)
+			writeTestFiles(t, root, map[string]string{"f.txt": tt.content})
+			r, err := ReadFile(filepath.Join(root, "f.txt"), tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkReadRange(t, r, tt.want)
+			if r.Size != int64(len(tt.content)) {
+				t.Errorf("size = %d, want %d", r.Size, len(tt.content))
+			}
+		})
+	}
+}
+
+func checkReadRange(t *testing.T, got *ReadFileResult, want ReadFileResult) {
+	t.Helper()
+	if got.Content != want.Content {
+		t.Errorf("content = %q, want %q", abbreviate(got.Content), abbreviate(want.Content))
+	}
+	if got.TotalLines != want.TotalLines || got.StartLine != want.StartLine || got.EndLine != want.EndLine || got.NextLine != want.NextLine {
+		t.Errorf("total/start/end/next line = %d/%d/%d/%d, want %d/%d/%d/%d",
+			got.TotalLines, got.StartLine, got.EndLine, got.NextLine, want.TotalLines, want.StartLine, want.EndLine, want.NextLine)
+	}
+	if got.Offset != want.Offset || got.Length != want.Length || got.NextOffset != want.NextOffset || got.HasMore != want.HasMore {
+		t.Errorf("offset/length/next offset/has more = %d/%d/%d/%v, want %d/%d/%d/%v",
+			got.Offset, got.Length, got.NextOffset, got.HasMore, want.Offset, want.Length, want.NextOffset, want.HasMore)
+	}
+}
+
+// 很长的内容只显示开头和结尾
+func abbreviate(s string) string {
+	if len(s) <= 80 {
+		return s
+	}
+	return s[:40] + "..." + s[len(s)-40:]
+}
+
+func TestReadFileMaxReadBytes(t *testing.T) {
+	root := setupLockRoot(t)
+	line := strings.Repeat("x", 999) + "\n"
+	// 300行，每行1000字节，超过单次读取的上限
+	lines := strings.Repeat(line, 300)
+	long := strings.Repeat("a", int(MaxReadBytes)+100)
+	wide := strings.Repeat("a", int(MaxReadBytes)-1) + strings.Repeat("\u00e9", 10) + "\n"
+	writeTestFiles(t, root, map[string]string{
+		"lines.txt": lines,
+		"long.txt":  long + "\nshort\n",
+		"later.txt": "short\n" + long + "\n",
+		"wide.txt":  wide,
+	})
+	capped := int64(MaxReadBytes) / 1000
+
+	tests := []struct {
+		name string
+		file string
+		opts ReadFileOptions
+		want ReadFileResult
+	}{
+		{
+			name: "whole file capped",
+			file: "lines.txt",
+			want: ReadFileResult{Content: lines[:MaxReadBytes], TotalLines: 300, Length: MaxReadBytes, HasMore: true, NextOffset: MaxReadBytes},
+		},
+		{
+			name: "length capped",
+			file: "lines.txt",
+			opts: ReadFileOptions{Offset: 1000, Length: MaxReadBytes * 2},
+			want: ReadFileResult{Content: lines[1000 : 1000+MaxReadBytes], TotalLines: 300, Offset: 1000, Length: MaxReadBytes, HasMore: true, NextOffset: 1000 + MaxReadBytes},
+		},
+		{
+			// 只返回完整的行，剩余的行从NextLine继续读取
+			name: "line range capped at a line boundary",
+			file: "lines.txt",
+			opts: ReadFileOptions{StartLine: 1},
+			want: ReadFileResult{Content: lines[:capped*1000], TotalLines: 300, StartLine: 1, EndLine: int(capped), Length: capped * 1000, HasMore: true, NextLine: int(capped) + 1},
+		},
+		{
+			name: "rest of the lines",
+			file: "lines.txt",
+			opts: ReadFileOptions{StartLine: int(capped) + 1},
+			want: ReadFileResult{Content: lines[capped*1000:], TotalLines: 300, StartLine: int(capped) + 1, EndLine: 300, Offset: capped * 1000, Length: 300000 - capped*1000},
+		},
+		{
+			// 第一行超出上限时返回它的开头，NextOffset指向这一行剩余的内容
+			name: "first line longer than the cap",
+			file: "long.txt",
+			opts: ReadFileOptions{StartLine: 1, EndLine: 2},
+			want: ReadFileResult{Content: long[:MaxReadBytes], TotalLines: 2, StartLine: 1, EndLine: 1, Length: MaxReadBytes, HasMore: true, NextLine: 2, NextOffset: MaxReadBytes},
+		},
+		{
+			name: "rest of the first line",
+			file: "long.txt",
+			opts: ReadFileOptions{Offset: MaxReadBytes},
+			want: ReadFileResult{Content: long[MaxReadBytes:] + "\nshort\n", TotalLines: 2, Offset: MaxReadBytes, Length: 107},
+		},
+		{
+			name: "long line after the start",
+			file: "later.txt",
+			opts: ReadFileOptions{StartLine: 2},
+			want: ReadFileResult{Content: long[:MaxReadBytes], TotalLines: 2, StartLine: 2, EndLine: 2, Offset: 6, Length: MaxReadBytes, HasMore: true, NextOffset: 6 + MaxReadBytes},
+		},
+		{
+			name: "long line stops before the cap",
+			file: "later.txt",
+			opts: ReadFileOptions{StartLine: 1},
+			want: ReadFileResult{Content: "short\n", TotalLines: 2, StartLine: 1, EndLine: 1, Length: 6, HasMore: true, NextLine: 2},
+		},
+		{
+			// 截断位置在多字节字符中间时退回到字符边界
+			name: "first line cut at a character boundary",
+			file: "wide.txt",
+			opts: ReadFileOptions{StartLine: 1},
+			want: ReadFileResult{Content: wide[:MaxReadBytes-1], TotalLines: 1, StartLine: 1, EndLine: 1, Length: MaxReadBytes - 1, HasMore: true, NextOffset: MaxReadBytes - 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ReadFile(filepath.Join(root, tt.file), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkReadRange(t, r, tt.want)
+		})
+	}
+}
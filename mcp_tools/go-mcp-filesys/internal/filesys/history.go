@@ -0,0 +1,667 @@
+package filesys
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 操作历史的默认保留限制
+const (
+	DefaultHistoryMaxEntries       = 200
+	DefaultHistoryMaxBytes   int64 = 512 * 1024 * 1024
+)
+
+// 超过该大小的文件或目录不保存内容，相关操作无法撤销
+const MaxHistoryItemBytes int64 = 64 * 1024 * 1024
+
+// 历史记录中保存元数据的文件名
+const historyEntryFile = "entry.json"
+
+// 操作历史配置
+type HistoryConfig struct {
+	// 保存历史记录的目录，为空时不记录历史。不能位于任何根目录内
+	Dir string
+	// 最多保留的记录数
+	MaxEntries int
+	// 所有记录占用的最大字节数
+	MaxBytes int64
+}
+
+// 路径在某一时刻的状态
+type HistoryState struct {
+	Exists  bool      `json:"exists"`
+	IsDir   bool      `json:"is_dir,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// 一次操作涉及的路径及其操作前的状态
+type HistoryFile struct {
+	Path    string      `json:"path"`
+	Existed bool        `json:"existed"`
+	IsDir   bool        `json:"is_dir,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	ModTime time.Time   `json:"mod_time"`
+	Size    int64       `json:"size,omitempty"`
+	// 是否保存了操作前的内容
+	Saved bool `json:"saved"`
+	// 只记录了权限等元数据，恢复时不改变内容
+	MetadataOnly bool `json:"metadata_only,omitempty"`
+	// 被移动到的路径，撤销时移回原处
+	MovedTo string `json:"moved_to,omitempty"`
+	Blob    string `json:"blob,omitempty"`
+	// 操作完成后的状态，撤销前用来检测之后是否又被修改过
+	After *HistoryState `json:"after,omitempty"`
+}
+
+// 一条操作历史记录
+type HistoryEntry struct {
+	ID     string        `json:"id"`
+	Time   time.Time     `json:"time"`
+	Op     string        `json:"op"`
+	Files  []HistoryFile `json:"files"`
+	Bytes  int64         `json:"bytes"`
+	Undone bool          `json:"undone,omitempty"`
+}
+
+var (
+	historyMu      sync.Mutex
+	historyConfig  HistoryConfig
+	historyEntries []*HistoryEntry
+	historySeq     int
+)
+
+// 设置操作历史目录并加载已有的记录
+func SetHistory(cfg HistoryConfig) error {
+	if cfg.Dir != "" {
+		absDir, err := filepath.Abs(cfg.Dir)
+		if err != nil {
+			return fmt.Errorf("invalid history directory: %w", err)
+		}
+		if err := os.MkdirAll(absDir, 0700); err != nil {
+			return fmt.Errorf("failed to create history directory: %w", err)
+		}
+		if realDir, err := filepath.EvalSymlinks(absDir); err == nil {
+			absDir = realDir
+		}
+		for _, root := range ListRoots() {
+			if isPathWithin(absDir, root.Path) || isPathWithin(root.Path, absDir) {
+				return fmt.Errorf("history directory %s must not overlap root %s", absDir, root.Name)
+			}
+		}
+		cfg.Dir = absDir
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultHistoryMaxEntries
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultHistoryMaxBytes
+	}
+
+	entries := make([]*HistoryEntry, 0)
+	if cfg.Dir != "" {
+		dirs, err := os.ReadDir(cfg.Dir)
+		if err != nil {
+			return fmt.Errorf("failed to read history directory: %w", err)
+		}
+		for _, d := range dirs {
+			data, err := os.ReadFile(filepath.Join(cfg.Dir, d.Name(), historyEntryFile))
+			if err != nil {
+				continue
+			}
+			entry := &HistoryEntry{}
+			if err := json.Unmarshal(data, entry); err != nil || entry.ID != d.Name() {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	historyConfig = cfg
+	historyEntries = entries
+	pruneHistoryLocked()
+	return nil
+}
+
+// 正在进行的操作的历史记录
+type historyRecord struct {
+	entry *HistoryEntry
+	dir   string
+}
+
+// 开始记录一次修改操作，保存paths中每个路径操作前的状态。
+// 未启用历史时返回nil，nil记录的所有方法都可以安全调用
+func beginHistory(op string, paths ...string) (*historyRecord, error) {
+	historyMu.Lock()
+	dir := historyConfig.Dir
+	historySeq++
+	id := fmt.Sprintf("%d-%06d", time.Now().UnixNano(), historySeq%1000000)
+	historyMu.Unlock()
+	if dir == "" {
+		return nil, nil
+	}
+
+	r := &historyRecord{
+		entry: &HistoryEntry{ID: id, Time: time.Now(), Op: op, Files: make([]HistoryFile, 0, len(paths))},
+		dir:   filepath.Join(dir, id),
+	}
+	if err := os.Mkdir(r.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to record history: %w", err)
+	}
+	for _, p := range paths {
+		if err := r.snapshot(p); err != nil {
+			r.discard()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// 保存路径当前的状态和内容，同一路径只保存第一次
+func (r *historyRecord) snapshot(path string) error {
+	if r == nil || r.has(path) {
+		return nil
+	}
+	file, info, err := r.describe(path)
+	if err != nil || info == nil {
+		return err
+	}
+	size, err := pathSize(path)
+	if err != nil {
+		return fmt.Errorf("failed to record history for %s: %w", DisplayPath(path), err)
+	}
+	if size <= MaxHistoryItemBytes {
+		file.Blob = fmt.Sprintf("%d", len(r.entry.Files))
+		if err := copyPath(path, filepath.Join(r.dir, file.Blob)); err != nil {
+			return fmt.Errorf("failed to record history for %s: %w", DisplayPath(path), err)
+		}
+		file.Saved = true
+	}
+	file.Size = size
+	r.entry.Files = append(r.entry.Files, file)
+	return nil
+}
+
+// 只保存路径的元数据，用于修改权限等不改变内容的操作
+func (r *historyRecord) snapshotMeta(path string) error {
+	if r == nil || r.has(path) {
+		return nil
+	}
+	file, info, err := r.describe(path)
+	if err != nil || info == nil {
+		return err
+	}
+	file.MetadataOnly = true
+	r.entry.Files = append(r.entry.Files, file)
+	return nil
+}
+
+// 记录移动操作：源路径撤销时移回，目标路径保存原有内容
+func (r *historyRecord) recordMove(from string, to string) error {
+	if r == nil {
+		return nil
+	}
+	file, info, err := r.describe(from)
+	if err != nil || info == nil {
+		return err
+	}
+	file.MovedTo = to
+	r.entry.Files = append(r.entry.Files, file)
+	return r.snapshot(to)
+}
+
+// 删除路径：启用历史时移入历史目录作为回收站，否则直接删除。
+// 超过历史记录总大小限制的路径放不进回收站（移入后会被立即清理），直接删除且无法撤销
+func (r *historyRecord) trash(path string) error {
+	if r == nil {
+		return os.RemoveAll(path)
+	}
+	file, info, err := r.describe(path)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return nil
+	}
+	size, err := pathSize(path)
+	if err != nil {
+		return fmt.Errorf("failed to record history for %s: %w", DisplayPath(path), err)
+	}
+	historyMu.Lock()
+	maxBytes := historyConfig.MaxBytes
+	historyMu.Unlock()
+	if size > maxBytes {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		file.Size = size
+		r.entry.Files = append(r.entry.Files, file)
+		return nil
+	}
+	file.Blob = fmt.Sprintf("%d", len(r.entry.Files))
+	if err := movePath(path, filepath.Join(r.dir, file.Blob)); err != nil {
+		return err
+	}
+	file.Saved = true
+	file.Size, _ = pathSize(filepath.Join(r.dir, file.Blob))
+	r.entry.Files = append(r.entry.Files, file)
+	return nil
+}
+
+func (r *historyRecord) has(path string) bool {
+	for _, f := range r.entry.Files {
+		if f.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// 读取路径当前的元数据。路径不存在时记录为不存在并返回nil，
+// 父目录也不存在时记录最上层不存在的目录，撤销时一并删除操作中创建的父目录
+func (r *historyRecord) describe(path string) (HistoryFile, fs.FileInfo, error) {
+	file := HistoryFile{Path: path}
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			file.Path = topmostMissing(path)
+			if !r.has(file.Path) {
+				r.entry.Files = append(r.entry.Files, file)
+			}
+			return file, nil, nil
+		}
+		return file, nil, fmt.Errorf("failed to record history for %s: %w", DisplayPath(path), err)
+	}
+	file.Existed = true
+	file.IsDir = info.IsDir()
+	file.Mode = info.Mode().Perm()
+	file.ModTime = info.ModTime()
+	return file, info, nil
+}
+
+// 结束记录：操作失败时丢弃记录并返回原错误，成功时保存记录并按保留限制清理旧记录
+func (r *historyRecord) finish(opErr error) error {
+	if r == nil {
+		return opErr
+	}
+	if opErr != nil {
+		r.discard()
+		return opErr
+	}
+	for i := range r.entry.Files {
+		state := currentState(r.entry.Files[i].Path)
+		r.entry.Files[i].After = &state
+	}
+	r.entry.Bytes, _ = pathSize(r.dir)
+	if err := writeHistoryEntry(r.dir, r.entry); err != nil {
+		// 操作已经完成，只能放弃这条记录
+		log.Printf("failed to save history entry %s: %v", r.entry.ID, err)
+		os.RemoveAll(r.dir)
+		return nil
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	historyEntries = append(historyEntries, r.entry)
+	pruneHistoryLocked()
+	return nil
+}
+
+// 丢弃记录。已经移入回收站的内容会先恢复到原处
+func (r *historyRecord) discard() {
+	if r == nil {
+		return
+	}
+	for i := len(r.entry.Files) - 1; i >= 0; i-- {
+		f := r.entry.Files[i]
+		if f.Saved && f.Blob != "" {
+			if _, err := os.Lstat(f.Path); os.IsNotExist(err) {
+				movePath(filepath.Join(r.dir, f.Blob), f.Path)
+			}
+		}
+	}
+	os.RemoveAll(r.dir)
+}
+
+func writeHistoryEntry(dir string, entry *HistoryEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return safeWriteFile(filepath.Join(dir, historyEntryFile), data, 0600)
+}
+
+// 按记录数和总大小清理最旧的记录，最新的一条（刚写入的记录）总是保留。调用者需要持有historyMu
+func pruneHistoryLocked() {
+	var total int64
+	for _, e := range historyEntries {
+		total += e.Bytes
+	}
+	for len(historyEntries) > 1 && (len(historyEntries) > historyConfig.MaxEntries || total > historyConfig.MaxBytes) {
+		oldest := historyEntries[0]
+		historyEntries = historyEntries[1:]
+		total -= oldest.Bytes
+		if historyConfig.Dir != "" {
+			os.RemoveAll(filepath.Join(historyConfig.Dir, oldest.ID))
+		}
+	}
+}
+
+// 路径本身或其最上层不存在的父目录（不超出所在的根目录）
+func topmostMissing(path string) string {
+	root := rootForPath(path)
+	for {
+		parent := filepath.Dir(path)
+		if parent == path || (root != nil && !isPathWithin(parent, root.Path)) {
+			return path
+		}
+		if _, err := os.Lstat(parent); err == nil {
+			return path
+		}
+		path = parent
+	}
+}
+
+func currentState(path string) HistoryState {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return HistoryState{}
+	}
+	state := HistoryState{Exists: true, IsDir: info.IsDir(), ModTime: info.ModTime()}
+	if !info.IsDir() {
+		state.Size = info.Size()
+	}
+	return state
+}
+
+// 文件大小或目录中所有文件的总大小
+func pathSize(path string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// 列出操作历史，最新的在前。path不为空时只返回涉及该路径（或其中文件）的记录
+func ListHistory(path string, limit int) []HistoryEntry {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	result := make([]HistoryEntry, 0)
+	for i := len(historyEntries) - 1; i >= 0; i-- {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		e := historyEntries[i]
+		if path != "" && !entryTouches(e, path) {
+			continue
+		}
+		view := *e
+		view.Files = make([]HistoryFile, len(e.Files))
+		for j, f := range e.Files {
+			f.Path = DisplayPath(f.Path)
+			if f.MovedTo != "" {
+				f.MovedTo = DisplayPath(f.MovedTo)
+			}
+			f.Blob = ""
+			view.Files[j] = f
+		}
+		result = append(result, view)
+	}
+	return result
+}
+
+func entryTouches(e *HistoryEntry, path string) bool {
+	for _, f := range e.Files {
+		if isPathWithin(f.Path, path) || (f.MovedTo != "" && isPathWithin(f.MovedTo, path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 撤销最近一次尚未撤销的操作（撤销和恢复操作本身除外），返回被撤销的记录。
+// force为false时，如果涉及的路径在操作之后又被修改过则拒绝撤销
+func UndoLast(force bool) (*HistoryEntry, error) {
+	historyMu.Lock()
+	if historyConfig.Dir == "" {
+		historyMu.Unlock()
+		return nil, fmt.Errorf("operation history is disabled")
+	}
+	var target *HistoryEntry
+	for i := len(historyEntries) - 1; i >= 0; i-- {
+		e := historyEntries[i]
+		if !e.Undone && !strings.HasPrefix(e.Op, "undo ") && !strings.HasPrefix(e.Op, "restore ") {
+			target = e
+			break
+		}
+	}
+	dir := historyConfig.Dir
+	historyMu.Unlock()
+	if target == nil {
+		return nil, fmt.Errorf("nothing to undo")
+	}
+
+	// 检查和恢复期间锁定涉及的路径，避免检查之后被其他写入修改
+	unlock := lockPaths(historyPaths(target.Files)...)
+	defer unlock()
+	historyMu.Lock()
+	undone := target.Undone
+	historyMu.Unlock()
+	if undone {
+		return nil, fmt.Errorf("%s was undone by another request", target.ID)
+	}
+
+	entryDir := filepath.Join(dir, target.ID)
+	for _, f := range target.Files {
+		if err := checkRestorable(f, force); err != nil {
+			return nil, fmt.Errorf("cannot undo %s (%s): %w", target.ID, target.Op, err)
+		}
+	}
+
+	rec, err := beginHistory("undo "+target.ID, historyPaths(target.Files)...)
+	if err != nil {
+		return nil, err
+	}
+	err = restoreHistoryFiles(entryDir, target.Files)
+	if err := rec.finish(err); err != nil {
+		return nil, fmt.Errorf("undo of %s failed: %w", target.ID, err)
+	}
+
+	historyMu.Lock()
+	target.Undone = true
+	historyMu.Unlock()
+	if err := writeHistoryEntry(entryDir, target); err != nil {
+		log.Printf("failed to update history entry %s: %v", target.ID, err)
+	}
+	return historyEntryView(target.ID), nil
+}
+
+// 把单个路径恢复到某条记录中保存的操作前状态。
+// id为空时使用涉及该路径的最近一条记录
+func RestoreFile(path string, id string, force bool) (*HistoryEntry, error) {
+	historyMu.Lock()
+	if historyConfig.Dir == "" {
+		historyMu.Unlock()
+		return nil, fmt.Errorf("operation history is disabled")
+	}
+	var target *HistoryEntry
+	var file HistoryFile
+	for i := len(historyEntries) - 1; i >= 0 && target == nil; i-- {
+		e := historyEntries[i]
+		if id != "" && e.ID != id {
+			continue
+		}
+		for _, f := range e.Files {
+			if f.Path == path {
+				target, file = e, f
+				break
+			}
+		}
+	}
+	dir := historyConfig.Dir
+	historyMu.Unlock()
+	if target == nil {
+		if id != "" {
+			return nil, fmt.Errorf("history entry %s does not contain %s", id, DisplayPath(path))
+		}
+		return nil, fmt.Errorf("no history found for %s", DisplayPath(path))
+	}
+
+	unlock := lockPaths(historyPaths([]HistoryFile{file})...)
+	defer unlock()
+	if err := checkRestorable(file, force); err != nil {
+		return nil, fmt.Errorf("cannot restore %s from %s: %w", DisplayPath(path), target.ID, err)
+	}
+	rec, err := beginHistory("restore "+target.ID, historyPaths([]HistoryFile{file})...)
+	if err != nil {
+		return nil, err
+	}
+	err = restoreHistoryFiles(filepath.Join(dir, target.ID), []HistoryFile{file})
+	if err := rec.finish(err); err != nil {
+		return nil, fmt.Errorf("restore of %s failed: %w", DisplayPath(path), err)
+	}
+	return historyEntryView(target.ID), nil
+}
+
+// 按ID获取一条历史记录，路径转换为显示形式
+func historyEntryView(id string) *HistoryEntry {
+	for _, e := range ListHistory("", 0) {
+		if e.ID == id {
+			return &e
+		}
+	}
+	return nil
+}
+
+func historyPaths(files []HistoryFile) []string {
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Path)
+		if f.MovedTo != "" {
+			paths = append(paths, f.MovedTo)
+		}
+	}
+	return paths
+}
+
+// 检查路径是否可以恢复：必须可写、内容已保存，且操作之后没有被再次修改
+func checkRestorable(f HistoryFile, force bool) error {
+	if err := checkWritable(f.Path); err != nil {
+		return err
+	}
+	if f.MovedTo != "" {
+		if err := checkWritable(f.MovedTo); err != nil {
+			return err
+		}
+	} else if f.Existed && !f.Saved && !f.MetadataOnly {
+		return fmt.Errorf("previous content of %s was not saved (%d bytes, too large for the history)", DisplayPath(f.Path), f.Size)
+	}
+	if force || f.After == nil {
+		return nil
+	}
+	current := currentState(f.Path)
+	after := *f.After
+	if current.Exists != after.Exists || current.IsDir != after.IsDir || current.Size != after.Size || !current.ModTime.Equal(after.ModTime) {
+		return fmt.Errorf("%s was modified after the operation, use force to override", DisplayPath(f.Path))
+	}
+	return nil
+}
+
+// 恢复记录中的路径：先把移动过的路径移回，再按相反顺序恢复其他路径
+func restoreHistoryFiles(entryDir string, files []HistoryFile) error {
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		if f.MovedTo == "" {
+			continue
+		}
+		if _, err := os.Lstat(f.Path); err == nil {
+			continue
+		}
+		if _, err := os.Lstat(f.MovedTo); err != nil {
+			return fmt.Errorf("cannot move %s back: %s no longer exists", DisplayPath(f.Path), DisplayPath(f.MovedTo))
+		}
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+			return err
+		}
+		if err := movePath(f.MovedTo, f.Path); err != nil {
+			return fmt.Errorf("failed to move %s back: %w", DisplayPath(f.Path), err)
+		}
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		if f.MovedTo != "" {
+			continue
+		}
+		if err := restoreHistoryFile(entryDir, f); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", DisplayPath(f.Path), err)
+		}
+	}
+	return nil
+}
+
+func restoreHistoryFile(entryDir string, f HistoryFile) error {
+	if !f.Existed {
+		if err := os.RemoveAll(f.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if f.MetadataOnly {
+		if err := os.Chmod(f.Path, f.Mode); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	blob := filepath.Join(entryDir, f.Blob)
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	if f.IsDir {
+		if err := os.RemoveAll(f.Path); err != nil {
+			return err
+		}
+		if err := copyPath(blob, f.Path); err != nil {
+			return err
+		}
+	} else {
+		content, err := os.ReadFile(blob)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Lstat(f.Path); err == nil && info.IsDir() {
+			if err := os.RemoveAll(f.Path); err != nil {
+				return err
+			}
+		}
+		if err := safeWriteFile(f.Path, content, f.Mode); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(f.Path, f.Mode); err != nil {
+		return err
+	}
+	return os.Chtimes(f.Path, f.ModTime, f.ModTime)
+}
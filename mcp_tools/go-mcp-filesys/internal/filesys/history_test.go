@@ -0,0 +1,138 @@
+package filesys
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 在根目录之外的临时目录中启用操作历史，测试结束后关闭
+func setupHistory(t *testing.T, maxBytes int64) {
+	t.Helper()
+	if err := SetHistory(HistoryConfig{Dir: t.TempDir(), MaxBytes: maxBytes}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetHistory(HistoryConfig{}) })
+}
+
+func TestUndoLastRestoresTree(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(root string) error
+	}{
+		{
+			name: "move file into new directory",
+			op: func(root string) error {
+				_, err := MoveFile(filepath.Join(root, "a.txt"), filepath.Join(root, "new/sub/a.txt"), MoveOptions{})
+				return err
+			},
+		},
+		{
+			name: "move file over existing file",
+			op: func(root string) error {
+				_, err := MoveFile(filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt"), MoveOptions{Conflict: ConflictOverwrite})
+				return err
+			},
+		},
+		{
+			name: "move directory",
+			op: func(root string) error {
+				_, err := MoveDirectory(filepath.Join(root, "dir"), filepath.Join(root, "renamed"), MoveOptions{})
+				return err
+			},
+		},
+		{
+			name: "delete file",
+			op: func(root string) error {
+				return DeleteFile(filepath.Join(root, "dir/c.txt"))
+			},
+		},
+		{
+			name: "delete directory",
+			op: func(root string) error {
+				return DeleteDirectory(filepath.Join(root, "dir"))
+			},
+		},
+		{
+			name: "write file",
+			op: func(root string) error {
+				_, err := WriteFile(filepath.Join(root, "a.txt"), "changed", "", TextOptions{})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupBatchTree(t)
+			setupHistory(t, 0)
+			before := snapshotTree(t, root)
+
+			if err := tt.op(root); err != nil {
+				t.Fatal(err)
+			}
+			if after := snapshotTree(t, root); reflect.DeepEqual(before, after) {
+				t.Fatal("operation did not change the tree")
+			}
+			if _, err := UndoLast(false); err != nil {
+				t.Fatal(err)
+			}
+			if after := snapshotTree(t, root); !reflect.DeepEqual(before, after) {
+				t.Errorf("tree not restored by undo:\nbefore %v\nafter  %v", before, after)
+			}
+			if _, err := UndoLast(false); err == nil || !strings.Contains(err.Error(), "nothing to undo") {
+				t.Errorf("second undo: got %v, want nothing to undo", err)
+			}
+		})
+	}
+}
+
+func TestUndoLastRefusesModifiedPath(t *testing.T) {
+	root := setupBatchTree(t)
+	setupHistory(t, 0)
+	file := filepath.Join(root, "a.txt")
+	if _, err := WriteFile(file, "first", "", TextOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// 在历史之外修改文件，撤销会覆盖这次修改，不强制时必须拒绝
+	if err := os.WriteFile(file, []byte("edited elsewhere"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UndoLast(false); err == nil {
+		t.Fatal("undo succeeded over a later modification")
+	}
+	if _, err := UndoLast(true); err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshotTree(t, root)["a.txt"]; got != "alpha\n" {
+		t.Errorf("a.txt = %q after forced undo, want alpha", got)
+	}
+}
+
+func TestHistoryKeepsEntriesWhenDeletingOversizedPath(t *testing.T) {
+	root := setupBatchTree(t)
+	// big.bin（200字节）超过历史记录的总大小限制，删除时不能进入回收站
+	setupHistory(t, 100)
+	if _, err := WriteFile(filepath.Join(root, "a.txt"), "changed", "", TextOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteFile(filepath.Join(root, "big.bin")); err != nil {
+		t.Fatal(err)
+	}
+	entries := ListHistory("", 0)
+	if len(entries) != 2 {
+		t.Fatalf("got %d history entries, want 2: %+v", len(entries), entries)
+	}
+	if _, err := UndoLast(false); err == nil || !strings.Contains(err.Error(), "was not saved") {
+		t.Fatalf("undo of oversized delete: got %v, want content not saved", err)
+	}
+	// 之前的记录仍然可以恢复
+	if _, err := RestoreFile(filepath.Join(root, "a.txt"), "", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshotTree(t, root)["a.txt"]; got != "alpha\n" {
+		t.Errorf("a.txt = %q after restore, want alpha", got)
+	}
+}
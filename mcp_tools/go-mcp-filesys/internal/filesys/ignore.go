@@ -0,0 +1,179 @@
+package filesys
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 每个目录中读取的忽略规则文件，后面的文件优先级更高
+var IgnoreFileNames = []string{".gitignore", ".ignore"}
+
+// 始终生效的忽略规则，优先级最低，可以被 .gitignore 中的 ! 规则取消
+var DefaultIgnorePatterns = []string{".git/", ".svn/", ".hg/", "node_modules/"}
+
+// 一条忽略规则
+type ignoreRule struct {
+	re       *regexp.Regexp
+	negate   bool
+	dirOnly  bool
+	basename bool
+	// 规则所在目录（相对于匹配器根目录，根目录为空字符串）
+	base string
+}
+
+// gitignore风格的忽略规则匹配器。
+// 规则按目录懒加载并缓存，可以在多个goroutine中并发使用
+type IgnoreMatcher struct {
+	root  string
+	mu    sync.Mutex
+	rules map[string][]ignoreRule
+}
+
+// 创建忽略规则匹配器，root为读取忽略文件的最上层目录
+func NewIgnoreMatcher(root string) *IgnoreMatcher {
+	m := &IgnoreMatcher{
+		root:  filepath.Clean(root),
+		rules: make(map[string][]ignoreRule),
+	}
+	defaults := make([]ignoreRule, 0, len(DefaultIgnorePatterns))
+	for _, p := range DefaultIgnorePatterns {
+		if rule, ok := parseIgnoreLine(p, ""); ok {
+			defaults = append(defaults, rule)
+		}
+	}
+	// 根目录的规则：默认规则 + .git/info/exclude + 根目录的忽略文件
+	rootRules := append(defaults, loadIgnoreFile(filepath.Join(m.root, ".git", "info", "exclude"), "")...)
+	for _, name := range IgnoreFileNames {
+		rootRules = append(rootRules, loadIgnoreFile(filepath.Join(m.root, name), "")...)
+	}
+	m.rules[""] = rootRules
+	return m
+}
+
+// 为指定目录创建匹配器，忽略文件从该目录所在的根目录开始读取
+func newIgnoreMatcherFor(directory string) *IgnoreMatcher {
+	if root := rootForPath(directory); root != nil {
+		return NewIgnoreMatcher(root.Path)
+	}
+	return NewIgnoreMatcher(directory)
+}
+
+// 判断路径是否被忽略。
+// 与git一致，只检查路径本身，遍历时被忽略的目录会整体跳过
+func (m *IgnoreMatcher) Match(absPath string, isDir bool) bool {
+	rel, err := filepath.Rel(m.root, absPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || rel == ".." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	ignored := false
+	dir := ""
+	parts := strings.Split(path.Dir(rel), "/")
+	for i := -1; i < len(parts); i++ {
+		if i >= 0 {
+			if parts[i] == "." {
+				break
+			}
+			dir = path.Join(dir, parts[i])
+		}
+		for _, rule := range m.rulesFor(dir) {
+			if rule.matches(rel, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// 获取目录中定义的规则，第一次访问时从磁盘读取
+func (m *IgnoreMatcher) rulesFor(dir string) []ignoreRule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rules, ok := m.rules[dir]; ok {
+		return rules
+	}
+	rules := make([]ignoreRule, 0)
+	for _, name := range IgnoreFileNames {
+		rules = append(rules, loadIgnoreFile(filepath.Join(m.root, filepath.FromSlash(dir), name), dir)...)
+	}
+	m.rules[dir] = rules
+	return rules
+}
+
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	if r.basename {
+		return r.re.MatchString(path.Base(rel))
+	}
+	return r.re.MatchString(rel)
+}
+
+// 读取忽略规则文件，文件不存在时返回空
+func loadIgnoreFile(file string, base string) []ignoreRule {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	rules := make([]ignoreRule, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// 解析一行gitignore规则
+func parseIgnoreLine(line string, base string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// 去掉末尾未转义的空格
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	// 不含 / 的规则匹配任意层级的文件名，否则相对于规则所在目录匹配
+	rule.basename = !strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	re, err := globToRegexp(line, false)
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
@@ -0,0 +1,102 @@
+package filesys
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcherMatch(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		".gitignore": "# comment\n" +
+			"*.log\n" +
+			"!keep.log\n" +
+			"/top.txt\n" +
+			"doc/*.md\n" +
+			"build/\n" +
+			"**/gen/*.go\n" +
+			"!node_modules/\n" +
+			`\#hash` + "\n" +
+			`\!bang` + "\n" +
+			"trailing.txt   \n" +
+			"crlf.txt\r\n",
+		".ignore":           "!override.log\n",
+		".git/info/exclude": "secret.env\n",
+		"sub/.gitignore":    "*.tmp\n/local\n!important.log\n",
+		"sub/deep/.ignore":  "!keep.tmp\n",
+	})
+	m := NewIgnoreMatcher(root)
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		// 不含 / 的规则匹配任意层级的文件名，! 取消前面的规则
+		{path: "a.log", want: true},
+		{path: "x/y/a.log", want: true},
+		{path: "keep.log", want: false},
+		{path: "x/keep.log", want: false},
+		{path: "a.txt", want: false},
+		// 以 / 开头或含 / 的规则相对于规则所在目录匹配
+		{path: "top.txt", want: true},
+		{path: "x/top.txt", want: false},
+		{path: "doc/a.md", want: true},
+		{path: "doc/x/a.md", want: false},
+		{path: "x/doc/a.md", want: false},
+		{path: "gen/a.go", want: true},
+		{path: "x/y/gen/a.go", want: true},
+		{path: "x/gen/y/a.go", want: false},
+		// 以 / 结尾的规则只匹配目录，目录中的文件在遍历时随目录一起跳过
+		{path: "build", isDir: true, want: true},
+		{path: "x/build", isDir: true, want: true},
+		{path: "build", want: false},
+		{path: "build/out.bin", want: false},
+		// 默认规则可以被取消
+		{path: ".git", isDir: true, want: true},
+		{path: "node_modules", isDir: true, want: false},
+		// 转义、行尾空格和CRLF
+		{path: "#hash", want: true},
+		{path: "!bang", want: true},
+		{path: "trailing.txt", want: true},
+		{path: "crlf.txt", want: true},
+		// .ignore优先于同一目录的 .gitignore
+		{path: "override.log", want: false},
+		{path: "secret.env", want: true},
+		{path: "x/secret.env", want: true},
+		// 子目录的规则只作用于该目录，并且可以取消上级目录的规则
+		{path: "sub/a.tmp", want: true},
+		{path: "sub/x/a.tmp", want: true},
+		{path: "a.tmp", want: false},
+		{path: "sub/local", want: true},
+		{path: "sub/x/local", want: false},
+		{path: "local", want: false},
+		{path: "sub/important.log", want: false},
+		{path: "sub/x/important.log", want: false},
+		{path: "important.log", want: true},
+		{path: "sub/deep/keep.tmp", want: false},
+		{path: "sub/keep.tmp", want: true},
+		// 根目录本身和根目录之外的路径不会被忽略
+		{path: ".", isDir: true, want: false},
+		{path: "../a.log", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := m.Match(filepath.Join(root, filepath.FromSlash(tt.path)), tt.isDir); got != tt.want {
+				t.Errorf("Match(%s, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreMatcherNoIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	m := NewIgnoreMatcher(root)
+	if m.Match(filepath.Join(root, "a.log"), false) {
+		t.Error("file ignored without any rules")
+	}
+	if !m.Match(filepath.Join(root, "x", "node_modules"), true) {
+		t.Error("default rules not applied")
+	}
+}
@@ -0,0 +1,369 @@
+package filesys
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 列目录时每页默认和最多返回的条目数
+const (
+	DefaultListLimit = 500
+	MaxListLimit     = 5000
+)
+
+// 排序字段
+const (
+	ListSortPath    = "path"
+	ListSortName    = "name"
+	ListSortSize    = "size"
+	ListSortModTime = "mod_time"
+	ListSortType    = "type"
+)
+
+// 条目类型
+const (
+	EntryFile      = "file"
+	EntryDirectory = "directory"
+	EntrySymlink   = "symlink"
+	EntryOther     = "other"
+)
+
+// 列目录的选项
+type ListOptions struct {
+	// 最大深度，直接位于目录中的条目深度为1，0表示不限制
+	MaxDepth int
+	// 跳过 .gitignore 等规则忽略的文件
+	RespectIgnore bool
+	// 只返回这些类型的条目，为空表示全部
+	Types []string
+	// 只返回这些扩展名的文件，例如 ".go"，不区分大小写
+	Extensions []string
+	// 文件大小范围，nil表示不限制。设置后只返回普通文件
+	MinSize *int64
+	MaxSize *int64
+	// 修改时间范围，零值表示不限制
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// 排序字段和方向
+	SortBy     string
+	Descending bool
+	// 每页条目数和上一页返回的游标
+	Limit  int
+	Cursor string
+}
+
+// 目录中的一个条目
+type ListEntry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Type    string    `json:"type"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Mode    string    `json:"mode"`
+	Depth   int       `json:"depth"`
+}
+
+// 列目录的结果，NextCursor不为空时表示还有更多条目
+type ListResult struct {
+	Directory  string      `json:"directory"`
+	Entries    []ListEntry `json:"entries"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	// 无法读取的目录数
+	Errors int `json:"errors,omitempty"`
+}
+
+// 游标记录排序方式和上一页最后一个条目，下一页从它之后开始
+type listCursor struct {
+	SortBy     string     `json:"s"`
+	Descending bool       `json:"d,omitempty"`
+	Path       string     `json:"p"`
+	Name       string     `json:"n,omitempty"`
+	Type       string     `json:"t,omitempty"`
+	Size       int64      `json:"z,omitempty"`
+	ModTime    *time.Time `json:"m,omitempty"`
+}
+
+// 已收集到足够的条目，停止遍历
+var errListComplete = errors.New("listing complete")
+
+// 列出目录中的条目，返回结构化的结果。
+// 按路径升序排列时边遍历边分页，只读取游标之后的部分；其他排序方式需要遍历整个目录
+func ListDirectory(directory string, opts ListOptions) (*ListResult, error) {
+	if !isPathInAllowedDirectory(directory) {
+		return nil, fmt.Errorf("directory access not allowed: %s", directory)
+	}
+	directory = filepath.Clean(directory)
+	info, err := os.Stat(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", directory)
+	}
+
+	if opts.SortBy == "" {
+		opts.SortBy = ListSortPath
+	}
+	switch opts.SortBy {
+	case ListSortPath, ListSortName, ListSortSize, ListSortModTime, ListSortType:
+	default:
+		return nil, fmt.Errorf("unsupported sort field: %s", opts.SortBy)
+	}
+	for _, t := range opts.Types {
+		switch t {
+		case EntryFile, EntryDirectory, EntrySymlink, EntryOther:
+		default:
+			return nil, fmt.Errorf("unsupported entry type: %s", t)
+		}
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultListLimit
+	}
+	if opts.Limit > MaxListLimit {
+		opts.Limit = MaxListLimit
+	}
+
+	var after *ListEntry
+	if opts.Cursor != "" {
+		after, err = decodeListCursor(opts.Cursor, opts.SortBy, opts.Descending)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	l := &lister{opts: opts, after: after, entries: make([]ListEntry, 0)}
+	l.opts.Extensions = make([]string, 0, len(opts.Extensions))
+	for _, ext := range opts.Extensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		l.opts.Extensions = append(l.opts.Extensions, ext)
+	}
+	if opts.RespectIgnore {
+		l.matcher = newIgnoreMatcherFor(directory)
+	}
+	// 按路径升序时遍历顺序就是输出顺序，多读一个条目用于判断是否还有下一页
+	l.streaming = opts.SortBy == ListSortPath && !opts.Descending
+	if err := l.walk(directory, "", 1); err != nil && err != errListComplete {
+		return nil, err
+	}
+
+	entries := l.entries
+	if !l.streaming {
+		sort.SliceStable(entries, func(i, j int) bool { return l.less(&entries[i], &entries[j]) })
+		if after != nil {
+			start := sort.Search(len(entries), func(i int) bool { return l.less(after, &entries[i]) })
+			entries = entries[start:]
+		}
+	}
+
+	result := &ListResult{Directory: DisplayPath(directory), Entries: entries, Errors: l.errors}
+	if len(entries) > opts.Limit {
+		result.Entries = entries[:opts.Limit]
+		result.NextCursor = encodeListCursor(&result.Entries[opts.Limit-1], opts.SortBy, opts.Descending)
+	}
+	return result, nil
+}
+
+type lister struct {
+	opts      ListOptions
+	matcher   *IgnoreMatcher
+	after     *ListEntry
+	streaming bool
+	entries   []ListEntry
+	errors    int
+}
+
+// 按文件名顺序递归读取目录，rel为相对于根目录的路径
+func (l *lister) walk(dir string, rel string, depth int) error {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		l.errors++
+		return nil
+	}
+	for _, d := range dirEntries {
+		path := filepath.Join(dir, d.Name())
+		childRel := d.Name()
+		if rel != "" {
+			childRel = rel + "/" + d.Name()
+		}
+		if l.matcher != nil && l.matcher.Match(path, d.IsDir()) {
+			continue
+		}
+		descend := d.IsDir() && (l.opts.MaxDepth <= 0 || depth < l.opts.MaxDepth)
+
+		// 跳过游标之前的条目，游标本身或游标位于其中的目录仍然需要进入
+		if l.streaming && l.after != nil && compareWalkOrder(childRel, l.after.Path) <= 0 {
+			if descend && (childRel == l.after.Path || strings.HasPrefix(l.after.Path, childRel+"/")) {
+				if err := l.walk(path, childRel, depth+1); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			l.errors++
+			continue
+		}
+		entry := ListEntry{
+			Name:    d.Name(),
+			Path:    childRel,
+			Type:    entryType(info.Mode()),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Mode:    info.Mode().String(),
+			Depth:   depth,
+		}
+		if l.match(&entry) {
+			l.entries = append(l.entries, entry)
+			if l.streaming && len(l.entries) > l.opts.Limit {
+				return errListComplete
+			}
+		}
+		if descend {
+			if err := l.walk(path, childRel, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 判断条目是否满足过滤条件
+func (l *lister) match(e *ListEntry) bool {
+	opts := &l.opts
+	if len(opts.Types) > 0 && !containsString(opts.Types, e.Type) {
+		return false
+	}
+	if len(opts.Extensions) > 0 || opts.MinSize != nil || opts.MaxSize != nil {
+		if e.Type != EntryFile {
+			return false
+		}
+	}
+	if len(opts.Extensions) > 0 && !containsString(opts.Extensions, strings.ToLower(filepath.Ext(e.Name))) {
+		return false
+	}
+	if opts.MinSize != nil && e.Size < *opts.MinSize {
+		return false
+	}
+	if opts.MaxSize != nil && e.Size > *opts.MaxSize {
+		return false
+	}
+	if !opts.ModifiedAfter.IsZero() && !e.ModTime.After(opts.ModifiedAfter) {
+		return false
+	}
+	if !opts.ModifiedBefore.IsZero() && !e.ModTime.Before(opts.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// 按排序字段比较两个条目，相同时按路径排序以保证分页稳定
+func (l *lister) less(a, b *ListEntry) bool {
+	c := 0
+	switch l.opts.SortBy {
+	case ListSortName:
+		c = strings.Compare(a.Name, b.Name)
+	case ListSortSize:
+		c = compareInt64(a.Size, b.Size)
+	case ListSortModTime:
+		c = a.ModTime.Compare(b.ModTime)
+	case ListSortType:
+		c = strings.Compare(a.Type, b.Type)
+	}
+	if c == 0 {
+		c = compareWalkOrder(a.Path, b.Path)
+	}
+	if l.opts.Descending {
+		return c > 0
+	}
+	return c < 0
+}
+
+// 按目录遍历顺序比较两个相对路径：逐级比较文件名，目录排在它的子条目之前
+func compareWalkOrder(a, b string) int {
+	as := strings.Split(a, "/")
+	bs := strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := strings.Compare(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return len(as) - len(bs)
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func entryType(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return EntrySymlink
+	case mode.IsDir():
+		return EntryDirectory
+	case mode.IsRegular():
+		return EntryFile
+	}
+	return EntryOther
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeListCursor(last *ListEntry, sortBy string, descending bool) string {
+	c := listCursor{SortBy: sortBy, Descending: descending, Path: last.Path}
+	switch sortBy {
+	case ListSortName:
+		c.Name = last.Name
+	case ListSortSize:
+		c.Size = last.Size
+	case ListSortModTime:
+		c.ModTime = &last.ModTime
+	case ListSortType:
+		c.Type = last.Type
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(cursor string, sortBy string, descending bool) (*ListEntry, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Path == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if c.SortBy != sortBy || c.Descending != descending {
+		return nil, fmt.Errorf("cursor was created with a different sort order, repeat the request with the same sortBy and order")
+	}
+	after := &ListEntry{Path: c.Path, Name: c.Name, Type: c.Type, Size: c.Size}
+	if c.ModTime != nil {
+		after.ModTime = *c.ModTime
+	}
+	return after, nil
+}
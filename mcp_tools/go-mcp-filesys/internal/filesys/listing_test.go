@@ -0,0 +1,226 @@
+package filesys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 构造测试目录，文件大小各不相同，修改时间按listTestFiles的顺序递增
+var listTestFiles = []struct {
+	path    string
+	content string
+}{
+	{"b.txt", "bb"},
+	{"a/x.TXT", "x"},
+	{"a/y/z.go", "zzzzz"},
+	{"a/y/w.md", "wwww"},
+	{"c/d/e/f.go", "ffffffff"},
+	{"c/d/e/g.log", "ggg"},
+	{".gitignore", "*.log\n"},
+}
+
+var listTestBase = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func setupListTree(t *testing.T) string {
+	t.Helper()
+	root := setupLockRoot(t)
+	for i, f := range listTestFiles {
+		writeTestFiles(t, root, map[string]string{f.path: f.content})
+		mtime := listTestBase.Add(time.Duration(i+1) * time.Hour)
+		if err := os.Chtimes(filepath.Join(root, filepath.FromSlash(f.path)), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("b.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func listPaths(entries []ListEntry) []string {
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		paths = append(paths, e.Path)
+	}
+	return paths
+}
+
+// 按limit逐页读取全部条目
+func listAllPages(t *testing.T, root string, opts ListOptions) []string {
+	t.Helper()
+	paths := make([]string, 0)
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatal("pagination does not terminate")
+		}
+		result, err := ListDirectory(root, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Entries) > opts.Limit {
+			t.Fatalf("page has %d entries, limit %d", len(result.Entries), opts.Limit)
+		}
+		paths = append(paths, listPaths(result.Entries)...)
+		if result.NextCursor == "" {
+			return paths
+		}
+		opts.Cursor = result.NextCursor
+	}
+}
+
+func TestListDirectoryPagination(t *testing.T) {
+	root := setupListTree(t)
+	walkOrder := []string{".gitignore", "a", "a/x.TXT", "a/y", "a/y/w.md", "a/y/z.go", "b.txt", "c", "c/d", "c/d/e", "c/d/e/f.go", "c/d/e/g.log", "empty", "link"}
+
+	tests := []struct {
+		sortBy     string
+		descending bool
+		// 为空时只检查分页结果与一次读取全部条目的结果相同
+		want []string
+	}{
+		{sortBy: ListSortPath, want: walkOrder},
+		{sortBy: ListSortPath, descending: true},
+		{sortBy: ListSortName},
+		{sortBy: ListSortName, descending: true},
+		{sortBy: ListSortSize},
+		{sortBy: ListSortSize, descending: true},
+		{sortBy: ListSortModTime},
+		{sortBy: ListSortType},
+	}
+
+	for _, tt := range tests {
+		for _, limit := range []int{1, 2, 3, 5} {
+			t.Run(fmt.Sprintf("%s desc=%v limit=%d", tt.sortBy, tt.descending, limit), func(t *testing.T) {
+				opts := ListOptions{SortBy: tt.sortBy, Descending: tt.descending}
+				all, err := ListDirectory(root, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := listPaths(all.Entries)
+				if all.NextCursor != "" || len(want) != len(walkOrder) {
+					t.Fatalf("full listing = %q", want)
+				}
+				if tt.want != nil && !reflect.DeepEqual(want, tt.want) {
+					t.Fatalf("order = %q, want %q", want, tt.want)
+				}
+				opts.Limit = limit
+				if got := listAllPages(t, root, opts); !reflect.DeepEqual(got, want) {
+					t.Errorf("pages = %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestListDirectorySortOrder(t *testing.T) {
+	root := setupListTree(t)
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{name: "name", opts: ListOptions{SortBy: ListSortName}, want: []string{".gitignore", "b.txt", "c/d/e/f.go", "c/d/e/g.log", "a/y/w.md", "a/x.TXT", "a/y/z.go"}},
+		{name: "size", opts: ListOptions{SortBy: ListSortSize}, want: []string{"a/x.TXT", "b.txt", "c/d/e/g.log", "a/y/w.md", "a/y/z.go", ".gitignore", "c/d/e/f.go"}},
+		{name: "size descending", opts: ListOptions{SortBy: ListSortSize, Descending: true}, want: []string{"c/d/e/f.go", ".gitignore", "a/y/z.go", "a/y/w.md", "c/d/e/g.log", "b.txt", "a/x.TXT"}},
+		{name: "mod time", opts: ListOptions{SortBy: ListSortModTime}, want: []string{"b.txt", "a/x.TXT", "a/y/z.go", "a/y/w.md", "c/d/e/f.go", "c/d/e/g.log", ".gitignore"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Types = []string{EntryFile}
+			result, err := ListDirectory(root, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := listPaths(result.Entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListDirectoryCursorErrors(t *testing.T) {
+	root := setupListTree(t)
+	first, err := ListDirectory(root, ListOptions{SortBy: ListSortSize, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.NextCursor == "" {
+		t.Fatal("no cursor returned")
+	}
+
+	tests := []struct {
+		name    string
+		opts    ListOptions
+		wantErr string
+	}{
+		{name: "different sort field", opts: ListOptions{SortBy: ListSortName, Cursor: first.NextCursor}, wantErr: "different sort order"},
+		{name: "different direction", opts: ListOptions{SortBy: ListSortSize, Descending: true, Cursor: first.NextCursor}, wantErr: "different sort order"},
+		{name: "default sort", opts: ListOptions{Cursor: first.NextCursor}, wantErr: "different sort order"},
+		{name: "not base64", opts: ListOptions{Cursor: "!!!"}, wantErr: "invalid cursor"},
+		{name: "not json", opts: ListOptions{Cursor: "bm90IGpzb24"}, wantErr: "invalid cursor"},
+		{name: "unknown sort field", opts: ListOptions{SortBy: "owner"}, wantErr: "unsupported sort field"},
+		{name: "unknown type", opts: ListOptions{Types: []string{"pipe"}}, wantErr: "unsupported entry type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ListDirectory(root, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListDirectoryFilters(t *testing.T) {
+	root := setupListTree(t)
+	size := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{name: "directories", opts: ListOptions{Types: []string{EntryDirectory}}, want: []string{"a", "a/y", "c", "c/d", "c/d/e", "empty"}},
+		{name: "symlinks", opts: ListOptions{Types: []string{EntrySymlink}}, want: []string{"link"}},
+		{name: "extensions ignore case and dot", opts: ListOptions{Extensions: []string{"txt", ".GO"}}, want: []string{"a/x.TXT", "a/y/z.go", "b.txt", "c/d/e/f.go"}},
+		{name: "min size", opts: ListOptions{MinSize: size(5)}, want: []string{".gitignore", "a/y/z.go", "c/d/e/f.go"}},
+		{name: "size range", opts: ListOptions{MinSize: size(2), MaxSize: size(4)}, want: []string{"a/y/w.md", "b.txt", "c/d/e/g.log"}},
+		{
+			name: "modified range",
+			opts: ListOptions{
+				Types:          []string{EntryFile},
+				ModifiedAfter:  listTestBase.Add(2 * time.Hour),
+				ModifiedBefore: listTestBase.Add(6 * time.Hour),
+			},
+			want: []string{"a/y/w.md", "a/y/z.go", "c/d/e/f.go"},
+		},
+		{name: "max depth", opts: ListOptions{MaxDepth: 1}, want: []string{".gitignore", "a", "b.txt", "c", "empty", "link"}},
+		{name: "max depth two", opts: ListOptions{MaxDepth: 2, Types: []string{EntryFile}}, want: []string{".gitignore", "a/x.TXT", "b.txt"}},
+		{name: "respect ignore", opts: ListOptions{RespectIgnore: true, Extensions: []string{"log", "go"}}, want: []string{"a/y/z.go", "c/d/e/f.go"}},
+		{name: "filters with pagination", opts: ListOptions{Extensions: []string{"go", "md"}, Limit: 1}, want: []string{"a/y/w.md", "a/y/z.go", "c/d/e/f.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts.Limit == 0 {
+				opts.Limit = DefaultListLimit
+			}
+			if got := listAllPages(t, root, opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package filesys
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// 写入时文件版本与预期不一致
+var ErrVersionConflict = errors.New("version conflict")
+
+// 按路径加锁，同一文件的读-改-写操作串行执行。
+// 锁在没有使用者时从表中删除，表的大小只与正在进行的操作数有关
+var (
+	pathLocksMu sync.Mutex
+	pathLocks   = make(map[string]*pathLock)
+)
+
+type pathLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// 锁定单个路径，返回解锁函数
+func lockPath(path string) func() {
+	return lockPaths(path)
+}
+
+// 同时锁定多个路径，按路径排序后依次加锁以避免死锁
+func lockPaths(paths ...string) func() {
+	keys := make([]string, 0, len(paths))
+	for _, p := range paths {
+		key := filepath.Clean(p)
+		if !containsString(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	locks := make([]*pathLock, len(keys))
+	pathLocksMu.Lock()
+	for i, key := range keys {
+		l := pathLocks[key]
+		if l == nil {
+			l = &pathLock{}
+			pathLocks[key] = l
+		}
+		l.refs++
+		locks[i] = l
+	}
+	pathLocksMu.Unlock()
+
+	for _, l := range locks {
+		l.mu.Lock()
+	}
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].mu.Unlock()
+		}
+		pathLocksMu.Lock()
+		for i, key := range keys {
+			locks[i].refs--
+			if locks[i].refs == 0 {
+				delete(pathLocks, key)
+			}
+		}
+		pathLocksMu.Unlock()
+	}
+}
+
+// 文件的版本标识，由修改时间和内容的SHA-256组成。
+// 写入工具的 expected_version 参数与它比较，不一致时拒绝写入
+func FileVersion(filePath string) (string, error) {
+	if !isPathInAllowedDirectory(filePath) {
+		return "", fmt.Errorf("access denied: %s", filePath)
+	}
+	return fileVersion(filepath.Clean(filePath))
+}
+
+func fileVersion(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return contentVersion(f, info)
+}
+
+// 从当前位置读取文件的全部内容计算版本
+func contentVersion(r io.Reader, info os.FileInfo) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x-%s", info.ModTime().UnixNano(), hex.EncodeToString(h.Sum(nil)[:12])), nil
+}
+
+// 检查文件的当前版本，expected为空时不检查。调用者需要持有该路径的锁
+func checkVersion(path string, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	current, err := fileVersion(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s no longer exists", ErrVersionConflict, DisplayPath(path))
+		}
+		return fmt.Errorf("failed to read file version: %w", err)
+	}
+	if current != expected {
+		return fmt.Errorf("%w: %s was modified by someone else (expected version %s, current version %s); read the file again and reapply the change", ErrVersionConflict, DisplayPath(path), expected, current)
+	}
+	return nil
+}
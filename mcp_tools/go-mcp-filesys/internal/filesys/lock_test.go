@@ -0,0 +1,181 @@
+package filesys
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func setupLockRoot(t *testing.T) string {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRoots([]Root{{Name: "ws", Path: root, Mode: RootModeReadWrite}}); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestConcurrentAppendsAreNotLost(t *testing.T) {
+	root := setupLockRoot(t)
+	file := filepath.Join(root, "log.txt")
+	if err := os.WriteFile(file, []byte("start"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := AppendFileContent(file, fmt.Sprintf("line %d", i), "", TextOptions{}); err != nil {
+				t.Errorf("append %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < writers; i++ {
+		if !strings.Contains(string(content), fmt.Sprintf("line %d\n", i)) && !strings.HasSuffix(string(content), fmt.Sprintf("line %d", i)) {
+			t.Fatalf("append %d was lost:\n%s", i, content)
+		}
+	}
+}
+
+func TestExpectedVersion(t *testing.T) {
+	root := setupLockRoot(t)
+	file := filepath.Join(root, "doc.txt")
+	if err := os.WriteFile(file, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadFile(file, ReadFileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := EditFile(file, "v2", read.Version, TextOptions{})
+	if err != nil {
+		t.Fatalf("edit with current version: %v", err)
+	}
+	if version == read.Version {
+		t.Fatalf("version did not change after edit: %s", version)
+	}
+
+	// 使用过期的版本写入必须被拒绝，文件内容保持不变
+	if _, err := WriteFile(file, "v3", read.Version, TextOptions{}); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("write with stale version: got %v, want ErrVersionConflict", err)
+	}
+	if _, err := ReplaceFileContent(file, "v2", "v3", read.Version, TextOptions{}); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("replace with stale version: got %v, want ErrVersionConflict", err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "v2" {
+		t.Fatalf("content = %q, want %q", content, "v2")
+	}
+
+	if _, err := AppendFileContent(file, "v3", version, TextOptions{}); err != nil {
+		t.Fatalf("append with current version: %v", err)
+	}
+}
+
+func TestWritersWaitForPathLock(t *testing.T) {
+	tests := []struct {
+		name string
+		// 被锁定的路径和等待该锁的写入操作
+		locked  string
+		history bool
+		setup   func(t *testing.T, root string)
+		op      func(root string) error
+	}{
+		{name: "copy file", locked: "dir/copy.txt", op: func(root string) error {
+			return CopyFile(filepath.Join(root, "a.txt"), filepath.Join(root, "dir/copy.txt"))
+		}},
+		{name: "copy directory", locked: "copy/c.txt", op: func(root string) error {
+			return CopyDirectory(filepath.Join(root, "dir"), filepath.Join(root, "copy"))
+		}},
+		{name: "create archive", locked: "out.tar", op: func(root string) error {
+			_, err := CreateArchive(filepath.Join(root, "out.tar"), []string{filepath.Join(root, "dir")}, CreateArchiveOptions{})
+			return err
+		}},
+		{
+			name:   "extract archive",
+			locked: "out/x.txt",
+			setup: func(t *testing.T, root string) {
+				writeTestTar(t, filepath.Join(root, "in.tar"), []tarEntry{{name: "x.txt", body: "x"}})
+			},
+			op: func(root string) error {
+				_, err := ExtractArchive(filepath.Join(root, "in.tar"), filepath.Join(root, "out"), ExtractOptions{})
+				return err
+			},
+		},
+		{
+			name:    "undo",
+			locked:  "a.txt",
+			history: true,
+			setup: func(t *testing.T, root string) {
+				if _, err := WriteFile(filepath.Join(root, "a.txt"), "changed", "", TextOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			op: func(root string) error {
+				_, err := UndoLast(false)
+				return err
+			},
+		},
+		{
+			name:    "restore",
+			locked:  "a.txt",
+			history: true,
+			setup: func(t *testing.T, root string) {
+				if _, err := WriteFile(filepath.Join(root, "a.txt"), "changed", "", TextOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			op: func(root string) error {
+				_, err := RestoreFile(filepath.Join(root, "a.txt"), "", false)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupBatchTree(t)
+			if tt.history {
+				setupHistory(t, 0)
+			}
+			if tt.setup != nil {
+				tt.setup(t, root)
+			}
+
+			unlock := lockPath(filepath.Join(root, filepath.FromSlash(tt.locked)))
+			done := make(chan error, 1)
+			go func() { done <- tt.op(root) }()
+			select {
+			case err := <-done:
+				unlock()
+				t.Fatalf("operation finished while %s was locked: %v", tt.locked, err)
+			case <-time.After(50 * time.Millisecond):
+			}
+			unlock()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
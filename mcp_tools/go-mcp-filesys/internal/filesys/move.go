@@ -0,0 +1,378 @@
+package filesys
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// 移动时目标已存在的处理方式
+const (
+	// 目标已存在时报错
+	ConflictError = "error"
+	// 用源替换目标
+	ConflictOverwrite = "overwrite"
+	// 目录合并到已存在的目录中，同名文件被替换
+	ConflictMerge = "merge"
+)
+
+// 移动方式
+const (
+	MoveRename = "rename"
+	MoveCopy   = "copy"
+	MoveMerged = "merge"
+)
+
+// 移动文件或目录的选项
+type MoveOptions struct {
+	// 目标已存在时的处理方式，默认为ConflictError
+	Conflict string
+}
+
+// 移动的结果
+type MoveResult struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	// rename 表示同一文件系统内直接重命名，copy 表示跨设备复制校验后删除源，merge 表示合并到已有目录
+	Method string `json:"method"`
+	// 新创建的父目录数
+	CreatedParents int `json:"created_parents,omitempty"`
+	// 被替换的已有文件或目录数
+	Replaced int `json:"replaced,omitempty"`
+}
+
+// 移动文件或目录：两端都必须允许写入，缺少的父目录会被创建，
+// 跨设备时复制并校验后再删除源，保留权限和修改时间。失败时已完成的部分会被回滚
+func movePathWithPolicy(op string, oldPath string, newPath string, wantDir bool, opts MoveOptions) (*MoveResult, error) {
+	if !isPathInAllowedDirectory(oldPath) || !isPathInAllowedDirectory(newPath) {
+		return nil, fmt.Errorf("access denied: source or destination path not allowed")
+	}
+	if err := checkWritable(oldPath); err != nil {
+		return nil, err
+	}
+	if err := checkWritable(newPath); err != nil {
+		return nil, err
+	}
+	switch opts.Conflict {
+	case "":
+		opts.Conflict = ConflictError
+	case ConflictError, ConflictOverwrite, ConflictMerge:
+	default:
+		return nil, fmt.Errorf("unsupported conflict policy: %s (supported: error, overwrite, merge)", opts.Conflict)
+	}
+
+	src := filepath.Clean(oldPath)
+	dst := filepath.Clean(newPath)
+	unlock := lockPaths(src, dst)
+	defer unlock()
+	info, err := os.Lstat(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("source does not exist: %s", DisplayPath(src))
+		}
+		return nil, fmt.Errorf("failed to access source: %w", err)
+	}
+	if wantDir && !info.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", DisplayPath(src))
+	}
+	if !wantDir && !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %s", DisplayPath(src))
+	}
+	if src == dst {
+		return nil, fmt.Errorf("source and destination are the same: %s", DisplayPath(src))
+	}
+	if info.IsDir() && isPathWithin(dst, src) {
+		return nil, fmt.Errorf("cannot move %s into itself", DisplayPath(src))
+	}
+	if root := rootForPath(src); root != nil && root.Path == src {
+		return nil, fmt.Errorf("cannot move root directory %s", root.Name)
+	}
+
+	if err := checkTransferQuota(src, dst, false); err != nil {
+		return nil, err
+	}
+
+	rec, err := beginHistory(op)
+	if err != nil {
+		return nil, err
+	}
+	// 目标不存在时在创建父目录之前记录，撤销时一并删除创建的父目录
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		if err := rec.snapshot(dst); err != nil {
+			return nil, rec.finish(err)
+		}
+	}
+
+	created, err := mkdirAllTracked(filepath.Dir(dst))
+	if err != nil {
+		return nil, rec.finish(err)
+	}
+	m := &mover{conflict: opts.Conflict, rec: rec}
+	method, err := m.move(src, dst)
+	if err != nil {
+		if rollbackErr := m.rollback(); rollbackErr != nil {
+			err = fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		removeCreatedDirs(created)
+		return nil, rec.finish(err)
+	}
+	m.cleanup()
+
+	result := &MoveResult{
+		Source:         DisplayPath(src),
+		Destination:    DisplayPath(dst),
+		Method:         method,
+		CreatedParents: len(created),
+		Replaced:       m.replaced,
+	}
+	return result, rec.finish(nil)
+}
+
+// 执行一次移动，记录每一步的撤销函数以便失败时回滚
+type mover struct {
+	conflict string
+	rec      *historyRecord
+	undo     []func() error
+	// 被替换的目标先改名保存，成功后删除
+	backups  []string
+	replaced int
+}
+
+// 把src移动到dst，返回使用的移动方式
+func (m *mover) move(src string, dst string) (string, error) {
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return "", err
+	}
+	if dstInfo, err := os.Lstat(dst); err == nil {
+		switch {
+		case m.conflict == ConflictMerge && srcInfo.IsDir() && dstInfo.IsDir():
+			return MoveMerged, m.merge(src, dst, srcInfo)
+		case m.conflict == ConflictError:
+			return "", fmt.Errorf("destination already exists: %s", DisplayPath(dst))
+		case srcInfo.IsDir() != dstInfo.IsDir():
+			return "", fmt.Errorf("cannot replace %s with %s: one is a directory and the other is not", DisplayPath(dst), DisplayPath(src))
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	// 合并时逐个条目记录，撤销时只移回源目录中原有的条目
+	if err := m.rec.recordMove(src, dst); err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		if err := m.setAside(dst); err != nil {
+			return "", err
+		}
+	}
+
+	method, err := transferPath(src, dst)
+	if err != nil {
+		return "", err
+	}
+	m.undo = append(m.undo, func() error { return movePath(dst, src) })
+	return method, nil
+}
+
+// 把源目录中的条目逐个移入已存在的目标目录，最后删除空的源目录
+func (m *mover) merge(src string, dst string, srcInfo os.FileInfo) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, entry := range entries {
+		if _, err := m.move(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("failed to remove merged directory %s: %w", DisplayPath(src), err)
+	}
+	m.undo = append(m.undo, func() error {
+		if err := os.Mkdir(src, srcInfo.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(src, srcInfo.ModTime(), srcInfo.ModTime())
+	})
+	return nil
+}
+
+// 把将被替换的目标改名到同一目录下的备份位置
+func (m *mover) setAside(dst string) error {
+	backup := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".%s.replaced-%d", filepath.Base(dst), time.Now().UnixNano()))
+	if err := os.Rename(dst, backup); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", DisplayPath(dst), err)
+	}
+	m.backups = append(m.backups, backup)
+	m.replaced++
+	m.undo = append(m.undo, func() error {
+		if err := os.RemoveAll(dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.Rename(backup, dst)
+	})
+	return nil
+}
+
+// 按相反顺序撤销已完成的步骤
+func (m *mover) rollback() error {
+	var errs []error
+	for i := len(m.undo) - 1; i >= 0; i-- {
+		if err := m.undo[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 移动成功后删除被替换的内容
+func (m *mover) cleanup() {
+	for _, backup := range m.backups {
+		os.RemoveAll(backup)
+	}
+}
+
+// 移动时使用的重命名函数，测试中替换为返回EXDEV以模拟跨设备移动
+var renameFunc = os.Rename
+
+// 重命名路径，跨设备时复制、校验后删除源
+func transferPath(src string, dst string) (string, error) {
+	err := renameFunc(src, dst)
+	if err == nil {
+		return MoveRename, nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return "", fmt.Errorf("failed to move %s: %w", DisplayPath(src), err)
+	}
+	if err := copyPreserving(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return "", fmt.Errorf("failed to copy %s across devices: %w", DisplayPath(src), err)
+	}
+	if err := verifyCopy(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return "", fmt.Errorf("copy of %s does not match the source: %w", DisplayPath(src), err)
+	}
+	if err := os.RemoveAll(src); err != nil {
+		return "", fmt.Errorf("copied %s but failed to remove the source: %w", DisplayPath(src), err)
+	}
+	return MoveCopy, nil
+}
+
+// 复制文件或目录树，并保留权限和修改时间
+func copyPreserving(from string, to string) error {
+	if err := copyPath(from, to); err != nil {
+		return err
+	}
+	return copyAttributes(from, to)
+}
+
+// 把权限和修改时间复制到目标，目录在子条目之后处理，避免修改时间被子条目的创建改变
+func copyAttributes(from string, to string) error {
+	info, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if info.IsDir() {
+		entries, err := os.ReadDir(from)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyAttributes(filepath.Join(from, entry.Name()), filepath.Join(to, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Chmod(to, info.Mode().Perm()|info.Mode()&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(to, info.ModTime(), info.ModTime())
+}
+
+// 比较两棵目录树：条目、类型、符号链接目标、文件大小和SHA-256都必须一致
+func verifyCopy(from string, to string) error {
+	a, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+	b, err := os.Lstat(to)
+	if err != nil {
+		return err
+	}
+	if a.Mode().Type() != b.Mode().Type() {
+		return fmt.Errorf("%s: type differs", DisplayPath(to))
+	}
+	switch {
+	case a.Mode()&os.ModeSymlink != 0:
+		ta, err := os.Readlink(from)
+		if err != nil {
+			return err
+		}
+		tb, err := os.Readlink(to)
+		if err != nil {
+			return err
+		}
+		if ta != tb {
+			return fmt.Errorf("%s: link target differs", DisplayPath(to))
+		}
+	case a.IsDir():
+		ea, err := os.ReadDir(from)
+		if err != nil {
+			return err
+		}
+		eb, err := os.ReadDir(to)
+		if err != nil {
+			return err
+		}
+		if len(ea) != len(eb) {
+			return fmt.Errorf("%s: entries differ", DisplayPath(to))
+		}
+		for i := range ea {
+			if ea[i].Name() != eb[i].Name() {
+				return fmt.Errorf("%s: entries differ", DisplayPath(to))
+			}
+			if err := verifyCopy(filepath.Join(from, ea[i].Name()), filepath.Join(to, eb[i].Name())); err != nil {
+				return err
+			}
+		}
+	default:
+		if a.Size() != b.Size() {
+			return fmt.Errorf("%s: size differs", DisplayPath(to))
+		}
+		ha, err := fileSHA256(from)
+		if err != nil {
+			return err
+		}
+		hb, err := fileSHA256(to)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(ha, hb) {
+			return fmt.Errorf("%s: content differs", DisplayPath(to))
+		}
+	}
+	return nil
+}
+
+func fileSHA256(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,145 @@
+package filesys
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 让移动中的重命名都返回EXDEV，模拟源和目标位于不同设备
+func simulateCrossDevice(t *testing.T) {
+	t.Helper()
+	renameFunc = func(from string, to string) error {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EXDEV}
+	}
+	t.Cleanup(func() { renameFunc = os.Rename })
+}
+
+func TestMoveAcrossDevices(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup map[string]string
+		op    func(root string) (*MoveResult, error)
+		// 成功时对移动前目录树的修改，为nil表示应当失败并完整回滚
+		change func(tree map[string]string)
+		method string
+	}{
+		{
+			name: "file into new directory",
+			op: func(root string) (*MoveResult, error) {
+				return MoveFile(filepath.Join(root, "a.txt"), filepath.Join(root, "other/a.txt"), MoveOptions{})
+			},
+			change: func(tree map[string]string) {
+				delete(tree, "a.txt")
+				tree["other"] = "<dir>"
+				tree["other/a.txt"] = "alpha\n"
+			},
+			method: MoveCopy,
+		},
+		{
+			name:  "overwrite directory",
+			setup: map[string]string{"dst/old.txt": "old\n"},
+			op: func(root string) (*MoveResult, error) {
+				return MoveDirectory(filepath.Join(root, "dir"), filepath.Join(root, "dst"), MoveOptions{Conflict: ConflictOverwrite})
+			},
+			change: func(tree map[string]string) {
+				delete(tree, "dir")
+				delete(tree, "dir/c.txt")
+				delete(tree, "dst/old.txt")
+				tree["dst/c.txt"] = "charlie\n"
+			},
+			method: MoveCopy,
+		},
+		{
+			name:  "merge into directory",
+			setup: map[string]string{"dst/c.txt": "old\n", "dst/keep.txt": "keep\n"},
+			op: func(root string) (*MoveResult, error) {
+				return MoveDirectory(filepath.Join(root, "dir"), filepath.Join(root, "dst"), MoveOptions{Conflict: ConflictMerge})
+			},
+			change: func(tree map[string]string) {
+				delete(tree, "dir")
+				delete(tree, "dir/c.txt")
+				tree["dst/c.txt"] = "charlie\n"
+			},
+			method: MoveMerged,
+		},
+		{
+			// c.txt 已经覆盖了目标中的同名文件，之后 z 的类型冲突使合并失败
+			name:  "merge rolls back replaced file",
+			setup: map[string]string{"dir/z": "file\n", "dst/c.txt": "old\n", "dst/z/inner.txt": "inner\n"},
+			op: func(root string) (*MoveResult, error) {
+				return MoveDirectory(filepath.Join(root, "dir"), filepath.Join(root, "dst"), MoveOptions{Conflict: ConflictMerge})
+			},
+		},
+		{
+			name:  "overwrite refuses file over directory",
+			setup: map[string]string{"dst/x.txt": "x\n"},
+			op: func(root string) (*MoveResult, error) {
+				return MoveFile(filepath.Join(root, "a.txt"), filepath.Join(root, "dst"), MoveOptions{Conflict: ConflictOverwrite})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupBatchTree(t)
+			for name, content := range tt.setup {
+				path := filepath.Join(root, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			simulateCrossDevice(t)
+			want := snapshotTree(t, root)
+
+			result, err := tt.op(root)
+			if tt.change == nil {
+				if err == nil {
+					t.Fatalf("move succeeded with method %s, want failure", result.Method)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Method != tt.method {
+					t.Errorf("method = %s, want %s", result.Method, tt.method)
+				}
+				tt.change(want)
+			}
+			if got := snapshotTree(t, root); !reflect.DeepEqual(want, got) {
+				t.Errorf("unexpected tree:\nwant %v\ngot  %v", want, got)
+			}
+		})
+	}
+}
+
+func TestMoveAcrossDevicesPreservesAttributes(t *testing.T) {
+	root := setupBatchTree(t)
+	src := filepath.Join(root, "a.txt")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chmod(src, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	simulateCrossDevice(t)
+
+	dst := filepath.Join(root, "moved.txt")
+	if _, err := MoveFile(src, dst, MoveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 || !info.ModTime().Equal(mtime) {
+		t.Errorf("got mode %v, mtime %v; want 0600, %v", info.Mode().Perm(), info.ModTime(), mtime)
+	}
+}
@@ -0,0 +1,745 @@
+package filesys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 默认允许的模糊匹配级别（忽略的首尾上下文行数）
+const DefaultPatchFuzz = 2
+
+const devNull = "/dev/null"
+
+var hunkHeaderRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@(.*)$`)
+
+// 补丁中的一个hunk
+type PatchHunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Header   string
+	// 每行带前缀：' ' 上下文，'-' 删除，'+' 新增
+	Lines    []string
+	OldNoEOL bool
+	NewNoEOL bool
+}
+
+// 单个文件的补丁
+type FilePatch struct {
+	OldPath string
+	NewPath string
+	Hunks   []*PatchHunk
+}
+
+// 应用补丁的选项
+type PatchOptions struct {
+	DryRun bool
+	// 模糊匹配时最多忽略的首尾上下文行数
+	MaxFuzz int
+	// 路径需要去掉的前缀层数，-1 表示自动识别 a/ b/ 前缀
+	Strip int
+}
+
+// 单个hunk的应用结果
+type HunkResult struct {
+	Index             int    `json:"index"`
+	Header            string `json:"header"`
+	Status            string `json:"status"`
+	Line              int    `json:"line,omitempty"`
+	Offset            int    `json:"offset,omitempty"`
+	Fuzz              int    `json:"fuzz,omitempty"`
+	IgnoredWhitespace bool   `json:"ignored_whitespace,omitempty"`
+	Reason            string `json:"reason,omitempty"`
+	Actual            string `json:"actual,omitempty"`
+}
+
+// 单个文件的应用结果
+type FilePatchResult struct {
+	Path      string       `json:"path"`
+	Operation string       `json:"operation"`
+	Status    string       `json:"status"`
+	Error     string       `json:"error,omitempty"`
+	Hunks     []HunkResult `json:"hunks"`
+}
+
+// 整个补丁的应用结果
+type PatchResult struct {
+	Applied bool              `json:"applied"`
+	DryRun  bool              `json:"dry_run"`
+	Files   []FilePatchResult `json:"files"`
+}
+
+// 按行保存的文本内容
+type textLines struct {
+	lines      []string
+	eol        string
+	noFinalEOL bool
+}
+
+func splitLines(content string) textLines {
+	t := textLines{eol: "\n"}
+	if strings.Contains(content, "\r\n") {
+		t.eol = "\r\n"
+	}
+	if content == "" {
+		return t
+	}
+	parts := strings.Split(content, "\n")
+	if parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	} else {
+		t.noFinalEOL = true
+	}
+	for i, p := range parts {
+		parts[i] = strings.TrimSuffix(p, "\r")
+	}
+	t.lines = parts
+	return t
+}
+
+func (t textLines) join() string {
+	if len(t.lines) == 0 {
+		return ""
+	}
+	s := strings.Join(t.lines, t.eol)
+	if !t.noFinalEOL {
+		s += t.eol
+	}
+	return s
+}
+
+// 解析unified diff，支持一个补丁中包含多个文件
+func ParseUnifiedDiff(diff string) ([]*FilePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	patches := make([]*FilePatch, 0)
+	var current *FilePatch
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			current = &FilePatch{
+				OldPath: parsePatchPath(line[4:]),
+				NewPath: parsePatchPath(lines[i+1][4:]),
+			}
+			patches = append(patches, current)
+			i += 2
+			continue
+		}
+		if strings.HasPrefix(line, "@@") {
+			if current == nil {
+				return nil, fmt.Errorf("line %d: hunk without file header", i+1)
+			}
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.Hunks = append(current.Hunks, hunk)
+			i = next
+			continue
+		}
+		// diff --git、index、new file mode 等行直接忽略
+		i++
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file headers (---/+++) found in patch")
+	}
+	for _, p := range patches {
+		if len(p.Hunks) == 0 {
+			return nil, fmt.Errorf("patch for %s contains no hunks", p.NewPath)
+		}
+	}
+	return patches, nil
+}
+
+// 解析文件头中的路径，去掉时间戳等后缀
+func parsePatchPath(s string) string {
+	if idx := strings.Index(s, "\t"); idx >= 0 {
+		s = s[:idx]
+	}
+	s = strings.TrimSpace(s)
+	if unquoted, err := strconv.Unquote(s); err == nil && strings.HasPrefix(s, "\"") {
+		s = unquoted
+	}
+	return s
+}
+
+// 解析一个hunk，返回下一行的位置。
+// hunk的行数以实际内容为准，头部的行数仅用于去掉末尾多余的空行，
+// 这样模型生成的补丁即使头部行数写错也能被解析
+func parseHunk(lines []string, start int) (*PatchHunk, int, error) {
+	m := hunkHeaderRegexp.FindStringSubmatch(lines[start])
+	if m == nil {
+		return nil, 0, fmt.Errorf("line %d: invalid hunk header: %s", start+1, lines[start])
+	}
+	hunk := &PatchHunk{Header: lines[start]}
+	hunk.OldStart, _ = strconv.Atoi(m[1])
+	hunk.OldLines = 1
+	if m[2] != "" {
+		hunk.OldLines, _ = strconv.Atoi(m[2])
+	}
+	hunk.NewStart, _ = strconv.Atoi(m[3])
+	hunk.NewLines = 1
+	if m[4] != "" {
+		hunk.NewLines, _ = strconv.Atoi(m[4])
+	}
+
+	i := start + 1
+loop:
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "@@") {
+			break
+		}
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			break
+		}
+		if line == "" {
+			// 部分编辑器会去掉空上下文行前面的空格
+			hunk.Lines = append(hunk.Lines, " ")
+			continue
+		}
+		switch line[0] {
+		case ' ', '-', '+':
+			hunk.Lines = append(hunk.Lines, line)
+		case '\\':
+			if len(hunk.Lines) == 0 {
+				return nil, 0, fmt.Errorf("line %d: unexpected no-newline marker", i+1)
+			}
+			switch hunk.Lines[len(hunk.Lines)-1][0] {
+			case '-':
+				hunk.OldNoEOL = true
+			case '+':
+				hunk.NewNoEOL = true
+			default:
+				hunk.OldNoEOL = true
+				hunk.NewNoEOL = true
+			}
+		default:
+			// 遇到无法识别的行，认为hunk结束
+			break loop
+		}
+	}
+
+	// 去掉末尾超出头部行数的空上下文行
+	for len(hunk.Lines) > 0 && hunk.Lines[len(hunk.Lines)-1] == " " {
+		oldCount, newCount := countHunkLines(hunk.Lines)
+		if oldCount <= hunk.OldLines && newCount <= hunk.NewLines {
+			break
+		}
+		hunk.Lines = hunk.Lines[:len(hunk.Lines)-1]
+	}
+	if len(hunk.Lines) == 0 {
+		return nil, 0, fmt.Errorf("line %d: empty hunk", start+1)
+	}
+	hunk.OldLines, hunk.NewLines = countHunkLines(hunk.Lines)
+	return hunk, i, nil
+}
+
+func countHunkLines(lines []string) (int, int) {
+	oldCount, newCount := 0, 0
+	for _, l := range lines {
+		switch l[0] {
+		case ' ':
+			oldCount++
+			newCount++
+		case '-':
+			oldCount++
+		case '+':
+			newCount++
+		}
+	}
+	return oldCount, newCount
+}
+
+// 根据strip设置处理补丁中的路径
+func stripPatchPath(p string, strip int) string {
+	if p == devNull {
+		return p
+	}
+	p = filepath.ToSlash(p)
+	for i := 0; i < strip; i++ {
+		idx := strings.Index(p, "/")
+		if idx < 0 {
+			break
+		}
+		p = p[idx+1:]
+	}
+	return p
+}
+
+// 自动识别git风格的 a/ b/ 前缀
+func detectStrip(fp *FilePatch) int {
+	oldOk := fp.OldPath == devNull || strings.HasPrefix(fp.OldPath, "a/")
+	newOk := fp.NewPath == devNull || strings.HasPrefix(fp.NewPath, "b/")
+	if oldOk && newOk && !(fp.OldPath == devNull && fp.NewPath == devNull) {
+		return 1
+	}
+	return 0
+}
+
+// 计划写入的文件变更
+type plannedChange struct {
+	oldPath   string
+	newPath   string
+	operation string
+	content   string
+	mode      os.FileMode
+}
+
+// 之前的文件段应用后文件在内存中的状态
+type patchedFile struct {
+	exists  bool
+	content string
+	mode    os.FileMode
+}
+
+// 应用unified diff补丁。
+// 所有hunk都先在内存中校验，只要有一个hunk被拒绝就不写入任何文件；
+// 同一文件的多个文件段按顺序应用在之前文件段的结果上；
+// 全部通过后依次通过safeWriteFile写入，中途失败会回滚已写入的文件
+func ApplyPatch(baseDir string, diff string, opts PatchOptions) (*PatchResult, error) {
+	if !isPathInAllowedDirectory(baseDir) {
+		return nil, fmt.Errorf("access denied: %s", baseDir)
+	}
+	if opts.MaxFuzz < 0 {
+		opts.MaxFuzz = 0
+	}
+
+	patches, err := ParseUnifiedDiff(diff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse patch: %w", err)
+	}
+
+	result := &PatchResult{Applied: true, DryRun: opts.DryRun}
+	changes := make([]plannedChange, 0, len(patches))
+
+	// 校验和写入期间锁定补丁涉及的所有文件，避免校验之后被其他操作修改
+	strips := make([]int, len(patches))
+	lockList := make([]string, 0, len(patches)*2)
+	for i, fp := range patches {
+		strips[i] = opts.Strip
+		if strips[i] < 0 {
+			strips[i] = detectStrip(fp)
+		}
+		for _, p := range []string{fp.OldPath, fp.NewPath} {
+			if p == devNull {
+				continue
+			}
+			if path, err := resolvePatchPath(baseDir, stripPatchPath(p, strips[i])); err == nil {
+				lockList = append(lockList, path)
+			}
+		}
+	}
+	unlock := lockPaths(lockList...)
+	defer unlock()
+
+	files := make(map[string]*patchedFile)
+	for i, fp := range patches {
+		change, fileResult := planFilePatch(baseDir, fp, strips[i], opts.MaxFuzz, files)
+		if fileResult.Status != "ok" {
+			result.Applied = false
+		}
+		result.Files = append(result.Files, fileResult)
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	if !result.Applied || opts.DryRun {
+		if !result.Applied {
+			for i := range result.Files {
+				if result.Files[i].Status == "ok" {
+					result.Files[i].Status = "not_applied"
+				}
+			}
+		}
+		return result, nil
+	}
+
+	paths := make([]string, 0, len(changes)*2)
+	seen := make(map[string]bool)
+	addPath := func(p string) {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	for _, c := range changes {
+		addPath(c.newPath)
+		if c.operation == "delete" || c.operation == "rename" {
+			addPath(c.oldPath)
+		}
+	}
+	rec, err := beginHistory("apply_patch", paths...)
+	if err != nil {
+		return nil, err
+	}
+	if err := rec.finish(commitChanges(changes)); err != nil {
+		result.Applied = false
+		for i := range result.Files {
+			result.Files[i].Status = "not_applied"
+		}
+		return result, err
+	}
+	for i := range result.Files {
+		result.Files[i].Status = "applied"
+	}
+	return result, nil
+}
+
+// 解析补丁中的路径并确认位于允许写入的目录内
+func resolvePatchPath(baseDir string, p string) (string, error) {
+	if p == "" {
+		return "", fmt.Errorf("empty path in patch")
+	}
+	fullPath, root, err := resolveAllowedPath(filepath.Join(baseDir, filepath.FromSlash(p)))
+	if err != nil {
+		return "", err
+	}
+	if root.Mode != RootModeReadWrite {
+		return "", fmt.Errorf("access denied: root %s is read-only", root.Name)
+	}
+	return fullPath, nil
+}
+
+// 在内存中校验并计算单个文件补丁的结果。
+// files记录之前的文件段应用后的文件状态，校验成功后更新
+func planFilePatch(baseDir string, fp *FilePatch, strip int, maxFuzz int, files map[string]*patchedFile) (*plannedChange, FilePatchResult) {
+	oldRel := stripPatchPath(fp.OldPath, strip)
+	newRel := stripPatchPath(fp.NewPath, strip)
+
+	fileResult := FilePatchResult{Path: newRel, Status: "ok"}
+	fail := func(err error) (*plannedChange, FilePatchResult) {
+		fileResult.Status = "error"
+		fileResult.Error = err.Error()
+		return nil, fileResult
+	}
+
+	change := &plannedChange{mode: 0644}
+	switch {
+	case oldRel == devNull && newRel == devNull:
+		return fail(fmt.Errorf("both source and destination are /dev/null"))
+	case oldRel == devNull:
+		change.operation = "create"
+	case newRel == devNull:
+		if err := checkProfileOperation(OperationDelete); err != nil {
+			return fail(err)
+		}
+		change.operation = "delete"
+		fileResult.Path = oldRel
+	case oldRel != newRel:
+		change.operation = "rename"
+	default:
+		change.operation = "modify"
+	}
+	fileResult.Operation = change.operation
+
+	original := splitLines("")
+	if change.operation != "create" {
+		oldPath, err := resolvePatchPath(baseDir, oldRel)
+		if err != nil {
+			return fail(err)
+		}
+		if f, ok := files[oldPath]; ok {
+			if !f.exists {
+				return fail(fmt.Errorf("file %s was removed by an earlier section of the patch", oldRel))
+			}
+			change.mode = f.mode
+			original = splitLines(f.content)
+		} else {
+			info, err := os.Stat(oldPath)
+			if err != nil {
+				return fail(fmt.Errorf("failed to access file: %w", err))
+			}
+			if !info.Mode().IsRegular() {
+				return fail(fmt.Errorf("not a regular file: %s", oldRel))
+			}
+			content, err := os.ReadFile(oldPath)
+			if err != nil {
+				return fail(fmt.Errorf("failed to read file: %w", err))
+			}
+			change.mode = info.Mode().Perm()
+			original = splitLines(string(content))
+		}
+		change.oldPath = oldPath
+	}
+	if change.operation != "delete" {
+		newPath, err := resolvePatchPath(baseDir, newRel)
+		if err != nil {
+			return fail(err)
+		}
+		if change.operation != "modify" {
+			exists := false
+			if f, ok := files[newPath]; ok {
+				exists = f.exists
+			} else if _, err := os.Stat(newPath); err == nil {
+				exists = true
+			}
+			if exists {
+				return fail(fmt.Errorf("file already exists: %s", newRel))
+			}
+			if !IsValidFileName(filepath.Base(newPath)) {
+				return fail(fmt.Errorf("invalid file name: %s", filepath.Base(newPath)))
+			}
+		}
+		change.newPath = newPath
+	}
+
+	patched, hunkResults := applyHunks(original, fp.Hunks, maxFuzz)
+	fileResult.Hunks = hunkResults
+	for _, h := range hunkResults {
+		if h.Status != "applied" {
+			fileResult.Status = "rejected"
+		}
+	}
+	if fileResult.Status != "ok" {
+		return nil, fileResult
+	}
+	if change.operation == "delete" && len(patched.lines) > 0 {
+		return fail(fmt.Errorf("file %s is not empty after applying the deletion patch", oldRel))
+	}
+	change.content = patched.join()
+	if change.oldPath != "" && change.oldPath != change.newPath {
+		files[change.oldPath] = &patchedFile{}
+	}
+	if change.newPath != "" {
+		files[change.newPath] = &patchedFile{exists: true, content: change.content, mode: change.mode}
+	}
+	return change, fileResult
+}
+
+// 依次应用hunk，被拒绝的hunk不影响后续hunk的校验
+func applyHunks(original textLines, hunks []*PatchHunk, maxFuzz int) (textLines, []HunkResult) {
+	working := textLines{
+		lines:      append([]string(nil), original.lines...),
+		eol:        original.eol,
+		noFinalEOL: original.noFinalEOL,
+	}
+	results := make([]HunkResult, 0, len(hunks))
+	delta := 0
+	minPos := 0
+
+	for idx, hunk := range hunks {
+		hr := HunkResult{Index: idx + 1, Header: hunk.Header}
+		expected := hunk.OldStart - 1
+		if hunk.OldLines == 0 {
+			expected = hunk.OldStart
+		}
+		expected += delta
+
+		pos, trimStart, trimEnd, fuzz, loose := locateHunk(working.lines, hunk, expected, minPos, maxFuzz)
+		if pos < 0 {
+			hr.Status = "rejected"
+			hr.Reason = fmt.Sprintf("context not found near line %d", expected+1)
+			hr.Actual = actualLines(working.lines, expected, hunk.OldLines)
+			results = append(results, hr)
+			continue
+		}
+
+		body := hunk.Lines[trimStart : len(hunk.Lines)-trimEnd]
+		replacement := make([]string, 0, len(body))
+		cursor := pos
+		for _, l := range body {
+			switch l[0] {
+			case ' ':
+				replacement = append(replacement, working.lines[cursor])
+				cursor++
+			case '-':
+				cursor++
+			case '+':
+				replacement = append(replacement, strings.TrimSuffix(l[1:], "\r"))
+			}
+		}
+
+		touchesEOF := cursor == len(working.lines) && trimEnd == 0
+		newLines := make([]string, 0, len(working.lines)-(cursor-pos)+len(replacement))
+		newLines = append(newLines, working.lines[:pos]...)
+		newLines = append(newLines, replacement...)
+		newLines = append(newLines, working.lines[cursor:]...)
+		working.lines = newLines
+		if touchesEOF {
+			if hunk.NewNoEOL {
+				working.noFinalEOL = true
+			} else if hunk.OldNoEOL || len(replacement) > 0 {
+				working.noFinalEOL = false
+			}
+		}
+
+		hr.Status = "applied"
+		hr.Line = pos + 1
+		hr.Offset = pos - (expected + trimStart)
+		hr.Fuzz = fuzz
+		hr.IgnoredWhitespace = loose
+		results = append(results, hr)
+
+		delta += len(replacement) - (cursor - pos)
+		minPos = pos + len(replacement)
+	}
+	return working, results
+}
+
+// 查找hunk在文件中的位置，返回 -1 表示没有找到。
+// 先精确匹配，再逐级忽略首尾上下文行，最后忽略空白差异
+func locateHunk(lines []string, hunk *PatchHunk, expected int, minPos int, maxFuzz int) (int, int, int, int, bool) {
+	leading, trailing := contextBounds(hunk.Lines)
+	for _, loose := range []bool{false, true} {
+		for fuzz := 0; fuzz <= maxFuzz; fuzz++ {
+			trimStart := min(fuzz, leading)
+			trimEnd := min(fuzz, trailing)
+			if fuzz > 0 && trimStart+trimEnd == 0 {
+				break
+			}
+			old := oldSide(hunk.Lines[trimStart : len(hunk.Lines)-trimEnd])
+			pos := searchLines(lines, old, expected+trimStart, minPos, loose)
+			if pos >= 0 {
+				return pos, trimStart, trimEnd, fuzz, loose
+			}
+		}
+	}
+	return -1, 0, 0, 0, false
+}
+
+// 统计hunk首尾连续上下文行的数量
+func contextBounds(lines []string) (int, int) {
+	leading := 0
+	for leading < len(lines) && lines[leading][0] == ' ' {
+		leading++
+	}
+	trailing := 0
+	for trailing < len(lines)-leading && lines[len(lines)-1-trailing][0] == ' ' {
+		trailing++
+	}
+	return leading, trailing
+}
+
+func oldSide(lines []string) []string {
+	old := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if l[0] == ' ' || l[0] == '-' {
+			old = append(old, strings.TrimSuffix(l[1:], "\r"))
+		}
+	}
+	return old
+}
+
+// 从期望位置开始向两侧查找匹配的位置
+func searchLines(lines []string, old []string, expected int, minPos int, loose bool) int {
+	maxPos := len(lines) - len(old)
+	if maxPos < minPos {
+		return -1
+	}
+	if len(old) == 0 {
+		return max(minPos, min(expected, len(lines)))
+	}
+	for dist := 0; ; dist++ {
+		before, after := expected-dist, expected+dist
+		if before < minPos && after > maxPos {
+			return -1
+		}
+		if before >= minPos && before <= maxPos && matchLines(lines[before:before+len(old)], old, loose) {
+			return before
+		}
+		if dist > 0 && after >= minPos && after <= maxPos && matchLines(lines[after:after+len(old)], old, loose) {
+			return after
+		}
+	}
+}
+
+func matchLines(a []string, b []string, loose bool) bool {
+	for i := range b {
+		if loose {
+			if strings.Join(strings.Fields(a[i]), " ") != strings.Join(strings.Fields(b[i]), " ") {
+				return false
+			}
+		} else if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 返回期望位置处的实际内容，方便调用方修正补丁
+func actualLines(lines []string, start int, count int) string {
+	if start < 0 {
+		start = 0
+	}
+	if count == 0 {
+		count = 1
+	}
+	end := min(start+count, len(lines))
+	if start >= end {
+		return ""
+	}
+	return strings.Join(lines[start:end], "\n")
+}
+
+// 写入所有变更，失败时回滚已完成的写入
+func commitChanges(changes []plannedChange) error {
+	type undo struct {
+		path    string
+		content []byte
+		mode    os.FileMode
+		existed bool
+	}
+	undos := make([]undo, 0, len(changes))
+	rollback := func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			u := undos[i]
+			if u.existed {
+				safeWriteFile(u.path, u.content, u.mode)
+			} else {
+				os.Remove(u.path)
+			}
+		}
+	}
+	backup := func(path string, mode os.FileMode) error {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				undos = append(undos, undo{path: path})
+				return nil
+			}
+			return err
+		}
+		undos = append(undos, undo{path: path, content: content, mode: mode, existed: true})
+		return nil
+	}
+
+	for _, c := range changes {
+		if c.newPath != "" {
+			if err := checkWriteQuota(c.newPath, int64(len(c.content))); err != nil {
+				rollback()
+				return err
+			}
+			if err := backup(c.newPath, c.mode); err != nil {
+				rollback()
+				return fmt.Errorf("failed to back up %s: %w", c.newPath, err)
+			}
+			if err := os.MkdirAll(filepath.Dir(c.newPath), 0755); err != nil {
+				rollback()
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+			if err := safeWriteFile(c.newPath, []byte(c.content), c.mode); err != nil {
+				rollback()
+				return fmt.Errorf("failed to write %s: %w", c.newPath, err)
+			}
+		}
+		if c.operation == "delete" || c.operation == "rename" {
+			if err := backup(c.oldPath, c.mode); err != nil {
+				rollback()
+				return fmt.Errorf("failed to back up %s: %w", c.oldPath, err)
+			}
+			if err := os.Remove(c.oldPath); err != nil {
+				rollback()
+				return fmt.Errorf("failed to remove %s: %w", c.oldPath, err)
+			}
+		}
+	}
+	return nil
+}
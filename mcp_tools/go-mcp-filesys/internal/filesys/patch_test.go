@@ -0,0 +1,236 @@
+package filesys
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const patchTestFile = "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+
+// 在根目录中写入测试文件，键为斜杠分隔的相对路径
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		patch       string
+		opts        PatchOptions
+		wantApplied bool
+		// 应用后的目录树，失败时应与原来相同
+		want  map[string]string
+		check func(t *testing.T, r *PatchResult)
+	}{
+		{
+			name:        "exact match",
+			files:       map[string]string{"f.txt": patchTestFile},
+			patch:       "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			wantApplied: true,
+			want:        map[string]string{"f.txt": "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\n"},
+		},
+		{
+			name:        "offset from header",
+			files:       map[string]string{"f.txt": patchTestFile},
+			patch:       "--- a/f.txt\n+++ b/f.txt\n@@ -4,3 +4,3 @@\n a\n-b\n+B\n c\n",
+			wantApplied: true,
+			want:        map[string]string{"f.txt": "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\n"},
+			check: func(t *testing.T, r *PatchResult) {
+				if h := r.Files[0].Hunks[0]; h.Offset != -3 || h.Line != 1 {
+					t.Errorf("offset = %d, line = %d; want -3, 1", h.Offset, h.Line)
+				}
+			},
+		},
+		{
+			name:        "fuzz ignores outer context",
+			files:       map[string]string{"f.txt": patchTestFile},
+			patch:       "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,3 @@\n x\n-b\n+B\n y\n",
+			opts:        PatchOptions{MaxFuzz: 1},
+			wantApplied: true,
+			want:        map[string]string{"f.txt": "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\n"},
+			check: func(t *testing.T, r *PatchResult) {
+				if h := r.Files[0].Hunks[0]; h.Fuzz != 1 {
+					t.Errorf("fuzz = %d, want 1", h.Fuzz)
+				}
+			},
+		},
+		{
+			name:  "fuzz not allowed",
+			files: map[string]string{"f.txt": patchTestFile},
+			patch: "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,3 @@\n x\n-b\n+B\n y\n",
+			want:  map[string]string{"f.txt": patchTestFile},
+		},
+		{
+			name:        "whitespace differences",
+			files:       map[string]string{"f.txt": "a\n  b  c\nd\n"},
+			patch:       "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,3 @@\n a\n-b c\n+B\n d\n",
+			wantApplied: true,
+			want:        map[string]string{"f.txt": "a\nB\nd\n"},
+			check: func(t *testing.T, r *PatchResult) {
+				if !r.Files[0].Hunks[0].IgnoredWhitespace {
+					t.Error("hunk not reported as matched ignoring whitespace")
+				}
+			},
+		},
+		{
+			name:  "rejected hunk blocks every file",
+			files: map[string]string{"f.txt": patchTestFile, "g.txt": "one\n"},
+			patch: "--- a/g.txt\n+++ b/g.txt\n@@ -1 +1 @@\n-one\n+two\n" +
+				"--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,2 @@\n a\n-zzz\n+B\n@@ -9,2 +9,2 @@\n h\n-i\n+I\n",
+			want: map[string]string{"f.txt": patchTestFile, "g.txt": "one\n"},
+			check: func(t *testing.T, r *PatchResult) {
+				if r.Files[0].Status != "not_applied" || r.Files[1].Status != "rejected" {
+					t.Errorf("file statuses = %s, %s; want not_applied, rejected", r.Files[0].Status, r.Files[1].Status)
+				}
+				hunks := r.Files[1].Hunks
+				if hunks[0].Status != "rejected" || hunks[0].Actual != "a\nb" || hunks[0].Reason == "" {
+					t.Errorf("first hunk = %+v, want rejected with actual content", hunks[0])
+				}
+				if hunks[1].Status != "applied" {
+					t.Errorf("second hunk status = %s, want applied", hunks[1].Status)
+				}
+			},
+		},
+		{
+			name:        "create file",
+			patch:       "--- /dev/null\n+++ b/new/n.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+			wantApplied: true,
+			want:        map[string]string{"new": "<dir>", "new/n.txt": "one\ntwo\n"},
+		},
+		{
+			name:  "create existing file",
+			files: map[string]string{"f.txt": "x\n"},
+			patch: "--- /dev/null\n+++ b/f.txt\n@@ -0,0 +1 @@\n+one\n",
+			want:  map[string]string{"f.txt": "x\n"},
+		},
+		{
+			name:        "delete file",
+			files:       map[string]string{"f.txt": "a\nb\n", "keep.txt": "k\n"},
+			patch:       "--- a/f.txt\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+			wantApplied: true,
+			want:        map[string]string{"keep.txt": "k\n"},
+		},
+		{
+			name:        "rename file",
+			files:       map[string]string{"f.txt": "a\nb\n"},
+			patch:       "--- a/f.txt\n+++ b/g.txt\n@@ -1,2 +1,2 @@\n a\n-b\n+B\n",
+			wantApplied: true,
+			want:        map[string]string{"g.txt": "a\nB\n"},
+		},
+		{
+			name:        "crlf file keeps line endings",
+			files:       map[string]string{"f.txt": "a\r\nb\r\nc\r\n"},
+			patch:       "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			wantApplied: true,
+			want:        map[string]string{"f.txt": "a\r\nB\r\nc\r\n"},
+		},
+		{
+			name:        "crlf patch",
+			files:       map[string]string{"f.txt": "a\nb\n"},
+			patch:       "--- a/f.txt\r\n+++ b/f.txt\r\n@@ -1,2 +1,2 @@\r\n a\r\n-b\r\n+B\r\n",
+			wantApplied: true,
+			want:        map[string]string{"f.txt": "a\nB\n"},
+		},
+		{
+			name:        "no newline at end of file",
+			files:       map[string]string{"f.txt": "x\ny"},
+			patch:       "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,2 @@\n x\n-y\n\\ No newline at end of file\n+z\n\\ No newline at end of file\n",
+			wantApplied: true,
+			want:        map[string]string{"f.txt": "x\nz"},
+		},
+		{
+			name:        "paths without prefix",
+			files:       map[string]string{"a/f.txt": "a\n"},
+			patch:       "--- a/f.txt\n+++ a/f.txt\n@@ -1 +1 @@\n-a\n+A\n",
+			wantApplied: true,
+			want:        map[string]string{"a": "<dir>", "a/f.txt": "A\n"},
+		},
+		{
+			name:        "explicit strip",
+			files:       map[string]string{"sub/f.txt": "a\n"},
+			patch:       "--- x/y/sub/f.txt\n+++ x/y/sub/f.txt\n@@ -1 +1 @@\n-a\n+A\n",
+			opts:        PatchOptions{Strip: 2},
+			wantApplied: true,
+			want:        map[string]string{"sub": "<dir>", "sub/f.txt": "A\n"},
+		},
+		{
+			name:  "two sections for the same file",
+			files: map[string]string{"f.txt": patchTestFile},
+			patch: "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n" +
+				"--- a/f.txt\n+++ b/f.txt\n@@ -8,3 +8,3 @@\n h\n-i\n+I\n j\n",
+			wantApplied: true,
+			want:        map[string]string{"f.txt": "a\nB\nc\nd\ne\nf\ng\nh\nI\nj\n"},
+		},
+		{
+			name: "create then modify",
+			patch: "--- /dev/null\n+++ b/n.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n" +
+				"--- a/n.txt\n+++ b/n.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+three\n",
+			wantApplied: true,
+			want:        map[string]string{"n.txt": "one\nthree\n"},
+		},
+		{
+			name:  "modify after delete",
+			files: map[string]string{"f.txt": "a\n"},
+			patch: "--- a/f.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n" +
+				"--- a/f.txt\n+++ b/f.txt\n@@ -1 +1 @@\n-a\n+b\n",
+			want: map[string]string{"f.txt": "a\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupLockRoot(t)
+			writeTestFiles(t, root, tt.files)
+			before := snapshotTree(t, root)
+
+			// 未指定时自动识别路径前缀
+			opts := tt.opts
+			if opts.Strip == 0 {
+				opts.Strip = -1
+			}
+			result, err := ApplyPatch(root, tt.patch, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Applied != tt.wantApplied {
+				t.Fatalf("applied = %v, want %v: %+v", result.Applied, tt.wantApplied, result.Files)
+			}
+			if !tt.wantApplied && !reflect.DeepEqual(tt.want, before) {
+				t.Fatalf("test case expects changes from a failing patch")
+			}
+			if got := snapshotTree(t, root); !reflect.DeepEqual(tt.want, got) {
+				t.Errorf("unexpected tree:\nwant %q\ngot  %q", tt.want, got)
+			}
+			if tt.check != nil {
+				tt.check(t, result)
+			}
+		})
+	}
+}
+
+func TestApplyPatchDryRun(t *testing.T) {
+	root := setupLockRoot(t)
+	writeTestFiles(t, root, map[string]string{"f.txt": "a\n"})
+	result, err := ApplyPatch(root, "--- a/f.txt\n+++ b/f.txt\n@@ -1 +1 @@\n-a\n+b\n", PatchOptions{DryRun: true, Strip: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Applied || result.Files[0].Status != "ok" {
+		t.Fatalf("dry run result = %+v", result)
+	}
+	if got := snapshotTree(t, root)["f.txt"]; got != "a\n" {
+		t.Errorf("dry run changed the file: %q", got)
+	}
+}
@@ -0,0 +1,112 @@
+package filesys
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 权限配置，决定启用哪些类别的操作
+type PermissionProfile string
+
+const (
+	// 只允许读取
+	ProfileReadOnly PermissionProfile = "read-only"
+	// 允许读取、创建和修改，不允许删除和修改权限
+	ProfileReadWrite PermissionProfile = "read-write"
+	// 允许所有操作
+	ProfileFull PermissionProfile = "full"
+)
+
+// 操作类别
+type Operation string
+
+const (
+	OperationRead   Operation = "read"
+	OperationWrite  Operation = "write"
+	OperationDelete Operation = "delete"
+	OperationChmod  Operation = "chmod"
+)
+
+// 每种权限配置允许的操作类别
+var profileOperations = map[PermissionProfile][]Operation{
+	ProfileReadOnly:  {OperationRead},
+	ProfileReadWrite: {OperationRead, OperationWrite},
+	ProfileFull:      {OperationRead, OperationWrite, OperationDelete, OperationChmod},
+}
+
+var (
+	permissionMu      sync.RWMutex
+	permissionProfile = ProfileFull
+	// 权限配置允许的操作类别，为nil时允许全部
+	allowedOperations map[Operation]bool
+	// 单独启用的工具额外需要的操作类别，只作用于这些工具本身
+	toolOperations map[Operation]bool
+)
+
+// 解析权限配置名称，为空时返回full
+func ParsePermissionProfile(profile string) (PermissionProfile, error) {
+	switch strings.ToLower(strings.TrimSpace(profile)) {
+	case "", "full":
+		return ProfileFull, nil
+	case "read-write", "readwrite", "rw":
+		return ProfileReadWrite, nil
+	case "read-only", "readonly", "ro":
+		return ProfileReadOnly, nil
+	default:
+		return "", fmt.Errorf("invalid permission profile: %s (supported: read-only, read-write, full)", profile)
+	}
+}
+
+// 返回权限配置允许的操作类别
+func ProfileOperations(profile PermissionProfile) []Operation {
+	return append([]Operation(nil), profileOperations[profile]...)
+}
+
+// 设置权限配置。extra是单独启用的工具在配置之外需要的操作类别，
+// 例如在read-write配置下单独启用了delete_file工具时需要delete。
+// extra只允许这些工具本身的操作，批量操作中的rm、rmdir和补丁中的删除仍然只按权限配置检查
+func SetPermissions(profile PermissionProfile, extra ...Operation) error {
+	ops, ok := profileOperations[profile]
+	if !ok {
+		return fmt.Errorf("invalid permission profile: %s", profile)
+	}
+	allowed := make(map[Operation]bool)
+	for _, op := range ops {
+		allowed[op] = true
+	}
+	tools := make(map[Operation]bool)
+	for _, op := range extra {
+		tools[op] = true
+	}
+	permissionMu.Lock()
+	defer permissionMu.Unlock()
+	permissionProfile = profile
+	allowedOperations = allowed
+	toolOperations = tools
+	return nil
+}
+
+// 检查操作类别是否被当前的权限配置或单独启用的工具允许。
+// 调用者需要对应一个完整的工具，工具是否启用由tools包决定
+func checkOperation(op Operation) error {
+	permissionMu.RLock()
+	defer permissionMu.RUnlock()
+	if allowedOperations == nil || allowedOperations[op] || toolOperations[op] {
+		return nil
+	}
+	return fmt.Errorf("%s operations are disabled: the server runs with the %s permission profile", op, permissionProfile)
+}
+
+// 检查操作类别是否被权限配置本身允许，用于批量操作和补丁中包含的删除等操作
+func checkProfileOperation(op Operation) error {
+	permissionMu.RLock()
+	defer permissionMu.RUnlock()
+	if allowedOperations == nil || allowedOperations[op] {
+		return nil
+	}
+	if toolOperations[op] {
+		return fmt.Errorf("%s operations are disabled: the server runs with the %s permission profile, and tools enabled with -allow-tool do not extend to batch operations or patches", op, permissionProfile)
+	}
+	return fmt.Errorf("%s operations are disabled: the server runs with the %s permission profile", op, permissionProfile)
+}
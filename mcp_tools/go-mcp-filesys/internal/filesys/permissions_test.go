@@ -0,0 +1,115 @@
+package filesys
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 设置权限配置，测试结束时恢复为full
+func setTestPermissions(t *testing.T, profile PermissionProfile, extra ...Operation) {
+	t.Helper()
+	if err := SetPermissions(profile, extra...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetPermissions(ProfileFull) })
+}
+
+func TestPermissionProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile PermissionProfile
+		extra   []Operation
+		// 每种操作是否应当被允许
+		write, delete, chmod bool
+	}{
+		{name: "read-only", profile: ProfileReadOnly},
+		{name: "read-write", profile: ProfileReadWrite, write: true},
+		{name: "full", profile: ProfileFull, write: true, delete: true, chmod: true},
+		{name: "read-write with delete tool", profile: ProfileReadWrite, extra: []Operation{OperationDelete}, write: true, delete: true},
+		{name: "read-only with chmod tool", profile: ProfileReadOnly, extra: []Operation{OperationChmod}, chmod: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupBatchTree(t)
+			setTestPermissions(t, tt.profile, tt.extra...)
+
+			_, err := WriteFile(filepath.Join(root, "a.txt"), "changed\n", "", TextOptions{})
+			if (err == nil) != tt.write {
+				t.Errorf("write: error = %v, want allowed %v", err, tt.write)
+			}
+			err = ChangeFilePermissions(filepath.Join(root, "b.txt"), "600")
+			if (err == nil) != tt.chmod {
+				t.Errorf("chmod: error = %v, want allowed %v", err, tt.chmod)
+			}
+			err = DeleteFile(filepath.Join(root, "b.txt"))
+			if (err == nil) != tt.delete {
+				t.Errorf("delete: error = %v, want allowed %v", err, tt.delete)
+			}
+			if err != nil && !strings.Contains(err.Error(), string(tt.profile)) {
+				t.Errorf("error does not name the profile: %v", err)
+			}
+		})
+	}
+}
+
+func TestToolPermissionsDoNotExtendToBatchOrPatch(t *testing.T) {
+	root := setupBatchTree(t)
+	// 单独启用delete_file时的权限
+	setTestPermissions(t, ProfileReadWrite, OperationDelete)
+	before := snapshotTree(t, root)
+
+	for _, op := range []BatchOperation{
+		{Op: BatchDelete, Path: filepath.Join(root, "a.txt")},
+		{Op: BatchRmdir, Path: filepath.Join(root, "dir")},
+	} {
+		result, err := ApplyBatch([]BatchOperation{op}, BatchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Committed || !strings.Contains(result.Steps[0].Error, "-allow-tool") {
+			t.Errorf("batch %s: committed = %v, error = %q", op.Op, result.Committed, result.Steps[0].Error)
+		}
+	}
+
+	result, err := ApplyPatch(root, "--- a/a.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-alpha\n", PatchOptions{Strip: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Applied || !strings.Contains(result.Files[0].Error, "-allow-tool") {
+		t.Errorf("patch deletion: applied = %v, error = %q", result.Applied, result.Files[0].Error)
+	}
+	if after := snapshotTree(t, root); !reflect.DeepEqual(before, after) {
+		t.Errorf("tree changed:\nbefore %v\nafter  %v", before, after)
+	}
+
+	// 工具本身仍然可以删除
+	if err := DeleteFile(filepath.Join(root, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("a.txt not deleted: %v", err)
+	}
+}
+
+func TestFullProfileAllowsBatchAndPatchDeletes(t *testing.T) {
+	root := setupBatchTree(t)
+	setTestPermissions(t, ProfileFull)
+	result, err := ApplyBatch([]BatchOperation{{Op: BatchDelete, Path: filepath.Join(root, "b.txt")}}, BatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Committed {
+		t.Errorf("batch delete not committed: %+v", result.Steps)
+	}
+	patch, err := ApplyPatch(root, "--- a/a.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-alpha\n", PatchOptions{Strip: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !patch.Applied {
+		t.Errorf("patch deletion not applied: %+v", patch.Files)
+	}
+}
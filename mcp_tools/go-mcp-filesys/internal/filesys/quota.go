@@ -0,0 +1,286 @@
+package filesys
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 写入超出配置的配额
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// 配额和大小限制，为0表示不限制
+type QuotaConfig struct {
+	// 单个文件写入后的最大字节数
+	MaxFileBytes int64 `json:"max_file_bytes"`
+	// 每个根目录下所有文件的最大总字节数
+	MaxRootBytes int64 `json:"max_root_bytes"`
+	// 单个目录中的最大条目数
+	MaxDirEntries int `json:"max_dir_entries"`
+	// 单个工具响应的最大字节数
+	MaxResultBytes int `json:"max_result_bytes"`
+}
+
+// 根目录占用的缓存有效期，过期后重新统计。
+// 缓存在每次通过检查的写入后按增量更新，只有外部修改需要等待重新统计
+const rootUsageTTL = 30 * time.Second
+
+var (
+	quotaMu    sync.Mutex
+	quota      QuotaConfig
+	rootUsages = make(map[string]*rootUsage)
+)
+
+type rootUsage struct {
+	bytes    int64
+	files    int
+	computed time.Time
+}
+
+// 设置配额，替换之前的配置
+func SetQuota(cfg QuotaConfig) error {
+	if cfg.MaxFileBytes < 0 || cfg.MaxRootBytes < 0 || cfg.MaxDirEntries < 0 || cfg.MaxResultBytes < 0 {
+		return fmt.Errorf("quota limits must not be negative")
+	}
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	quota = cfg
+	rootUsages = make(map[string]*rootUsage)
+	return nil
+}
+
+func currentQuota() QuotaConfig {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	return quota
+}
+
+// 检查写入后大小为newSize的文件是否超出配额：单文件大小、根目录总大小，
+// 文件不存在时还检查所在目录的条目数。路径不在任何根目录内时不检查
+func checkWriteQuota(path string, newSize int64) error {
+	root := rootForPath(path)
+	if root == nil {
+		return nil
+	}
+	if err := checkFileSizeQuota(path, newSize); err != nil {
+		return err
+	}
+	var oldSize int64
+	info, err := os.Lstat(path)
+	switch {
+	case err == nil:
+		oldSize = info.Size()
+	case os.IsNotExist(err):
+		if err := checkNewEntryQuota(path); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	return reserveRootBytes(root, newSize-oldSize)
+}
+
+// 检查单个文件的大小限制
+func checkFileSizeQuota(path string, size int64) error {
+	limit := currentQuota().MaxFileBytes
+	if limit > 0 && size > limit {
+		return fmt.Errorf("%w: %s would be %d bytes, larger than the per-file limit of %d bytes", ErrQuotaExceeded, DisplayPath(path), size, limit)
+	}
+	return nil
+}
+
+// 检查创建path（以及缺少的父目录）是否会超出目录条目数限制
+func checkNewEntryQuota(path string) error {
+	limit := currentQuota().MaxDirEntries
+	if limit <= 0 || rootForPath(path) == nil {
+		return nil
+	}
+	dir := filepath.Dir(topmostMissing(filepath.Clean(path)))
+	count, err := countDirEntries(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if count+1 > limit {
+		return fmt.Errorf("%w: directory %s already has %d entries, the limit is %d per directory", ErrQuotaExceeded, DisplayPath(dir), count, limit)
+	}
+	return nil
+}
+
+// 检查把src复制或移动到dst是否超出配额。同一根目录内的移动不改变根目录的总大小
+func checkTransferQuota(src string, dst string, copy bool) error {
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		if err := checkNewEntryQuota(dst); err != nil {
+			return err
+		}
+	}
+	srcRoot, dstRoot := rootForPath(src), rootForPath(dst)
+	if dstRoot == nil || (!copy && srcRoot != nil && srcRoot.Path == dstRoot.Path) {
+		return nil
+	}
+	q := currentQuota()
+	if q.MaxFileBytes <= 0 && q.MaxRootBytes <= 0 {
+		return nil
+	}
+	size, err := pathSize(src)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Lstat(src); err == nil && info.Mode().IsRegular() {
+		if err := checkFileSizeQuota(dst, size); err != nil {
+			return err
+		}
+	}
+	return reserveRootBytes(dstRoot, size)
+}
+
+// 检查向path所在根目录写入delta字节是否超出根目录配额
+func checkRootQuota(path string, delta int64) error {
+	root := rootForPath(path)
+	if root == nil {
+		return nil
+	}
+	return reserveRootBytes(root, delta)
+}
+
+// 释放path所在根目录中预留的空间，或扣除被替换、删除的内容占用的空间。
+// 只调整已缓存的占用，没有缓存时下次统计会得到实际的占用
+func releaseRootBytes(path string, size int64) {
+	root := rootForPath(path)
+	if root == nil || size <= 0 {
+		return
+	}
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	if usage := rootUsages[root.Path]; usage != nil {
+		usage.bytes = max(usage.bytes-size, 0)
+	}
+}
+
+// 检查并预留根目录的空间。缓存的占用超出限制时先重新统计，避免删除后的过期缓存误报
+func reserveRootBytes(root *Root, delta int64) error {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	limit := quota.MaxRootBytes
+	if limit <= 0 {
+		return nil
+	}
+	usage, err := rootUsageLocked(root, false)
+	if err != nil {
+		return err
+	}
+	if delta > 0 && usage.bytes+delta > limit {
+		if usage, err = rootUsageLocked(root, true); err != nil {
+			return err
+		}
+		if usage.bytes+delta > limit {
+			return fmt.Errorf("%w: writing %d more bytes would bring root %s to %d bytes, over its quota of %d bytes (%d bytes used)", ErrQuotaExceeded, delta, root.Name, usage.bytes+delta, limit, usage.bytes)
+		}
+	}
+	usage.bytes += delta
+	return nil
+}
+
+// 返回根目录的占用，缓存过期或refresh为true时重新统计。调用者需要持有quotaMu
+func rootUsageLocked(root *Root, refresh bool) (*rootUsage, error) {
+	usage := rootUsages[root.Path]
+	if usage != nil && !refresh && time.Since(usage.computed) < rootUsageTTL {
+		return usage, nil
+	}
+	usage = &rootUsage{computed: time.Now()}
+	err := filepath.WalkDir(root.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 统计时跳过无法访问的条目
+			if p != root.Path {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			usage.bytes += info.Size()
+			usage.files++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure usage of root %s: %w", root.Name, err)
+	}
+	rootUsages[root.Path] = usage
+	return usage, nil
+}
+
+// 统计目录中的条目数
+func countDirEntries(dir string) (int, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	count := 0
+	for {
+		names, err := f.Readdirnames(1024)
+		count += len(names)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+// 检查工具响应的大小
+func CheckResultSize(size int) error {
+	limit := currentQuota().MaxResultBytes
+	if limit > 0 && size > limit {
+		return fmt.Errorf("%w: the result is %d bytes, larger than the limit of %d bytes per response; narrow the request (e.g. read a line or byte range, lower the limit or use pagination)", ErrQuotaExceeded, size, limit)
+	}
+	return nil
+}
+
+// 根目录的配额使用情况
+type RootQuotaUsage struct {
+	Name  string   `json:"name"`
+	Mode  RootMode `json:"mode"`
+	Files int      `json:"files"`
+	Bytes int64    `json:"bytes"`
+	// 剩余可写入的字节数，未限制根目录大小时省略
+	RemainingBytes *int64 `json:"remaining_bytes,omitempty"`
+}
+
+// 配额报告
+type QuotaReport struct {
+	Limits QuotaConfig      `json:"limits"`
+	Roots  []RootQuotaUsage `json:"roots"`
+}
+
+// 返回配置的限制和每个根目录当前的占用，占用会重新统计
+func GetQuota() (*QuotaReport, error) {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	report := &QuotaReport{Limits: quota, Roots: make([]RootQuotaUsage, 0)}
+	for _, r := range ListRoots() {
+		usage, err := rootUsageLocked(&r, true)
+		if err != nil {
+			return nil, err
+		}
+		entry := RootQuotaUsage{Name: r.Name, Mode: r.Mode, Files: usage.files, Bytes: usage.bytes}
+		if quota.MaxRootBytes > 0 {
+			remaining := max(quota.MaxRootBytes-usage.bytes, 0)
+			entry.RemainingBytes = &remaining
+		}
+		report.Roots = append(report.Roots, entry)
+	}
+	return report, nil
+}
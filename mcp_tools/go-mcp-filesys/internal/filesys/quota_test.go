@@ -0,0 +1,247 @@
+package filesys
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuotaLimits(t *testing.T) {
+	// setupBatchTree 的根目录中有 a.txt、b.txt、dir、big.bin 四个条目，文件共220字节
+	tests := []struct {
+		name    string
+		quota   QuotaConfig
+		setup   func(t *testing.T, root string)
+		op      func(root string) error
+		wantErr bool
+	}{
+		{
+			name:  "write within file limit",
+			quota: QuotaConfig{MaxFileBytes: 10},
+			op: func(root string) error {
+				_, err := WriteFile(filepath.Join(root, "a.txt"), "12345", "", TextOptions{})
+				return err
+			},
+		},
+		{
+			name:  "write over file limit",
+			quota: QuotaConfig{MaxFileBytes: 10},
+			op: func(root string) error {
+				_, err := WriteFile(filepath.Join(root, "a.txt"), "12345678901", "", TextOptions{})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name:  "append over file limit",
+			quota: QuotaConfig{MaxFileBytes: 10},
+			op: func(root string) error {
+				_, err := AppendFileContent(filepath.Join(root, "a.txt"), "xxxxx", "", TextOptions{})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name:  "create within root limit",
+			quota: QuotaConfig{MaxRootBytes: 230},
+			op: func(root string) error {
+				_, err := CreateNewFile(filepath.Join(root, "new.txt"), "12345", TextOptions{})
+				return err
+			},
+		},
+		{
+			name:  "create over root limit",
+			quota: QuotaConfig{MaxRootBytes: 230},
+			op: func(root string) error {
+				_, err := CreateNewFile(filepath.Join(root, "new.txt"), strings.Repeat("x", 20), TextOptions{})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name:  "shrinking a file is allowed over root limit",
+			quota: QuotaConfig{MaxRootBytes: 100},
+			op: func(root string) error {
+				_, err := WriteFile(filepath.Join(root, "big.bin"), "x", "", TextOptions{})
+				return err
+			},
+		},
+		{
+			name:  "create in full directory",
+			quota: QuotaConfig{MaxDirEntries: 4},
+			op: func(root string) error {
+				_, err := CreateNewFile(filepath.Join(root, "new.txt"), "x", TextOptions{})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name:  "create in directory with room",
+			quota: QuotaConfig{MaxDirEntries: 4},
+			op: func(root string) error {
+				_, err := CreateNewFile(filepath.Join(root, "dir", "new.txt"), "x", TextOptions{})
+				return err
+			},
+		},
+		{
+			name:  "missing parents count in the existing directory",
+			quota: QuotaConfig{MaxDirEntries: 4},
+			op: func(root string) error {
+				_, err := CreateNewFile(filepath.Join(root, "x", "y", "z.txt"), "x", TextOptions{})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name:  "copy over file limit",
+			quota: QuotaConfig{MaxFileBytes: 100},
+			op: func(root string) error {
+				return CopyFile(filepath.Join(root, "big.bin"), filepath.Join(root, "dir", "big.bin"))
+			},
+			wantErr: true,
+		},
+		{
+			name:  "archive over file limit",
+			quota: QuotaConfig{MaxFileBytes: 100},
+			op: func(root string) error {
+				_, err := CreateArchive(filepath.Join(root, "dir", "out.tar"), []string{filepath.Join(root, "a.txt")}, CreateArchiveOptions{})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name:  "archive over root limit",
+			quota: QuotaConfig{MaxRootBytes: 1000},
+			op: func(root string) error {
+				_, err := CreateArchive(filepath.Join(root, "dir", "out.tar"), []string{filepath.Join(root, "big.bin")}, CreateArchiveOptions{})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name:  "archive within limits",
+			quota: QuotaConfig{MaxFileBytes: 4096, MaxRootBytes: 10000},
+			op: func(root string) error {
+				_, err := CreateArchive(filepath.Join(root, "dir", "out.tar"), []string{filepath.Join(root, "a.txt")}, CreateArchiveOptions{})
+				return err
+			},
+		},
+		{
+			name:  "extract over directory entry limit",
+			quota: QuotaConfig{MaxDirEntries: 3},
+			setup: func(t *testing.T, root string) {
+				writeTestTar(t, filepath.Join(root, "dir", "in.tar"), []tarEntry{
+					{name: "1.txt", body: "1"}, {name: "2.txt", body: "2"}, {name: "3.txt", body: "3"}, {name: "4.txt", body: "4"},
+				})
+			},
+			op: func(root string) error {
+				_, err := ExtractArchive(filepath.Join(root, "dir", "in.tar"), filepath.Join(root, "dir", "out"), ExtractOptions{})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name:  "extract with implicit parent over limit",
+			quota: QuotaConfig{MaxDirEntries: 3},
+			setup: func(t *testing.T, root string) {
+				writeTestTar(t, filepath.Join(root, "dir", "in.tar"), []tarEntry{
+					{name: "sub/1.txt", body: "1"}, {name: "sub/2.txt", body: "2"}, {name: "sub/3.txt", body: "3"}, {name: "sub/4.txt", body: "4"},
+				})
+			},
+			op: func(root string) error {
+				_, err := ExtractArchive(filepath.Join(root, "dir", "in.tar"), filepath.Join(root, "dir", "out"), ExtractOptions{})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			// dir 中已有 c.txt 和 in.tar，同名的 c.txt 不计入新增条目
+			name:  "extract into existing directory over limit",
+			quota: QuotaConfig{MaxDirEntries: 3},
+			setup: func(t *testing.T, root string) {
+				writeTestTar(t, filepath.Join(root, "dir", "in.tar"), []tarEntry{{name: "c.txt", body: "same name"}, {name: "d.txt", body: "d"}, {name: "e.txt", body: "e"}})
+			},
+			op: func(root string) error {
+				_, err := ExtractArchive(filepath.Join(root, "dir", "in.tar"), filepath.Join(root, "dir"), ExtractOptions{Overwrite: true})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name:  "extract within limits",
+			quota: QuotaConfig{MaxDirEntries: 4, MaxFileBytes: 10},
+			setup: func(t *testing.T, root string) {
+				writeTestTar(t, filepath.Join(root, "dir", "in.tar"), []tarEntry{
+					{name: "sub/1.txt", body: "1"}, {name: "sub/2.txt", body: "2"}, {name: "3.txt", body: "3"}, {name: "4.txt", body: "4"},
+				})
+			},
+			op: func(root string) error {
+				_, err := ExtractArchive(filepath.Join(root, "dir", "in.tar"), filepath.Join(root, "dir", "out"), ExtractOptions{})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupBatchTree(t)
+			if tt.setup != nil {
+				tt.setup(t, root)
+			}
+			if err := SetQuota(tt.quota); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { SetQuota(QuotaConfig{}) })
+			before := snapshotTree(t, root)
+
+			err := tt.op(root)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrQuotaExceeded) {
+				t.Fatalf("got %v, want quota exceeded", err)
+			}
+			if after := snapshotTree(t, root); !reflect.DeepEqual(before, after) {
+				t.Errorf("tree changed after rejected write:\nbefore %v\nafter  %v", before, after)
+			}
+		})
+	}
+}
+
+func TestSetQuotaRejectsNegativeLimits(t *testing.T) {
+	if err := SetQuota(QuotaConfig{MaxFileBytes: -1}); err == nil {
+		SetQuota(QuotaConfig{})
+		t.Fatal("negative limit accepted")
+	}
+}
+
+func TestGetQuotaReportsRemainingBytes(t *testing.T) {
+	setupBatchTree(t)
+	if err := SetQuota(QuotaConfig{MaxRootBytes: 1000, MaxResultBytes: 10}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetQuota(QuotaConfig{}) })
+
+	report, err := GetQuota()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Roots) != 1 {
+		t.Fatalf("got %d roots, want 1", len(report.Roots))
+	}
+	r := report.Roots[0]
+	if r.Files != 4 || r.Bytes != 220 || r.RemainingBytes == nil || *r.RemainingBytes != 780 {
+		t.Errorf("unexpected usage: %+v", r)
+	}
+	if err := CheckResultSize(10); err != nil {
+		t.Errorf("result at the limit rejected: %v", err)
+	}
+	if err := CheckResultSize(11); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("oversized result: got %v, want quota exceeded", err)
+	}
+}
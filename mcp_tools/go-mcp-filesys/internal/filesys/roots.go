@@ -0,0 +1,246 @@
+package filesys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 根目录的访问模式
+type RootMode string
+
+const (
+	RootModeReadOnly  RootMode = "read-only"
+	RootModeReadWrite RootMode = "read-write"
+)
+
+// 允许访问的根目录
+type Root struct {
+	Name string   `json:"name"`
+	Path string   `json:"path"`
+	Mode RootMode `json:"mode"`
+}
+
+// 根目录名称规则，至少两个字符，避免与Windows盘符混淆
+var rootNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]+$`)
+
+// 已注册的根目录，第一个为默认根目录
+var (
+	roots       []Root
+	folderMutex sync.RWMutex
+)
+
+// 解析访问模式，支持 read-only/ro 和 read-write/rw
+func ParseRootMode(mode string) (RootMode, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "rw", "read-write", "readwrite":
+		return RootModeReadWrite, nil
+	case "ro", "read-only", "readonly":
+		return RootModeReadOnly, nil
+	default:
+		return "", fmt.Errorf("invalid root mode: %s", mode)
+	}
+}
+
+// 设置允许访问的根目录，替换之前的所有配置
+func SetRoots(newRoots []Root) error {
+	if len(newRoots) == 0 {
+		return fmt.Errorf("at least one root directory must be configured")
+	}
+
+	normalized := make([]Root, 0, len(newRoots))
+	names := make(map[string]bool)
+	for _, r := range newRoots {
+		if !rootNameRegexp.MatchString(r.Name) {
+			return fmt.Errorf("invalid root name %q: must start with a letter and contain at least two letters, digits, '-' or '_'", r.Name)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("duplicate root name: %s", r.Name)
+		}
+		names[r.Name] = true
+
+		mode, err := ParseRootMode(string(r.Mode))
+		if err != nil {
+			return err
+		}
+
+		absPath, err := filepath.Abs(r.Path)
+		if err != nil {
+			return fmt.Errorf("invalid path for root %s: %w", r.Name, err)
+		}
+		info, err := os.Stat(absPath)
+		if err != nil {
+			return fmt.Errorf("failed to access root %s: %w", r.Name, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("root %s is not a directory: %s", r.Name, absPath)
+		}
+		// 保存解析符号链接后的真实路径，路径检查都基于真实路径进行
+		realPath, err := filepath.EvalSymlinks(absPath)
+		if err != nil {
+			return fmt.Errorf("failed to resolve root %s: %w", r.Name, err)
+		}
+		normalized = append(normalized, Root{Name: r.Name, Path: filepath.Clean(realPath), Mode: mode})
+	}
+
+	folderMutex.Lock()
+	defer folderMutex.Unlock()
+	roots = normalized
+	return nil
+}
+
+// 返回所有已注册的根目录
+func ListRoots() []Root {
+	folderMutex.RLock()
+	defer folderMutex.RUnlock()
+	return append([]Root(nil), roots...)
+}
+
+// 检查路径是否在任意一个允许的根目录内，路径中的符号链接会被解析后再检查
+func isPathInAllowedDirectory(path string) bool {
+	_, _, err := resolveAllowedPath(path)
+	return err == nil
+}
+
+// 查找路径所属的根目录，路径不在任何根目录内时返回nil。
+// 根目录互相嵌套时返回最内层的根目录
+func rootForPath(path string) *Root {
+	folderMutex.RLock()
+	defer folderMutex.RUnlock()
+
+	cleanPath := filepath.Clean(path)
+	var found *Root
+	for i := range roots {
+		if !isPathWithin(cleanPath, roots[i].Path) {
+			continue
+		}
+		if found == nil || len(roots[i].Path) > len(found.Path) {
+			r := roots[i]
+			found = &r
+		}
+	}
+	return found
+}
+
+// 按名称查找根目录
+func rootByName(name string) *Root {
+	folderMutex.RLock()
+	defer folderMutex.RUnlock()
+
+	for i := range roots {
+		if roots[i].Name == name {
+			r := roots[i]
+			return &r
+		}
+	}
+	return nil
+}
+
+// 默认根目录
+func defaultRoot() *Root {
+	folderMutex.RLock()
+	defer folderMutex.RUnlock()
+
+	if len(roots) == 0 {
+		return nil
+	}
+	r := roots[0]
+	return &r
+}
+
+// 检查路径所在的根目录是否允许写入
+func checkWritable(path string) error {
+	return checkWritableFor(path, OperationWrite)
+}
+
+// 检查权限配置是否允许该类别的操作，以及路径所在的根目录是否允许写入
+func checkWritableFor(path string, op Operation) error {
+	if err := checkOperation(op); err != nil {
+		return err
+	}
+	_, root, err := resolveAllowedPath(path)
+	if err != nil {
+		return err
+	}
+	if root.Mode != RootModeReadWrite {
+		return fmt.Errorf("access denied: root %s is read-only", root.Name)
+	}
+	return nil
+}
+
+// 将工具参数中的路径解析为绝对路径。
+// 支持 "root:relative/path" 指定根目录，不带前缀时使用默认根目录；
+// 也接受位于某个根目录内的绝对路径。返回解析符号链接后的真实路径，不检查路径是否存在
+func ResolvePath(target string) (string, error) {
+	fullPath, root, err := lexicalPath(target)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := confinePath(fullPath, root.Path)
+	if err != nil {
+		return "", fmt.Errorf("access denied: %s escapes root %s: %w", target, root.Name, err)
+	}
+	return resolved, nil
+}
+
+// 按字面拼接出工具参数对应的绝对路径，不解析符号链接，
+// 只检查路径在字面上位于所属根目录内
+func lexicalPath(target string) (string, *Root, error) {
+	target = strings.TrimSpace(target)
+
+	root := defaultRoot()
+	if root == nil {
+		return "", nil, fmt.Errorf("no root directory configured")
+	}
+
+	var fullPath string
+	if idx := strings.Index(target, ":"); idx > 0 && rootByName(target[:idx]) != nil {
+		// 指定了根目录时，路径始终相对于该根目录
+		root = rootByName(target[:idx])
+		fullPath = filepath.Join(root.Path, filepath.FromSlash(target[idx+1:]))
+	} else if filepath.IsAbs(target) {
+		// 绝对路径必须位于某个根目录内
+		fullPath = filepath.Clean(target)
+		if r := rootForPath(fullPath); r != nil {
+			root = r
+		}
+	} else {
+		fullPath = filepath.Join(root.Path, filepath.FromSlash(target))
+	}
+
+	if !isPathWithin(fullPath, root.Path) {
+		return "", nil, fmt.Errorf("access denied: %s is outside root %s", target, root.Name)
+	}
+	return fullPath, root, nil
+}
+
+// 解析路径并要求路径已存在
+func ResolveExistingPath(target string) (string, error) {
+	fullPath, err := ResolvePath(target)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(fullPath); err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%s does not exist", target)
+		}
+		return "", err
+	}
+	return fullPath, nil
+}
+
+// 将绝对路径转换为 "root:relative/path" 形式，便于在结果中返回给调用方
+func DisplayPath(path string) string {
+	root := rootForPath(path)
+	if root == nil {
+		return filepath.ToSlash(path)
+	}
+	rel, err := filepath.Rel(root.Path, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return root.Name + ":" + filepath.ToSlash(rel)
+}
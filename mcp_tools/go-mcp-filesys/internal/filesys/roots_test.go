@@ -0,0 +1,203 @@
+package filesys
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 构造三个根目录：默认的读写根目录ws、只读的docs，以及嵌套在ws中的只读根目录vendor
+func setupRoots(t *testing.T) (string, string) {
+	t.Helper()
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := filepath.Join(base, "ws")
+	docs := filepath.Join(base, "docs")
+	writeTestFiles(t, base, map[string]string{
+		"ws/a.txt":        "alpha\n",
+		"ws/vendor/v.txt": "vendored\n",
+		"docs/guide.md":   "guide\n",
+	})
+	err = SetRoots([]Root{
+		{Name: "ws", Path: ws, Mode: RootModeReadWrite},
+		{Name: "docs", Path: docs, Mode: RootModeReadOnly},
+		{Name: "vendor", Path: filepath.Join(ws, "vendor"), Mode: "ro"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws, docs
+}
+
+func TestSetRootsValidation(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		roots   []Root
+		wantErr string
+	}{
+		{name: "no roots", wantErr: "at least one root"},
+		{name: "single letter name", roots: []Root{{Name: "C", Path: dir}}, wantErr: "invalid root name"},
+		{name: "name starting with a digit", roots: []Root{{Name: "1ws", Path: dir}}, wantErr: "invalid root name"},
+		{name: "name with a colon", roots: []Root{{Name: "w:s", Path: dir}}, wantErr: "invalid root name"},
+		{name: "empty name", roots: []Root{{Path: dir}}, wantErr: "invalid root name"},
+		{name: "duplicate name", roots: []Root{{Name: "ws", Path: dir}, {Name: "ws", Path: t.TempDir()}}, wantErr: "duplicate root name: ws"},
+		{name: "invalid mode", roots: []Root{{Name: "ws", Path: dir, Mode: "append"}}, wantErr: "invalid root mode"},
+		{name: "missing directory", roots: []Root{{Name: "ws", Path: filepath.Join(dir, "missing")}}, wantErr: "failed to access root ws"},
+		{name: "file as root", roots: []Root{{Name: "ws", Path: file}}, wantErr: "not a directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupLockRoot(t)
+			err := SetRoots(tt.roots)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			// 设置失败时保留原来的根目录
+			want := []Root{{Name: "ws", Path: root, Mode: RootModeReadWrite}}
+			if got := ListRoots(); !reflect.DeepEqual(got, want) {
+				t.Errorf("roots = %+v after a failed update, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestSetRootsNormalizes(t *testing.T) {
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	realDir := filepath.Join(base, "real")
+	if err := os.Mkdir(realDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(realDir, filepath.Join(base, "link")); err != nil {
+		t.Fatal(err)
+	}
+	roots := []Root{
+		{Name: "ws", Path: base + "/link/../link/"},
+		{Name: "alias", Path: base + "/real/.", Mode: "RO"},
+	}
+	if err := SetRoots(roots); err != nil {
+		t.Fatal(err)
+	}
+	want := []Root{
+		{Name: "ws", Path: realDir, Mode: RootModeReadWrite},
+		{Name: "alias", Path: realDir, Mode: RootModeReadOnly},
+	}
+	if got := ListRoots(); !reflect.DeepEqual(got, want) {
+		t.Errorf("roots = %+v, want %+v", got, want)
+	}
+}
+
+func TestResolvePathRoots(t *testing.T) {
+	ws, docs := setupRoots(t)
+
+	tests := []struct {
+		name    string
+		target  string
+		want    string
+		display string
+		wantErr string
+	}{
+		{name: "relative to the default root", target: "a.txt", want: filepath.Join(ws, "a.txt"), display: "ws:a.txt"},
+		{name: "named root", target: "docs:guide.md", want: filepath.Join(docs, "guide.md"), display: "docs:guide.md"},
+		{name: "named root with leading slash", target: "docs:/guide.md", want: filepath.Join(docs, "guide.md"), display: "docs:guide.md"},
+		{name: "root itself", target: "docs:", want: docs, display: "docs:."},
+		{name: "surrounding spaces", target: "  docs:guide.md ", want: filepath.Join(docs, "guide.md"), display: "docs:guide.md"},
+		{name: "nested root by name", target: "vendor:v.txt", want: filepath.Join(ws, "vendor", "v.txt"), display: "vendor:v.txt"},
+		{name: "nested root through parent", target: "ws:vendor/v.txt", want: filepath.Join(ws, "vendor", "v.txt"), display: "vendor:v.txt"},
+		{name: "absolute path in another root", target: filepath.Join(docs, "guide.md"), want: filepath.Join(docs, "guide.md"), display: "docs:guide.md"},
+		{name: "unknown prefix is part of the name", target: "other:x.txt", want: filepath.Join(ws, "other:x.txt"), display: "ws:other:x.txt"},
+		{name: "traversal between roots", target: "docs:../ws/a.txt", wantErr: "outside root docs"},
+		{name: "traversal from the default root", target: "../docs/guide.md", wantErr: "outside root ws"},
+		{name: "absolute path outside the roots", target: filepath.Dir(ws), wantErr: "outside root ws"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolvePath(tt.target)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ResolvePath(%q) = %q, %v; want error %q", tt.target, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolvePath(%q) = %q, want %q", tt.target, got, tt.want)
+			}
+			if display := DisplayPath(got); display != tt.display {
+				t.Errorf("DisplayPath(%q) = %q, want %q", got, display, tt.display)
+			}
+		})
+	}
+}
+
+func TestReadOnlyRoots(t *testing.T) {
+	ws, docs := setupRoots(t)
+
+	tests := []struct {
+		name    string
+		path    string
+		op      Operation
+		wantErr string
+	}{
+		{name: "write in read-write root", path: filepath.Join(ws, "a.txt"), op: OperationWrite},
+		{name: "delete in read-write root", path: filepath.Join(ws, "new.txt"), op: OperationDelete},
+		{name: "write in read-only root", path: filepath.Join(docs, "guide.md"), op: OperationWrite, wantErr: "root docs is read-only"},
+		{name: "new file in read-only root", path: filepath.Join(docs, "new.md"), op: OperationWrite, wantErr: "root docs is read-only"},
+		{name: "chmod in read-only root", path: filepath.Join(docs, "guide.md"), op: OperationChmod, wantErr: "root docs is read-only"},
+		{name: "nested read-only root wins", path: filepath.Join(ws, "vendor", "v.txt"), op: OperationWrite, wantErr: "root vendor is read-only"},
+		{name: "outside the roots", path: filepath.Join(filepath.Dir(ws), "x.txt"), op: OperationWrite, wantErr: "access denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkWritableFor(tt.path, tt.op)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 只读根目录中的文件可以读取，但写入、删除和批量操作都被拒绝
+	if _, err := ReadFile(filepath.Join(docs, "guide.md"), ReadFileOptions{}); err != nil {
+		t.Errorf("read in read-only root: %v", err)
+	}
+	before := snapshotTree(t, docs)
+	if _, err := WriteFile(filepath.Join(docs, "guide.md"), "changed\n", "", TextOptions{}); err == nil {
+		t.Error("write in read-only root accepted")
+	}
+	if err := DeleteFile(filepath.Join(docs, "guide.md")); err == nil {
+		t.Error("delete in read-only root accepted")
+	}
+	result, err := ApplyBatch([]BatchOperation{{Op: BatchMove, From: filepath.Join(ws, "a.txt"), To: filepath.Join(docs, "a.txt")}}, BatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Committed {
+		t.Error("batch move into read-only root committed")
+	}
+	if after := snapshotTree(t, docs); !reflect.DeepEqual(before, after) {
+		t.Errorf("read-only root changed:\nbefore %v\nafter  %v", before, after)
+	}
+}
@@ -0,0 +1,436 @@
+package filesys
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// 默认最多返回的结果数量
+const DefaultMaxSearchResults = 100
+
+// 结果中单行内容的最大长度，避免压缩过的超长行占满上下文
+const maxSearchLineLength = 512
+
+// 判断二进制文件时检查的字节数
+const binarySniffLength = 8000
+
+// 搜索时每行最多读取的字节数，超出的部分不参与匹配
+const maxSearchLineBytes = 1024 * 1024
+
+// 搜索选项
+type SearchOptions struct {
+	// 搜索内容（或文件名），Regex为false时按普通字符串匹配
+	Pattern    string
+	Regex      bool
+	IgnoreCase bool
+	// glob模式，不含 / 的模式匹配文件名，含 / 的模式匹配相对路径，支持 **
+	Include      []string
+	Exclude      []string
+	MaxResults   int
+	ContextLines int
+	// 是否遵循 .gitignore / .ignore 规则
+	RespectIgnore bool
+}
+
+// 一条匹配结果
+type SearchMatch struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line"`
+	Column int      `json:"column"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// 内容搜索结果
+type SearchResult struct {
+	Matches       []*SearchMatch `json:"matches"`
+	FilesScanned  int            `json:"files_scanned"`
+	FilesMatched  int            `json:"files_matched"`
+	SkippedBinary int            `json:"skipped_binary"`
+	Truncated     bool           `json:"truncated"`
+}
+
+// 编译后的glob模式
+type globPattern struct {
+	re       *regexp.Regexp
+	basename bool
+}
+
+// 将glob模式转换为正则表达式，支持 * ? [...] 和 **
+func globToRegexp(pattern string, ignoreCase bool) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	if ignoreCase {
+		sb.WriteString("(?i)")
+	}
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+func compileGlobs(patterns []string, ignoreCase bool) ([]globPattern, error) {
+	globs := make([]globPattern, 0, len(patterns))
+	for _, p := range patterns {
+		p = strings.TrimSpace(filepath.ToSlash(p))
+		if p == "" {
+			continue
+		}
+		basename := !strings.Contains(strings.TrimSuffix(p, "/"), "/")
+		re, err := globToRegexp(strings.TrimSuffix(strings.TrimPrefix(p, "/"), "/"), ignoreCase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", p, err)
+		}
+		globs = append(globs, globPattern{re: re, basename: basename})
+	}
+	return globs, nil
+}
+
+func matchAnyGlob(globs []globPattern, relPath string) bool {
+	for _, g := range globs {
+		target := relPath
+		if g.basename {
+			target = filepath.Base(relPath)
+		}
+		if g.re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据选项构造匹配用的正则表达式
+func compileSearchPattern(opts SearchOptions) (*regexp.Regexp, error) {
+	pattern := opts.Pattern
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+	return re, nil
+}
+
+// 遍历目录并对每个符合include/exclude条件的文件调用fn，fn返回false时停止遍历。
+// matcher不为nil时跳过被忽略规则匹配的文件和目录
+func walkSearchFiles(directory string, include []globPattern, exclude []globPattern, matcher *IgnoreMatcher, fn func(path string, relPath string, d fs.DirEntry) bool) error {
+	stop := fmt.Errorf("stop walking")
+	err := filepath.WalkDir(directory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 根目录无法访问时返回错误，其余无法访问的条目直接跳过
+			if path == directory {
+				return err
+			}
+			return nil
+		}
+		if path == directory {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if matchAnyGlob(exclude, relPath) || (matcher != nil && matcher.Match(path, d.IsDir())) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// WalkDir不会进入符号链接目录，只需检查符号链接本身指向的位置
+		if d.Type()&fs.ModeSymlink != 0 && !isPathInAllowedDirectory(path) {
+			return nil
+		}
+		if !d.IsDir() && len(include) > 0 && !matchAnyGlob(include, relPath) {
+			return nil
+		}
+		if !fn(path, relPath, d) {
+			return stop
+		}
+		return nil
+	})
+	if err == stop {
+		return nil
+	}
+	return err
+}
+
+// 搜索文件名，支持子串、glob和正则匹配
+func SearchFile(directory string, opts SearchOptions) ([]string, bool, error) {
+	if !isPathInAllowedDirectory(directory) {
+		return nil, false, fmt.Errorf("access denied: %s", directory)
+	}
+	directory = filepath.Clean(directory)
+	if _, err := os.Stat(directory); os.IsNotExist(err) {
+		return nil, false, fmt.Errorf("directory does not exist: %s", directory)
+	}
+
+	include, err := compileGlobs(opts.Include, opts.IgnoreCase)
+	if err != nil {
+		return nil, false, err
+	}
+	exclude, err := compileGlobs(opts.Exclude, opts.IgnoreCase)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 不是正则且含有通配符时，文件名按glob匹配，否则按子串/正则匹配
+	var match func(name string) bool
+	if !opts.Regex && strings.ContainsAny(opts.Pattern, "*?[") {
+		globs, err := compileGlobs([]string{opts.Pattern}, opts.IgnoreCase)
+		if err != nil {
+			return nil, false, err
+		}
+		match = func(relPath string) bool { return matchAnyGlob(globs, relPath) }
+	} else {
+		re, err := compileSearchPattern(opts)
+		if err != nil {
+			return nil, false, err
+		}
+		match = func(relPath string) bool { return re.MatchString(filepath.Base(relPath)) }
+	}
+
+	maxResults := opts.MaxResults
+	if maxResults <= 0 {
+		maxResults = DefaultMaxSearchResults
+	}
+
+	var matcher *IgnoreMatcher
+	if opts.RespectIgnore {
+		matcher = newIgnoreMatcherFor(directory)
+	}
+
+	result := make([]string, 0)
+	truncated := false
+	err = walkSearchFiles(directory, include, exclude, matcher, func(path string, relPath string, d fs.DirEntry) bool {
+		if !match(relPath) {
+			return true
+		}
+		if len(result) >= maxResults {
+			truncated = true
+			return false
+		}
+		result = append(result, relPath)
+		return true
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to search files: %w", err)
+	}
+	return result, truncated, nil
+}
+
+// 搜索文件内容，逐行流式读取文件，返回带上下文的匹配位置
+func SearchFileContent(directory string, opts SearchOptions) (*SearchResult, error) {
+	if !isPathInAllowedDirectory(directory) {
+		return nil, fmt.Errorf("access denied: %s", directory)
+	}
+	cleanDir := filepath.Clean(directory)
+
+	re, err := compileSearchPattern(opts)
+	if err != nil {
+		return nil, err
+	}
+	include, err := compileGlobs(opts.Include, opts.IgnoreCase)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileGlobs(opts.Exclude, opts.IgnoreCase)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxResults <= 0 {
+		opts.MaxResults = DefaultMaxSearchResults
+	}
+	if opts.ContextLines < 0 {
+		opts.ContextLines = 0
+	}
+
+	var matcher *IgnoreMatcher
+	if opts.RespectIgnore {
+		matcher = newIgnoreMatcherFor(cleanDir)
+	}
+
+	result := &SearchResult{Matches: make([]*SearchMatch, 0)}
+	err = walkSearchFiles(cleanDir, include, exclude, matcher, func(path string, relPath string, d fs.DirEntry) bool {
+		if !d.Type().IsRegular() {
+			return true
+		}
+		before := len(result.Matches)
+		binary, truncated := searchInFile(path, relPath, re, opts, result)
+		switch {
+		case binary:
+			result.SkippedBinary++
+		default:
+			result.FilesScanned++
+		}
+		if len(result.Matches) > before {
+			result.FilesMatched++
+		}
+		if truncated {
+			result.Truncated = true
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search files: %w", err)
+	}
+	return result, nil
+}
+
+// 在单个文件中搜索，返回文件是否为二进制文件以及是否达到结果上限
+func searchInFile(path string, relPath string, re *regexp.Regexp, opts SearchOptions, result *SearchResult) (bool, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, false
+	}
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	head, _ := reader.Peek(binarySniffLength)
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true, false
+	}
+
+	// 保存前N行用于上下文，pending中的匹配还在等待后续上下文
+	previous := make([]string, 0, opts.ContextLines)
+	pending := make([]*SearchMatch, 0)
+	limitReached := false
+	lineNo := 0
+
+	for {
+		line, err := readSearchLine(reader)
+		if len(line) == 0 && err != nil {
+			break
+		}
+		lineNo++
+		line = strings.TrimRight(line, "\r\n")
+		display := truncateSearchLine(line)
+
+		if opts.ContextLines > 0 {
+			remaining := pending[:0]
+			for _, m := range pending {
+				m.After = append(m.After, display)
+				if len(m.After) < opts.ContextLines {
+					remaining = append(remaining, m)
+				}
+			}
+			pending = remaining
+		}
+
+		if !limitReached {
+			if loc := re.FindStringIndex(line); loc != nil {
+				if len(result.Matches) >= opts.MaxResults {
+					limitReached = true
+				} else {
+					m := &SearchMatch{
+						Path:   relPath,
+						Line:   lineNo,
+						Column: utf8.RuneCountInString(line[:loc[0]]) + 1,
+						Text:   display,
+					}
+					if len(previous) > 0 {
+						m.Before = append([]string(nil), previous...)
+					}
+					result.Matches = append(result.Matches, m)
+					if opts.ContextLines > 0 {
+						pending = append(pending, m)
+					}
+				}
+			}
+		}
+
+		if limitReached && len(pending) == 0 {
+			break
+		}
+		if opts.ContextLines > 0 {
+			if len(previous) == opts.ContextLines {
+				previous = previous[1:]
+			}
+			previous = append(previous, display)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return false, limitReached
+}
+
+func truncateSearchLine(line string) string {
+	if len(line) <= maxSearchLineLength {
+		return line
+	}
+	return string(trimIncompleteRune([]byte(line[:maxSearchLineLength]))) + "..."
+}
+
+// 读取一行，最多保留maxSearchLineBytes字节。ReadSlice每次最多返回缓冲区大小的内容，
+// 超长的行分多次读取，超出的部分直接丢弃，不会整行读入内存
+func readSearchLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	capped := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !capped {
+			if room := maxSearchLineBytes - len(line); len(chunk) > room {
+				line = trimIncompleteRune(append(line, chunk[:room]...))
+				capped = true
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
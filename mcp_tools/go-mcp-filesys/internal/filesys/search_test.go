@@ -0,0 +1,271 @@
+package filesys
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGlobMatching(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		ignoreCase bool
+		path       string
+		want       bool
+	}{
+		// 不含 / 的模式匹配任意深度的文件名
+		{pattern: "*.go", path: "main.go", want: true},
+		{pattern: "*.go", path: "cmd/app/main.go", want: true},
+		{pattern: "*.go", path: "main.go.txt", want: false},
+		{pattern: "*.GO", path: "main.go", want: false},
+		{pattern: "*.GO", ignoreCase: true, path: "main.go", want: true},
+		{pattern: "a?c", path: "x/abc", want: true},
+		{pattern: "a?c", path: "ac", want: false},
+		{pattern: "[!a]*.txt", path: "b.txt", want: true},
+		{pattern: "[!a]*.txt", path: "a.txt", want: false},
+		{pattern: "[a-c].txt", path: "d/b.txt", want: true},
+		{pattern: "[abc", path: "[abc", want: true},
+		{pattern: `\*.txt`, path: "*.txt", want: true},
+		{pattern: `\*.txt`, path: "a.txt", want: false},
+		{pattern: "vendor/", path: "src/vendor", want: true},
+		// 含 / 的模式匹配相对路径
+		{pattern: "cmd/*.go", path: "cmd/main.go", want: true},
+		{pattern: "cmd/*.go", path: "cmd/app/main.go", want: false},
+		{pattern: "cmd/*.go", path: "x/cmd/main.go", want: false},
+		{pattern: "/main.go", path: "main.go", want: true},
+		{pattern: "/main.go", path: "cmd/main.go", want: false},
+		{pattern: "**/*.go", path: "main.go", want: true},
+		{pattern: "**/*.go", path: "a/b/c.go", want: true},
+		{pattern: "src/**", path: "src/a/b.go", want: true},
+		{pattern: "src/**", path: "lib/src/a.go", want: false},
+		{pattern: "a/**/b.go", path: "a/b.go", want: true},
+		{pattern: "a/**/b.go", path: "a/x/y/b.go", want: true},
+		{pattern: "a/**/b.go", path: "a/xb.go", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.pattern, tt.path), func(t *testing.T) {
+			globs, err := compileGlobs([]string{tt.pattern}, tt.ignoreCase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matchAnyGlob(globs, tt.path); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchFileContent(t *testing.T) {
+	files := map[string]string{
+		"a.txt":       "one\ntwo needle\nthree\nfour\nfive needle\nsix\n",
+		"b.go":        "package b\n\n// 中文 needle here\n",
+		"sub/c.txt":   "needle\r\nNEEDLE\r\n",
+		"bin.dat":     "needle\x00\x01\x02",
+		"skip/d.txt":  "needle\n",
+		".gitignore":  "skip/\n",
+		"sub/e.md":    "nothing\n",
+		"long/f.txt":  strings.Repeat("x", 100) + "needle" + "\n",
+		"order/g.txt": "needle needle\n",
+	}
+
+	tests := []struct {
+		name string
+		opts SearchOptions
+		// path:line:column
+		want          []string
+		wantTruncated bool
+		check         func(t *testing.T, r *SearchResult)
+	}{
+		{
+			name: "literal",
+			opts: SearchOptions{Pattern: "needle", Include: []string{"a.txt"}},
+			want: []string{"a.txt:2:5", "a.txt:5:6"},
+		},
+		{
+			name: "column counts characters",
+			opts: SearchOptions{Pattern: "needle", Include: []string{"*.go"}},
+			want: []string{"b.go:3:7"},
+		},
+		{
+			name: "first match on the line",
+			opts: SearchOptions{Pattern: "needle", Include: []string{"order/*"}},
+			want: []string{"order/g.txt:1:1"},
+		},
+		{
+			name: "ignore case and crlf",
+			opts: SearchOptions{Pattern: "needle", IgnoreCase: true, Include: []string{"sub/**"}},
+			want: []string{"sub/c.txt:1:1", "sub/c.txt:2:1"},
+			check: func(t *testing.T, r *SearchResult) {
+				if r.Matches[0].Text != "needle" {
+					t.Errorf("text = %q, want line ending removed", r.Matches[0].Text)
+				}
+			},
+		},
+		{
+			name: "regex",
+			opts: SearchOptions{Pattern: `t\w+ needle`, Regex: true},
+			want: []string{"a.txt:2:1"},
+		},
+		{
+			name: "literal does not use regex syntax",
+			opts: SearchOptions{Pattern: "ne.dle"},
+		},
+		{
+			name: "exclude",
+			opts: SearchOptions{Pattern: "needle", Exclude: []string{"*.txt", "*.go"}},
+			check: func(t *testing.T, r *SearchResult) {
+				if r.SkippedBinary != 1 {
+					t.Errorf("skipped binary = %d, want 1", r.SkippedBinary)
+				}
+			},
+		},
+		{
+			name: "respect ignore files",
+			opts: SearchOptions{Pattern: "needle", Include: []string{"*.txt"}, RespectIgnore: true},
+			want: []string{"a.txt:2:5", "a.txt:5:6", "long/f.txt:1:101", "order/g.txt:1:1", "sub/c.txt:1:1"},
+		},
+		{
+			name: "binary files are skipped",
+			opts: SearchOptions{Pattern: "needle", Include: []string{"*.dat", "*.md"}},
+			check: func(t *testing.T, r *SearchResult) {
+				if r.SkippedBinary != 1 || r.FilesScanned != 1 || r.FilesMatched != 0 {
+					t.Errorf("skipped = %d, scanned = %d, matched = %d; want 1, 1, 0", r.SkippedBinary, r.FilesScanned, r.FilesMatched)
+				}
+			},
+		},
+		{
+			name: "context lines",
+			opts: SearchOptions{Pattern: "needle", Include: []string{"a.txt"}, ContextLines: 2},
+			want: []string{"a.txt:2:5", "a.txt:5:6"},
+			check: func(t *testing.T, r *SearchResult) {
+				first, second := r.Matches[0], r.Matches[1]
+				if !reflect.DeepEqual(first.Before, []string{"one"}) || !reflect.DeepEqual(first.After, []string{"three", "four"}) {
+					t.Errorf("first match context = %q / %q", first.Before, first.After)
+				}
+				if !reflect.DeepEqual(second.Before, []string{"three", "four"}) || !reflect.DeepEqual(second.After, []string{"six"}) {
+					t.Errorf("second match context = %q / %q", second.Before, second.After)
+				}
+			},
+		},
+		{
+			name:          "max results",
+			opts:          SearchOptions{Pattern: "needle", Include: []string{"a.txt"}, MaxResults: 1, ContextLines: 1},
+			want:          []string{"a.txt:2:5"},
+			wantTruncated: true,
+			check: func(t *testing.T, r *SearchResult) {
+				// 达到上限后仍然补齐已有匹配的后续上下文
+				if !reflect.DeepEqual(r.Matches[0].After, []string{"three"}) {
+					t.Errorf("after = %q, want [three]", r.Matches[0].After)
+				}
+			},
+		},
+		{
+			name: "max results not exceeded",
+			opts: SearchOptions{Pattern: "needle", Include: []string{"a.txt"}, MaxResults: 2},
+			want: []string{"a.txt:2:5", "a.txt:5:6"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupLockRoot(t)
+			writeTestFiles(t, root, files)
+			r, err := SearchFileContent(root, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(r.Matches))
+			for _, m := range r.Matches {
+				got = append(got, fmt.Sprintf("%s:%d:%d", m.Path, m.Line, m.Column))
+			}
+			want := tt.want
+			if want == nil {
+				want = []string{}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("matches = %q, want %q", got, want)
+			}
+			if r.Truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", r.Truncated, tt.wantTruncated)
+			}
+			if tt.check != nil {
+				tt.check(t, r)
+			}
+		})
+	}
+}
+
+func TestSearchFileContentLongLines(t *testing.T) {
+	root := setupLockRoot(t)
+	// 第一行超出读取上限，上限之后的内容不参与匹配，也不影响后面的行号
+	long := "head" + strings.Repeat("x", maxSearchLineBytes) + "late\n"
+	writeTestFiles(t, root, map[string]string{"f.txt": long + "late again\n"})
+
+	r, err := SearchFileContent(root, SearchOptions{Pattern: "late"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Matches) != 1 || r.Matches[0].Line != 2 || r.Matches[0].Text != "late again" {
+		t.Fatalf("unexpected matches: %+v", r.Matches)
+	}
+
+	r, err = SearchFileContent(root, SearchOptions{Pattern: "head"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Matches) != 1 || r.Matches[0].Line != 1 {
+		t.Fatalf("unexpected matches: %+v", r.Matches)
+	}
+	if text := r.Matches[0].Text; len(text) != maxSearchLineLength+len("...") || !strings.HasPrefix(text, "headxxx") {
+		t.Errorf("text length = %d, want truncated to %d", len(text), maxSearchLineLength)
+	}
+}
+
+func TestSearchFile(t *testing.T) {
+	files := map[string]string{
+		"main.go":         "",
+		"cmd/app/main.go": "",
+		"cmd/app/App.txt": "",
+		"docs/readme.md":  "",
+		"vendor/x/y.go":   "",
+	}
+
+	tests := []struct {
+		name          string
+		opts          SearchOptions
+		want          []string
+		wantTruncated bool
+	}{
+		{name: "substring", opts: SearchOptions{Pattern: "main"}, want: []string{"cmd/app/main.go", "main.go"}},
+		{name: "glob by name", opts: SearchOptions{Pattern: "*.go"}, want: []string{"cmd/app/main.go", "main.go", "vendor/x/y.go"}},
+		{name: "glob by path", opts: SearchOptions{Pattern: "cmd/**/*.go"}, want: []string{"cmd/app/main.go"}},
+		{name: "regex", opts: SearchOptions{Pattern: `^[a-z]\.go$`, Regex: true}, want: []string{"vendor/x/y.go"}},
+		{name: "ignore case matches directories too", opts: SearchOptions{Pattern: "app", IgnoreCase: true}, want: []string{"cmd/app", "cmd/app/App.txt"}},
+		{name: "exclude directory", opts: SearchOptions{Pattern: "*.go", Exclude: []string{"vendor/"}}, want: []string{"cmd/app/main.go", "main.go"}},
+		{name: "include", opts: SearchOptions{Pattern: ".", Include: []string{"*.md"}}, want: []string{"docs/readme.md"}},
+		{name: "max results", opts: SearchOptions{Pattern: "*.go", MaxResults: 2}, want: []string{"cmd/app/main.go", "main.go"}, wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupLockRoot(t)
+			writeTestFiles(t, root, files)
+			got, truncated, err := SearchFile(root, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range got {
+				got[i] = filepath.ToSlash(got[i])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+			if truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package filesys
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 批量查询文件信息时的最大路径数
+const MaxStatPaths = 100
+
+// 判断MIME类型和编码时读取的字节数
+const statSniffLength = 8000
+
+// 查询文件信息的选项
+type StatOptions struct {
+	SHA256 bool
+	MD5    bool
+	// 统计文本文件的行数
+	CountLines bool
+}
+
+// 文件信息。路径是符号链接时Type为symlink，其余字段描述链接指向的目标
+type FileStat struct {
+	Path          string     `json:"path"`
+	Type          string     `json:"type,omitempty"`
+	Size          int64      `json:"size"`
+	Mode          string     `json:"mode,omitempty"`
+	Permissions   string     `json:"permissions,omitempty"`
+	Owner         string     `json:"owner,omitempty"`
+	Group         string     `json:"group,omitempty"`
+	UID           *int       `json:"uid,omitempty"`
+	GID           *int       `json:"gid,omitempty"`
+	ModTime       time.Time  `json:"mod_time"`
+	ChangeTime    *time.Time `json:"change_time,omitempty"`
+	SymlinkTarget string     `json:"symlink_target,omitempty"`
+	ResolvedPath  string     `json:"resolved_path,omitempty"`
+	MIMEType      string     `json:"mime_type,omitempty"`
+	Encoding      string     `json:"encoding,omitempty"`
+	LineEnding    string     `json:"line_ending,omitempty"`
+	Lines         *int       `json:"lines,omitempty"`
+	SHA256        string     `json:"sha256,omitempty"`
+	MD5           string     `json:"md5,omitempty"`
+}
+
+// 批量查询中单个路径的结果，失败时只有Path和Error
+type StatResult struct {
+	*FileStat
+	Path  string `json:"path"`
+	Error string `json:"error,omitempty"`
+}
+
+// 查询单个路径的文件信息，target为工具参数中的路径（支持 "root:path" 形式）。
+// 符号链接本身和它指向的目标都必须位于根目录内
+func StatFile(target string, opts StatOptions) (*FileStat, error) {
+	linkPath, _, err := lexicalPath(target)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := ResolvePath(target)
+	if err != nil {
+		return nil, err
+	}
+
+	stat := &FileStat{Path: DisplayPath(linkPath)}
+	if linkInfo, err := os.Lstat(linkPath); err == nil && linkInfo.Mode()&os.ModeSymlink != 0 {
+		stat.Type = "symlink"
+		stat.SymlinkTarget, _ = os.Readlink(linkPath)
+	}
+	if resolved != linkPath {
+		stat.ResolvedPath = DisplayPath(resolved)
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if stat.Type == "symlink" {
+				return nil, fmt.Errorf("%s is a dangling symbolic link to %s", target, stat.SymlinkTarget)
+			}
+			return nil, fmt.Errorf("%s does not exist", target)
+		}
+		return nil, err
+	}
+
+	if stat.Type == "" {
+		switch {
+		case info.IsDir():
+			stat.Type = "directory"
+		case info.Mode().IsRegular():
+			stat.Type = "file"
+		default:
+			stat.Type = "other"
+		}
+	}
+	stat.Size = info.Size()
+	stat.Mode = info.Mode().String()
+	stat.Permissions = fmt.Sprintf("%04o", info.Mode().Perm())
+	stat.ModTime = info.ModTime()
+	if owner, ok := fileOwner(info); ok {
+		stat.UID, stat.GID = &owner.uid, &owner.gid
+		stat.Owner = lookupUserName(owner.uid)
+		stat.Group = lookupGroupName(owner.gid)
+		stat.ChangeTime = owner.ctime
+	}
+
+	if !info.Mode().IsRegular() {
+		return stat, nil
+	}
+	if err := statContent(resolved, stat, opts); err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
+
+// 批量查询文件信息，单个路径失败时在对应结果的Error中返回
+func StatFiles(targets []string, opts StatOptions) ([]StatResult, error) {
+	if len(targets) > MaxStatPaths {
+		return nil, fmt.Errorf("too many paths: %d (limit %d)", len(targets), MaxStatPaths)
+	}
+	results := make([]StatResult, 0, len(targets))
+	for _, target := range targets {
+		stat, err := StatFile(target, opts)
+		if err != nil {
+			results = append(results, StatResult{Path: target, Error: err.Error()})
+			continue
+		}
+		results = append(results, StatResult{FileStat: stat, Path: stat.Path})
+	}
+	return results, nil
+}
+
+// 读取文件内容，识别MIME类型和编码，并按需统计行数和计算校验和
+func statContent(path string, stat *FileStat, opts StatOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	head := make([]byte, statSniffLength)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+	stat.Encoding = guessEncoding(head, int64(n) == stat.Size)
+	if stat.Encoding != "binary" {
+		stat.LineEnding = detectTextFormat(head, int64(n) == stat.Size).LineEnding
+	}
+	stat.MIMEType = detectMIMEType(path, head, stat.Encoding)
+
+	needLines := opts.CountLines && stat.Encoding != "binary"
+	if !needLines && !opts.SHA256 && !opts.MD5 {
+		return nil
+	}
+
+	writers := make([]io.Writer, 0, 3)
+	var sha, md hash.Hash
+	if opts.SHA256 {
+		sha = sha256.New()
+		writers = append(writers, sha)
+	}
+	if opts.MD5 {
+		md = md5.New()
+		writers = append(writers, md)
+	}
+	lines := &lineCounter{encoding: stat.Encoding}
+	if needLines {
+		writers = append(writers, lines)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if sha != nil {
+		stat.SHA256 = hex.EncodeToString(sha.Sum(nil))
+	}
+	if md != nil {
+		stat.MD5 = hex.EncodeToString(md.Sum(nil))
+	}
+	if needLines {
+		count := lines.count()
+		stat.Lines = &count
+	}
+	return nil
+}
+
+// 统计写入内容的行数，规则与countLines一致：最后一行没有换行符时也计为一行。
+// UTF-16编码的内容按两字节的编码单元统计，其余编码按字节统计
+type lineCounter struct {
+	encoding string
+	newlines int
+	written  int64
+	last     uint16
+	// UTF-16编码单元中已写入的第一个字节
+	pending    byte
+	hasPending bool
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	c.written += int64(len(p))
+	if c.encoding != "utf-16le" && c.encoding != "utf-16be" {
+		c.newlines += bytes.Count(p, []byte{'\n'})
+		if len(p) > 0 {
+			c.last = uint16(p[len(p)-1])
+		}
+		return len(p), nil
+	}
+	for _, b := range p {
+		if !c.hasPending {
+			c.pending, c.hasPending = b, true
+			continue
+		}
+		c.hasPending = false
+		if c.encoding == "utf-16le" {
+			c.last = uint16(c.pending) | uint16(b)<<8
+		} else {
+			c.last = uint16(c.pending)<<8 | uint16(b)
+		}
+		if c.last == '\n' {
+			c.newlines++
+		}
+	}
+	return len(p), nil
+}
+
+func (c *lineCounter) count() int {
+	if c.written > 0 && c.last != '\n' {
+		return c.newlines + 1
+	}
+	return c.newlines
+}
+
+// 根据开头的内容猜测文本编码。complete表示sample是完整的文件内容
+func guessEncoding(sample []byte, complete bool) string {
+	switch {
+	case len(sample) == 0:
+		return "empty"
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8-bom"
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return "utf-16le"
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return "utf-16be"
+	}
+	if enc := guessUTF16(sample); enc != "" {
+		return enc
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return "binary"
+	}
+	raw := sample
+	if !complete {
+		sample = trimIncompleteRune(sample)
+	}
+	if !utf8.Valid(sample) {
+		if validGBK(raw, complete) {
+			return "gbk"
+		}
+		return "unknown"
+	}
+	for _, b := range sample {
+		if b >= utf8.RuneSelf {
+			return "utf-8"
+		}
+	}
+	return "ascii"
+}
+
+// 通过内容识别MIME类型，内容无法区分时（纯文本或未知二进制）按扩展名判断
+func detectMIMEType(path string, head []byte, encoding string) string {
+	detected := http.DetectContentType(head)
+	generic := strings.HasPrefix(detected, "text/plain") || detected == "application/octet-stream"
+	if generic {
+		if byExt := mime.TypeByExtension(filepath.Ext(path)); byExt != "" {
+			return byExt
+		}
+	}
+	if encoding == "binary" && strings.HasPrefix(detected, "text/plain") {
+		return "application/octet-stream"
+	}
+	return detected
+}
+
+// 文件所有者信息，由各平台的fileOwner提供
+type ownerInfo struct {
+	uid   int
+	gid   int
+	ctime *time.Time
+}
+
+var (
+	userNames  sync.Map
+	groupNames sync.Map
+)
+
+func lookupUserName(uid int) string {
+	if name, ok := userNames.Load(uid); ok {
+		return name.(string)
+	}
+	name := strconv.Itoa(uid)
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	userNames.Store(uid, name)
+	return name
+}
+
+func lookupGroupName(gid int) string {
+	if name, ok := groupNames.Load(gid); ok {
+		return name.(string)
+	}
+	name := strconv.Itoa(gid)
+	if g, err := user.LookupGroupId(name); err == nil {
+		name = g.Name
+	}
+	groupNames.Store(gid, name)
+	return name
+}
@@ -0,0 +1,17 @@
+package filesys
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// 从Stat_t中读取所有者和状态改变时间
+func fileOwner(info os.FileInfo) (ownerInfo, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ownerInfo{}, false
+	}
+	ctime := time.Unix(st.Ctimespec.Sec, st.Ctimespec.Nsec)
+	return ownerInfo{uid: int(st.Uid), gid: int(st.Gid), ctime: &ctime}, true
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package filesys
+
+import "os"
+
+// 当前平台不提供所有者信息
+func fileOwner(info os.FileInfo) (ownerInfo, bool) {
+	return ownerInfo{}, false
+}
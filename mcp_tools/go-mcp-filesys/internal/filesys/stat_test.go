@@ -0,0 +1,298 @@
+package filesys
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestStatFileContent(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR" + strings.Repeat("\x00", 20)
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		opts    StatOptions
+		want    FileStat
+		// 为-1时不应统计行数
+		wantLines int
+	}{
+		{
+			name:      "ascii text",
+			file:      "notes.txt",
+			content:   "hello\nworld\n",
+			opts:      StatOptions{CountLines: true},
+			want:      FileStat{MIMEType: "text/plain; charset=utf-8", Encoding: "ascii", LineEnding: LineEndingLF},
+			wantLines: 2,
+		},
+		{
+			name:      "utf-8 with crlf and no final newline",
+			file:      "notes",
+			content:   "héllo\r\nwörld",
+			opts:      StatOptions{CountLines: true},
+			want:      FileStat{MIMEType: "text/plain; charset=utf-8", Encoding: "utf-8", LineEnding: LineEndingCRLF},
+			wantLines: 2,
+		},
+		{
+			name:      "mixed line endings",
+			file:      "mixed.txt",
+			content:   "a\r\nb\nc\n",
+			want:      FileStat{MIMEType: "text/plain; charset=utf-8", Encoding: "ascii", LineEnding: LineEndingMixed},
+			wantLines: -1,
+		},
+		{
+			name:      "utf-8 bom",
+			file:      "bom.txt",
+			content:   "\xEF\xBB\xBFhi\n",
+			want:      FileStat{MIMEType: "text/plain; charset=utf-8", Encoding: "utf-8-bom", LineEnding: LineEndingLF},
+			wantLines: -1,
+		},
+		{
+			name:      "utf-16le with bom",
+			file:      "wide",
+			content:   "\xFF\xFEa\x00\n\x00b\x00\n\x00",
+			opts:      StatOptions{CountLines: true},
+			want:      FileStat{MIMEType: "text/plain; charset=utf-16le", Encoding: "utf-16le", LineEnding: LineEndingLF},
+			wantLines: 2,
+		},
+		{
+			// U+0A0A 的两个字节都是换行符的值，但不是换行符
+			name:      "utf-16be without bom",
+			file:      "wide.txt",
+			content:   "\x00a\x00b\x0a\x0a\x00c\x00\r\x00\n\x00d",
+			opts:      StatOptions{CountLines: true},
+			want:      FileStat{MIMEType: "text/plain; charset=utf-8", Encoding: "utf-16be", LineEnding: LineEndingCRLF},
+			wantLines: 2,
+		},
+		{
+			name:      "gbk",
+			file:      "gbk.txt",
+			content:   "\xc4\xe3\xba\xc3\n",
+			want:      FileStat{MIMEType: "text/plain; charset=utf-8", Encoding: "gbk", LineEnding: LineEndingLF},
+			wantLines: -1,
+		},
+		{
+			name:      "empty",
+			file:      "empty.txt",
+			opts:      StatOptions{CountLines: true},
+			want:      FileStat{MIMEType: "text/plain; charset=utf-8", Encoding: "empty"},
+			wantLines: 0,
+		},
+		{
+			name:      "html sniffed from content",
+			file:      "page.txt",
+			content:   "<!DOCTYPE html><html><body>hi</body></html>",
+			want:      FileStat{MIMEType: "text/html; charset=utf-8", Encoding: "ascii"},
+			wantLines: -1,
+		},
+		{
+			name:      "json by extension",
+			file:      "data.json",
+			content:   `{"a": 1}`,
+			want:      FileStat{MIMEType: "application/json", Encoding: "ascii"},
+			wantLines: -1,
+		},
+		{
+			name:      "png sniffed despite extension",
+			file:      "image.txt",
+			content:   png,
+			opts:      StatOptions{CountLines: true},
+			want:      FileStat{MIMEType: "image/png", Encoding: "binary"},
+			wantLines: -1,
+		},
+		{
+			name:      "unknown binary",
+			file:      "blob",
+			content:   "\x01\x00\x02",
+			want:      FileStat{MIMEType: "application/octet-stream", Encoding: "binary"},
+			wantLines: -1,
+		},
+		{
+			name:      "checksums",
+			file:      "sum.txt",
+			content:   "checksum me\n",
+			opts:      StatOptions{SHA256: true, MD5: true},
+			want:      FileStat{MIMEType: "text/plain; charset=utf-8", Encoding: "ascii", LineEnding: LineEndingLF, SHA256: sha256Hex("checksum me\n"), MD5: md5Hex("checksum me\n")},
+			wantLines: -1,
+		},
+		{
+			name:      "checksums of binary content",
+			file:      "blob.bin",
+			content:   png,
+			opts:      StatOptions{SHA256: true, MD5: true},
+			want:      FileStat{MIMEType: "image/png", Encoding: "binary", SHA256: sha256Hex(png), MD5: md5Hex(png)},
+			wantLines: -1,
+		},
+		{
+			name:      "checksums of empty file",
+			file:      "zero",
+			opts:      StatOptions{SHA256: true, MD5: true},
+			want:      FileStat{MIMEType: "text/plain; charset=utf-8", Encoding: "empty", SHA256: sha256Hex(""), MD5: md5Hex("")},
+			wantLines: -1,
+		},
+		{
+			// 超过判断编码读取的长度时，校验和与行数仍然覆盖整个文件
+			name:      "beyond sniff length",
+			file:      "long.txt",
+			content:   strings.Repeat("0123456789\n", 2000),
+			opts:      StatOptions{CountLines: true, SHA256: true},
+			want:      FileStat{MIMEType: "text/plain; charset=utf-8", Encoding: "ascii", LineEnding: LineEndingLF, SHA256: sha256Hex(strings.Repeat("0123456789\n", 2000))},
+			wantLines: 2000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupLockRoot(t)
+			writeTestFiles(t, root, map[string]string{tt.file: tt.content})
+			stat, err := StatFile(filepath.Join(root, tt.file), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.Type != "file" || stat.Size != int64(len(tt.content)) || stat.Path != "ws:"+tt.file {
+				t.Errorf("type = %s, size = %d, path = %s", stat.Type, stat.Size, stat.Path)
+			}
+			if stat.MIMEType != tt.want.MIMEType {
+				t.Errorf("mime type = %q, want %q", stat.MIMEType, tt.want.MIMEType)
+			}
+			if stat.Encoding != tt.want.Encoding || stat.LineEnding != tt.want.LineEnding {
+				t.Errorf("encoding = %q, line ending = %q; want %q, %q", stat.Encoding, stat.LineEnding, tt.want.Encoding, tt.want.LineEnding)
+			}
+			if stat.SHA256 != tt.want.SHA256 || stat.MD5 != tt.want.MD5 {
+				t.Errorf("sha256 = %q, md5 = %q; want %q, %q", stat.SHA256, stat.MD5, tt.want.SHA256, tt.want.MD5)
+			}
+			lines := -1
+			if stat.Lines != nil {
+				lines = *stat.Lines
+			}
+			if lines != tt.wantLines {
+				t.Errorf("lines = %d, want %d", lines, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestStatFileTypes(t *testing.T) {
+	root := setupLockRoot(t)
+	outside := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"dir/a.txt": "alpha\n"})
+	writeTestFiles(t, outside, map[string]string{"secret.txt": "secret\n"})
+	if err := os.Chmod(filepath.Join(root, "dir/a.txt"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"link":     "dir/a.txt",
+		"dirlink":  "dir",
+		"dangling": "missing.txt",
+		"escape":   filepath.Join(outside, "secret.txt"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		want    FileStat
+		wantErr string
+	}{
+		{
+			name:   "file",
+			target: filepath.Join(root, "dir/a.txt"),
+			want:   FileStat{Path: "ws:dir/a.txt", Type: "file", Size: 6, Permissions: "0640", MIMEType: "text/plain; charset=utf-8"},
+		},
+		{
+			name:   "root prefixed path",
+			target: "ws:dir/a.txt",
+			want:   FileStat{Path: "ws:dir/a.txt", Type: "file", Size: 6, Permissions: "0640", MIMEType: "text/plain; charset=utf-8"},
+		},
+		{
+			name:   "directory",
+			target: filepath.Join(root, "dir"),
+			want:   FileStat{Path: "ws:dir", Type: "directory"},
+		},
+		{
+			name:   "symlink to file",
+			target: filepath.Join(root, "link"),
+			want:   FileStat{Path: "ws:link", Type: "symlink", Size: 6, Permissions: "0640", SymlinkTarget: "dir/a.txt", ResolvedPath: "ws:dir/a.txt", MIMEType: "text/plain; charset=utf-8"},
+		},
+		{
+			name:   "symlink to directory",
+			target: filepath.Join(root, "dirlink"),
+			want:   FileStat{Path: "ws:dirlink", Type: "symlink", SymlinkTarget: "dir", ResolvedPath: "ws:dir"},
+		},
+		{name: "dangling symlink", target: filepath.Join(root, "dangling"), wantErr: "dangling symbolic link to missing.txt"},
+		{name: "symlink out of the root", target: filepath.Join(root, "escape"), wantErr: "access denied"},
+		{name: "missing", target: filepath.Join(root, "nope"), wantErr: "does not exist"},
+		{name: "outside the roots", target: filepath.Join(outside, "secret.txt"), wantErr: "access denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stat, err := StatFile(tt.target, StatOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.Path != tt.want.Path || stat.Type != tt.want.Type || stat.SymlinkTarget != tt.want.SymlinkTarget || stat.ResolvedPath != tt.want.ResolvedPath {
+				t.Errorf("path = %s, type = %s, target = %q, resolved = %q; want %s, %s, %q, %q",
+					stat.Path, stat.Type, stat.SymlinkTarget, stat.ResolvedPath, tt.want.Path, tt.want.Type, tt.want.SymlinkTarget, tt.want.ResolvedPath)
+			}
+			if stat.MIMEType != tt.want.MIMEType {
+				t.Errorf("mime type = %q, want %q", stat.MIMEType, tt.want.MIMEType)
+			}
+			if tt.want.Permissions != "" && (stat.Size != tt.want.Size || stat.Permissions != tt.want.Permissions) {
+				t.Errorf("size = %d, permissions = %s; want %d, %s", stat.Size, stat.Permissions, tt.want.Size, tt.want.Permissions)
+			}
+			if stat.UID == nil || stat.Owner == "" || stat.ChangeTime == nil {
+				t.Errorf("owner not reported: %+v", stat)
+			}
+		})
+	}
+}
+
+func TestStatFiles(t *testing.T) {
+	root := setupLockRoot(t)
+	writeTestFiles(t, root, map[string]string{"a.txt": "alpha\n", "b.txt": "bravo\n"})
+
+	results, err := StatFiles([]string{filepath.Join(root, "a.txt"), "ws:missing", "ws:b.txt"}, StatOptions{SHA256: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("%d results, want 3", len(results))
+	}
+	if r := results[0]; r.Error != "" || r.Path != "ws:a.txt" || r.SHA256 != sha256Hex("alpha\n") {
+		t.Errorf("first result = %+v", r)
+	}
+	if r := results[1]; r.FileStat != nil || r.Path != "ws:missing" || !strings.Contains(r.Error, "does not exist") {
+		t.Errorf("missing path result = %+v", r)
+	}
+	if r := results[2]; r.Error != "" || r.Path != "ws:b.txt" || r.SHA256 != sha256Hex("bravo\n") {
+		t.Errorf("last result = %+v", r)
+	}
+
+	targets := make([]string, MaxStatPaths+1)
+	for i := range targets {
+		targets[i] = "ws:a.txt"
+	}
+	if _, err := StatFiles(targets, StatOptions{}); err == nil || !strings.Contains(err.Error(), "too many paths") {
+		t.Errorf("too many paths: got %v", err)
+	}
+}
@@ -0,0 +1,1282 @@
+package filesys
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// 支持的结构化文件格式
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// 结构化编辑操作
+const (
+	StructuredSet    = "set"
+	StructuredDelete = "delete"
+	StructuredMerge  = "merge"
+)
+
+// 读取结构化文件中某个路径的值
+type StructuredValue struct {
+	File   string          `json:"file"`
+	Format string          `json:"format"`
+	Path   string          `json:"path"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// 结构化编辑的结果，DryRun时Content为修改后的完整内容，文件不会被写入
+type StructuredEditResult struct {
+	File    string          `json:"file"`
+	Format  string          `json:"format"`
+	Op      string          `json:"op"`
+	Path    string          `json:"path"`
+	Changed bool            `json:"changed"`
+	Value   json.RawMessage `json:"value,omitempty"`
+	DryRun  bool            `json:"dry_run,omitempty"`
+	Content string          `json:"content,omitempty"`
+}
+
+// 读取结构化文件中path处的值并以JSON返回。
+// path可以是JSON Pointer（/a/b/0），也可以是点分形式（a.b[0] 或 a.b.0），为空表示整个文档
+func GetStructuredValue(filePath string, format string, path string) (*StructuredValue, error) {
+	if !isPathInAllowedDirectory(filePath) {
+		return nil, fmt.Errorf("access denied: %s", filePath)
+	}
+	doc, err := loadStructured(filePath, format)
+	if err != nil {
+		return nil, err
+	}
+	segs, err := parseDocPath(path)
+	if err != nil {
+		return nil, err
+	}
+	node, err := lookupNode(doc.root, segs)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeJSONNode(&buf, node, "  ", 0); err != nil {
+		return nil, err
+	}
+	return &StructuredValue{File: DisplayPath(filePath), Format: doc.format, Path: path, Value: buf.Bytes()}, nil
+}
+
+// 修改结构化文件：set设置path处的值（缺少的上级对象会被创建），delete删除path处的值，
+// merge按JSON Merge Patch（RFC 7386）把对象合并到path处，其中的null表示删除。
+// value为JSON文本。修改后的内容重新解析校验通过后才写入文件
+func EditStructuredFile(filePath string, format string, op string, path string, value string, dryRun bool) (*StructuredEditResult, error) {
+	if !isPathInAllowedDirectory(filePath) {
+		return nil, fmt.Errorf("access denied: %s", filePath)
+	}
+	if !dryRun {
+		if err := checkWritable(filePath); err != nil {
+			return nil, err
+		}
+	}
+	// 读取、修改和写回之间持有锁
+	unlock := lockPath(filePath)
+	defer unlock()
+	doc, err := loadStructured(filePath, format)
+	if err != nil {
+		return nil, err
+	}
+	segs, err := parseDocPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var valueNode *yaml.Node
+	if op == StructuredSet || op == StructuredMerge {
+		if strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("value is required for %s", op)
+		}
+		if valueNode, err = jsonToNode([]byte(value)); err != nil {
+			return nil, fmt.Errorf("value must be valid JSON (quote strings, e.g. \"text\"): %w", err)
+		}
+	}
+
+	switch op {
+	case StructuredSet:
+		doc.root, err = setNode(doc.root, segs, valueNode)
+	case StructuredDelete:
+		if len(segs) == 0 {
+			return nil, fmt.Errorf("cannot delete the whole document")
+		}
+		err = deleteNode(doc.root, segs)
+	case StructuredMerge:
+		var target *yaml.Node
+		target, err = lookupNode(doc.root, segs)
+		if err != nil {
+			doc.root, err = setNode(doc.root, segs, stripNulls(valueNode))
+		} else if target.Kind == yaml.MappingNode && valueNode.Kind == yaml.MappingNode {
+			mergeNodes(target, valueNode)
+		} else {
+			doc.root, err = setNode(doc.root, segs, stripNulls(valueNode))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported operation: %s", op)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := doc.encode()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateStructured(content, doc.format); err != nil {
+		return nil, fmt.Errorf("edit would produce an invalid %s document: %w", doc.format, err)
+	}
+
+	result := &StructuredEditResult{
+		File:    DisplayPath(filePath),
+		Format:  doc.format,
+		Op:      op,
+		Path:    path,
+		Changed: !bytes.Equal(content, doc.original),
+		DryRun:  dryRun,
+	}
+	if op != StructuredDelete {
+		// 以"-"追加时按新元素的下标读取结果
+		if len(segs) > 0 && segs[len(segs)-1] == "-" {
+			if parent, err := lookupNode(doc.root, segs[:len(segs)-1]); err == nil && parent.Kind == yaml.SequenceNode {
+				segs[len(segs)-1] = strconv.Itoa(len(parent.Content) - 1)
+			}
+		}
+		if node, err := lookupNode(doc.root, segs); err == nil {
+			var buf bytes.Buffer
+			if err := writeJSONNode(&buf, node, "", 0); err == nil {
+				result.Value = buf.Bytes()
+			}
+		}
+	}
+	if dryRun {
+		result.Content = string(content)
+		return result, nil
+	}
+	if !result.Changed {
+		return result, nil
+	}
+
+	cleanPath := filepath.Clean(filePath)
+	if err := checkWriteQuota(cleanPath, int64(len(content))); err != nil {
+		return nil, err
+	}
+	rec, err := beginHistory("structured_"+op, cleanPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := rec.finish(safeWriteFile(cleanPath, content, doc.mode)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 解析后的结构化文档，三种格式都转换为yaml.Node树进行编辑
+type structuredDoc struct {
+	format   string
+	original []byte
+	mode     os.FileMode
+	// YAML的文档节点，保留注释
+	yamlDoc *yaml.Node
+	root    *yaml.Node
+	indent  string
+	newline bool
+}
+
+func detectStructuredFormat(filePath string, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatYAML, "yml":
+		return FormatYAML, nil
+	case FormatTOML:
+		return FormatTOML, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported format: %s (supported: json, yaml, toml)", format)
+	}
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	}
+	return "", fmt.Errorf("cannot determine the format of %s from its extension, specify format", DisplayPath(filePath))
+}
+
+func loadStructured(filePath string, format string) (*structuredDoc, error) {
+	format, err := detectStructuredFormat(filePath, format)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %s", filePath)
+	}
+	if info.Size() > MaxReadBytes*16 {
+		return nil, fmt.Errorf("file is too large to edit structurally (%d bytes)", info.Size())
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	doc := &structuredDoc{format: format, original: data, mode: info.Mode().Perm(), newline: len(data) == 0 || bytes.HasSuffix(data, []byte("\n"))}
+	switch format {
+	case FormatJSON:
+		doc.indent = detectJSONIndent(data)
+		if len(bytes.TrimSpace(data)) == 0 {
+			doc.root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			break
+		}
+		if doc.root, err = jsonToNode(data); err != nil {
+			return nil, fmt.Errorf("%s is not valid JSON: %w", DisplayPath(filePath), err)
+		}
+	case FormatYAML:
+		doc.indent = strings.Repeat(" ", detectYAMLIndent(data))
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		var node yaml.Node
+		if err := dec.Decode(&node); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s is not valid YAML: %w", DisplayPath(filePath), err)
+		}
+		var extra yaml.Node
+		if err := dec.Decode(&extra); err != io.EOF {
+			return nil, fmt.Errorf("%s contains multiple YAML documents, which is not supported", DisplayPath(filePath))
+		}
+		if node.Kind != yaml.DocumentNode || len(node.Content) == 0 {
+			node = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+		}
+		doc.yamlDoc = &node
+		doc.root = node.Content[0]
+	case FormatTOML:
+		var check map[string]any
+		if err := toml.Unmarshal(data, &check); err != nil {
+			return nil, fmt.Errorf("%s is not valid TOML: %w", DisplayPath(filePath), err)
+		}
+		if doc.root, err = tomlToNode(data); err != nil {
+			return nil, fmt.Errorf("%s is not valid TOML: %w", DisplayPath(filePath), err)
+		}
+	}
+	return doc, nil
+}
+
+func (d *structuredDoc) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	switch d.format {
+	case FormatJSON:
+		if err := writeJSONNode(&buf, d.root, d.indent, 0); err != nil {
+			return nil, err
+		}
+		if d.newline {
+			buf.WriteByte('\n')
+		}
+	case FormatYAML:
+		d.yamlDoc.Content[0] = d.root
+		// yaml.v3会把合并键输出为"!!merge <<"，编码时临时去掉标签
+		merges := mergeKeys(d.root, nil)
+		for _, k := range merges {
+			k.Tag = ""
+		}
+		defer func() {
+			for _, k := range merges {
+				k.Tag = "!!merge"
+			}
+		}()
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(len(d.indent))
+		if err := enc.Encode(d.yamlDoc); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		if d.root.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("the root of a TOML document must be a table")
+		}
+		if err := writeTOMLTable(&buf, d.root, nil); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func validateStructured(content []byte, format string) error {
+	switch format {
+	case FormatJSON:
+		if !json.Valid(content) {
+			return fmt.Errorf("invalid JSON")
+		}
+	case FormatYAML:
+		var v any
+		return yaml.Unmarshal(content, &v)
+	case FormatTOML:
+		var v map[string]any
+		return toml.Unmarshal(content, &v)
+	}
+	return nil
+}
+
+// 解析路径表达式，返回各级键名或下标
+func parseDocPath(path string) ([]string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" || path == "$" || path == "." {
+		return nil, nil
+	}
+	if strings.HasPrefix(path, "/") {
+		segs := strings.Split(path[1:], "/")
+		for i, s := range segs {
+			segs[i] = strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+		}
+		return segs, nil
+	}
+
+	path = strings.TrimPrefix(path, "$.")
+	segs := make([]string, 0)
+	for _, part := range strings.Split(path, ".") {
+		// 拆分 name[0][1] 形式的下标
+		name := part
+		var indexes []string
+		if i := strings.Index(part, "["); i >= 0 {
+			name = part[:i]
+			rest := part[i:]
+			for rest != "" {
+				end := strings.Index(rest, "]")
+				if !strings.HasPrefix(rest, "[") || end < 0 {
+					return nil, fmt.Errorf("invalid path %q", path)
+				}
+				indexes = append(indexes, rest[1:end])
+				rest = rest[end+1:]
+			}
+		}
+		if name == "" && len(indexes) == 0 {
+			return nil, fmt.Errorf("invalid path %q: empty key", path)
+		}
+		if name != "" {
+			segs = append(segs, name)
+		}
+		segs = append(segs, indexes...)
+	}
+	return segs, nil
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// 查找节点的子节点，返回子节点在Content中的位置，不存在时返回-1
+func childIndex(n *yaml.Node, seg string) (int, error) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if resolveAlias(n.Content[i]).Value == seg {
+				return i + 1, nil
+			}
+		}
+		return -1, nil
+	case yaml.SequenceNode:
+		if seg == "-" {
+			return -1, nil
+		}
+		idx, err := strconv.Atoi(seg)
+		if err != nil || idx < 0 {
+			return -1, fmt.Errorf("%q is not a valid array index", seg)
+		}
+		if idx >= len(n.Content) {
+			return -1, nil
+		}
+		return idx, nil
+	}
+	return -1, fmt.Errorf("cannot look up %q in a scalar value", seg)
+}
+
+func lookupNode(root *yaml.Node, segs []string) (*yaml.Node, error) {
+	n := resolveAlias(root)
+	for i, seg := range segs {
+		idx, err := childIndex(n, seg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", formatDocPath(segs[:i+1]), err)
+		}
+		if idx >= 0 {
+			n = resolveAlias(n.Content[idx])
+			continue
+		}
+		if v := mergedValue(n, seg); v != nil {
+			n = resolveAlias(v)
+			continue
+		}
+		return nil, fmt.Errorf("path not found: %s", formatDocPath(segs[:i+1]))
+	}
+	return n, nil
+}
+
+func isMergeKey(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.ShortTag() == "!!merge"
+}
+
+// 收集树中所有的YAML合并键（<<）
+func mergeKeys(n *yaml.Node, keys []*yaml.Node) []*yaml.Node {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if isMergeKey(n.Content[i]) {
+				keys = append(keys, n.Content[i])
+			}
+		}
+	}
+	for _, child := range n.Content {
+		keys = mergeKeys(child, keys)
+	}
+	return keys
+}
+
+// 映射的有效键值对（键、值交替排列），合并键引入的键只在本地没有定义时生效，
+// 合并多个映射时排在前面的优先
+func mappingPairs(n *yaml.Node) []*yaml.Node {
+	local := make(map[string]bool)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if !isMergeKey(n.Content[i]) {
+			local[resolveAlias(n.Content[i]).Value] = true
+		}
+	}
+	pairs := make([]*yaml.Node, 0, len(n.Content))
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if !isMergeKey(n.Content[i]) {
+			pairs = append(pairs, n.Content[i], n.Content[i+1])
+			continue
+		}
+		sources := []*yaml.Node{resolveAlias(n.Content[i+1])}
+		if sources[0].Kind == yaml.SequenceNode {
+			sources = sources[0].Content
+		}
+		for _, src := range sources {
+			src = resolveAlias(src)
+			if src.Kind != yaml.MappingNode {
+				continue
+			}
+			merged := mappingPairs(src)
+			for j := 0; j+1 < len(merged); j += 2 {
+				key := resolveAlias(merged[j]).Value
+				if !local[key] {
+					local[key] = true
+					pairs = append(pairs, merged[j], merged[j+1])
+				}
+			}
+		}
+	}
+	return pairs
+}
+
+// 查找映射通过合并键继承的值，没有时返回nil
+func mergedValue(n *yaml.Node, seg string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	pairs := mappingPairs(n)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if resolveAlias(pairs[i]).Value == seg {
+			return pairs[i+1]
+		}
+	}
+	return nil
+}
+
+func formatDocPath(segs []string) string {
+	escaped := make([]string, len(segs))
+	for i, s := range segs {
+		escaped[i] = strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+	}
+	return "/" + strings.Join(escaped, "/")
+}
+
+// 设置path处的值，缺少的上级对象会被创建，返回新的根节点
+func setNode(root *yaml.Node, segs []string, value *yaml.Node) (*yaml.Node, error) {
+	if len(segs) == 0 {
+		copyComments(value, root)
+		return value, nil
+	}
+	n := resolveAlias(root)
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		idx, err := childIndex(n, seg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", formatDocPath(segs[:i+1]), err)
+		}
+		if idx >= 0 {
+			if last {
+				copyComments(value, n.Content[idx])
+				n.Content[idx] = value
+				return root, nil
+			}
+			n = resolveAlias(n.Content[idx])
+			continue
+		}
+
+		child := value
+		if !last {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		switch n.Kind {
+		case yaml.MappingNode:
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: seg}, child)
+		case yaml.SequenceNode:
+			if seg != "-" && seg != strconv.Itoa(len(n.Content)) {
+				return nil, fmt.Errorf("%s: index out of range, the array has %d elements", formatDocPath(segs[:i+1]), len(n.Content))
+			}
+			n.Content = append(n.Content, child)
+		}
+		n = child
+	}
+	return root, nil
+}
+
+func deleteNode(root *yaml.Node, segs []string) error {
+	parent, err := lookupNode(root, segs[:len(segs)-1])
+	if err != nil {
+		return err
+	}
+	seg := segs[len(segs)-1]
+	idx, err := childIndex(parent, seg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", formatDocPath(segs), err)
+	}
+	if idx < 0 {
+		return fmt.Errorf("path not found: %s", formatDocPath(segs))
+	}
+	if parent.Kind == yaml.MappingNode {
+		parent.Content = append(parent.Content[:idx-1], parent.Content[idx+1:]...)
+	} else {
+		parent.Content = append(parent.Content[:idx], parent.Content[idx+1:]...)
+	}
+	return nil
+}
+
+// 按JSON Merge Patch合并两个对象，patch中的null表示删除对应的键
+func mergeNodes(target *yaml.Node, patch *yaml.Node) {
+	for i := 0; i+1 < len(patch.Content); i += 2 {
+		key := patch.Content[i].Value
+		pv := patch.Content[i+1]
+		idx, _ := childIndex(target, key)
+		switch {
+		case isNullNode(pv):
+			if idx >= 0 {
+				target.Content = append(target.Content[:idx-1], target.Content[idx+1:]...)
+			}
+		case idx < 0:
+			target.Content = append(target.Content, patch.Content[i], stripNulls(pv))
+		default:
+			existing := resolveAlias(target.Content[idx])
+			if existing.Kind == yaml.MappingNode && pv.Kind == yaml.MappingNode {
+				mergeNodes(existing, pv)
+			} else {
+				nv := stripNulls(pv)
+				copyComments(nv, target.Content[idx])
+				target.Content[idx] = nv
+			}
+		}
+	}
+}
+
+// 删除对象中值为null的键，用于合并时新增的内容
+func stripNulls(n *yaml.Node) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return n
+	}
+	content := make([]*yaml.Node, 0, len(n.Content))
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if isNullNode(n.Content[i+1]) {
+			continue
+		}
+		content = append(content, n.Content[i], stripNulls(n.Content[i+1]))
+	}
+	n.Content = content
+	return n
+}
+
+func isNullNode(n *yaml.Node) bool {
+	n = resolveAlias(n)
+	return n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null"
+}
+
+// 替换节点时保留原节点上的注释
+func copyComments(dst *yaml.Node, src *yaml.Node) {
+	if dst.HeadComment == "" {
+		dst.HeadComment = src.HeadComment
+	}
+	if dst.LineComment == "" && dst.Kind == yaml.ScalarNode {
+		dst.LineComment = src.LineComment
+	}
+	if dst.FootComment == "" {
+		dst.FootComment = src.FootComment
+	}
+}
+
+// 把JSON解析为节点树，保留对象中键的顺序
+func jsonToNode(data []byte) (*yaml.Node, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := decodeJSONNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return node, nil
+}
+
+func decodeJSONNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ := keyTok.(string)
+				child, err := decodeJSONNode(dec)
+				if err != nil {
+					return nil, err
+				}
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+			}
+			_, err := dec.Token()
+			return n, err
+		}
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for dec.More() {
+			child, err := decodeJSONNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, child)
+		}
+		_, err := dec.Token()
+		return n, err
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(v.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", tok)
+}
+
+// 把节点树写成JSON，indent为空时输出紧凑格式
+func writeJSONNode(buf *bytes.Buffer, n *yaml.Node, indent string, level int) error {
+	n = resolveAlias(n)
+	newline := func(l int) {
+		if indent != "" {
+			buf.WriteByte('\n')
+			buf.WriteString(strings.Repeat(indent, l))
+		}
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeJSONNode(buf, n.Content[0], indent, level)
+	case yaml.MappingNode:
+		pairs := mappingPairs(n)
+		if len(pairs) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(pairs); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			newline(level + 1)
+			buf.WriteString(jsonString(resolveAlias(pairs[i]).Value))
+			buf.WriteByte(':')
+			if indent != "" {
+				buf.WriteByte(' ')
+			}
+			if err := writeJSONNode(buf, pairs[i+1], indent, level+1); err != nil {
+				return err
+			}
+		}
+		newline(level)
+		buf.WriteByte('}')
+		return nil
+	case yaml.SequenceNode:
+		if len(n.Content) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteByte('[')
+		for i, child := range n.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			newline(level + 1)
+			if err := writeJSONNode(buf, child, indent, level+1); err != nil {
+				return err
+			}
+		}
+		newline(level)
+		buf.WriteByte(']')
+		return nil
+	}
+
+	switch n.ShortTag() {
+	case "!!null":
+		buf.WriteString("null")
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatBool(b))
+	case "!!int", "!!float":
+		if isJSONNumber(n.Value) {
+			buf.WriteString(n.Value)
+			return nil
+		}
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return err
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("value %s cannot be represented in JSON", n.Value)
+		}
+		buf.Write(data)
+	default:
+		buf.WriteString(jsonString(n.Value))
+	}
+	return nil
+}
+
+var jsonNumberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+func isJSONNumber(s string) bool {
+	return jsonNumberPattern.MatchString(s)
+}
+
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// 根据第一个缩进的行判断JSON的缩进，默认两个空格
+func detectJSONIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || len(trimmed) == len(line) {
+			continue
+		}
+		return line[:len(line)-len(trimmed)]
+	}
+	return "  "
+}
+
+// 取最小的非零缩进作为YAML的缩进，默认两个空格
+func detectYAMLIndent(data []byte) int {
+	indent := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if n := len(line) - len(trimmed); n > 0 && (indent == 0 || n < indent) {
+			indent = n
+		}
+	}
+	if indent < 2 {
+		return 2
+	}
+	return indent
+}
+
+// 用go-toml的解析器按出现顺序构建节点树，行内表和数组标记为FlowStyle，写回时保持原来的形式。
+// 注释与YAML一样保存在节点上：表和键之前的整行注释为HeadComment，行尾注释为LineComment，
+// 文档末尾的注释为根节点的FootComment。多行数组内部的注释不保留
+func tomlToNode(data []byte) (*yaml.Node, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	current := root
+	p := unstable.Parser{KeepComments: true}
+	p.Reset(data)
+	var comments []string
+	for p.NextExpression() {
+		expr := p.Expression()
+		var commented *yaml.Node
+		switch expr.Kind {
+		case unstable.Comment:
+			comments = append(comments, tomlComment(expr))
+			continue
+		case unstable.Table:
+			table, err := tomlTable(root, tomlKey(expr.Key()), false)
+			if err != nil {
+				return nil, err
+			}
+			current, commented = table, table
+		case unstable.ArrayTable:
+			table, err := tomlTable(root, tomlKey(expr.Key()), true)
+			if err != nil {
+				return nil, err
+			}
+			current, commented = table, table
+		case unstable.KeyValue:
+			if err := tomlKeyValue(current, expr); err != nil {
+				return nil, err
+			}
+			// 刚添加的键所在的表可能是点号分隔的键隐式创建的，取其中最后添加的键
+			commented = lastTOMLKey(current, tomlKey(expr.Key()))
+		}
+		if commented == nil {
+			continue
+		}
+		commented.HeadComment = strings.Join(comments, "\n")
+		comments = nil
+		if next := expr.Next(); next != nil && next.Kind == unstable.Comment {
+			commented.LineComment = tomlComment(next)
+		}
+	}
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+	root.FootComment = strings.Join(comments, "\n")
+	return root, nil
+}
+
+func tomlComment(n *unstable.Node) string {
+	return strings.TrimRight(string(n.Data), "\r")
+}
+
+// 键值对添加后，键路径最后一级的键节点
+func lastTOMLKey(table *yaml.Node, keys []string) *yaml.Node {
+	n := table
+	for _, key := range keys[:len(keys)-1] {
+		idx, _ := childIndex(n, key)
+		if idx < 0 {
+			return nil
+		}
+		n = n.Content[idx]
+	}
+	if len(n.Content) < 2 {
+		return nil
+	}
+	return n.Content[len(n.Content)-2]
+}
+
+func tomlKey(it unstable.Iterator) []string {
+	keys := make([]string, 0)
+	for it.Next() {
+		keys = append(keys, string(it.Node().Data))
+	}
+	return keys
+}
+
+// 查找或创建 [a.b] 或 [[a.b]] 对应的表，路径中的表数组取最后一个元素
+func tomlTable(root *yaml.Node, keys []string, array bool) (*yaml.Node, error) {
+	n := root
+	for i, key := range keys {
+		last := i == len(keys)-1
+		idx, _ := childIndex(n, key)
+		if idx < 0 {
+			child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			if last && array {
+				child = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			}
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+			idx = len(n.Content) - 1
+		}
+		child := n.Content[idx]
+		if last && array {
+			if child.Kind != yaml.SequenceNode {
+				return nil, fmt.Errorf("%s is not an array of tables", strings.Join(keys, "."))
+			}
+			table := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			child.Content = append(child.Content, table)
+			return table, nil
+		}
+		if child.Kind == yaml.SequenceNode && len(child.Content) > 0 {
+			child = child.Content[len(child.Content)-1]
+		}
+		if child.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s is not a table", strings.Join(keys[:i+1], "."))
+		}
+		n = child
+	}
+	return n, nil
+}
+
+func tomlKeyValue(table *yaml.Node, expr *unstable.Node) error {
+	keys := tomlKey(expr.Key())
+	parent, err := tomlTable(table, keys[:len(keys)-1], false)
+	if err != nil {
+		return err
+	}
+	value, err := tomlValue(expr.Value())
+	if err != nil {
+		return err
+	}
+	parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: keys[len(keys)-1]}, value)
+	return nil
+}
+
+func tomlValue(v *unstable.Node) (*yaml.Node, error) {
+	data := string(v.Data)
+	switch v.Kind {
+	case unstable.String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: data}, nil
+	case unstable.Bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: data}, nil
+	case unstable.Integer:
+		i, err := strconv.ParseInt(data, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s: %w", data, err)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatInt(i, 10)}, nil
+	case unstable.Float:
+		s := strings.ReplaceAll(data, "_", "")
+		switch strings.TrimPrefix(s, "+") {
+		case "inf":
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: ".inf"}, nil
+		case "-inf":
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: "-.inf"}, nil
+		case "nan", "-nan":
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: ".nan"}, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %s: %w", data, err)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: formatFloat(f)}, nil
+	case unstable.LocalDate, unstable.LocalTime, unstable.LocalDateTime, unstable.DateTime:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: data}, nil
+	case unstable.Array:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+		it := v.Children()
+		for it.Next() {
+			if it.Node().Kind == unstable.Comment {
+				continue
+			}
+			child, err := tomlValue(it.Node())
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, child)
+		}
+		return n, nil
+	case unstable.InlineTable:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Style: yaml.FlowStyle}
+		it := v.Children()
+		for it.Next() {
+			if err := tomlKeyValue(n, it.Node()); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("unsupported TOML value %s", v.Kind)
+}
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+	return s
+}
+
+// 写出TOML表：先写普通键值，再写子表和表数组
+func writeTOMLTable(buf *bytes.Buffer, table *yaml.Node, path []string) error {
+	var plain, tables []int
+	for i := 0; i+1 < len(table.Content); i += 2 {
+		if isTOMLTable(resolveAlias(table.Content[i+1])) {
+			tables = append(tables, i)
+		} else {
+			plain = append(plain, i)
+		}
+	}
+
+	header := len(path) > 0 && (len(plain) > 0 || len(tables) == 0)
+	if header || (len(path) > 0 && table.HeadComment != "") {
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		writeTOMLComment(buf, table.HeadComment)
+	}
+	if header {
+		fmt.Fprintf(buf, "[%s]", tomlKeyPath(path))
+		writeTOMLLineComment(buf, table.LineComment)
+	}
+	for _, i := range plain {
+		keyNode := resolveAlias(table.Content[i])
+		writeTOMLComment(buf, keyNode.HeadComment)
+		buf.WriteString(tomlKeyString(keyNode.Value))
+		buf.WriteString(" = ")
+		if err := writeTOMLValue(buf, table.Content[i+1], append(path, keyNode.Value)); err != nil {
+			return err
+		}
+		writeTOMLLineComment(buf, keyNode.LineComment)
+	}
+	for _, i := range tables {
+		key := resolveAlias(table.Content[i]).Value
+		childPath := append(append([]string(nil), path...), key)
+		child := resolveAlias(table.Content[i+1])
+		if child.Kind == yaml.MappingNode {
+			if err := writeTOMLTable(buf, child, childPath); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, item := range child.Content {
+			item = resolveAlias(item)
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			writeTOMLComment(buf, item.HeadComment)
+			fmt.Fprintf(buf, "[[%s]]", tomlKeyPath(childPath))
+			writeTOMLLineComment(buf, item.LineComment)
+			if err := writeTOMLArrayTable(buf, item, childPath); err != nil {
+				return err
+			}
+		}
+	}
+	if len(path) == 0 && table.FootComment != "" {
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		writeTOMLComment(buf, table.FootComment)
+	}
+	return nil
+}
+
+// 在键或表之前写出整行注释，没有 # 的行（例如来自其他格式的注释）补上 #
+func writeTOMLComment(buf *bytes.Buffer, comment string) {
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			line = "# " + line
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+}
+
+// 结束一行，有行尾注释时写在行尾
+func writeTOMLLineComment(buf *bytes.Buffer, comment string) {
+	if comment != "" && !strings.Contains(comment, "\n") {
+		if !strings.HasPrefix(comment, "#") {
+			comment = "# " + comment
+		}
+		buf.WriteString(" ")
+		buf.WriteString(comment)
+	}
+	buf.WriteByte('\n')
+}
+
+// 表数组元素的内容，子表的路径接在表数组之后
+func writeTOMLArrayTable(buf *bytes.Buffer, table *yaml.Node, path []string) error {
+	// 元素的注释已经随 [[path]] 标题写出
+	plain := *table
+	plain.HeadComment, plain.LineComment = "", ""
+	table = &plain
+	var sub bytes.Buffer
+	if err := writeTOMLTable(&sub, table, path); err != nil {
+		return err
+	}
+	// writeTOMLTable会为非空的表写出 [path] 标题，表数组元素的标题已经写过
+	header := fmt.Sprintf("[%s]\n", tomlKeyPath(path))
+	out := sub.String()
+	out = strings.TrimPrefix(out, header)
+	buf.WriteString(out)
+	return nil
+}
+
+// 非行内的对象和元素都是对象的非空数组写成表和表数组
+func isTOMLTable(n *yaml.Node) bool {
+	if n.Style&yaml.FlowStyle != 0 {
+		return false
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		return true
+	case yaml.SequenceNode:
+		if len(n.Content) == 0 {
+			return false
+		}
+		for _, item := range n.Content {
+			if resolveAlias(item).Kind != yaml.MappingNode {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func writeTOMLValue(buf *bytes.Buffer, n *yaml.Node, path []string) error {
+	n = resolveAlias(n)
+	switch n.Kind {
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range n.Content {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := writeTOMLValue(buf, item, path); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case yaml.MappingNode:
+		if len(n.Content) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{ ")
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			key := resolveAlias(n.Content[i]).Value
+			buf.WriteString(tomlKeyString(key))
+			buf.WriteString(" = ")
+			if err := writeTOMLValue(buf, n.Content[i+1], append(path, key)); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(" }")
+		return nil
+	}
+
+	switch n.ShortTag() {
+	case "!!null":
+		return fmt.Errorf("%s: TOML has no null value, use delete to remove a key", tomlKeyPath(path))
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatBool(b))
+	case "!!int":
+		if i, err := strconv.ParseInt(n.Value, 0, 64); err == nil {
+			buf.WriteString(strconv.FormatInt(i, 10))
+			return nil
+		}
+		var i int64
+		if err := n.Decode(&i); err != nil {
+			return fmt.Errorf("%s: integer %s cannot be represented in TOML", tomlKeyPath(path), n.Value)
+		}
+		buf.WriteString(strconv.FormatInt(i, 10))
+	case "!!float":
+		f, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			if err := n.Decode(&f); err != nil {
+				return err
+			}
+		}
+		switch {
+		case math.IsInf(f, 1):
+			buf.WriteString("inf")
+		case math.IsInf(f, -1):
+			buf.WriteString("-inf")
+		case math.IsNaN(f):
+			buf.WriteString("nan")
+		default:
+			buf.WriteString(formatFloat(f))
+		}
+	case "!!timestamp":
+		buf.WriteString(n.Value)
+	default:
+		buf.WriteString(tomlString(n.Value))
+	}
+	return nil
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKeyString(key string) string {
+	if tomlBareKey.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+func tomlKeyPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, k := range path {
+		keys[i] = tomlKeyString(k)
+	}
+	return strings.Join(keys, ".")
+}
+
+func tomlString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
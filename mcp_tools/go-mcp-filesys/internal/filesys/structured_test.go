@@ -0,0 +1,289 @@
+package filesys
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const structuredTestTOML = `# top comment
+title = "demo" # inline
+when = 1979-05-27T07:32:00Z
+local = 1979-05-27T07:32:00
+day = 1979-05-27
+clock = 07:32:00
+point = { x = 1, y = 2 }
+
+[server]
+# port comment
+port = 8080
+
+[[users]]
+name = "a"
+
+[[users]]
+name = "b"
+`
+
+const structuredTestJSON = "{\n\t\"zeta\": 1,\n\t\"alpha\": {\"b\": 2, \"a\": 1},\n\t\"list\": [1, 2.50, true, null]\n}"
+
+const structuredTestYAML = `# head
+base: &base
+  name: x # trailing
+  port: 1
+prod:
+  <<: *base
+  port: 2
+ref: *base
+`
+
+func TestEditStructuredFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		op      string
+		path    string
+		value   string
+		// 修改后的完整内容，出错时文件应保持不变
+		want      string
+		wantValue string
+		wantErr   string
+	}{
+		{
+			name:    "toml set keeps comments, datetimes and inline tables",
+			file:    "c.toml",
+			content: structuredTestTOML,
+			op:      StructuredSet,
+			path:    "server.port",
+			value:   "9090",
+			want:    strings.Replace(structuredTestTOML, "port = 8080", "port = 9090", 1),
+		},
+		{
+			name:    "toml set in array table",
+			file:    "c.toml",
+			content: structuredTestTOML,
+			op:      StructuredSet,
+			path:    "users[1].name",
+			value:   `"z"`,
+			want:    strings.Replace(structuredTestTOML, `name = "b"`, `name = "z"`, 1),
+		},
+		{
+			name:      "toml append array table",
+			file:      "c.toml",
+			content:   structuredTestTOML,
+			op:        StructuredSet,
+			path:      "users.-",
+			value:     `{"name": "c"}`,
+			want:      structuredTestTOML + "\n[[users]]\nname = \"c\"\n",
+			wantValue: `{"name":"c"}`,
+		},
+		{
+			name:    "toml set in inline table",
+			file:    "c.toml",
+			content: structuredTestTOML,
+			op:      StructuredSet,
+			path:    "point.z",
+			value:   "3",
+			want:    strings.Replace(structuredTestTOML, "{ x = 1, y = 2 }", "{ x = 1, y = 2, z = 3 }", 1),
+		},
+		{
+			name:    "toml delete array table",
+			file:    "c.toml",
+			content: structuredTestTOML,
+			op:      StructuredDelete,
+			path:    "users[0]",
+			want:    strings.Replace(structuredTestTOML, "[[users]]\nname = \"a\"\n\n", "", 1),
+		},
+		{
+			name:    "toml root must be a table",
+			file:    "c.toml",
+			content: structuredTestTOML,
+			op:      StructuredSet,
+			value:   "[1]",
+			wantErr: "must be a table",
+		},
+		{
+			name:    "json keeps key order, indentation and numbers",
+			file:    "c.json",
+			content: structuredTestJSON,
+			op:      StructuredSet,
+			path:    "/list/0",
+			value:   "3",
+			want:    "{\n\t\"zeta\": 1,\n\t\"alpha\": {\n\t\t\"b\": 2,\n\t\t\"a\": 1\n\t},\n\t\"list\": [\n\t\t3,\n\t\t2.50,\n\t\ttrue,\n\t\tnull\n\t]\n}",
+		},
+		{
+			name:    "json set creates parents",
+			file:    "c.json",
+			content: "{\n  \"b\": 1\n}\n",
+			op:      StructuredSet,
+			path:    "x.y",
+			value:   `"v"`,
+			want:    "{\n  \"b\": 1,\n  \"x\": {\n    \"y\": \"v\"\n  }\n}\n",
+		},
+		{
+			name:    "json delete",
+			file:    "c.json",
+			content: "{\n  \"b\": 1,\n  \"a\": [1, 2]\n}\n",
+			op:      StructuredDelete,
+			path:    "a[0]",
+			want:    "{\n  \"b\": 1,\n  \"a\": [\n    2\n  ]\n}\n",
+		},
+		{
+			name:      "json merge patch",
+			file:      "c.json",
+			content:   "{\n  \"b\": 1,\n  \"c\": {\"d\": 1, \"e\": 2}\n}\n",
+			op:        StructuredMerge,
+			value:     `{"b": null, "c": {"d": null, "f": 3}, "g": {"h": null}}`,
+			want:      "{\n  \"c\": {\n    \"e\": 2,\n    \"f\": 3\n  },\n  \"g\": {}\n}\n",
+			wantValue: `{"c":{"e":2,"f":3},"g":{}}`,
+		},
+		{
+			name:    "yaml keeps anchors, merge keys and comments",
+			file:    "c.yaml",
+			content: structuredTestYAML,
+			op:      StructuredSet,
+			path:    "prod.port",
+			value:   "3",
+			want:    strings.Replace(structuredTestYAML, "port: 2", "port: 3", 1),
+		},
+		{
+			name:    "yaml set through an alias edits the anchor",
+			file:    "c.yaml",
+			content: structuredTestYAML,
+			op:      StructuredSet,
+			path:    "ref.port",
+			value:   "5",
+			want:    strings.Replace(structuredTestYAML, "port: 1", "port: 5", 1),
+		},
+		{
+			name:    "yaml set overrides a merged key locally",
+			file:    "c.yaml",
+			content: structuredTestYAML,
+			op:      StructuredSet,
+			path:    "prod.name",
+			value:   `"y"`,
+			want:    strings.Replace(structuredTestYAML, "port: 2\n", "port: 2\n  name: y\n", 1),
+		},
+		{
+			name:    "yaml merge",
+			file:    "c.yaml",
+			content: "a: 1 # keep\nb:\n  c: 2\n",
+			op:      StructuredMerge,
+			value:   `{"b": {"d": [1]}}`,
+			want:    "a: 1 # keep\nb:\n  c: 2\n  d:\n    - 1\n",
+		},
+		{name: "invalid path", file: "c.json", content: "{}\n", op: StructuredSet, path: "a..b", value: "1", wantErr: "empty key"},
+		{name: "unterminated index", file: "c.json", content: "{}\n", op: StructuredSet, path: "a[0", value: "1", wantErr: "invalid path"},
+		{name: "index out of range", file: "c.json", content: `{"a": [1]}`, op: StructuredSet, path: "a[3]", value: "1", wantErr: "index out of range"},
+		{name: "not an array index", file: "c.json", content: `{"a": [1]}`, op: StructuredSet, path: "a.x", value: "1", wantErr: "not a valid array index"},
+		{name: "lookup in scalar", file: "c.json", content: `{"a": 1}`, op: StructuredSet, path: "a.b", value: "1", wantErr: "scalar"},
+		{name: "delete missing path", file: "c.json", content: `{"a": 1}`, op: StructuredDelete, path: "b", wantErr: "path not found"},
+		{name: "delete whole document", file: "c.json", content: `{"a": 1}`, op: StructuredDelete, wantErr: "whole document"},
+		{name: "value must be json", file: "c.json", content: `{"a": 1}`, op: StructuredSet, path: "a", value: "text", wantErr: "valid JSON"},
+		{name: "unknown operation", file: "c.json", content: `{"a": 1}`, op: "rename", path: "a", wantErr: "unsupported operation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupLockRoot(t)
+			path := filepath.Join(root, tt.file)
+			writeTestFiles(t, root, map[string]string{tt.file: tt.content})
+
+			result, err := EditStructuredFile(path, "", tt.op, tt.path, tt.value, false)
+			got, readErr := os.ReadFile(path)
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				if string(got) != tt.content {
+					t.Errorf("file changed after failed edit:\n%s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("unexpected content:\nwant %q\ngot  %q", tt.want, got)
+			}
+			if !result.Changed {
+				t.Error("edit not reported as changed")
+			}
+			if tt.wantValue != "" && string(result.Value) != tt.wantValue {
+				t.Errorf("value = %s, want %s", result.Value, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestEditStructuredFileDryRunAndNoop(t *testing.T) {
+	root := setupLockRoot(t)
+	path := filepath.Join(root, "c.toml")
+	writeTestFiles(t, root, map[string]string{"c.toml": structuredTestTOML})
+
+	result, err := EditStructuredFile(path, "", StructuredSet, "title", `"new"`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Changed || !strings.Contains(result.Content, `title = "new" # inline`) {
+		t.Errorf("unexpected dry run result: %+v", result)
+	}
+
+	result, err = EditStructuredFile(path, "", StructuredSet, "server.port", "8080", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Changed {
+		t.Error("setting the same value reported as changed")
+	}
+	if got, _ := os.ReadFile(path); string(got) != structuredTestTOML {
+		t.Errorf("file changed:\n%s", got)
+	}
+}
+
+func TestGetStructuredValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		path    string
+		want    string
+		wantErr string
+	}{
+		{name: "toml datetimes", file: "c.toml", content: structuredTestTOML, path: "when", want: `"1979-05-27T07:32:00Z"`},
+		{name: "toml local date", file: "c.toml", content: structuredTestTOML, path: "day", want: `"1979-05-27"`},
+		{name: "toml inline table", file: "c.toml", content: structuredTestTOML, path: "point", want: "{\n  \"x\": 1,\n  \"y\": 2\n}"},
+		{name: "toml array table", file: "c.toml", content: structuredTestTOML, path: "users[1].name", want: `"b"`},
+		{name: "json pointer escapes", file: "c.json", content: `{"a/b": {"c~d": 1}}`, path: "/a~1b/c~0d", want: "1"},
+		{name: "json keeps number text", file: "c.json", content: structuredTestJSON, path: "$.list[1]", want: "2.50"},
+		{name: "yaml alias", file: "c.yaml", content: structuredTestYAML, path: "ref.name", want: `"x"`},
+		{name: "yaml merged key", file: "c.yaml", content: structuredTestYAML, path: "prod.name", want: `"x"`},
+		{name: "yaml merged mapping", file: "c.yaml", content: structuredTestYAML, path: "prod", want: "{\n  \"name\": \"x\",\n  \"port\": 2\n}"},
+		{name: "missing path", file: "c.yaml", content: structuredTestYAML, path: "prod.host", wantErr: "path not found: /prod/host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupLockRoot(t)
+			writeTestFiles(t, root, map[string]string{tt.file: tt.content})
+			v, err := GetStructuredValue(filepath.Join(root, tt.file), "", tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(v.Value) != tt.want {
+				t.Errorf("value = %s, want %s", v.Value, tt.want)
+			}
+		})
+	}
+}
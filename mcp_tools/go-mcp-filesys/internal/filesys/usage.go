@@ -0,0 +1,341 @@
+package filesys
+
+import (
+	"container/heap"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认返回的最大文件数
+const DefaultUsageTopFiles = 10
+
+// 遍历目录的工作goroutine数
+const usageConcurrency = 8
+
+// 统计选项
+type UsageOptions struct {
+	// 跳过 .gitignore 等规则忽略的文件
+	RespectIgnore bool
+	// 返回最大的N个文件，0表示不返回
+	TopFiles int
+}
+
+// 统计结果中的文件
+type UsageFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// 子目录的统计
+type UsageDirectory struct {
+	Path        string `json:"path"`
+	Files       int    `json:"files"`
+	Directories int    `json:"directories"`
+	Size        int64  `json:"size"`
+}
+
+// 按扩展名的统计
+type ExtensionUsage struct {
+	Extension string `json:"extension"`
+	Files     int    `json:"files"`
+	Size      int64  `json:"size"`
+}
+
+// 目录的磁盘占用报告，所有统计都是递归的，只统计普通文件的大小，不跟随符号链接
+type UsageReport struct {
+	Path        string `json:"path"`
+	Files       int    `json:"files"`
+	Directories int    `json:"directories"`
+	Symlinks    int    `json:"symlinks,omitempty"`
+	Size        int64  `json:"size"`
+	// 直接位于该目录中的文件
+	TopLevelFiles int   `json:"top_level_files"`
+	TopLevelSize  int64 `json:"top_level_size"`
+	// 每个直接子目录的统计，按大小降序
+	Subdirectories []UsageDirectory `json:"subdirectories"`
+	LargestFiles   []UsageFile      `json:"largest_files,omitempty"`
+	// 按扩展名的统计，按大小降序，没有扩展名的文件记为 "(none)"
+	Extensions []ExtensionUsage `json:"extensions"`
+	Oldest     *UsageFile       `json:"oldest,omitempty"`
+	Newest     *UsageFile       `json:"newest,omitempty"`
+	// 无法读取的目录或文件数
+	Errors int `json:"errors,omitempty"`
+}
+
+// 按大小排列的最小堆，用于保留最大的N个文件
+type usageFileHeap []UsageFile
+
+func (h usageFileHeap) Len() int           { return len(h) }
+func (h usageFileHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h usageFileHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *usageFileHeap) Push(x any)        { *h = append(*h, x.(UsageFile)) }
+func (h *usageFileHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// 并发遍历目录的状态。固定数量的工作goroutine从队列中取出目录读取，
+// 发现的子目录放回队列；pending为队列中和正在读取的目录数，为0时遍历结束
+type usageWalker struct {
+	root    string
+	opts    UsageOptions
+	matcher *IgnoreMatcher
+
+	queueMu sync.Mutex
+	queued  *sync.Cond
+	queue   []usageTask
+	pending int
+
+	mu         sync.Mutex
+	report     *UsageReport
+	subdirs    map[string]*UsageDirectory
+	extensions map[string]*ExtensionUsage
+	largest    usageFileHeap
+}
+
+// 待读取的目录，top为该目录所属的直接子目录，为空表示统计的根目录本身
+type usageTask struct {
+	dir string
+	top string
+}
+
+// 单个目录中的统计，读取完成后合并到总结果
+type usageBatch struct {
+	files, dirs, symlinks, errors int
+	size                          int64
+	extensions                    map[string]*ExtensionUsage
+	largest                       []UsageFile
+	oldest, newest                *UsageFile
+}
+
+// 统计目录的磁盘占用
+func DiskUsage(directory string, opts UsageOptions) (*UsageReport, error) {
+	if !isPathInAllowedDirectory(directory) {
+		return nil, fmt.Errorf("directory access not allowed: %s", directory)
+	}
+	directory = filepath.Clean(directory)
+	info, err := os.Stat(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", directory)
+	}
+
+	w := &usageWalker{
+		root:       directory,
+		opts:       opts,
+		queue:      []usageTask{{dir: directory}},
+		pending:    1,
+		report:     &UsageReport{Path: DisplayPath(directory)},
+		subdirs:    make(map[string]*UsageDirectory),
+		extensions: make(map[string]*ExtensionUsage),
+	}
+	if opts.RespectIgnore {
+		w.matcher = newIgnoreMatcherFor(directory)
+	}
+
+	w.queued = sync.NewCond(&w.queueMu)
+	var wg sync.WaitGroup
+	for i := 0; i < usageConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+
+	report := w.report
+	report.Subdirectories = make([]UsageDirectory, 0, len(w.subdirs))
+	for _, d := range w.subdirs {
+		report.Subdirectories = append(report.Subdirectories, *d)
+	}
+	sort.Slice(report.Subdirectories, func(i, j int) bool {
+		a, b := report.Subdirectories[i], report.Subdirectories[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Path < b.Path
+	})
+	report.Extensions = make([]ExtensionUsage, 0, len(w.extensions))
+	for _, e := range w.extensions {
+		report.Extensions = append(report.Extensions, *e)
+	}
+	sort.Slice(report.Extensions, func(i, j int) bool {
+		a, b := report.Extensions[i], report.Extensions[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Extension < b.Extension
+	})
+	report.LargestFiles = make([]UsageFile, len(w.largest))
+	copy(report.LargestFiles, w.largest)
+	sort.Slice(report.LargestFiles, func(i, j int) bool {
+		a, b := report.LargestFiles[i], report.LargestFiles[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Path < b.Path
+	})
+	return report, nil
+}
+
+// 工作goroutine：不断从队列中取出目录读取，直到所有目录都已读取。
+// 后进先出地取出目录，遍历接近深度优先，排队的目录数保持较少
+func (w *usageWalker) work() {
+	for {
+		w.queueMu.Lock()
+		for len(w.queue) == 0 && w.pending > 0 {
+			w.queued.Wait()
+		}
+		if len(w.queue) == 0 {
+			w.queueMu.Unlock()
+			return
+		}
+		task := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+		w.queueMu.Unlock()
+
+		children := w.walk(task.dir, task.top)
+
+		w.queueMu.Lock()
+		w.queue = append(w.queue, children...)
+		w.pending += len(children) - 1
+		if len(children) > 0 || w.pending == 0 {
+			w.queued.Broadcast()
+		}
+		w.queueMu.Unlock()
+	}
+}
+
+// 读取一个目录并合并统计，返回需要继续读取的子目录
+func (w *usageWalker) walk(dir string, top string) []usageTask {
+	entries, err := os.ReadDir(dir)
+
+	var children []usageTask
+	batch := usageBatch{extensions: make(map[string]*ExtensionUsage)}
+	if err != nil {
+		batch.errors++
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if w.matcher != nil && w.matcher.Match(path, entry.IsDir()) {
+			continue
+		}
+		switch {
+		case entry.Type()&os.ModeSymlink != 0:
+			batch.symlinks++
+		case entry.IsDir():
+			batch.dirs++
+			childTop := top
+			if childTop == "" {
+				childTop = path
+				w.mu.Lock()
+				w.subdirs[path] = &UsageDirectory{Path: DisplayPath(path)}
+				w.mu.Unlock()
+			}
+			children = append(children, usageTask{dir: path, top: childTop})
+		case entry.Type().IsRegular():
+			info, err := entry.Info()
+			if err != nil {
+				batch.errors++
+				continue
+			}
+			batch.add(path, info)
+		}
+	}
+	w.merge(top, &batch)
+	return children
+}
+
+func (b *usageBatch) add(path string, info os.FileInfo) {
+	b.files++
+	b.size += info.Size()
+
+	ext := strings.ToLower(filepath.Ext(info.Name()))
+	if ext == "" {
+		ext = "(none)"
+	}
+	e := b.extensions[ext]
+	if e == nil {
+		e = &ExtensionUsage{Extension: ext}
+		b.extensions[ext] = e
+	}
+	e.Files++
+	e.Size += info.Size()
+
+	file := UsageFile{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+	b.largest = append(b.largest, file)
+	if b.oldest == nil || file.ModTime.Before(b.oldest.ModTime) {
+		f := file
+		b.oldest = &f
+	}
+	if b.newest == nil || file.ModTime.After(b.newest.ModTime) {
+		f := file
+		b.newest = &f
+	}
+}
+
+// 把一个目录的统计合并到总结果
+func (w *usageWalker) merge(top string, b *usageBatch) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	r := w.report
+	r.Files += b.files
+	r.Directories += b.dirs
+	r.Symlinks += b.symlinks
+	r.Size += b.size
+	r.Errors += b.errors
+	if top == "" {
+		r.TopLevelFiles += b.files
+		r.TopLevelSize += b.size
+	} else if d := w.subdirs[top]; d != nil {
+		d.Files += b.files
+		d.Directories += b.dirs
+		d.Size += b.size
+	}
+
+	for ext, e := range b.extensions {
+		total := w.extensions[ext]
+		if total == nil {
+			total = &ExtensionUsage{Extension: ext}
+			w.extensions[ext] = total
+		}
+		total.Files += e.Files
+		total.Size += e.Size
+	}
+	for _, f := range b.largest {
+		if w.opts.TopFiles <= 0 {
+			break
+		}
+		if len(w.largest) < w.opts.TopFiles {
+			f.Path = DisplayPath(f.Path)
+			heap.Push(&w.largest, f)
+		} else if f.Size > w.largest[0].Size {
+			f.Path = DisplayPath(f.Path)
+			w.largest[0] = f
+			heap.Fix(&w.largest, 0)
+		}
+	}
+	if b.oldest != nil && (r.Oldest == nil || b.oldest.ModTime.Before(r.Oldest.ModTime)) {
+		f := *b.oldest
+		f.Path = DisplayPath(f.Path)
+		r.Oldest = &f
+	}
+	if b.newest != nil && (r.Newest == nil || b.newest.ModTime.After(r.Newest.ModTime)) {
+		f := *b.newest
+		f.Path = DisplayPath(f.Path)
+		r.Newest = &f
+	}
+}
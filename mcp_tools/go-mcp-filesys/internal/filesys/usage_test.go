@@ -0,0 +1,204 @@
+package filesys
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupUsageTree(t *testing.T) string {
+	t.Helper()
+	root := setupLockRoot(t)
+	writeTestFiles(t, root, map[string]string{
+		"top.txt":          "12345",
+		"Makefile":         "mk",
+		"src/a.go":         strings.Repeat("a", 100),
+		"src/b.GO":         strings.Repeat("b", 50),
+		"src/pkg/c.go":     strings.Repeat("c", 30),
+		"src/pkg/deep/d.c": strings.Repeat("d", 20),
+		"docs/readme.md":   strings.Repeat("r", 40),
+		"build/out.log":    strings.Repeat("l", 200),
+		".gitignore":       "build/\n",
+	})
+	if err := os.Mkdir(filepath.Join(root, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("top.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	times := map[string]time.Time{
+		"src/pkg/deep/d.c": base,
+		"docs/readme.md":   base.Add(48 * time.Hour),
+	}
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		mtime, ok := times[filepath.ToSlash(rel)]
+		if !ok {
+			mtime = base.Add(24 * time.Hour)
+		}
+		return os.Chtimes(path, mtime, mtime)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestDiskUsage(t *testing.T) {
+	root := setupUsageTree(t)
+
+	tests := []struct {
+		name  string
+		opts  UsageOptions
+		check func(t *testing.T, r *UsageReport)
+	}{
+		{
+			name: "totals",
+			check: func(t *testing.T, r *UsageReport) {
+				// .gitignore 有7个字节
+				if r.Files != 9 || r.Size != 454 || r.Directories != 6 || r.Symlinks != 1 {
+					t.Errorf("files = %d, size = %d, dirs = %d, symlinks = %d; want 9, 454, 6, 1", r.Files, r.Size, r.Directories, r.Symlinks)
+				}
+				if r.TopLevelFiles != 3 || r.TopLevelSize != 14 {
+					t.Errorf("top level = %d files, %d bytes; want 3, 14", r.TopLevelFiles, r.TopLevelSize)
+				}
+				if r.Path != "ws:." {
+					t.Errorf("path = %s", r.Path)
+				}
+			},
+		},
+		{
+			name: "subdirectories",
+			check: func(t *testing.T, r *UsageReport) {
+				want := []UsageDirectory{
+					{Path: "ws:build", Files: 1, Size: 200},
+					{Path: "ws:src", Files: 4, Directories: 2, Size: 200},
+					{Path: "ws:docs", Files: 1, Size: 40},
+					{Path: "ws:empty"},
+				}
+				if !reflect.DeepEqual(r.Subdirectories, want) {
+					t.Errorf("subdirectories = %+v, want %+v", r.Subdirectories, want)
+				}
+			},
+		},
+		{
+			name: "extensions",
+			check: func(t *testing.T, r *UsageReport) {
+				want := []ExtensionUsage{
+					{Extension: ".log", Files: 1, Size: 200},
+					{Extension: ".go", Files: 3, Size: 180},
+					{Extension: ".md", Files: 1, Size: 40},
+					{Extension: ".c", Files: 1, Size: 20},
+					{Extension: ".gitignore", Files: 1, Size: 7},
+					{Extension: ".txt", Files: 1, Size: 5},
+					{Extension: "(none)", Files: 1, Size: 2},
+				}
+				if !reflect.DeepEqual(r.Extensions, want) {
+					t.Errorf("extensions = %+v, want %+v", r.Extensions, want)
+				}
+			},
+		},
+		{
+			name: "oldest and newest",
+			check: func(t *testing.T, r *UsageReport) {
+				if r.Oldest == nil || r.Oldest.Path != "ws:src/pkg/deep/d.c" {
+					t.Errorf("oldest = %+v", r.Oldest)
+				}
+				if r.Newest == nil || r.Newest.Path != "ws:docs/readme.md" {
+					t.Errorf("newest = %+v", r.Newest)
+				}
+			},
+		},
+		{
+			name: "no largest files by default",
+			check: func(t *testing.T, r *UsageReport) {
+				if len(r.LargestFiles) != 0 {
+					t.Errorf("largest files = %+v", r.LargestFiles)
+				}
+			},
+		},
+		{
+			name: "top files",
+			opts: UsageOptions{TopFiles: 3},
+			check: func(t *testing.T, r *UsageReport) {
+				got := make([]string, 0, len(r.LargestFiles))
+				for _, f := range r.LargestFiles {
+					got = append(got, f.Path)
+				}
+				want := []string{"ws:build/out.log", "ws:src/a.go", "ws:src/b.GO"}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("largest files = %q, want %q", got, want)
+				}
+			},
+		},
+		{
+			name: "respect ignore",
+			opts: UsageOptions{RespectIgnore: true},
+			check: func(t *testing.T, r *UsageReport) {
+				if r.Files != 8 || r.Size != 254 || r.Directories != 5 {
+					t.Errorf("files = %d, size = %d, dirs = %d; want 8, 254, 5", r.Files, r.Size, r.Directories)
+				}
+				for _, d := range r.Subdirectories {
+					if d.Path == "ws:build" {
+						t.Error("ignored directory reported")
+					}
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := DiskUsage(root, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, r)
+		})
+	}
+}
+
+func TestDiskUsageOfSubdirectory(t *testing.T) {
+	root := setupUsageTree(t)
+	r, err := DiskUsage(filepath.Join(root, "src"), UsageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Files != 4 || r.Size != 200 || r.TopLevelFiles != 2 || r.TopLevelSize != 150 {
+		t.Errorf("unexpected report: %+v", r)
+	}
+	want := []UsageDirectory{{Path: "ws:src/pkg", Files: 2, Directories: 1, Size: 50}}
+	if !reflect.DeepEqual(r.Subdirectories, want) {
+		t.Errorf("subdirectories = %+v, want %+v", r.Subdirectories, want)
+	}
+
+	if _, err := DiskUsage(filepath.Join(root, "top.txt"), UsageOptions{}); err == nil {
+		t.Error("usage of a file accepted")
+	}
+}
+
+func TestCountFilesInDirectory(t *testing.T) {
+	root := setupUsageTree(t)
+	// 只统计普通文件，不计入目录和符号链接
+	files, size, err := CountFilesInDirectory(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 9 || size != 454 {
+		t.Errorf("count = %d files, %d bytes; want 9, 454", files, size)
+	}
+	files, size, err = CountFilesInDirectory(root, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 8 || size != 254 {
+		t.Errorf("count respecting ignore = %d files, %d bytes; want 8, 254", files, size)
+	}
+}
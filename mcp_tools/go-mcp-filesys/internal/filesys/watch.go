@@ -0,0 +1,348 @@
+package filesys
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 文件监视模式
+type WatchMode string
+
+const (
+	// 优先使用fsnotify，失败时退化为轮询
+	WatchAuto WatchMode = "auto"
+	// 使用fsnotify（Linux上为inotify）
+	WatchNotify WatchMode = "fsnotify"
+	// 定时扫描根目录比较文件大小和修改时间
+	WatchPoll WatchMode = "poll"
+	// 不监视文件变化
+	WatchOff WatchMode = "off"
+)
+
+// 默认轮询间隔
+const DefaultPollInterval = 2 * time.Second
+
+// 合并同一文件短时间内多次变化的时间窗口
+const watchDebounce = 100 * time.Millisecond
+
+// 文件变化类型
+type ChangeOp string
+
+const (
+	ChangeCreate ChangeOp = "create"
+	ChangeWrite  ChangeOp = "write"
+	ChangeRemove ChangeOp = "remove"
+)
+
+// 文件变化事件，Path为绝对路径
+type ChangeEvent struct {
+	Path string
+	Op   ChangeOp
+}
+
+// 解析文件监视模式
+func ParseWatchMode(mode string) (WatchMode, error) {
+	switch WatchMode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", WatchAuto:
+		return WatchAuto, nil
+	case WatchNotify:
+		return WatchNotify, nil
+	case WatchPoll:
+		return WatchPoll, nil
+	case WatchOff:
+		return WatchOff, nil
+	default:
+		return "", fmt.Errorf("invalid watch mode: %s", mode)
+	}
+}
+
+// 监视所有根目录下的文件变化，遵循忽略规则。
+// 短时间内同一路径的多次变化会合并为一个事件
+type Watcher struct {
+	mode     WatchMode
+	interval time.Duration
+	onChange func(ChangeEvent)
+
+	notify   *fsnotify.Watcher
+	matchers map[string]*IgnoreMatcher
+
+	mu      sync.Mutex
+	pending map[string]ChangeOp
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// 轮询时记录的文件状态
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// 创建文件监视器，需要调用Start开始监视
+func NewWatcher(mode WatchMode, interval time.Duration, onChange func(ChangeEvent)) *Watcher {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return &Watcher{
+		mode:     mode,
+		interval: interval,
+		onChange: onChange,
+		matchers: make(map[string]*IgnoreMatcher),
+		pending:  make(map[string]ChangeOp),
+		done:     make(chan struct{}),
+	}
+}
+
+// 开始监视，返回实际使用的模式（fsnotify、poll或off）
+func (w *Watcher) Start() (WatchMode, error) {
+	if w.mode == WatchOff {
+		return WatchOff, nil
+	}
+	for _, root := range ListRoots() {
+		w.matchers[root.Path] = NewIgnoreMatcher(root.Path)
+	}
+
+	if w.mode == WatchAuto || w.mode == WatchNotify {
+		err := w.startNotify()
+		if err == nil {
+			w.startFlusher()
+			return WatchNotify, nil
+		}
+		if w.mode == WatchNotify {
+			return "", fmt.Errorf("failed to start fsnotify watcher: %w", err)
+		}
+		log.Printf("fsnotify unavailable, falling back to polling: %v", err)
+	}
+
+	snapshot := w.scan()
+	w.wg.Add(1)
+	go w.pollLoop(snapshot)
+	w.startFlusher()
+	return WatchPoll, nil
+}
+
+// 停止监视
+func (w *Watcher) Close() {
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	close(w.done)
+	if w.notify != nil {
+		w.notify.Close()
+	}
+	w.wg.Wait()
+}
+
+func (w *Watcher) startNotify() error {
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	w.notify = notify
+	for _, root := range ListRoots() {
+		if err := w.addTree(root.Path, false); err != nil {
+			notify.Close()
+			w.notify = nil
+			return err
+		}
+	}
+	w.wg.Add(1)
+	go w.notifyLoop()
+	return nil
+}
+
+// 为目录及其所有未被忽略的子目录添加监视。
+// emit为true时为目录中已存在的文件产生创建事件（新建目录时文件可能在添加监视前已写入）
+func (w *Watcher) addTree(dir string, emit bool) error {
+	return w.walk(dir, func(path string, d fs.DirEntry) error {
+		if d.IsDir() {
+			return w.notify.Add(path)
+		}
+		if emit {
+			w.queue(path, ChangeCreate)
+		}
+		return nil
+	})
+}
+
+func (w *Watcher) notifyLoop() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.notify.Events:
+			if !ok {
+				return
+			}
+			w.handleNotify(event)
+		case err, ok := <-w.notify.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("file watcher error: %v", err)
+		}
+	}
+}
+
+func (w *Watcher) handleNotify(event fsnotify.Event) {
+	path := filepath.Clean(event.Name)
+	switch {
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		// 被删除的目录由fsnotify自动移除监视
+		w.queue(path, ChangeRemove)
+	case event.Has(fsnotify.Create):
+		info, err := os.Lstat(path)
+		if err != nil || w.ignored(path, info.IsDir()) {
+			return
+		}
+		if info.IsDir() {
+			if err := w.addTree(path, true); err != nil {
+				log.Printf("failed to watch %s: %v", path, err)
+			}
+		}
+		w.queue(path, ChangeCreate)
+	case event.Has(fsnotify.Write), event.Has(fsnotify.Chmod):
+		if w.ignored(path, false) {
+			return
+		}
+		w.queue(path, ChangeWrite)
+	}
+}
+
+func (w *Watcher) pollLoop(snapshot map[string]fileStamp) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			current := w.scan()
+			for path, stamp := range current {
+				old, ok := snapshot[path]
+				switch {
+				case !ok:
+					w.queue(path, ChangeCreate)
+				case !stamp.isDir && (old.size != stamp.size || !old.modTime.Equal(stamp.modTime)):
+					w.queue(path, ChangeWrite)
+				}
+			}
+			for path := range snapshot {
+				if _, ok := current[path]; !ok {
+					w.queue(path, ChangeRemove)
+				}
+			}
+			snapshot = current
+		}
+	}
+}
+
+// 扫描所有根目录，记录文件和目录的状态
+func (w *Watcher) scan() map[string]fileStamp {
+	snapshot := make(map[string]fileStamp)
+	for _, root := range ListRoots() {
+		w.walk(root.Path, func(path string, d fs.DirEntry) error {
+			if path == root.Path {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			snapshot[path] = fileStamp{size: info.Size(), modTime: info.ModTime(), isDir: d.IsDir()}
+			return nil
+		})
+	}
+	return snapshot
+}
+
+// 遍历目录，跳过被忽略的路径，不跟随符号链接
+func (w *Watcher) walk(dir string, fn func(path string, d fs.DirEntry) error) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if path != dir && w.ignored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(path, d)
+	})
+}
+
+func (w *Watcher) ignored(path string, isDir bool) bool {
+	root := rootForPath(path)
+	if root == nil {
+		return true
+	}
+	matcher := w.matchers[root.Path]
+	if matcher == nil {
+		return false
+	}
+	return matcher.Match(path, isDir)
+}
+
+// 记录待发送的事件，同一路径的多个事件合并：
+// 先创建后修改仍为创建，先创建后删除则相互抵消
+func (w *Watcher) queue(path string, op ChangeOp) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	prev, ok := w.pending[path]
+	switch {
+	case !ok:
+		w.pending[path] = op
+	case prev == ChangeCreate && op == ChangeWrite:
+	case prev == ChangeCreate && op == ChangeRemove:
+		delete(w.pending, path)
+	case prev == ChangeRemove && op == ChangeCreate:
+		w.pending[path] = ChangeWrite
+	default:
+		w.pending[path] = op
+	}
+}
+
+func (w *Watcher) startFlusher() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(watchDebounce)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+				w.flush()
+			}
+		}
+	}()
+}
+
+func (w *Watcher) flush() {
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = make(map[string]ChangeOp)
+	w.mu.Unlock()
+	for path, op := range pending {
+		w.onChange(ChangeEvent{Path: path, Op: op})
+	}
+}
@@ -0,0 +1,412 @@
+package resources
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go-mcp-filesys/internal/filesys"
+	"go-mcp-filesys/internal/transport"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 注册为静态资源的最大文件数，超出的文件仍可以通过资源模板读取
+const MaxListedResources = 10000
+
+// 通过资源读取的最大文件大小
+const MaxResourceBytes = 8 * 1024 * 1024
+
+// 文件资源模板，path为去掉开头斜杠的绝对路径
+const FileURITemplate = "file:///{+path}"
+
+// mcp-go 未定义的订阅方法
+const (
+	methodSubscribe   = "resources/subscribe"
+	methodUnsubscribe = "resources/unsubscribe"
+)
+
+// 判断是否为二进制内容时检查的字节数
+const binarySniffLength = 8000
+
+// 资源管理器：把根目录下的文件注册为 file:// 资源，
+// 监视文件变化并向订阅的会话发送 notifications/resources/updated。
+//
+// mcp-go 没有实现 resources/subscribe 和 resources/unsubscribe，
+// 这两个请求在传输层被拦截并记录订阅，然后改写为 ping 交给服务器处理，
+// 这样客户端仍会收到一个带有相同id的空结果
+type Manager struct {
+	server  *server.MCPServer
+	watcher *filesys.Watcher
+
+	mu sync.Mutex
+	// 已注册为静态资源的文件
+	registered map[string]bool
+	// 订阅的路径 -> 会话ID -> 订阅时使用的URI
+	subscriptions map[string]map[string]string
+	sessions      map[string]server.ClientSession
+}
+
+// 创建资源管理器
+func NewManager() *Manager {
+	return &Manager{
+		registered:    make(map[string]bool),
+		subscriptions: make(map[string]map[string]string),
+		sessions:      make(map[string]server.ClientSession),
+	}
+}
+
+// 注册会话钩子，需要在创建服务器时通过 server.WithHooks 传入hooks
+func (m *Manager) RegisterHooks(hooks *server.Hooks) {
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.sessions[session.SessionID()] = session
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.sessions, session.SessionID())
+		for path, subscribers := range m.subscriptions {
+			delete(subscribers, session.SessionID())
+			if len(subscribers) == 0 {
+				delete(m.subscriptions, path)
+			}
+		}
+	})
+}
+
+// 注册资源模板和根目录下的文件资源，并开始监视文件变化
+func (m *Manager) Start(mcpServer *server.MCPServer, mode filesys.WatchMode, interval time.Duration) error {
+	m.server = mcpServer
+	mcpServer.AddResourceTemplate(
+		mcp.NewResourceTemplate(FileURITemplate, "file",
+			mcp.WithTemplateDescription("Files and directories under the allowed roots, addressed by absolute path"),
+		),
+		m.handleRead,
+	)
+
+	count := 0
+	for _, root := range filesys.ListRoots() {
+		matcher := filesys.NewIgnoreMatcher(root.Path)
+		err := filepath.WalkDir(root.Path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if path != root.Path && matcher.Match(path, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if count >= MaxListedResources {
+				return fs.SkipAll
+			}
+			m.addResource(path)
+			count++
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list files under root %s: %w", root.Name, err)
+		}
+	}
+	if count >= MaxListedResources {
+		log.Printf("more than %d files under roots, only the first %d are listed as resources", MaxListedResources, MaxListedResources)
+	}
+
+	m.watcher = filesys.NewWatcher(mode, interval, m.handleChange)
+	actual, err := m.watcher.Start()
+	if err != nil {
+		return err
+	}
+	log.Printf("file watch mode: %s", actual)
+	return nil
+}
+
+// 停止监视文件变化
+func (m *Manager) Close() {
+	if m.watcher != nil {
+		m.watcher.Close()
+	}
+}
+
+// 路径对应的 file:// URI
+func FileURI(path string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	if !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path
+	}
+	return u.String()
+}
+
+// 解析 file:// URI，返回其中的路径
+func pathFromURI(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid resource URI %s: %w", uri, err)
+	}
+	if u.Scheme != "file" || (u.Host != "" && u.Host != "localhost") {
+		return "", fmt.Errorf("unsupported resource URI: %s", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// 把文件注册为静态资源，调用者需要持有锁或处于启动阶段
+func (m *Manager) addResource(path string) {
+	uri := FileURI(path)
+	resource := mcp.NewResource(uri, filesys.DisplayPath(path), mcp.WithMIMEType(mimeTypeFor(path)))
+	m.server.AddResource(resource, m.handleRead)
+	m.registered[path] = true
+}
+
+func (m *Manager) handleRead(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	path, err := pathFromURI(request.Params.URI)
+	if err != nil {
+		return nil, err
+	}
+	return readResource(request.Params.URI, path)
+}
+
+// 读取资源内容：文本文件返回文本，二进制文件返回base64，目录返回JSON格式的条目列表
+func readResource(uri string, path string) ([]mcp.ResourceContents, error) {
+	abs, err := filesys.ResolveExistingPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not allowed: %w", uri, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		entries, err := filesys.ListFilesInDirectory(abs, false, true)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: "application/json", Text: string(data)}}, nil
+	}
+
+	if info.Size() > MaxResourceBytes {
+		return nil, fmt.Errorf("%s is too large to read as a resource (%d bytes, limit %d), use read_file with offset/length", uri, info.Size(), MaxResourceBytes)
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	mimeType := mimeTypeFor(abs)
+	if isText(data) {
+		return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: mimeType, Text: string(data)}}, nil
+	}
+	if mimeType == "text/plain" {
+		mimeType = "application/octet-stream"
+	}
+	return []mcp.ResourceContents{mcp.BlobResourceContents{URI: uri, MIMEType: mimeType, Blob: base64.StdEncoding.EncodeToString(data)}}, nil
+}
+
+func mimeTypeFor(path string) string {
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return t
+	}
+	return "text/plain"
+}
+
+func isText(data []byte) bool {
+	sniff := data
+	if len(sniff) > binarySniffLength {
+		sniff = sniff[:binarySniffLength]
+	}
+	return bytes.IndexByte(sniff, 0) < 0 && utf8.Valid(data)
+}
+
+// 处理文件变化：更新静态资源列表并通知订阅了该文件或其上级目录的会话
+func (m *Manager) handleChange(event filesys.ChangeEvent) {
+	m.mu.Lock()
+	switch event.Op {
+	case filesys.ChangeCreate:
+		if !m.registered[event.Path] && len(m.registered) < MaxListedResources {
+			if info, err := os.Lstat(event.Path); err == nil && info.Mode().IsRegular() {
+				m.addResource(event.Path)
+			}
+		}
+	case filesys.ChangeRemove:
+		// 删除目录时移除其中所有文件
+		for path := range m.registered {
+			if path == event.Path || strings.HasPrefix(path, event.Path+string(filepath.Separator)) {
+				m.server.RemoveResource(FileURI(path))
+				delete(m.registered, path)
+			}
+		}
+	}
+
+	type target struct {
+		session server.ClientSession
+		uri     string
+	}
+	targets := make([]target, 0)
+	for path, subscribers := range m.subscriptions {
+		if path != event.Path && !strings.HasPrefix(event.Path, path+string(filepath.Separator)) {
+			continue
+		}
+		for sessionID, uri := range subscribers {
+			if session, ok := m.sessions[sessionID]; ok {
+				targets = append(targets, target{session: session, uri: uri})
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	for _, t := range targets {
+		ctx := m.server.WithContext(context.Background(), t.session)
+		err := m.server.SendNotificationToClient(ctx, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": t.uri})
+		if err != nil {
+			log.Printf("failed to notify session %s about %s: %v", t.session.SessionID(), t.uri, err)
+		}
+	}
+}
+
+// 订阅或取消订阅资源
+func (m *Manager) subscribe(sessionID string, uri string, subscribe bool) error {
+	path, err := pathFromURI(uri)
+	if err != nil {
+		return err
+	}
+	// 文件可以尚不存在，创建后会收到通知
+	abs, err := filesys.ResolvePath(path)
+	if err != nil {
+		return fmt.Errorf("%s is not allowed: %w", uri, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if subscribe {
+		if m.subscriptions[abs] == nil {
+			m.subscriptions[abs] = make(map[string]string)
+		}
+		m.subscriptions[abs][sessionID] = uri
+		return nil
+	}
+	if subscribers, ok := m.subscriptions[abs]; ok {
+		delete(subscribers, sessionID)
+		if len(subscribers) == 0 {
+			delete(m.subscriptions, abs)
+		}
+	}
+	return nil
+}
+
+// JSON-RPC请求中需要拦截的部分
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  struct {
+		URI string `json:"uri"`
+	} `json:"params"`
+}
+
+// 拦截订阅请求。成功时改写为ping，得到与订阅相同的空结果；
+// 失败时改写为对同一URI的resources/read，由服务器返回描述错误的响应。
+// 其他消息原样返回
+func (m *Manager) InterceptMessage(sessionID string, message []byte) []byte {
+	var req rpcRequest
+	if err := json.Unmarshal(message, &req); err != nil {
+		return message
+	}
+	var subscribe bool
+	switch req.Method {
+	case methodSubscribe:
+		subscribe = true
+	case methodUnsubscribe:
+		subscribe = false
+	default:
+		return message
+	}
+
+	rewritten := map[string]any{"jsonrpc": mcp.JSONRPC_VERSION, "id": req.ID}
+	if err := m.subscribe(sessionID, req.Params.URI, subscribe); err != nil {
+		rewritten["method"] = string(mcp.MethodResourcesRead)
+		rewritten["params"] = map[string]any{"uri": req.Params.URI}
+	} else {
+		rewritten["method"] = string(mcp.MethodPing)
+	}
+	data, err := json.Marshal(rewritten)
+	if err != nil {
+		return message
+	}
+	return data
+}
+
+// 包装stdio传输的输入，逐行拦截订阅请求。stdio传输只有一个会话，ID固定为"stdio"
+func (m *Manager) StdioReader(r io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				trimmed := bytes.TrimSpace(line)
+				if len(trimmed) > 0 {
+					line = append(m.InterceptMessage("stdio", trimmed), '\n')
+				}
+				if _, werr := pw.Write(line); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return pr
+}
+
+// 包装SSE传输的HTTP处理器，拦截发往消息端点的订阅请求
+func (m *Manager) HTTPMiddleware(next http.Handler, messagePath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.URL.Query().Get("sessionId")
+		if r.Method != http.MethodPost || r.URL.Path != messagePath || sessionID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, transport.MaxMessageBytes))
+		r.Body.Close()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, fmt.Sprintf("request body is larger than %d bytes", transport.MaxMessageBytes), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		body = m.InterceptMessage(sessionID, body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		next.ServeHTTP(w, r)
+	})
+}
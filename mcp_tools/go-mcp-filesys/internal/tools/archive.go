@@ -0,0 +1,158 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 创建一个工具，用于把文件和目录打包
+func CreateArchiveTool() mcp.Tool {
+	return mcp.NewTool("create_archive",
+		mcp.WithDescription(fmt.Sprintf("Bundle files and directories into a zip, tar or tar.gz archive. Each source is stored under its own name at the top level of the archive, directories recursively; permissions and modification times are kept and symbolic links are stored as links. At most %d files and %d bytes", filesys.MaxArchiveFiles, filesys.MaxArchiveBytes)),
+		mcp.WithString("archive",
+			mcp.Required(),
+			mcp.Description("The archive file to create"),
+		),
+		mcp.WithArray("sources",
+			mcp.Required(),
+			mcp.Description("Files and directories to include"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("format",
+			mcp.Description("Archive format; detected from the archive extension when omitted"),
+			mcp.Enum(filesys.ArchiveZip, filesys.ArchiveTar, filesys.ArchiveTarGz),
+		),
+		mcp.WithBoolean("overwrite",
+			mcp.Description("Replace the archive if it already exists"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithBoolean("respectGitignore",
+			mcp.Description("Skip files ignored by .gitignore/.ignore files, as well as .git and node_modules directories"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// 创建一个工具，用于列出压缩包中的内容
+func ListArchiveTool() mcp.Tool {
+	return mcp.NewTool("list_archive",
+		mcp.WithDescription("List the entries of a zip, tar or tar.gz archive without extracting it, with name, type, size, mode, modification time and link target"),
+		mcp.WithString("archive",
+			mcp.Required(),
+			mcp.Description("The archive file to list"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Archive format; detected from the extension or the file content when omitted"),
+			mcp.Enum(filesys.ArchiveZip, filesys.ArchiveTar, filesys.ArchiveTarGz),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entries to return; the totals always cover the whole archive"),
+			mcp.DefaultNumber(filesys.DefaultArchiveListLimit),
+		),
+	)
+}
+
+// 创建一个工具，用于解压压缩包
+func ExtractArchiveTool() mcp.Tool {
+	return mcp.NewTool("extract_archive",
+		mcp.WithDescription(fmt.Sprintf("Extract a zip, tar or tar.gz archive into a directory, which is created if missing. All entries are checked before anything is written: entries with absolute paths or .. components, symbolic links pointing outside the destination, archives over the file count or size limit (at most %d files and %d bytes) and existing files are rejected unless overwrite is set. Permissions and modification times are preserved; if extraction fails midway, extracted files are removed and overwritten files restored", filesys.MaxArchiveFiles, filesys.MaxArchiveBytes)),
+		mcp.WithString("archive",
+			mcp.Required(),
+			mcp.Description("The archive file to extract"),
+		),
+		mcp.WithString("destination",
+			mcp.Required(),
+			mcp.Description("The directory to extract into"),
+		),
+		mcp.WithBoolean("overwrite",
+			mcp.Description("Replace existing files; existing directories are always merged"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithNumber("maxBytes",
+			mcp.Description("Maximum total uncompressed size to extract"),
+			mcp.DefaultNumber(float64(filesys.MaxArchiveBytes)),
+		),
+		mcp.WithNumber("maxFiles",
+			mcp.Description("Maximum number of files to extract"),
+			mcp.DefaultNumber(filesys.MaxArchiveFiles),
+		),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func CreateArchiveToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		archive, _ := request.Params.Arguments["archive"].(string)
+		absArchive, err := filesys.ResolvePath(archive)
+		if err != nil {
+			return nil, fmt.Errorf("%s archive is not allowed: %w", archive, err)
+		}
+		sources := parseStringList(request, "sources")
+		if len(sources) == 0 {
+			return nil, fmt.Errorf("no sources provided")
+		}
+		absSources := make([]string, 0, len(sources))
+		for _, source := range sources {
+			absSource, err := filesys.ResolveExistingPath(source)
+			if err != nil {
+				return nil, fmt.Errorf("%s is not allowed: %w", source, err)
+			}
+			absSources = append(absSources, absSource)
+		}
+		result, err := filesys.CreateArchive(absArchive, absSources, filesys.CreateArchiveOptions{
+			Format:        mcp.ParseString(request, "format", ""),
+			Overwrite:     mcp.ParseBoolean(request, "overwrite", false),
+			RespectIgnore: mcp.ParseBoolean(request, "respectGitignore", false),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(result)
+	}
+}
+
+func ListArchiveToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		archive, _ := request.Params.Arguments["archive"].(string)
+		absArchive, err := filesys.ResolveExistingPath(archive)
+		if err != nil {
+			return nil, fmt.Errorf("%s archive is not allowed: %w", archive, err)
+		}
+		listing, err := filesys.ListArchive(absArchive,
+			mcp.ParseString(request, "format", ""),
+			mcp.ParseInt(request, "limit", filesys.DefaultArchiveListLimit),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(listing)
+	}
+}
+
+func ExtractArchiveToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		archive, _ := request.Params.Arguments["archive"].(string)
+		absArchive, err := filesys.ResolveExistingPath(archive)
+		if err != nil {
+			return nil, fmt.Errorf("%s archive is not allowed: %w", archive, err)
+		}
+		destination, _ := request.Params.Arguments["destination"].(string)
+		absDestination, err := filesys.ResolvePath(destination)
+		if err != nil {
+			return nil, fmt.Errorf("%s destination is not allowed: %w", destination, err)
+		}
+		result, err := filesys.ExtractArchive(absArchive, absDestination, filesys.ExtractOptions{
+			Overwrite: mcp.ParseBoolean(request, "overwrite", false),
+			MaxBytes:  mcp.ParseInt64(request, "maxBytes", filesys.MaxArchiveBytes),
+			MaxFiles:  mcp.ParseInt(request, "maxFiles", filesys.MaxArchiveFiles),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(result)
+	}
+}
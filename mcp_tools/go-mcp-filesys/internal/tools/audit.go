@@ -0,0 +1,243 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 审计记录中只保留长度和SHA-256的参数，包括批量操作中的同名字段
+var auditRedactedArguments = map[string]bool{
+	"content":    true,
+	"newcontent": true,
+	"data":       true,
+	"value":      true,
+	"patch":      true,
+	"old":        true,
+	"new":        true,
+	"match":      true,
+}
+
+// 超过该长度的其他字符串参数同样只保留长度和SHA-256
+const auditMaxArgumentLength = 1024
+
+// 审计记录中需要解析为绝对路径的参数
+var auditPathArguments = map[string]bool{
+	"file":        true,
+	"directory":   true,
+	"path":        true,
+	"paths":       true,
+	"destination": true,
+	"archive":     true,
+	"sources":     true,
+	"from":        true,
+	"to":          true,
+	"other":       true,
+}
+
+// 创建一个工具，用于查询审计日志
+func AuditQueryTool() mcp.Tool {
+	return mcp.NewTool("audit_query",
+		mcp.WithDescription("Search the audit log of tool invocations, newest first. Every entry records the time, tool, session id, arguments (file content is replaced by its length and SHA-256), resolved paths, result, error and duration"),
+		mcp.WithString("tool",
+			mcp.Description("Only return calls of this tool"),
+		),
+		mcp.WithString("session",
+			mcp.Description("Only return calls from this MCP session id"),
+		),
+		mcp.WithString("path",
+			mcp.Description("Only return calls that touched this file or anything inside this directory"),
+		),
+		mcp.WithString("since",
+			mcp.Description("Only return calls at or after this time, as RFC 3339 (2024-01-02T15:04:05Z) or a duration before now (e.g. 1h, 30m)"),
+		),
+		mcp.WithString("until",
+			mcp.Description("Only return calls at or before this time, in the same formats as since"),
+		),
+		mcp.WithBoolean("errorsOnly",
+			mcp.Description("Only return calls that failed or returned an error result"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum number of entries to return (max %d)", filesys.MaxAuditQueryLimit)),
+			mcp.DefaultNumber(filesys.DefaultAuditQueryLimit),
+		),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func AuditQueryToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		q := filesys.AuditQuery{
+			Tool:    mcp.ParseString(request, "tool", ""),
+			Session: mcp.ParseString(request, "session", ""),
+			Errors:  mcp.ParseBoolean(request, "errorsOnly", false),
+			Limit:   mcp.ParseInt(request, "limit", filesys.DefaultAuditQueryLimit),
+		}
+		if path := mcp.ParseString(request, "path", ""); path != "" {
+			absPath, err := filesys.ResolvePath(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s path is not allowed: %w", path, err)
+			}
+			q.Path = absPath
+		}
+		var err error
+		if q.Since, err = parseAuditTime(mcp.ParseString(request, "since", "")); err != nil {
+			return nil, err
+		}
+		if q.Until, err = parseAuditTime(mcp.ParseString(request, "until", "")); err != nil {
+			return nil, err
+		}
+		entries, err := filesys.QueryAudit(q)
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(entries)
+	}
+}
+
+// 解析RFC 3339时间或距现在的时长
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339 (2024-01-02T15:04:05Z) or a duration such as 1h", value)
+}
+
+// 工具处理中间件，把每次调用写入审计日志。审计日志未启用时直接调用
+func AuditToolCalls(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !filesys.AuditEnabled() {
+			return next(ctx, request)
+		}
+		start := time.Now()
+		result, err := next(ctx, request)
+
+		entry := &filesys.AuditEntry{
+			Time:       start.UTC(),
+			Tool:       request.Params.Name,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			entry.Session = session.SessionID()
+		}
+		if len(request.Params.Arguments) > 0 {
+			entry.Arguments = redactAuditArguments(request.Params.Arguments)
+			entry.Paths = auditPaths(request.Params.Arguments, nil)
+			sort.Strings(entry.Paths)
+		}
+		switch {
+		case err != nil:
+			entry.Result = "failed"
+			entry.Error = err.Error()
+		case result != nil && result.IsError:
+			entry.Result = "error"
+		default:
+			entry.Result = "ok"
+		}
+		if result != nil {
+			if data, jerr := json.Marshal(result.Content); jerr == nil {
+				sum := sha256.Sum256(data)
+				entry.ResultBytes = len(data)
+				entry.ResultSHA256 = hex.EncodeToString(sum[:])
+			}
+			if result.IsError {
+				for _, c := range result.Content {
+					if text, ok := c.(mcp.TextContent); ok {
+						entry.Error = text.Text
+						break
+					}
+				}
+			}
+		}
+		if werr := filesys.WriteAudit(entry); werr != nil {
+			log.Printf("Failed to write audit log: %v", werr)
+		}
+		return result, err
+	}
+}
+
+// 复制参数，文件内容和过长的字符串替换为长度和SHA-256
+func redactAuditArguments(args map[string]any) map[string]any {
+	out := make(map[string]any, len(args))
+	for key, value := range args {
+		out[key] = redactAuditValue(key, value)
+	}
+	return out
+}
+
+func redactAuditValue(key string, value any) any {
+	switch v := value.(type) {
+	case string:
+		if auditRedactedArguments[key] || len(v) > auditMaxArgumentLength {
+			sum := sha256.Sum256([]byte(v))
+			return map[string]any{"redacted": true, "bytes": len(v), "sha256": hex.EncodeToString(sum[:])}
+		}
+		return v
+	case map[string]any:
+		return redactAuditArguments(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = redactAuditValue(key, item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// 收集参数（包括批量操作）中的路径并解析为绝对路径，无法解析的路径忽略
+func auditPaths(args map[string]any, paths []string) []string {
+	for key, value := range args {
+		switch v := value.(type) {
+		case string:
+			if auditPathArguments[key] && v != "" {
+				paths = appendAuditPath(paths, v)
+			}
+		case map[string]any:
+			paths = auditPaths(v, paths)
+		case []any:
+			for _, item := range v {
+				switch it := item.(type) {
+				case string:
+					if auditPathArguments[key] && it != "" {
+						paths = appendAuditPath(paths, it)
+					}
+				case map[string]any:
+					paths = auditPaths(it, paths)
+				}
+			}
+		}
+	}
+	return paths
+}
+
+func appendAuditPath(paths []string, target string) []string {
+	absPath, err := filesys.ResolvePath(target)
+	if err != nil {
+		return paths
+	}
+	for _, p := range paths {
+		if p == absPath {
+			return paths
+		}
+	}
+	return append(paths, absPath)
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactAuditArguments(t *testing.T) {
+	long := strings.Repeat("x", auditMaxArgumentLength+1)
+	tests := []struct {
+		name     string
+		args     map[string]any
+		redacted []string
+		kept     []string
+	}{
+		{
+			name:     "replace_file_content",
+			args:     map[string]any{"file": "a.txt", "content": "old secret", "newcontent": "new secret"},
+			redacted: []string{"content", "newcontent"},
+			kept:     []string{"file"},
+		},
+		{
+			name:     "long argument",
+			args:     map[string]any{"file": "a.txt", "pattern": long},
+			redacted: []string{"pattern"},
+			kept:     []string{"file"},
+		},
+		{
+			name: "short argument",
+			args: map[string]any{"pattern": "*.go"},
+			kept: []string{"pattern"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := redactAuditArguments(tt.args)
+			for _, key := range tt.redacted {
+				m, ok := out[key].(map[string]any)
+				if !ok || m["redacted"] != true || m["bytes"] != len(tt.args[key].(string)) {
+					t.Errorf("%s was not redacted: %v", key, out[key])
+				}
+			}
+			for _, key := range tt.kept {
+				if out[key] != tt.args[key] {
+					t.Errorf("%s = %v, want %v", key, out[key], tt.args[key])
+				}
+			}
+		})
+	}
+}
+
+func TestRedactAuditArgumentsNested(t *testing.T) {
+	// edit_lines 和 batch_operations 的操作列表中的内容同样要隐去
+	args := map[string]any{
+		"file": "a.txt",
+		"edits": []any{
+			map[string]any{"op": "replace_match", "match": "password=hunter2", "content": "password=***"},
+		},
+	}
+	out := redactAuditArguments(args)
+	edit := out["edits"].([]any)[0].(map[string]any)
+	for _, key := range []string{"match", "content"} {
+		if m, ok := edit[key].(map[string]any); !ok || m["redacted"] != true {
+			t.Errorf("edits[0].%s was not redacted: %v", key, edit[key])
+		}
+	}
+	if edit["op"] != "replace_match" {
+		t.Errorf("edits[0].op = %v", edit["op"])
+	}
+}
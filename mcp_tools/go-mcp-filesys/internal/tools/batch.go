@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 创建一个工具，用于以事务方式执行一组文件操作
+func BatchOperationsTool() mcp.Tool {
+	return mcp.NewTool("batch_operations",
+		mcp.WithDescription("Run an ordered list of file operations as a single transaction. Every step is validated against the state left by the previous steps and new content is staged in a temporary area; nothing is written unless all steps are valid, and if a step fails while committing the completed steps are rolled back. Returns a per-step report"),
+		mcp.WithArray("operations",
+			mcp.Required(),
+			mcp.Description("Operations to run in order. op is one of create, write, append, replace, delete, mkdir, rmdir (using path) or move, copy (using from and to)"),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"op": map[string]any{
+						"type": "string",
+						"enum": []string{
+							filesys.BatchCreate, filesys.BatchWrite, filesys.BatchAppend, filesys.BatchReplace,
+							filesys.BatchDelete, filesys.BatchMkdir, filesys.BatchRmdir, filesys.BatchMove, filesys.BatchCopy,
+						},
+					},
+					"path":    map[string]any{"type": "string", "description": "Target path for create, write, append, replace, delete, mkdir and rmdir"},
+					"from":    map[string]any{"type": "string", "description": "Source path for move and copy"},
+					"to":      map[string]any{"type": "string", "description": "Destination path for move and copy, must not exist"},
+					"content": map[string]any{"type": "string", "description": "Content for create, write and append"},
+					"old":     map[string]any{"type": "string", "description": "Content to replace, must occur in the file"},
+					"new":     map[string]any{"type": "string", "description": "Replacement content"},
+				},
+				"required": []string{"op"},
+			}),
+		),
+		mcp.WithBoolean("dryRun",
+			mcp.Description("Only validate the operations and report the result without changing any file"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func BatchOperationsToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ops, err := parseBatchOperations(request.Params.Arguments["operations"])
+		if err != nil {
+			return nil, err
+		}
+		result, err := filesys.ApplyBatch(ops, filesys.BatchOptions{
+			DryRun: mcp.ParseBoolean(request, "dryRun", false),
+		})
+		if err != nil {
+			return nil, err
+		}
+		jsonResponse, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		return mcp.NewToolResultText(string(jsonResponse)), nil
+	}
+}
+
+// 解析操作列表，接受数组或JSON字符串
+func parseBatchOperations(value any) ([]filesys.BatchOperation, error) {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return nil, fmt.Errorf("no operations provided")
+	case string:
+		data = []byte(v)
+	default:
+		var err error
+		data, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid operations: %w", err)
+		}
+	}
+	var ops []filesys.BatchOperation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, fmt.Errorf("invalid operations: %w", err)
+	}
+	return ops, nil
+}
@@ -0,0 +1,239 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go-mcp-filesys/internal/filesys"
+	"go-mcp-filesys/internal/resources"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 创建一个工具，用于以base64读取二进制文件
+func ReadFileBinaryTool() mcp.Tool {
+	return mcp.NewTool("read_file_binary",
+		mcp.WithDescription(fmt.Sprintf("Read a file as base64 without any text conversion, for images, PDFs and other binary files. Returns at most %d bytes per call together with the file size, MIME type, the SHA-256 of the returned bytes and whether the end of the file was reached; use offset to read the rest", filesys.MaxBinaryChunkBytes)),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("The file to read"),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Byte offset to start reading from"),
+			mcp.DefaultNumber(0),
+		),
+		mcp.WithNumber("length",
+			mcp.Description("Number of bytes to read, 0 means as much as allowed"),
+			mcp.DefaultNumber(0),
+		),
+		mcp.WithBoolean("asResource",
+			mcp.Description("Also return the bytes as an embedded blob resource"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// 创建一个工具，用于写入base64编码的二进制内容
+func WriteFileBinaryTool() mcp.Tool {
+	return mcp.NewTool("write_file_binary",
+		mcp.WithDescription(fmt.Sprintf("Write base64 encoded content to a file byte for byte. Content is limited to %d bytes; use begin_upload for larger files", filesys.MaxBinaryChunkBytes)),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("The file to write"),
+		),
+		mcp.WithString("data",
+			mcp.Required(),
+			mcp.Description("The content encoded as base64, a data: URL is also accepted"),
+		),
+		mcp.WithBoolean("overwrite",
+			mcp.Description("Replace the file if it already exists"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithString("sha256",
+			mcp.Description("Expected SHA-256 of the decoded content; the file is not written if it does not match"),
+		),
+	)
+}
+
+// 创建一个工具，用于开始分块上传
+func BeginUploadTool() mcp.Tool {
+	return mcp.NewTool("begin_upload",
+		mcp.WithDescription(fmt.Sprintf("Start a chunked upload of a large binary file (up to %d bytes). Returns an upload_id; send the content with upload_chunk and complete it with finish_upload, which verifies the SHA-256 before the file is written. Idle uploads expire after %s", filesys.MaxUploadBytes, filesys.UploadSessionTTL)),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("The file to create"),
+		),
+		mcp.WithNumber("size",
+			mcp.Description("Total size of the file in bytes, if known"),
+		),
+		mcp.WithString("sha256",
+			mcp.Description("Expected SHA-256 of the whole file, can also be given to finish_upload"),
+		),
+		mcp.WithBoolean("overwrite",
+			mcp.Description("Replace the file if it already exists"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// 创建一个工具，用于上传一个分块
+func UploadChunkTool() mcp.Tool {
+	return mcp.NewTool("upload_chunk",
+		mcp.WithDescription(fmt.Sprintf("Send one base64 encoded chunk of an upload, at most %d bytes. offset must not be beyond the bytes received so far; sending an earlier offset again replaces that part", filesys.MaxBinaryChunkBytes)),
+		mcp.WithString("uploadId",
+			mcp.Required(),
+			mcp.Description("The upload_id returned by begin_upload"),
+		),
+		mcp.WithNumber("offset",
+			mcp.Required(),
+			mcp.Description("Byte offset of this chunk in the file"),
+		),
+		mcp.WithString("data",
+			mcp.Required(),
+			mcp.Description("The chunk encoded as base64"),
+		),
+	)
+}
+
+// 创建一个工具，用于完成分块上传
+func FinishUploadTool() mcp.Tool {
+	return mcp.NewTool("finish_upload",
+		mcp.WithDescription("Complete a chunked upload: verify the size and SHA-256 of the received content and move it into place. On a checksum mismatch the upload is kept so chunks can be sent again"),
+		mcp.WithString("uploadId",
+			mcp.Required(),
+			mcp.Description("The upload_id returned by begin_upload"),
+		),
+		mcp.WithString("sha256",
+			mcp.Description("SHA-256 of the whole file, required unless given to begin_upload"),
+		),
+	)
+}
+
+// 创建一个工具，用于取消分块上传
+func CancelUploadTool() mcp.Tool {
+	return mcp.NewTool("cancel_upload",
+		mcp.WithDescription("Cancel a chunked upload and discard the received content"),
+		mcp.WithString("uploadId",
+			mcp.Required(),
+			mcp.Description("The upload_id returned by begin_upload"),
+		),
+	)
+}
+
+// 创建一个工具，用于列出进行中的上传
+func ListUploadsTool() mcp.Tool {
+	return mcp.NewTool("list_uploads",
+		mcp.WithDescription("List chunked uploads in progress with the number of bytes received, so an interrupted upload can be resumed"),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func ReadFileBinaryToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		file, _ := request.Params.Arguments["file"].(string)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
+		}
+		chunk, err := filesys.ReadFileBinary(absFile,
+			mcp.ParseInt64(request, "offset", 0),
+			mcp.ParseInt(request, "length", 0),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if mcp.ParseBoolean(request, "asResource", false) {
+			blob := mcp.BlobResourceContents{URI: resources.FileURI(absFile), MIMEType: chunk.MIMEType, Blob: chunk.Data}
+			chunk.Data = ""
+			jsonResponse, err := json.Marshal(chunk)
+			if err != nil {
+				return nil, fmt.Errorf("failed to serialize response: %w", err)
+			}
+			return mcp.NewToolResultResource(string(jsonResponse), blob), nil
+		}
+		return jsonResult(chunk)
+	}
+}
+
+func WriteFileBinaryToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		file, _ := request.Params.Arguments["file"].(string)
+		absFile, err := filesys.ResolvePath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
+		}
+		data, _ := request.Params.Arguments["data"].(string)
+		result, err := filesys.WriteFileBinary(absFile, data,
+			mcp.ParseBoolean(request, "overwrite", false),
+			mcp.ParseString(request, "sha256", ""),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(result)
+	}
+}
+
+func BeginUploadToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		file, _ := request.Params.Arguments["file"].(string)
+		absFile, err := filesys.ResolvePath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
+		}
+		status, err := filesys.BeginUpload(absFile,
+			mcp.ParseInt64(request, "size", 0),
+			mcp.ParseString(request, "sha256", ""),
+			mcp.ParseBoolean(request, "overwrite", false),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(status)
+	}
+}
+
+func UploadChunkToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		data, _ := request.Params.Arguments["data"].(string)
+		status, err := filesys.UploadChunk(
+			mcp.ParseString(request, "uploadId", ""),
+			mcp.ParseInt64(request, "offset", 0),
+			data,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(status)
+	}
+}
+
+func FinishUploadToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := filesys.FinishUpload(
+			mcp.ParseString(request, "uploadId", ""),
+			mcp.ParseString(request, "sha256", ""),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(result)
+	}
+}
+
+func CancelUploadToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id := mcp.ParseString(request, "uploadId", "")
+		if err := filesys.CancelUpload(id); err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("upload %s cancelled", id)), nil
+	}
+}
+
+func ListUploadsToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return jsonResult(filesys.ListUploads())
+	}
+}
@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 创建一个工具，用于查询CSV等表格文件
+func QueryCSVTool() mcp.Tool {
+	return mcp.NewTool("query_csv",
+		mcp.WithDescription(fmt.Sprintf("Query a CSV or TSV file without reading it as text. Column types (integer, number, boolean, date, string) are inferred from the data; rows can be filtered, sorted, grouped with aggregates and limited. Returns the columns with their types and the rows as JSON objects, at most %d rows per call", filesys.MaxCSVLimit)),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("The CSV or TSV file to query"),
+		),
+		mcp.WithArray("columns",
+			mcp.Description("Columns to return, all columns if omitted. Ignored when grouping"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithArray("filters",
+			mcp.Description("Conditions that must all match, each written as \"column operator value\", e.g. \"age >= 30\" or \"city contains york\". Operators: =, !=, >, >=, <, <=, contains, not contains, startswith, endswith, is empty, is not empty. Comparisons use the column type; text matching ignores case"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithArray("groupBy",
+			mcp.Description("Columns to group rows by"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithArray("aggregates",
+			mcp.Description("Aggregates per group: count, count(column), count_distinct(column), sum(column), avg(column), min(column), max(column). Defaults to count when grouping"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithArray("sortBy",
+			mcp.Description("Sort keys, \"column\" for ascending and \"-column\" or \"column desc\" for descending. Aggregates can be sorted by name, e.g. \"-sum(amount)\""),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of rows to return"),
+			mcp.DefaultNumber(filesys.DefaultCSVLimit),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Number of result rows to skip"),
+			mcp.DefaultNumber(0),
+		),
+		mcp.WithString("delimiter",
+			mcp.Description("Field delimiter, e.g. \",\", \";\" or \"tab\". Detected from the file if omitted"),
+		),
+		mcp.WithBoolean("header",
+			mcp.Description("Whether the first row contains column names; otherwise columns are named column1, column2 and so on"),
+			mcp.DefaultBool(true),
+		),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func QueryCSVToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		file, _ := request.Params.Arguments["file"].(string)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
+		}
+		result, err := filesys.QueryCSV(absFile, filesys.CSVQueryOptions{
+			Delimiter:  mcp.ParseString(request, "delimiter", ""),
+			NoHeader:   !mcp.ParseBoolean(request, "header", true),
+			Columns:    parseStringList(request, "columns"),
+			Filters:    parseStringList(request, "filters"),
+			GroupBy:    parseStringList(request, "groupBy"),
+			Aggregates: parseStringList(request, "aggregates"),
+			SortBy:     parseStringList(request, "sortBy"),
+			Limit:      mcp.ParseInt(request, "limit", filesys.DefaultCSVLimit),
+			Offset:     mcp.ParseInt(request, "offset", 0),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s: %w", file, err)
+		}
+		return jsonResult(result)
+	}
+}
@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 创建一个工具，用于比较两个文件或文件与给定内容的差异
+func DiffFilesTool() mcp.Tool {
+	return mcp.NewTool("diff_files",
+		mcp.WithDescription("Show the differences between two files, or between a file and proposed content, without changing anything. Returns a unified or side-by-side diff plus a summary of added and removed lines and the number of hunks. Files are compared after decoding their encoding, so UTF-16/GBK files and CRLF line endings compare by content"),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("The original file (the old side of the diff)"),
+		),
+		mcp.WithString("other",
+			mcp.Description("The file to compare against (the new side). Either other or content must be given"),
+		),
+		mcp.WithString("content",
+			mcp.Description("Proposed new content to compare the file against, e.g. before calling write_file or edit_file"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format"),
+			mcp.Enum(filesys.DiffUnified, filesys.DiffSideBySide),
+			mcp.DefaultString(filesys.DiffUnified),
+		),
+		mcp.WithNumber("context",
+			mcp.Description("Number of unchanged lines to show around each change"),
+			mcp.DefaultNumber(filesys.DefaultDiffContext),
+		),
+		mcp.WithString("whitespace",
+			mcp.Description("Whitespace differences to ignore: none, trailing (end of line), change (amount of whitespace) or all"),
+			mcp.Enum("none", filesys.WhitespaceTrailing, filesys.WhitespaceChange, filesys.WhitespaceAll),
+			mcp.DefaultString("none"),
+		),
+		mcp.WithNumber("width",
+			mcp.Description("Width in characters of each column in the side-by-side format (10-500); longer lines are truncated"),
+			mcp.DefaultNumber(filesys.DefaultDiffWidth),
+		),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func DiffFilesToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		file := mcp.ParseString(request, "file", "")
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
+		}
+		opts := filesys.DiffOptions{
+			Format:     mcp.ParseString(request, "format", filesys.DiffUnified),
+			Context:    mcp.ParseInt(request, "context", filesys.DefaultDiffContext),
+			Whitespace: mcp.ParseString(request, "whitespace", ""),
+			Width:      mcp.ParseInt(request, "width", filesys.DefaultDiffWidth),
+		}
+
+		other := mcp.ParseString(request, "other", "")
+		content, hasContent := request.Params.Arguments["content"].(string)
+		var result *filesys.DiffResult
+		switch {
+		case other != "" && hasContent:
+			return nil, fmt.Errorf("specify either other or content, not both")
+		case other != "":
+			absOther, err := filesys.ResolveExistingPath(other)
+			if err != nil {
+				return nil, fmt.Errorf("%s file is not allowed: %w", other, err)
+			}
+			result, err = filesys.DiffFiles(absFile, absOther, opts)
+			if err != nil {
+				return nil, err
+			}
+		case hasContent:
+			result, err = filesys.DiffFileContent(absFile, content, opts)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("either other or content is required")
+		}
+		return jsonResult(result)
+	}
+}
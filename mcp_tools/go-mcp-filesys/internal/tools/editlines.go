@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 创建一个工具，用于按行编辑文件
+func EditLinesTool() mcp.Tool {
+	return mcp.NewTool("edit_lines",
+		mcp.WithDescription("Apply a list of line-based edits to a file in one atomic write and return a unified diff of what changed. All line numbers refer to the file before any edit (as returned by read_file), so edits do not shift each other; overlapping edits are rejected and nothing is written. The file keeps its encoding and line endings"),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("The file to edit"),
+		),
+		mcp.WithArray("edits",
+			mcp.Required(),
+			mcp.Description("Edits to apply. op is insert_before/insert_after (line, content), delete (start, end), replace (start, end, content) or replace_match (match, content, optional regex and occurrence)"),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"op": map[string]any{
+						"type": "string",
+						"enum": []string{
+							filesys.LineInsertBefore, filesys.LineInsertAfter, filesys.LineDelete,
+							filesys.LineReplace, filesys.LineReplaceMatch,
+						},
+					},
+					"line":       map[string]any{"type": "integer", "description": "Line to insert before or after; insert_after 0 inserts at the top, insert_before last+1 appends"},
+					"start":      map[string]any{"type": "integer", "description": "First line to delete or replace"},
+					"end":        map[string]any{"type": "integer", "description": "Last line to delete or replace (inclusive), defaults to start"},
+					"content":    map[string]any{"type": "string", "description": "Lines to insert, the replacement lines, or the replacement text for replace_match (may use $1 for regex groups)"},
+					"match":      map[string]any{"type": "string", "description": "String or regular expression to find for replace_match; may span lines"},
+					"regex":      map[string]any{"type": "boolean", "description": "Treat match as a Go regular expression"},
+					"occurrence": map[string]any{"type": "integer", "description": "Which occurrence of match to replace, starting at 1 (default 1)"},
+				},
+				"required": []string{"op"},
+			}),
+		),
+		mcp.WithBoolean("dryRun",
+			mcp.Description("Only compute and return the diff without changing the file"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithString("expected_version",
+			mcp.Description(expectedVersionDescription),
+		),
+		mcp.WithString("encoding",
+			mcp.Description(encodingDescription),
+		),
+		mcp.WithString("line_ending",
+			mcp.Description(lineEndingDescription),
+		),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func EditLinesToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		file := mcp.ParseString(request, "file", "")
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
+		}
+		edits, err := parseLineEdits(request.Params.Arguments["edits"])
+		if err != nil {
+			return nil, err
+		}
+		text, err := parseTextOptions(request)
+		if err != nil {
+			return nil, err
+		}
+		result, err := filesys.EditLines(absFile, edits, filesys.EditLinesOptions{
+			ExpectedVersion: mcp.ParseString(request, "expected_version", ""),
+			DryRun:          mcp.ParseBoolean(request, "dryRun", false),
+			Text:            text,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(result)
+	}
+}
+
+// 解析编辑列表，接受数组或JSON字符串
+func parseLineEdits(value any) ([]filesys.LineEdit, error) {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return nil, fmt.Errorf("no edits provided")
+	case string:
+		data = []byte(v)
+	default:
+		var err error
+		data, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid edits: %w", err)
+		}
+	}
+	var edits []filesys.LineEdit
+	if err := json.Unmarshal(data, &edits); err != nil {
+		return nil, fmt.Errorf("invalid edits: %w", err)
+	}
+	return edits, nil
+}
@@ -0,0 +1,112 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 创建一个工具，用于列出文件操作历史
+func ListHistoryTool() mcp.Tool {
+	return mcp.NewTool("list_history",
+		mcp.WithDescription("List recorded file operations, newest first. Every mutating tool call stores the previous content and metadata of the paths it touches so it can be undone"),
+		mcp.WithString("path",
+			mcp.Description("Only list operations that touched this file or anything inside this directory"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entries to return"),
+			mcp.DefaultNumber(20),
+		),
+	)
+}
+
+// 创建一个工具，用于撤销最近一次文件操作
+func UndoLastTool() mcp.Tool {
+	return mcp.NewTool("undo_last",
+		mcp.WithDescription("Undo the most recent file operation that has not been undone yet, restoring the previous content, permissions and location of every path it touched. Refuses when a path was changed again after the operation unless force is set"),
+		mcp.WithBoolean("force",
+			mcp.Description("Undo even if the affected paths were modified after the operation"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// 创建一个工具，用于从操作历史中恢复单个文件
+func RestoreFileTool() mcp.Tool {
+	return mcp.NewTool("restore_file",
+		mcp.WithDescription("Restore a single file or directory to the state it had before a recorded operation"),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("The path to restore"),
+		),
+		mcp.WithString("id",
+			mcp.Description("History entry id from list_history; defaults to the newest entry that touched the path"),
+		),
+		mcp.WithBoolean("force",
+			mcp.Description("Restore even if the path was modified after the operation"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func ListHistoryToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		path, _ := request.Params.Arguments["path"].(string)
+		absPath := ""
+		if path != "" {
+			var err error
+			absPath, err = filesys.ResolvePath(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s path is not allowed: %w", path, err)
+			}
+		}
+		entries := filesys.ListHistory(absPath, mcp.ParseInt(request, "limit", 20))
+		jsonResponse, err := json.Marshal(entries)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		return mcp.NewToolResultText(string(jsonResponse)), nil
+	}
+}
+
+func UndoLastToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		entry, err := filesys.UndoLast(mcp.ParseBoolean(request, "force", false))
+		if err != nil {
+			return nil, err
+		}
+		jsonResponse, err := json.Marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		return mcp.NewToolResultText(string(jsonResponse)), nil
+	}
+}
+
+func RestoreFileToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		path, _ := request.Params.Arguments["path"].(string)
+		if path == "" {
+			return nil, fmt.Errorf("no path provided")
+		}
+		absPath, err := filesys.ResolvePath(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s path is not allowed: %w", path, err)
+		}
+		id, _ := request.Params.Arguments["id"].(string)
+		entry, err := filesys.RestoreFile(absPath, id, mcp.ParseBoolean(request, "force", false))
+		if err != nil {
+			return nil, err
+		}
+		jsonResponse, err := json.Marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		return mcp.NewToolResultText(string(jsonResponse)), nil
+	}
+}
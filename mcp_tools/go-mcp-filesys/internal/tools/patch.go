@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 创建一个工具，用于应用unified diff补丁
+func ApplyPatchTool() mcp.Tool {
+	return mcp.NewTool("apply_patch",
+		mcp.WithDescription("Apply a unified diff (one or more files) to files in the allowed folder. Several sections for the same file are applied in order. Hunks are matched against the current content with context/fuzz matching; if any hunk is rejected nothing is written and the per-hunk report explains why, including the actual content found at the expected location"),
+		mcp.WithString("patch",
+			mcp.Required(),
+			mcp.Description("The unified diff to apply, with ---/+++ file headers and @@ hunk headers. Use /dev/null as the old path to create a file and as the new path to delete one"),
+		),
+		mcp.WithString("directory",
+			mcp.Description("The directory that paths in the patch are relative to"),
+			mcp.DefaultString("."),
+		),
+		mcp.WithBoolean("dryRun",
+			mcp.Description("Only validate the patch and report the result without writing any file"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithNumber("fuzz",
+			mcp.Description("Maximum number of leading/trailing context lines that may be ignored when matching a hunk"),
+			mcp.DefaultNumber(filesys.DefaultPatchFuzz),
+		),
+		mcp.WithNumber("strip",
+			mcp.Description("Number of leading path components to strip from file names, -1 detects git style a/ b/ prefixes automatically"),
+			mcp.DefaultNumber(-1),
+		),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func ApplyPatchToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		patch, _ := request.Params.Arguments["patch"].(string)
+		if patch == "" {
+			return nil, fmt.Errorf("no patch provided")
+		}
+		directory, _ := request.Params.Arguments["directory"].(string)
+		absDirectory, err := filesys.ResolveExistingPath(directory)
+		if err != nil {
+			return nil, fmt.Errorf("%s directory is not allowed: %w", directory, err)
+		}
+		opts := filesys.PatchOptions{
+			DryRun:  mcp.ParseBoolean(request, "dryRun", false),
+			MaxFuzz: mcp.ParseInt(request, "fuzz", filesys.DefaultPatchFuzz),
+			Strip:   mcp.ParseInt(request, "strip", -1),
+		}
+		result, err := filesys.ApplyPatch(absDirectory, patch, opts)
+		if err != nil {
+			return nil, err
+		}
+		jsonResponse, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		return mcp.NewToolResultText(string(jsonResponse)), nil
+	}
+}
@@ -0,0 +1,153 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 每个工具所需的操作类别，权限配置据此决定注册哪些工具。
+// 新增工具时需要在这里登记，未登记的工具被视为禁用
+var toolOperations = map[string]filesys.Operation{
+	"list_allowed_roots":       filesys.OperationRead,
+	"list_files_in_directory":  filesys.OperationRead,
+	"read_file":                filesys.OperationRead,
+	"find_file":                filesys.OperationRead,
+	"count_files_in_directory": filesys.OperationRead,
+	"disk_usage":               filesys.OperationRead,
+	"stat_file":                filesys.OperationRead,
+	"stat_files":               filesys.OperationRead,
+	"list_archive":             filesys.OperationRead,
+	"read_file_binary":         filesys.OperationRead,
+	"list_uploads":             filesys.OperationRead,
+	"structured_get":           filesys.OperationRead,
+	"query_csv":                filesys.OperationRead,
+	"list_history":             filesys.OperationRead,
+	"get_quota":                filesys.OperationRead,
+	"audit_query":              filesys.OperationRead,
+	"diff_files":               filesys.OperationRead,
+
+	"write_file":           filesys.OperationWrite,
+	"replace_file_content": filesys.OperationWrite,
+	"create_new_file":      filesys.OperationWrite,
+	"append_file_content":  filesys.OperationWrite,
+	"edit_file":            filesys.OperationWrite,
+	"edit_lines":           filesys.OperationWrite,
+	"apply_patch":          filesys.OperationWrite,
+	"batch_operations":     filesys.OperationWrite,
+	"undo_last":            filesys.OperationWrite,
+	"restore_file":         filesys.OperationWrite,
+	"create_archive":       filesys.OperationWrite,
+	"extract_archive":      filesys.OperationWrite,
+	"write_file_binary":    filesys.OperationWrite,
+	"begin_upload":         filesys.OperationWrite,
+	"upload_chunk":         filesys.OperationWrite,
+	"finish_upload":        filesys.OperationWrite,
+	"cancel_upload":        filesys.OperationWrite,
+	"structured_set":       filesys.OperationWrite,
+	"structured_delete":    filesys.OperationWrite,
+	"structured_merge":     filesys.OperationWrite,
+	"move_file":            filesys.OperationWrite,
+	"copy_file":            filesys.OperationWrite,
+	"create_directory":     filesys.OperationWrite,
+	"move_directory":       filesys.OperationWrite,
+	"copy_directory":       filesys.OperationWrite,
+
+	"delete_file":                  filesys.OperationDelete,
+	"delete_directory":             filesys.OperationDelete,
+	"change_file_permissions":      filesys.OperationChmod,
+	"change_directory_permissions": filesys.OperationChmod,
+}
+
+// 工具的启用规则：权限配置允许的工具，加上allow中的工具，再去掉deny中的工具
+type Permissions struct {
+	Profile filesys.PermissionProfile
+	allow   map[string]bool
+	deny    map[string]bool
+}
+
+// 创建启用规则，allow和deny中的工具名称必须存在
+func NewPermissions(profile filesys.PermissionProfile, allow []string, deny []string) (*Permissions, error) {
+	p := &Permissions{Profile: profile, allow: make(map[string]bool), deny: make(map[string]bool)}
+	for _, name := range allow {
+		if _, ok := toolOperations[name]; !ok {
+			return nil, fmt.Errorf("unknown tool in allow list: %s", name)
+		}
+		p.allow[name] = true
+	}
+	for _, name := range deny {
+		if _, ok := toolOperations[name]; !ok {
+			return nil, fmt.Errorf("unknown tool in deny list: %s", name)
+		}
+		p.deny[name] = true
+	}
+	return p, nil
+}
+
+// 工具是否启用
+func (p *Permissions) Enabled(name string) bool {
+	op, ok := toolOperations[name]
+	if !ok || p.deny[name] {
+		return false
+	}
+	if p.allow[name] {
+		return true
+	}
+	for _, allowed := range filesys.ProfileOperations(p.Profile) {
+		if op == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// 被allow单独启用的工具所需的操作类别，需要同时在filesys中允许。
+// 这些类别只作用于该工具本身，例如单独启用delete_file后batch_operations中的rm和apply_patch中的删除仍然被拒绝
+func (p *Permissions) ExtraOperations() []filesys.Operation {
+	ops := make([]filesys.Operation, 0)
+	for name := range p.allow {
+		ops = append(ops, toolOperations[name])
+	}
+	return ops
+}
+
+// 被禁用工具的处理函数，返回说明禁用原因和启用方法的错误
+func (p *Permissions) RejectHandle(name string) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if p.deny[name] {
+			return nil, fmt.Errorf("tool %s is disabled by the server's deny list", name)
+		}
+		return nil, fmt.Errorf("tool %s needs %s permission, which the %s permission profile does not grant; the server must be started with -allow-tool %s or a broader -profile", name, toolOperations[name], p.Profile, name)
+	}
+}
+
+// 从工具列表中去掉被禁用的工具。被禁用的工具仍然注册为RejectHandle，
+// 客户端直接调用时得到说明原因的错误，而不是工具不存在
+func (p *Permissions) RegisterHooks(hooks *server.Hooks) {
+	hooks.AddAfterListTools(func(ctx context.Context, id any, message *mcp.ListToolsRequest, result *mcp.ListToolsResult) {
+		enabled := result.Tools[:0]
+		for _, tool := range result.Tools {
+			if p.Enabled(tool.Name) {
+				enabled = append(enabled, tool)
+			}
+		}
+		result.Tools = enabled
+	})
+}
+
+// 被禁用的工具，按名称排序
+func (p *Permissions) Disabled() []string {
+	names := make([]string, 0)
+	for name := range toolOperations {
+		if !p.Enabled(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-mcp-filesys/internal/filesys"
+)
+
+func TestPermissionsEnabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile filesys.PermissionProfile
+		allow   []string
+		deny    []string
+		enabled []string
+		// 被禁用的工具
+		disabled []string
+	}{
+		{
+			name:     "read-only",
+			profile:  filesys.ProfileReadOnly,
+			enabled:  []string{"read_file", "list_files_in_directory", "query_csv", "audit_query"},
+			disabled: []string{"write_file", "batch_operations", "apply_patch", "delete_file", "change_file_permissions"},
+		},
+		{
+			name:     "read-write",
+			profile:  filesys.ProfileReadWrite,
+			enabled:  []string{"read_file", "write_file", "batch_operations", "apply_patch", "move_file"},
+			disabled: []string{"delete_file", "delete_directory", "change_file_permissions", "change_directory_permissions"},
+		},
+		{
+			name:    "full",
+			profile: filesys.ProfileFull,
+			enabled: []string{"read_file", "write_file", "delete_file", "delete_directory", "change_file_permissions"},
+		},
+		{
+			name:     "allow a single tool",
+			profile:  filesys.ProfileReadWrite,
+			allow:    []string{"delete_file"},
+			enabled:  []string{"delete_file", "write_file"},
+			disabled: []string{"delete_directory", "change_file_permissions"},
+		},
+		{
+			name:     "deny wins over profile",
+			profile:  filesys.ProfileFull,
+			deny:     []string{"delete_directory", "read_file"},
+			enabled:  []string{"delete_file", "list_files_in_directory"},
+			disabled: []string{"delete_directory", "read_file"},
+		},
+		{
+			name:     "deny wins over allow",
+			profile:  filesys.ProfileReadOnly,
+			allow:    []string{"write_file"},
+			deny:     []string{"write_file"},
+			disabled: []string{"write_file"},
+		},
+		{
+			name:     "unregistered tool",
+			profile:  filesys.ProfileFull,
+			disabled: []string{"no_such_tool"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPermissions(tt.profile, tt.allow, tt.deny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.enabled {
+				if !p.Enabled(name) {
+					t.Errorf("%s disabled, want enabled", name)
+				}
+			}
+			for _, name := range tt.disabled {
+				if p.Enabled(name) {
+					t.Errorf("%s enabled, want disabled", name)
+				}
+			}
+			for _, name := range p.Disabled() {
+				if p.Enabled(name) {
+					t.Errorf("%s listed as disabled but enabled", name)
+				}
+			}
+		})
+	}
+}
+
+func TestNewPermissionsRejectsUnknownTools(t *testing.T) {
+	if _, err := NewPermissions(filesys.ProfileFull, []string{"delete_everything"}, nil); err == nil || !strings.Contains(err.Error(), "allow list") {
+		t.Errorf("unknown allowed tool: got %v", err)
+	}
+	if _, err := NewPermissions(filesys.ProfileFull, nil, []string{"delete_everything"}); err == nil || !strings.Contains(err.Error(), "deny list") {
+		t.Errorf("unknown denied tool: got %v", err)
+	}
+}
+
+func TestPermissionsExtraOperations(t *testing.T) {
+	p, err := NewPermissions(filesys.ProfileReadWrite, []string{"delete_file"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.ExtraOperations(); !reflect.DeepEqual(got, []filesys.Operation{filesys.OperationDelete}) {
+		t.Errorf("extra operations = %v, want [delete]", got)
+	}
+	p, err = NewPermissions(filesys.ProfileReadOnly, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.ExtraOperations(); len(got) != 0 {
+		t.Errorf("extra operations = %v, want none", got)
+	}
+}
+
+func TestDisabledToolsAreSorted(t *testing.T) {
+	p, err := NewPermissions(filesys.ProfileReadOnly, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled := p.Disabled()
+	want := make([]string, 0)
+	for name, op := range toolOperations {
+		if op != filesys.OperationRead {
+			want = append(want, name)
+		}
+	}
+	if len(disabled) != len(want) {
+		t.Errorf("%d tools disabled, want %d", len(disabled), len(want))
+	}
+	for i := 1; i < len(disabled); i++ {
+		if disabled[i-1] >= disabled[i] {
+			t.Fatalf("disabled tools not sorted: %q", disabled)
+		}
+	}
+}
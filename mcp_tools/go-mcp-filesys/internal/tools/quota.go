@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 创建一个工具，用于查看配额和当前占用
+func GetQuotaTool() mcp.Tool {
+	return mcp.NewTool("get_quota",
+		mcp.WithDescription("Report the configured limits (max file size per write, max total bytes per root, max entries per directory, max result size per tool response; 0 means unlimited) and the current number of files and bytes under each root, with the remaining bytes when a root quota is set"),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func GetQuotaToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		report, err := filesys.GetQuota()
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(report)
+	}
+}
+
+// 工具处理中间件，限制单个响应的大小。只读工具的结果超出限制时返回错误；
+// 修改文件的工具此时已经完成了修改，返回错误会让调用方误以为失败而重试，
+// 因此把结果替换为说明修改已完成的简短文本
+func LimitResultSize(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, request)
+		if err != nil || result == nil {
+			return result, err
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		if err := filesys.CheckResultSize(len(data)); err != nil {
+			if op, ok := toolOperations[request.Params.Name]; result.IsError || (ok && op == filesys.OperationRead) {
+				return nil, fmt.Errorf("%s: %w", request.Params.Name, err)
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("%s completed successfully and its changes were applied, but the result was omitted: %v", request.Params.Name, err)), nil
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 创建一个工具，用于查看文件的元数据
+func StatFileTool() mcp.Tool {
+	return mcp.NewTool("stat_file",
+		mcp.WithDescription("Get metadata of a file or directory as JSON: type, size, mode and permissions, owner and group, modification and change times, symlink target, MIME type detected from the content, a text encoding guess, line count and optional SHA-256/MD5 checksums"),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("The file or directory to inspect"),
+		),
+		mcp.WithBoolean("countLines",
+			mcp.Description("Count the lines of text files"),
+			mcp.DefaultBool(true),
+		),
+		mcp.WithBoolean("sha256",
+			mcp.Description("Compute the SHA-256 checksum of the file"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithBoolean("md5",
+			mcp.Description("Compute the MD5 checksum of the file"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// 创建一个工具，用于批量查看多个文件的元数据
+func StatFilesTool() mcp.Tool {
+	return mcp.NewTool("stat_files",
+		mcp.WithDescription(fmt.Sprintf("Get metadata of up to %d files or directories at once, with the same fields as stat_file. A path that cannot be inspected gets an error field instead of failing the whole request", filesys.MaxStatPaths)),
+		mcp.WithArray("paths",
+			mcp.Required(),
+			mcp.Description("The files or directories to inspect"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithBoolean("countLines",
+			mcp.Description("Count the lines of text files"),
+			mcp.DefaultBool(true),
+		),
+		mcp.WithBoolean("sha256",
+			mcp.Description("Compute the SHA-256 checksum of each file"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithBoolean("md5",
+			mcp.Description("Compute the MD5 checksum of each file"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func StatFileToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		file, _ := request.Params.Arguments["file"].(string)
+		stat, err := filesys.StatFile(file, parseStatOptions(request))
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+		jsonResponse, err := json.Marshal(stat)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		return mcp.NewToolResultText(string(jsonResponse)), nil
+	}
+}
+
+func StatFilesToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		paths := parseStringList(request, "paths")
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no paths provided")
+		}
+		stats, err := filesys.StatFiles(paths, parseStatOptions(request))
+		if err != nil {
+			return nil, err
+		}
+		jsonResponse, err := json.Marshal(stats)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		return mcp.NewToolResultText(string(jsonResponse)), nil
+	}
+}
+
+func parseStatOptions(request mcp.CallToolRequest) filesys.StatOptions {
+	return filesys.StatOptions{
+		CountLines: mcp.ParseBoolean(request, "countLines", true),
+		SHA256:     mcp.ParseBoolean(request, "sha256", false),
+		MD5:        mcp.ParseBoolean(request, "md5", false),
+	}
+}
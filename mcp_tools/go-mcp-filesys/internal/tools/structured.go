@@ -0,0 +1,175 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go-mcp-filesys/internal/filesys"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const structuredPathDescription = "Location inside the document: a JSON Pointer such as /servers/0/port, or dotted keys such as servers[0].port. Empty means the whole document"
+
+// 创建一个工具，用于读取JSON/YAML/TOML文件中的值
+func StructuredGetTool() mcp.Tool {
+	return mcp.NewTool("structured_get",
+		mcp.WithDescription("Read a value from a JSON, YAML or TOML file by path and return it as JSON"),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("The JSON, YAML or TOML file to read"),
+		),
+		mcp.WithString("path",
+			mcp.Description(structuredPathDescription),
+		),
+		mcp.WithString("format",
+			mcp.Description("File format, detected from the extension if omitted"),
+			mcp.Enum(filesys.FormatJSON, filesys.FormatYAML, filesys.FormatTOML),
+		),
+	)
+}
+
+// 创建一个工具，用于设置JSON/YAML/TOML文件中的值
+func StructuredSetTool() mcp.Tool {
+	return mcp.NewTool("structured_set",
+		mcp.WithDescription("Set a value in a JSON, YAML or TOML file by path, creating missing parent objects. Key order is kept for all formats and comments are kept in YAML and TOML (except comments inside multi-line TOML arrays). The result is validated before the file is written"),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("The JSON, YAML or TOML file to modify"),
+		),
+		mcp.WithString("path",
+			mcp.Description(structuredPathDescription+". In arrays, - or the array length appends an element"),
+		),
+		mcp.WithString("value",
+			mcp.Required(),
+			mcp.Description("The new value as JSON, e.g. 8080, true, \"text\" or {\"a\": 1}"),
+		),
+		mcp.WithString("format",
+			mcp.Description("File format, detected from the extension if omitted"),
+			mcp.Enum(filesys.FormatJSON, filesys.FormatYAML, filesys.FormatTOML),
+		),
+		mcp.WithBoolean("dryRun",
+			mcp.Description("Return the modified content without writing the file"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// 创建一个工具，用于删除JSON/YAML/TOML文件中的值
+func StructuredDeleteTool() mcp.Tool {
+	return mcp.NewTool("structured_delete",
+		mcp.WithDescription("Delete a key or array element from a JSON, YAML or TOML file by path. The result is validated before the file is written"),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("The JSON, YAML or TOML file to modify"),
+		),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description(structuredPathDescription),
+		),
+		mcp.WithString("format",
+			mcp.Description("File format, detected from the extension if omitted"),
+			mcp.Enum(filesys.FormatJSON, filesys.FormatYAML, filesys.FormatTOML),
+		),
+		mcp.WithBoolean("dryRun",
+			mcp.Description("Return the modified content without writing the file"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// 创建一个工具，用于把对象合并到JSON/YAML/TOML文件中
+func StructuredMergeTool() mcp.Tool {
+	return mcp.NewTool("structured_merge",
+		mcp.WithDescription("Merge a JSON object into a JSON, YAML or TOML file at path using JSON Merge Patch (RFC 7386) rules: objects are merged recursively, other values are replaced and null removes a key. The result is validated before the file is written"),
+		mcp.WithString("file",
+			mcp.Required(),
+			mcp.Description("The JSON, YAML or TOML file to modify"),
+		),
+		mcp.WithString("path",
+			mcp.Description(structuredPathDescription),
+		),
+		mcp.WithString("value",
+			mcp.Required(),
+			mcp.Description("The merge patch as JSON, e.g. {\"server\": {\"port\": 8080, \"debug\": null}}"),
+		),
+		mcp.WithString("format",
+			mcp.Description("File format, detected from the extension if omitted"),
+			mcp.Enum(filesys.FormatJSON, filesys.FormatYAML, filesys.FormatTOML),
+		),
+		mcp.WithBoolean("dryRun",
+			mcp.Description("Return the modified content without writing the file"),
+			mcp.DefaultBool(false),
+		),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func StructuredGetToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		file, _ := request.Params.Arguments["file"].(string)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
+		}
+		value, err := filesys.GetStructuredValue(absFile, mcp.ParseString(request, "format", ""), mcp.ParseString(request, "path", ""))
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(value)
+	}
+}
+
+func StructuredSetToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return structuredEditHandle(filesys.StructuredSet)
+}
+
+func StructuredDeleteToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return structuredEditHandle(filesys.StructuredDelete)
+}
+
+func StructuredMergeToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return structuredEditHandle(filesys.StructuredMerge)
+}
+
+func structuredEditHandle(op string) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		file, _ := request.Params.Arguments["file"].(string)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
+		}
+		value, err := structuredValueArgument(request)
+		if err != nil {
+			return nil, err
+		}
+		result, err := filesys.EditStructuredFile(absFile,
+			mcp.ParseString(request, "format", ""),
+			op,
+			mcp.ParseString(request, "path", ""),
+			value,
+			mcp.ParseBoolean(request, "dryRun", false),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return jsonResult(result)
+	}
+}
+
+// value参数是JSON文本，客户端直接传入对象或数字时也接受
+func structuredValueArgument(request mcp.CallToolRequest) (string, error) {
+	switch v := request.Params.Arguments["value"].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid value: %w", err)
+		}
+		return string(data), nil
+	}
+}
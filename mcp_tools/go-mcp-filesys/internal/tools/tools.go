@@ -2,18 +2,40 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"go-mcp-filesys/internal/filesys"
 
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
+// 创建一个工具，用于列出允许访问的根目录
+func ListAllowedRootsTool() mcp.Tool {
+	return mcp.NewTool("list_allowed_roots",
+		mcp.WithDescription("List the root directories this server can access, with their names and read-only/read-write mode. Paths in other tools are written as root:relative/path; paths without a root prefix use the first (default) root"),
+	)
+}
+
+// --------------------------handle tools--------------------------------
+func ListAllowedRootsToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		jsonResponse, err := json.Marshal(filesys.ListRoots())
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		return mcp.NewToolResultText(string(jsonResponse)), nil
+	}
+}
+
 // 创建一个工具，用于列出目录中的文件
 func ListFilesInDirectoryTool() mcp.Tool {
 	return mcp.NewTool("list_files_in_directory",
-		mcp.WithDescription("List all files in the directory"),
+		mcp.WithDescription("List the entries of a directory as JSON. Each entry has name, path relative to the directory, type (file, directory, symlink or other), size, mod_time, mode and depth. Supports filtering, sorting and cursor-based pagination: when the result contains next_cursor, repeat the request with the same arguments and that cursor to get the next page"),
 		mcp.WithString("directory",
 			mcp.Description("The directory to list files from"),
 			mcp.DefaultString("."),
@@ -22,6 +44,54 @@ func ListFilesInDirectoryTool() mcp.Tool {
 			mcp.Description("Include subdirectories"),
 			mcp.DefaultBool(true),
 		),
+		mcp.WithNumber("maxDepth",
+			mcp.Description("Maximum depth to descend, entries directly in the directory have depth 1; 0 means unlimited"),
+			mcp.DefaultNumber(0),
+		),
+		mcp.WithBoolean("respectGitignore",
+			mcp.Description("Skip files ignored by .gitignore/.ignore files, as well as .git and node_modules directories"),
+			mcp.DefaultBool(true),
+		),
+		mcp.WithArray("types",
+			mcp.Description("Only return entries of these types"),
+			mcp.Items(map[string]any{
+				"type": "string",
+				"enum": []string{filesys.EntryFile, filesys.EntryDirectory, filesys.EntrySymlink, filesys.EntryOther},
+			}),
+		),
+		mcp.WithArray("extensions",
+			mcp.Description("Only return files with these extensions, e.g. [\".go\", \".md\"]"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithNumber("minSize",
+			mcp.Description("Only return files of at least this many bytes"),
+		),
+		mcp.WithNumber("maxSize",
+			mcp.Description("Only return files of at most this many bytes"),
+		),
+		mcp.WithString("modifiedAfter",
+			mcp.Description("Only return entries modified after this time, as RFC 3339 (2006-01-02T15:04:05Z), a date (2006-01-02) or a duration ago (24h)"),
+		),
+		mcp.WithString("modifiedBefore",
+			mcp.Description("Only return entries modified before this time, in the same formats as modifiedAfter"),
+		),
+		mcp.WithString("sortBy",
+			mcp.Description("Field to sort by. Sorting by path lists the tree incrementally; the other fields read the whole tree for every page"),
+			mcp.Enum(filesys.ListSortPath, filesys.ListSortName, filesys.ListSortSize, filesys.ListSortModTime, filesys.ListSortType),
+			mcp.DefaultString(filesys.ListSortPath),
+		),
+		mcp.WithString("order",
+			mcp.Description("Sort order"),
+			mcp.Enum("asc", "desc"),
+			mcp.DefaultString("asc"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum number of entries to return, at most %d", filesys.MaxListLimit)),
+			mcp.DefaultNumber(filesys.DefaultListLimit),
+		),
+		mcp.WithString("cursor",
+			mcp.Description("The next_cursor returned by the previous page"),
+		),
 	)
 }
 
@@ -29,27 +99,94 @@ func ListFilesInDirectoryTool() mcp.Tool {
 func ListFilesInDirectoryHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		directory, _ := request.Params.Arguments["directory"].(string)
-		includeSubdirectories, _ := request.Params.Arguments["includeSubdirectories"].(bool)
-		absDirectory := filesys.GetAbsPathWithAllowedOpsFolder(directory)
-		if absDirectory == "" {
-			return nil, fmt.Errorf("%s directory is not allowed", directory)
+		absDirectory, err := filesys.ResolveExistingPath(directory)
+		if err != nil {
+			return nil, fmt.Errorf("%s directory is not allowed: %w", directory, err)
+		}
+		opts := filesys.ListOptions{
+			MaxDepth:      mcp.ParseInt(request, "maxDepth", 0),
+			RespectIgnore: mcp.ParseBoolean(request, "respectGitignore", true),
+			Types:         parseStringList(request, "types"),
+			Extensions:    parseStringList(request, "extensions"),
+			SortBy:        mcp.ParseString(request, "sortBy", filesys.ListSortPath),
+			Limit:         mcp.ParseInt(request, "limit", filesys.DefaultListLimit),
+			Cursor:        mcp.ParseString(request, "cursor", ""),
+		}
+		if !mcp.ParseBoolean(request, "includeSubdirectories", true) {
+			opts.MaxDepth = 1
+		}
+		switch order := mcp.ParseString(request, "order", "asc"); order {
+		case "asc":
+		case "desc":
+			opts.Descending = true
+		default:
+			return nil, fmt.Errorf("unsupported order: %s", order)
+		}
+		if _, ok := request.Params.Arguments["minSize"]; ok {
+			minSize := mcp.ParseInt64(request, "minSize", 0)
+			opts.MinSize = &minSize
+		}
+		if _, ok := request.Params.Arguments["maxSize"]; ok {
+			maxSize := mcp.ParseInt64(request, "maxSize", 0)
+			opts.MaxSize = &maxSize
+		}
+		if opts.ModifiedAfter, err = parseTimeArgument(request, "modifiedAfter"); err != nil {
+			return nil, err
+		}
+		if opts.ModifiedBefore, err = parseTimeArgument(request, "modifiedBefore"); err != nil {
+			return nil, err
 		}
-		files, err := filesys.ListFilesInDirectory(absDirectory, includeSubdirectories)
+
+		result, err := filesys.ListDirectory(absDirectory, opts)
 		if err != nil {
 			return nil, err
 		}
-		return mcp.NewToolResultText(strings.Join(files, "\n")), nil
+		jsonResponse, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		return mcp.NewToolResultText(string(jsonResponse)), nil
+	}
+}
+
+// 解析时间参数，接受RFC 3339时间、日期或表示多久之前的时长
+func parseTimeArgument(request mcp.CallToolRequest, key string) (time.Time, error) {
+	value := strings.TrimSpace(mcp.ParseString(request, key, ""))
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
 	}
+	return time.Time{}, fmt.Errorf("invalid %s: %q, expected RFC 3339 time, a date or a duration such as 24h", key, value)
 }
 
 // 创建一个工具，用于读取文件内容
 func ReadFileTool() mcp.Tool {
 	return mcp.NewTool("read_file",
-		mcp.WithDescription("Read the content of a file"),
+		mcp.WithDescription("Read the content of a file. Supports reading a line range or a byte range so large files can be paged through; the result includes the total line count, file size, where to continue reading, the file version to pass as expected_version when writing, and the detected encoding, BOM and line ending. A line longer than the read limit is returned cut off, with next_offset to read the rest as a byte range. UTF-16 and GBK files are returned transcoded to UTF-8 and written back in their original format"),
 		mcp.WithString("file",
 			mcp.Description("The file to read"),
 			mcp.DefaultString("."),
 		),
+		mcp.WithNumber("startLine",
+			mcp.Description("First line to read, starting from 1"),
+		),
+		mcp.WithNumber("endLine",
+			mcp.Description("Last line to read (inclusive), reads to the end of the file if omitted"),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Byte offset to start reading from, cannot be combined with a line range"),
+		),
+		mcp.WithNumber("length",
+			mcp.Description("Number of bytes to read, at most 262144 bytes are returned per call"),
+		),
 	)
 }
 
@@ -57,18 +194,40 @@ func ReadFileTool() mcp.Tool {
 func ReadFileToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		file, _ := request.Params.Arguments["file"].(string)
-		absFile := filesys.GetAbsPathWithAllowedOpsFolder(file)
-		if absFile == "" {
-			return nil, fmt.Errorf("%s file is not allowed", file)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
 		}
-		content, err := filesys.ReadFile(absFile)
+		opts := filesys.ReadFileOptions{
+			StartLine: mcp.ParseInt(request, "startLine", 0),
+			EndLine:   mcp.ParseInt(request, "endLine", 0),
+			Offset:    mcp.ParseInt64(request, "offset", 0),
+			Length:    mcp.ParseInt64(request, "length", 0),
+		}
+		result, err := filesys.ReadFile(absFile, opts)
 		if err != nil {
 			return nil, err
 		}
-		return mcp.NewToolResultText(content), nil
+		jsonResponse, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		return mcp.NewToolResultText(string(jsonResponse)), nil
 	}
 }
 
+const expectedVersionDescription = "Version of the file as returned by read_file or a previous write; the write is rejected if the file has changed since"
+
+const (
+	encodingDescription   = "Encoding to write the file in: utf-8, utf-8-bom, utf-16le, utf-16be (written with a BOM) or gbk. Defaults to the file's current encoding and BOM as reported by read_file"
+	lineEndingDescription = "Line ending to write: lf or crlf. Defaults to the file's current line ending style as reported by read_file; line endings in the content are converted"
+)
+
+// 解析写入工具的编码和换行参数
+func parseTextOptions(request mcp.CallToolRequest) (filesys.TextOptions, error) {
+	return filesys.ParseTextOptions(mcp.ParseString(request, "encoding", ""), mcp.ParseString(request, "line_ending", ""))
+}
+
 // 创建一个工具，用于写入文件内容
 func WriteFileTool() mcp.Tool {
 	return mcp.NewTool("write_file",
@@ -80,6 +239,15 @@ func WriteFileTool() mcp.Tool {
 		mcp.WithString("content",
 			mcp.Description("The content to write to the file"),
 		),
+		mcp.WithString("expected_version",
+			mcp.Description(expectedVersionDescription),
+		),
+		mcp.WithString("encoding",
+			mcp.Description(encodingDescription),
+		),
+		mcp.WithString("line_ending",
+			mcp.Description(lineEndingDescription),
+		),
 	)
 }
 
@@ -88,15 +256,19 @@ func WriteFileToolHandle() func(ctx context.Context, request mcp.CallToolRequest
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		file, _ := request.Params.Arguments["file"].(string)
 		content, _ := request.Params.Arguments["content"].(string)
-		absFile := filesys.GetAbsPathWithAllowedOpsFolder(file)
-		if absFile == "" {
-			return nil, fmt.Errorf("%s file is not allowed", file)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
+		}
+		text, err := parseTextOptions(request)
+		if err != nil {
+			return nil, err
 		}
-		err := filesys.WriteFile(absFile, content)
+		version, err := filesys.WriteFile(absFile, content, mcp.ParseString(request, "expected_version", ""), text)
 		if err != nil {
 			return nil, err
 		}
-		return mcp.NewToolResultText("write file success"), nil
+		return mcp.NewToolResultText(fmt.Sprintf("write file success, version: %s", version)), nil
 	}
 }
 
@@ -113,11 +285,11 @@ func DeleteFileTool() mcp.Tool {
 func DeleteFileToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		file, _ := request.Params.Arguments["file"].(string)
-		absFile := filesys.GetAbsPathWithAllowedOpsFolder(file)
-		if absFile == "" {
-			return nil, fmt.Errorf("%s file is not allowed", file)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
 		}
-		err := filesys.DeleteFile(absFile)
+		err = filesys.DeleteFile(absFile)
 		if err != nil {
 			return nil, err
 		}
@@ -128,13 +300,19 @@ func DeleteFileToolHandle() func(ctx context.Context, request mcp.CallToolReques
 // 创建一个工具，用于移动文件
 func MoveFileTool() mcp.Tool {
 	return mcp.NewTool("move_file",
-		mcp.WithDescription("Move a file"),
+		mcp.WithDescription("Move or rename a file. Missing parent directories of the destination are created; across filesystems the file is copied, verified and then removed, keeping its mode and modification time"),
 		mcp.WithString("file",
 			mcp.Description("The file to move"),
 			mcp.DefaultString("."),
 		),
 		mcp.WithString("destination",
-			mcp.Description("The destination to move the file to"),
+			mcp.Required(),
+			mcp.Description("The new path of the file"),
+		),
+		mcp.WithString("onConflict",
+			mcp.Description("What to do when the destination exists: error or overwrite"),
+			mcp.Enum(filesys.ConflictError, filesys.ConflictOverwrite),
+			mcp.DefaultString(filesys.ConflictError),
 		),
 	)
 }
@@ -142,19 +320,21 @@ func MoveFileToolHandle() func(ctx context.Context, request mcp.CallToolRequest)
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		file, _ := request.Params.Arguments["file"].(string)
 		destination, _ := request.Params.Arguments["destination"].(string)
-		absFile := filesys.GetAbsPathWithAllowedOpsFolder(file)
-		absDestination := filesys.GetAbsPathWithAllowedOpsFolder(destination)
-		if absFile == "" {
-			return nil, fmt.Errorf("%s file is not allowed", file)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
 		}
-		if absDestination == "" {
-			return nil, fmt.Errorf("%s destination is not allowed", destination)
+		absDestination, err := filesys.ResolvePath(destination)
+		if err != nil {
+			return nil, fmt.Errorf("%s destination is not allowed: %w", destination, err)
 		}
-		err := filesys.MoveFile(absFile, absDestination)
+		result, err := filesys.MoveFile(absFile, absDestination, filesys.MoveOptions{
+			Conflict: mcp.ParseString(request, "onConflict", filesys.ConflictError),
+		})
 		if err != nil {
 			return nil, err
 		}
-		return mcp.NewToolResultText("move file success"), nil
+		return jsonResult(result)
 	}
 }
 
@@ -175,15 +355,15 @@ func CopyFileToolHandle() func(ctx context.Context, request mcp.CallToolRequest)
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		file, _ := request.Params.Arguments["file"].(string)
 		destination, _ := request.Params.Arguments["destination"].(string)
-		absFile := filesys.GetAbsPathWithAllowedOpsFolder(file)
-		absDestination := filesys.GetAbsPathWithAllowedOpsFolder(destination)
-		if absFile == "" {
-			return nil, fmt.Errorf("%s file is not allowed", file)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
 		}
-		if absDestination == "" {
-			return nil, fmt.Errorf("%s destination is not allowed", destination)
+		absDestination, err := filesys.ResolvePath(destination)
+		if err != nil {
+			return nil, fmt.Errorf("%s destination is not allowed: %w", destination, err)
 		}
-		err := filesys.CopyFile(absFile, absDestination)
+		err = filesys.CopyFile(absFile, absDestination)
 		if err != nil {
 			return nil, err
 		}
@@ -208,11 +388,11 @@ func ChangeFilePermissionsToolHandle() func(ctx context.Context, request mcp.Cal
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		file, _ := request.Params.Arguments["file"].(string)
 		permissions, _ := request.Params.Arguments["permissions"].(string)
-		absFile := filesys.GetAbsPathWithAllowedOpsFolder(file)
-		if absFile == "" {
-			return nil, fmt.Errorf("%s file is not allowed", file)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
 		}
-		err := filesys.ChangeFilePermissions(absFile, permissions)
+		err = filesys.ChangeFilePermissions(absFile, permissions)
 		if err != nil {
 			return nil, err
 		}
@@ -233,16 +413,18 @@ func CreateDirectoryTool() mcp.Tool {
 func CreateDirectoryToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		directory, _ := request.Params.Arguments["directory"].(string)
+		newDirectory, err := filesys.ResolvePath(directory)
+		if err != nil {
+			return nil, fmt.Errorf("%s directory is not allowed: %w", directory, err)
+		}
 		//检查文件名是否合法
-		if !filesys.IsValidFileName(directory) {
+		if !filesys.IsValidFileName(filepath.Base(newDirectory)) {
 			return nil, fmt.Errorf("%s directory name is not allowed", directory)
 		}
-		absDirectory := filesys.GetAbsPathWithAllowedOpsFolder(directory)
-		if absDirectory != "" {
+		if _, err := os.Stat(newDirectory); err == nil {
 			return nil, fmt.Errorf("%s directory already exists", directory)
 		}
-		newDirectory := fmt.Sprintf("%s/%s", filesys.ALLOWED_OPS_FOLDER, directory)
-		err := filesys.CreateDirectory(newDirectory)
+		err = filesys.CreateDirectory(newDirectory)
 		if err != nil {
 			return nil, err
 		}
@@ -263,11 +445,11 @@ func DeleteDirectoryTool() mcp.Tool {
 func DeleteDirectoryToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		directory, _ := request.Params.Arguments["directory"].(string)
-		absDirectory := filesys.GetAbsPathWithAllowedOpsFolder(directory)
-		if absDirectory == "" {
-			return nil, fmt.Errorf("%s directory is not allowed", directory)
+		absDirectory, err := filesys.ResolveExistingPath(directory)
+		if err != nil {
+			return nil, fmt.Errorf("%s directory is not allowed: %w", directory, err)
 		}
-		err := filesys.DeleteDirectory(absDirectory)
+		err = filesys.DeleteDirectory(absDirectory)
 		if err != nil {
 			return nil, err
 		}
@@ -278,13 +460,19 @@ func DeleteDirectoryToolHandle() func(ctx context.Context, request mcp.CallToolR
 // 创建一个工具，用于移动目录
 func MoveDirectoryTool() mcp.Tool {
 	return mcp.NewTool("move_directory",
-		mcp.WithDescription("Move a directory"),
+		mcp.WithDescription("Move or rename a directory. Missing parent directories of the destination are created; across filesystems the tree is copied, verified and then removed, keeping modes and modification times. If anything fails the move is rolled back"),
 		mcp.WithString("directory",
 			mcp.Description("The directory to move"),
 			mcp.DefaultString("."),
 		),
 		mcp.WithString("destination",
-			mcp.Description("The destination to move the directory to"),
+			mcp.Required(),
+			mcp.Description("The new path of the directory"),
+		),
+		mcp.WithString("onConflict",
+			mcp.Description("What to do when the destination exists: error, overwrite (replace it) or merge (move the contents into it, replacing files with the same name)"),
+			mcp.Enum(filesys.ConflictError, filesys.ConflictOverwrite, filesys.ConflictMerge),
+			mcp.DefaultString(filesys.ConflictError),
 		),
 	)
 }
@@ -292,19 +480,21 @@ func MoveDirectoryToolHandle() func(ctx context.Context, request mcp.CallToolReq
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		directory, _ := request.Params.Arguments["directory"].(string)
 		destination, _ := request.Params.Arguments["destination"].(string)
-		absDirectory := filesys.GetAbsPathWithAllowedOpsFolder(directory)
-		absDestination := filesys.GetAbsPathWithAllowedOpsFolder(destination)
-		if absDirectory == "" {
-			return nil, fmt.Errorf("%s directory is not allowed", directory)
+		absDirectory, err := filesys.ResolveExistingPath(directory)
+		if err != nil {
+			return nil, fmt.Errorf("%s directory is not allowed: %w", directory, err)
 		}
-		if absDestination == "" {
-			return nil, fmt.Errorf("%s destination is not allowed", destination)
+		absDestination, err := filesys.ResolvePath(destination)
+		if err != nil {
+			return nil, fmt.Errorf("%s destination is not allowed: %w", destination, err)
 		}
-		err := filesys.MoveDirectory(absDirectory, absDestination)
+		result, err := filesys.MoveDirectory(absDirectory, absDestination, filesys.MoveOptions{
+			Conflict: mcp.ParseString(request, "onConflict", filesys.ConflictError),
+		})
 		if err != nil {
 			return nil, err
 		}
-		return mcp.NewToolResultText("move directory success"), nil
+		return jsonResult(result)
 	}
 }
 
@@ -325,18 +515,16 @@ func CopyDirectoryToolHandle() func(ctx context.Context, request mcp.CallToolReq
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		directory, _ := request.Params.Arguments["directory"].(string)
 		destination, _ := request.Params.Arguments["destination"].(string)
-		absDirectory := filesys.GetAbsPathWithAllowedOpsFolder(directory)
-		absDestination := filesys.GetAbsPathWithAllowedOpsFolder(destination)
-		if absDirectory == "" {
-			return nil, fmt.Errorf("%s directory is not allowed", directory)
+		absDirectory, err := filesys.ResolveExistingPath(directory)
+		if err != nil {
+			return nil, fmt.Errorf("%s directory is not allowed: %w", directory, err)
 		}
-		if absDestination == "" {
-			// 如果目标目录不存在，则创建目标目录
-			newfolder := fmt.Sprintf("%s/%s", filesys.ALLOWED_OPS_FOLDER, destination)
-			filesys.CreateDirectory(newfolder)
-			absDestination = newfolder
+		// 目标目录不存在时由CopyDirectory创建
+		absDestination, err := filesys.ResolvePath(destination)
+		if err != nil {
+			return nil, fmt.Errorf("%s destination is not allowed: %w", destination, err)
 		}
-		err := filesys.CopyDirectory(absDirectory, absDestination)
+		err = filesys.CopyDirectory(absDirectory, absDestination)
 		if err != nil {
 			return nil, err
 		}
@@ -347,21 +535,26 @@ func CopyDirectoryToolHandle() func(ctx context.Context, request mcp.CallToolReq
 // 创建一个工具，用于统计目录中的文件数量和大小
 func CountFilesInDirectoryTool() mcp.Tool {
 	return mcp.NewTool("count_files_in_directory",
-		mcp.WithDescription("Count the number of files and their total size in a directory"),
+		mcp.WithDescription("Count the number of files and their total size in a directory, including all subdirectories"),
 		mcp.WithString("directory",
 			mcp.Description("The directory to count the files in"),
 			mcp.DefaultString("."),
 		),
+		mcp.WithBoolean("respectGitignore",
+			mcp.Description("Skip files ignored by .gitignore/.ignore files, as well as .git and node_modules directories"),
+			mcp.DefaultBool(true),
+		),
 	)
 }
 func CountFilesInDirectoryToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		directory, _ := request.Params.Arguments["directory"].(string)
-		absDirectory := filesys.GetAbsPathWithAllowedOpsFolder(directory)
-		if absDirectory == "" {
-			return nil, fmt.Errorf("%s directory is not allowed", directory)
+		absDirectory, err := filesys.ResolveExistingPath(directory)
+		if err != nil {
+			return nil, fmt.Errorf("%s directory is not allowed: %w", directory, err)
 		}
-		num, size, err := filesys.CountFilesInDirectory(absDirectory)
+		respectGitignore := mcp.ParseBoolean(request, "respectGitignore", true)
+		num, size, err := filesys.CountFilesInDirectory(absDirectory, respectGitignore)
 		if err != nil {
 			return nil, err
 		}
@@ -369,16 +562,87 @@ func CountFilesInDirectoryToolHandle() func(ctx context.Context, request mcp.Cal
 	}
 }
 
+// 创建一个工具，用于生成目录的磁盘占用报告
+func DiskUsageTool() mcp.Tool {
+	return mcp.NewTool("disk_usage",
+		mcp.WithDescription("Report disk usage of a directory recursively: total files, directories and bytes, a breakdown per immediate subdirectory, the largest files, counts and sizes by extension, and the oldest and newest files by modification time"),
+		mcp.WithString("directory",
+			mcp.Description("The directory to analyze"),
+			mcp.DefaultString("."),
+		),
+		mcp.WithNumber("topFiles",
+			mcp.Description("Number of largest files to return"),
+			mcp.DefaultNumber(filesys.DefaultUsageTopFiles),
+		),
+		mcp.WithBoolean("respectGitignore",
+			mcp.Description("Skip files ignored by .gitignore/.ignore files, as well as .git and node_modules directories"),
+			mcp.DefaultBool(true),
+		),
+	)
+}
+func DiskUsageToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		directory, _ := request.Params.Arguments["directory"].(string)
+		absDirectory, err := filesys.ResolveExistingPath(directory)
+		if err != nil {
+			return nil, fmt.Errorf("%s directory is not allowed: %w", directory, err)
+		}
+		report, err := filesys.DiskUsage(absDirectory, filesys.UsageOptions{
+			RespectIgnore: mcp.ParseBoolean(request, "respectGitignore", true),
+			TopFiles:      mcp.ParseInt(request, "topFiles", filesys.DefaultUsageTopFiles),
+		})
+		if err != nil {
+			return nil, err
+		}
+		jsonResponse, err := json.Marshal(report)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize response: %w", err)
+		}
+		return mcp.NewToolResultText(string(jsonResponse)), nil
+	}
+}
+
 // 创建一个工具，用于查找文件，文件内容查找，并返回文件路径
 func FindFileTool() mcp.Tool {
 	return mcp.NewTool("find_file",
-		mcp.WithDescription("Find a file, file content search, and return the file path"),
+		mcp.WithDescription("Find files by name, or search file contents like grep. Content matches are returned as path:line:column: text, with optional surrounding context lines"),
 		mcp.WithString("file",
-			mcp.Description("The file to find"),
-			mcp.DefaultString("."),
+			mcp.Description("The file name to find: a substring, a glob such as *.go, or a regular expression when regex is true"),
 		),
 		mcp.WithString("content",
-			mcp.Description("The content to find in the file"),
+			mcp.Description("The content to find in the files: a plain string, or a regular expression when regex is true"),
+		),
+		mcp.WithString("directory",
+			mcp.Description("The directory to search in"),
+			mcp.DefaultString("."),
+		),
+		mcp.WithBoolean("regex",
+			mcp.Description("Treat file/content as a regular expression (Go RE2 syntax)"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithBoolean("ignoreCase",
+			mcp.Description("Case-insensitive matching"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithArray("include",
+			mcp.Description("Glob patterns of files to search, e.g. *.go or src/**/*.ts"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithArray("exclude",
+			mcp.Description("Glob patterns of files or directories to skip, e.g. vendor or **/*.min.js"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithNumber("maxResults",
+			mcp.Description("Maximum number of results to return"),
+			mcp.DefaultNumber(filesys.DefaultMaxSearchResults),
+		),
+		mcp.WithNumber("contextLines",
+			mcp.Description("Number of lines of context to show before and after each content match"),
+			mcp.DefaultNumber(0),
+		),
+		mcp.WithBoolean("respectGitignore",
+			mcp.Description("Skip files ignored by .gitignore/.ignore files, as well as .git and node_modules directories"),
+			mcp.DefaultBool(true),
 		),
 	)
 }
@@ -386,28 +650,107 @@ func FindFileTool() mcp.Tool {
 // --------------------------handle tools--------------------------------
 func FindFileToolHandle() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		directory := filesys.GetAbsPathWithAllowedOpsFolder("")
+		dir, _ := request.Params.Arguments["directory"].(string)
+		directory, err := filesys.ResolveExistingPath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s directory is not allowed: %w", dir, err)
+		}
 		content, _ := request.Params.Arguments["content"].(string)
 		filename, _ := request.Params.Arguments["file"].(string)
+		opts := filesys.SearchOptions{
+			Regex:         mcp.ParseBoolean(request, "regex", false),
+			IgnoreCase:    mcp.ParseBoolean(request, "ignoreCase", false),
+			Include:       parseStringList(request, "include"),
+			Exclude:       parseStringList(request, "exclude"),
+			MaxResults:    mcp.ParseInt(request, "maxResults", filesys.DefaultMaxSearchResults),
+			ContextLines:  mcp.ParseInt(request, "contextLines", 0),
+			RespectIgnore: mcp.ParseBoolean(request, "respectGitignore", true),
+		}
 		if len(filename) > 0 {
 			// search file in directory
-			files, err := filesys.SearchFile(directory, filename)
+			opts.Pattern = filename
+			files, truncated, err := filesys.SearchFile(directory, opts)
 			if err != nil {
 				return nil, err
 			}
-			return mcp.NewToolResultText(strings.Join(files, "\n")), nil
+			text := strings.Join(files, "\n")
+			if truncated {
+				text += fmt.Sprintf("\n(results truncated at %d files)", len(files))
+			}
+			return mcp.NewToolResultText(text), nil
 		}
 		if len(content) > 0 {
-			filepaths, err := filesys.SearchFileContent(directory, content)
+			opts.Pattern = content
+			result, err := filesys.SearchFileContent(directory, opts)
 			if err != nil {
 				return nil, err
 			}
-			return mcp.NewToolResultText(strings.Join(filepaths, "\n")), nil
+			return mcp.NewToolResultText(formatSearchResult(result)), nil
 		}
 		return nil, fmt.Errorf("no file or content provided")
 	}
 }
 
+// 将内容搜索结果格式化为grep风格的文本
+func formatSearchResult(result *filesys.SearchResult) string {
+	var sb strings.Builder
+	for i, m := range result.Matches {
+		hasContext := len(m.Before) > 0 || len(m.After) > 0
+		if hasContext && i > 0 {
+			sb.WriteString("--\n")
+		}
+		for j, line := range m.Before {
+			fmt.Fprintf(&sb, "%s-%d- %s\n", m.Path, m.Line-len(m.Before)+j, line)
+		}
+		fmt.Fprintf(&sb, "%s:%d:%d: %s\n", m.Path, m.Line, m.Column, m.Text)
+		for j, line := range m.After {
+			fmt.Fprintf(&sb, "%s-%d- %s\n", m.Path, m.Line+j+1, line)
+		}
+	}
+	fmt.Fprintf(&sb, "(%d matches in %d files, %d files scanned, %d binary files skipped",
+		len(result.Matches), result.FilesMatched, result.FilesScanned, result.SkippedBinary)
+	if result.Truncated {
+		sb.WriteString(", results truncated")
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// 把结果序列化为JSON文本
+func jsonResult(result any) (*mcp.CallToolResult, error) {
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize response: %w", err)
+	}
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
+
+// 读取字符串数组参数，也接受逗号分隔的字符串
+func parseStringList(request mcp.CallToolRequest, key string) []string {
+	result := make([]string, 0)
+	switch v := request.Params.Arguments[key].(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+				result = append(result, strings.TrimSpace(s))
+			}
+		}
+	case []string:
+		for _, s := range v {
+			if strings.TrimSpace(s) != "" {
+				result = append(result, strings.TrimSpace(s))
+			}
+		}
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if strings.TrimSpace(s) != "" {
+				result = append(result, strings.TrimSpace(s))
+			}
+		}
+	}
+	return result
+}
+
 // 创建一个工具，用于替换文件内容
 func ReplaceFileContentTool() mcp.Tool {
 	return mcp.NewTool("replace_file_content",
@@ -419,6 +762,15 @@ func ReplaceFileContentTool() mcp.Tool {
 		mcp.WithString("content",
 			mcp.Description("The content to replace the content of the file with"),
 		),
+		mcp.WithString("expected_version",
+			mcp.Description(expectedVersionDescription),
+		),
+		mcp.WithString("encoding",
+			mcp.Description(encodingDescription),
+		),
+		mcp.WithString("line_ending",
+			mcp.Description(lineEndingDescription),
+		),
 	)
 }
 
@@ -428,15 +780,19 @@ func ReplaceFileContentToolHandle() func(ctx context.Context, request mcp.CallTo
 		file, _ := request.Params.Arguments["file"].(string)
 		content, _ := request.Params.Arguments["content"].(string)
 		newcontent, _ := request.Params.Arguments["newcontent"].(string)
-		absFile := filesys.GetAbsPathWithAllowedOpsFolder(file)
-		if absFile == "" {
-			return nil, fmt.Errorf("%s file is not allowed", file)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
+		}
+		text, err := parseTextOptions(request)
+		if err != nil {
+			return nil, err
 		}
-		err := filesys.ReplaceFileContent(absFile, content, newcontent)
+		version, err := filesys.ReplaceFileContent(absFile, content, newcontent, mcp.ParseString(request, "expected_version", ""), text)
 		if err != nil {
 			return nil, err
 		}
-		return mcp.NewToolResultText("replace file content success"), nil
+		return mcp.NewToolResultText(fmt.Sprintf("replace file content success, version: %s", version)), nil
 	}
 }
 
@@ -451,6 +807,12 @@ func CreateNewFileTool() mcp.Tool {
 		mcp.WithString("content",
 			mcp.Description("The content to write to the file"),
 		),
+		mcp.WithString("encoding",
+			mcp.Description(encodingDescription),
+		),
+		mcp.WithString("line_ending",
+			mcp.Description(lineEndingDescription),
+		),
 	)
 }
 
@@ -459,27 +821,26 @@ func CreateNewFileToolHandle() func(ctx context.Context, request mcp.CallToolReq
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		file, _ := request.Params.Arguments["file"].(string)
 		content, _ := request.Params.Arguments["content"].(string)
+		absFile, err := filesys.ResolvePath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
+		}
 		//检查文件名是否合法
-		splitarr := strings.Split(file, "/")
-		if len(splitarr) > 1 {
-			if !filesys.IsValidFileName(splitarr[len(splitarr)-1]) {
-				return nil, fmt.Errorf("%s file name is not allowed", splitarr[len(splitarr)-1])
-			}
-		} else {
-			if !filesys.IsValidFileName(file) {
-				return nil, fmt.Errorf("%s file name is not allowed", file)
-			}
+		if !filesys.IsValidFileName(filepath.Base(absFile)) {
+			return nil, fmt.Errorf("%s file name is not allowed", filepath.Base(absFile))
 		}
-		absFile := filesys.GetAbsPathWithAllowedOpsFolder(file)
-		if absFile != "" {
+		if _, err := os.Stat(absFile); err == nil {
 			return nil, fmt.Errorf("%s file already exists, please use another name", file)
 		}
-		absFile = fmt.Sprintf("%s/%s", filesys.ALLOWED_OPS_FOLDER, file)
-		err := filesys.CreateNewFile(absFile, content)
+		text, err := parseTextOptions(request)
 		if err != nil {
 			return nil, err
 		}
-		return mcp.NewToolResultText(fmt.Sprintf("create new file success %s", file)), nil
+		version, err := filesys.CreateNewFile(absFile, content, text)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("create new file success %s, version: %s", file, version)), nil
 	}
 }
 
@@ -494,6 +855,15 @@ func AppendFileContentTool() mcp.Tool {
 		mcp.WithString("content",
 			mcp.Description("The content to append to the file"),
 		),
+		mcp.WithString("expected_version",
+			mcp.Description(expectedVersionDescription),
+		),
+		mcp.WithString("encoding",
+			mcp.Description(encodingDescription),
+		),
+		mcp.WithString("line_ending",
+			mcp.Description(lineEndingDescription),
+		),
 	)
 }
 
@@ -502,20 +872,19 @@ func AppendFileContentToolHandle() func(ctx context.Context, request mcp.CallToo
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		file, _ := request.Params.Arguments["file"].(string)
 		content, _ := request.Params.Arguments["content"].(string)
-		absFile := filesys.GetAbsPathWithAllowedOpsFolder(file)
-		// 多层级目录的文件
-		splitarr := strings.Split(file, "/")
-		if len(splitarr) > 1 {
-			absFile = fmt.Sprintf("%s/%s", filesys.ALLOWED_OPS_FOLDER, file)
-		} else {
-			absFile = fmt.Sprintf("%s/%s", filesys.ALLOWED_OPS_FOLDER, file)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
 		}
-
-		err := filesys.AppendFileContent(absFile, content)
+		text, err := parseTextOptions(request)
+		if err != nil {
+			return nil, err
+		}
+		version, err := filesys.AppendFileContent(absFile, content, mcp.ParseString(request, "expected_version", ""), text)
 		if err != nil {
 			return nil, err
 		}
-		return mcp.NewToolResultText("append file content success"), nil
+		return mcp.NewToolResultText(fmt.Sprintf("append file content success, version: %s", version)), nil
 	}
 }
 
@@ -530,6 +899,15 @@ func EditFileTool() mcp.Tool {
 		mcp.WithString("content",
 			mcp.Description("The content to edit the file with"),
 		),
+		mcp.WithString("expected_version",
+			mcp.Description(expectedVersionDescription),
+		),
+		mcp.WithString("encoding",
+			mcp.Description(encodingDescription),
+		),
+		mcp.WithString("line_ending",
+			mcp.Description(lineEndingDescription),
+		),
 	)
 }
 
@@ -538,15 +916,19 @@ func EditFileToolHandle() func(ctx context.Context, request mcp.CallToolRequest)
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		file, _ := request.Params.Arguments["file"].(string)
 		content, _ := request.Params.Arguments["content"].(string)
-		absFile := filesys.GetAbsPathWithAllowedOpsFolder(file)
-		if absFile == "" {
-			return nil, fmt.Errorf("%s file is not allowed", file)
+		absFile, err := filesys.ResolveExistingPath(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s file is not allowed: %w", file, err)
 		}
-		err := filesys.EditFile(absFile, content)
+		text, err := parseTextOptions(request)
 		if err != nil {
 			return nil, err
 		}
-		return mcp.NewToolResultText("edit file success"), nil
+		version, err := filesys.EditFile(absFile, content, mcp.ParseString(request, "expected_version", ""), text)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("edit file success, version: %s", version)), nil
 	}
 }
 
@@ -568,11 +950,11 @@ func ChangeDirectoryPermissionsToolHandle() func(ctx context.Context, request mc
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		directory, _ := request.Params.Arguments["directory"].(string)
 		permissions, _ := request.Params.Arguments["permissions"].(string)
-		absDirectory := filesys.GetAbsPathWithAllowedOpsFolder(directory)
-		if absDirectory == "" {
-			return nil, fmt.Errorf("%s directory is not allowed", directory)
+		absDirectory, err := filesys.ResolveExistingPath(directory)
+		if err != nil {
+			return nil, fmt.Errorf("%s directory is not allowed: %w", directory, err)
 		}
-		err := filesys.ChangeDirectoryPermissions(absDirectory, permissions)
+		err = filesys.ChangeDirectoryPermissions(absDirectory, permissions)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,112 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// API key 的请求头，与 Authorization: Bearer 等价
+const APIKeyHeader = "X-API-Key"
+
+// HTTP传输的访问控制选项
+type SecurityOptions struct {
+	// 允许的bearer token或API key，为空时不要求认证
+	Tokens []string
+	// 允许跨域访问的来源，如 https://app.example.com，"*" 表示任意来源。
+	// 带有Origin头的请求来源不在列表中且主机名不是允许的主机名时被拒绝
+	CORSOrigins []string
+	// 服务器自身的主机名（不含端口），如 base URL 中的主机名，本机回环名称总是允许。
+	// 未配置令牌时Host请求头必须是这些主机名之一，防止DNS重绑定攻击：
+	// 重绑定后浏览器发送的Host和Origin都是攻击者的域名，不能作为可信的依据
+	Hosts []string
+}
+
+// 为HTTP处理器加上CORS和认证检查。预检请求不需要认证
+func Secure(next http.Handler, opts SecurityOptions) http.Handler {
+	tokens := make([][32]byte, 0, len(opts.Tokens))
+	for _, t := range opts.Tokens {
+		if t != "" {
+			tokens = append(tokens, sha256.Sum256([]byte(t)))
+		}
+	}
+	hosts := make(map[string]bool, len(opts.Hosts))
+	for _, h := range opts.Hosts {
+		hosts[strings.ToLower(strings.Trim(h, "[]"))] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(tokens) == 0 && !hostAllowed(r.Host, hosts) {
+			http.Error(w, "host not allowed", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if !originAllowed(origin, hosts, opts.CORSOrigins) {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			h := w.Header()
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Add("Vary", "Origin")
+			h.Set("Access-Control-Expose-Headers", SessionHeader)
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+				h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept, Last-Event-ID, "+SessionHeader+", "+APIKeyHeader)
+				h.Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		if len(tokens) > 0 && !authorized(r, tokens) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp"`)
+			http.Error(w, "unauthorized: send Authorization: Bearer <token> or "+APIKeyHeader+": <key>", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func originAllowed(origin string, hosts map[string]bool, allowed []string) bool {
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(strings.TrimSuffix(a, "/"), origin) {
+			return true
+		}
+	}
+	// 来自服务器自身页面的请求允许，主机名与配置比较而不是与请求的Host比较
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && hostAllowed(u.Host, hosts)
+}
+
+// 检查主机（可以带端口）是否为本机回环名称或配置的主机名
+func hostAllowed(host string, hosts map[string]bool) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if host == "localhost" || hosts[host] {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// 比较令牌的SHA-256，使比较时间与令牌内容无关
+func authorized(r *http.Request, tokens [][32]byte) bool {
+	presented := r.Header.Get(APIKeyHeader)
+	if auth := r.Header.Get("Authorization"); presented == "" && len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		presented = strings.TrimSpace(auth[7:])
+	}
+	if presented == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(presented))
+	ok := false
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare(sum[:], t[:]) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecure(t *testing.T) {
+	withTokens := SecurityOptions{Tokens: []string{"secret"}, CORSOrigins: []string{"https://app.example.com"}}
+	noTokens := SecurityOptions{Hosts: []string{"mcp.example.com"}}
+
+	tests := []struct {
+		name    string
+		opts    SecurityOptions
+		method  string
+		host    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "missing token", opts: withTokens, want: http.StatusUnauthorized},
+		{name: "wrong token", opts: withTokens, headers: map[string]string{"Authorization": "Bearer wrong"}, want: http.StatusUnauthorized},
+		{name: "bearer token", opts: withTokens, headers: map[string]string{"Authorization": "Bearer secret"}, want: http.StatusOK},
+		{name: "lowercase bearer scheme", opts: withTokens, headers: map[string]string{"Authorization": "bearer secret"}, want: http.StatusOK},
+		{name: "api key", opts: withTokens, headers: map[string]string{APIKeyHeader: "secret"}, want: http.StatusOK},
+		{name: "token on foreign host", opts: withTokens, host: "evil.example.com", headers: map[string]string{APIKeyHeader: "secret"}, want: http.StatusOK},
+		{
+			name:    "foreign origin with token",
+			opts:    withTokens,
+			headers: map[string]string{"Origin": "https://evil.example.com", APIKeyHeader: "secret"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "allowed origin",
+			opts:    withTokens,
+			headers: map[string]string{"Origin": "https://app.example.com", APIKeyHeader: "secret"},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "preflight without token",
+			opts:    withTokens,
+			method:  http.MethodOptions,
+			headers: map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST"},
+			want:    http.StatusNoContent,
+		},
+		{name: "loopback host", opts: noTokens, host: "127.0.0.1:8080", want: http.StatusOK},
+		{name: "localhost", opts: noTokens, host: "localhost:8080", want: http.StatusOK},
+		{name: "configured host", opts: noTokens, host: "mcp.example.com", want: http.StatusOK},
+		// DNS重绑定：Host和Origin都是攻击者的域名
+		{
+			name:    "rebound host",
+			opts:    noTokens,
+			host:    "evil.example.com:8080",
+			headers: map[string]string{"Origin": "http://evil.example.com:8080"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "foreign origin on loopback",
+			opts:    noTokens,
+			host:    "127.0.0.1:8080",
+			headers: map[string]string{"Origin": "https://evil.example.com"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "same origin on loopback",
+			opts:    noTokens,
+			host:    "127.0.0.1:8080",
+			headers: map[string]string{"Origin": "http://127.0.0.1:8080"},
+			want:    http.StatusOK,
+		},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, "/mcp", nil)
+			req.Host = "localhost"
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			Secure(next, tt.opts).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 response without WWW-Authenticate header")
+			}
+		})
+	}
+}
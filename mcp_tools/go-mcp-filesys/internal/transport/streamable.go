@@ -0,0 +1,320 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 会话ID的请求和响应头
+const SessionHeader = "Mcp-Session-Id"
+
+// 单个POST请求体的最大字节数，SSE传输的消息端点使用同样的限制
+const MaxMessageBytes = 32 * 1024 * 1024
+
+// 没有打开的事件流且超过该时间没有请求的会话会被清理
+const sessionIdleTimeout = time.Hour
+
+// MCP streamable HTTP 传输：客户端向同一个端点POST JSON-RPC消息，
+// 服务器以JSON返回响应；GET在该端点上打开SSE流接收资源变化等通知；DELETE结束会话。
+// 会话在initialize时创建，之后的请求都需要携带 Mcp-Session-Id 头
+type StreamableServer struct {
+	server *server.MCPServer
+	// 在交给MCP服务器之前改写消息，用于拦截资源订阅请求
+	intercept func(sessionID string, message []byte) []byte
+
+	mu       sync.Mutex
+	sessions map[string]*streamSession
+	closed   bool
+}
+
+type streamSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+	// 打开的GET事件流数量，同一时间只允许一个
+	streams  atomic.Int32
+	lastSeen atomic.Int64
+	done     chan struct{}
+}
+
+func (s *streamSession) SessionID() string { return s.id }
+
+func (s *streamSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *streamSession) Initialize() { s.initialized.Store(true) }
+
+func (s *streamSession) Initialized() bool { return s.initialized.Load() }
+
+// 创建streamable HTTP传输，intercept可以为nil
+func NewStreamableServer(mcpServer *server.MCPServer, intercept func(sessionID string, message []byte) []byte) *StreamableServer {
+	return &StreamableServer{
+		server:    mcpServer,
+		intercept: intercept,
+		sessions:  make(map[string]*streamSession),
+	}
+}
+
+func (s *StreamableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.handlePost(w, r)
+	case http.MethodGet:
+		s.handleGet(w, r)
+	case http.MethodDelete:
+		s.handleDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *StreamableServer) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxMessageBytes+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > MaxMessageBytes {
+		http.Error(w, fmt.Sprintf("request body is larger than %d bytes", MaxMessageBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// 请求体可以是单个消息，也可以是JSON-RPC批量数组
+	body = bytes.TrimSpace(body)
+	batch := len(body) > 0 && body[0] == '['
+	var messages []json.RawMessage
+	if batch {
+		if err := json.Unmarshal(body, &messages); err != nil || len(messages) == 0 {
+			writeJSONRPCError(w, mcp.PARSE_ERROR, "invalid JSON-RPC batch")
+			return
+		}
+	} else {
+		messages = []json.RawMessage{body}
+	}
+
+	var session *streamSession
+	if isInitialize(messages) {
+		if r.Header.Get(SessionHeader) != "" {
+			http.Error(w, "initialize must not carry a session id", http.StatusBadRequest)
+			return
+		}
+		if session, err = s.newSession(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	} else if session = s.lookup(w, r); session == nil {
+		return
+	}
+	session.lastSeen.Store(time.Now().UnixNano())
+
+	ctx := s.server.WithContext(r.Context(), session)
+	responses := make([]mcp.JSONRPCMessage, 0, len(messages))
+	for _, message := range messages {
+		if s.intercept != nil {
+			message = s.intercept(session.id, message)
+		}
+		if response := s.server.HandleMessage(ctx, message); response != nil {
+			responses = append(responses, response)
+		}
+	}
+
+	w.Header().Set(SessionHeader, session.id)
+	if len(responses) == 0 {
+		// 只包含通知或响应的请求没有返回内容
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if batch {
+		json.NewEncoder(w).Encode(responses)
+	} else {
+		json.NewEncoder(w).Encode(responses[0])
+	}
+}
+
+// 打开SSE事件流，把发给该会话的通知推送给客户端
+func (s *StreamableServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		http.Error(w, "GET requires Accept: text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	session := s.lookup(w, r)
+	if session == nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	if !session.streams.CompareAndSwap(0, 1) {
+		http.Error(w, "an event stream is already open for this session", http.StatusConflict)
+		return
+	}
+	defer session.streams.Store(0)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set(SessionHeader, session.id)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case notification := <-session.notifications:
+			data, err := json.Marshal(notification)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			// 注释行，防止代理因空闲关闭连接
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-session.done:
+			return
+		case <-r.Context().Done():
+			session.lastSeen.Store(time.Now().UnixNano())
+			return
+		}
+	}
+}
+
+func (s *StreamableServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	session := s.lookup(w, r)
+	if session == nil {
+		return
+	}
+	s.remove(r.Context(), session)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 按请求头查找会话，找不到时写入错误响应并返回nil
+func (s *StreamableServer) lookup(w http.ResponseWriter, r *http.Request) *streamSession {
+	id := r.Header.Get(SessionHeader)
+	if id == "" {
+		http.Error(w, "missing "+SessionHeader+" header; send initialize first", http.StatusBadRequest)
+		return nil
+	}
+	s.mu.Lock()
+	session := s.sessions[id]
+	s.mu.Unlock()
+	if session == nil {
+		// 按规范返回404，客户端应重新初始化
+		http.Error(w, "unknown or expired session", http.StatusNotFound)
+		return nil
+	}
+	return session
+}
+
+func (s *StreamableServer) newSession(ctx context.Context) (*streamSession, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to create session id: %w", err)
+	}
+	session := &streamSession{
+		id:            hex.EncodeToString(buf),
+		notifications: make(chan mcp.JSONRPCNotification, 100),
+		done:          make(chan struct{}),
+	}
+	session.lastSeen.Store(time.Now().UnixNano())
+
+	s.expireIdle(ctx)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("server is shutting down")
+	}
+	s.sessions[session.id] = session
+	s.mu.Unlock()
+	if err := s.server.RegisterSession(ctx, session); err != nil {
+		s.mu.Lock()
+		delete(s.sessions, session.id)
+		s.mu.Unlock()
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *StreamableServer) remove(ctx context.Context, session *streamSession) {
+	s.mu.Lock()
+	_, ok := s.sessions[session.id]
+	delete(s.sessions, session.id)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	close(session.done)
+	s.server.UnregisterSession(ctx, session.id)
+}
+
+// 清理长时间没有活动的会话，客户端可能没有发送DELETE就退出了
+func (s *StreamableServer) expireIdle(ctx context.Context) {
+	cutoff := time.Now().Add(-sessionIdleTimeout).UnixNano()
+	s.mu.Lock()
+	var idle []*streamSession
+	for _, session := range s.sessions {
+		if session.streams.Load() == 0 && session.lastSeen.Load() < cutoff {
+			idle = append(idle, session)
+		}
+	}
+	s.mu.Unlock()
+	for _, session := range idle {
+		s.remove(ctx, session)
+	}
+}
+
+// 结束所有会话并关闭打开的事件流，之后不再接受新的会话
+func (s *StreamableServer) Shutdown(ctx context.Context) {
+	s.mu.Lock()
+	s.closed = true
+	sessions := make([]*streamSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+	for _, session := range sessions {
+		s.remove(ctx, session)
+	}
+}
+
+// 请求中是否包含initialize请求
+func isInitialize(messages []json.RawMessage) bool {
+	for _, message := range messages {
+		var m struct {
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(message, &m) == nil && m.Method == string(mcp.MethodInitialize) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSONRPCError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{
+		"jsonrpc": mcp.JSONRPC_VERSION,
+		"id":      nil,
+		"error":   map[string]any{"code": code, "message": message},
+	})
+}